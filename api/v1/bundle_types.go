@@ -0,0 +1,47 @@
+package v1
+
+import (
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BundleSpec defines a curated bundle that Installations can reference by name.
+type BundleSpec struct {
+	// Reference to the bundle in an OCI Registry, e.g. getporter/porter-hello:v0.1.1.
+	Reference string `json:"reference"`
+
+	// Approved allows Installations to use the bundle. Installations that
+	// reference a bundle that is not approved are not run.
+	Approved bool `json:"approved,omitempty"`
+
+	// Parameters are the default parameter values for Installations of the
+	// bundle. An Installation's own parameters take precedence.
+	Parameters map[string]apiextensionsv1.JSON `json:"parameters,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Reference",type=string,JSONPath=`.spec.reference`
+// +kubebuilder:printcolumn:name="Approved",type=boolean,JSONPath=`.spec.approved`
+
+// Bundle is the Schema for the bundles API, a catalog of the bundles that
+// Installations can reference with BundleRef.
+type Bundle struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec BundleSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// BundleList contains a list of Bundle
+type BundleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Bundle `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Bundle{}, &BundleList{})
+}
@@ -2,9 +2,103 @@ package v1
 
 import (
 	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// AnnotationPaused pauses the Installation when set to "true".
+	AnnotationPaused = "porter.sh/paused"
+
+	// AnnotationForceDelete removes the Installation without uninstalling the
+	// bundle when set to "true", e.g. when the bundle's resources are already gone.
+	AnnotationForceDelete = "porter.sh/force-delete"
+
+	// AnnotationRerun runs the Installation's action again when its value
+	// changes, even when the spec has not changed, e.g. set it to a timestamp.
+	AnnotationRerun = "porter.sh/rerun"
+
+	// AnnotationRetryFailed runs the Installation's action again only when
+	// the last run failed. The operator removes the annotation once it has
+	// been handled, so that it can be set on many Installations at once.
+	AnnotationRetryFailed = "porter.sh/retry-failed"
+
+	// AnnotationAllowBundleSwap lets the Installation run a different bundle
+	// than the one that is installed, e.g. after the bundle was renamed, when
+	// set to "true".
+	AnnotationAllowBundleSwap = "porter.sh/allow-bundle-swap"
+
+	// AnnotationProgress is set by the porter agent pod, or by the bundle on
+	// its own pod, to report the progress of a run, e.g. "running install step
+	// 3/5". The operator copies the latest value to the Installation's status.
+	AnnotationProgress = "porter.sh/progress"
+
+	// FinalizerUninstall blocks the removal of the Installation until the
+	// bundle is uninstalled.
+	FinalizerUninstall = "porter.sh/uninstall"
+)
+
+const (
+	// ConditionPaused indicates that the operator is not running the Installation.
+	ConditionPaused = "Paused"
+
+	// ConditionFailed indicates that the Installation could not be run.
+	ConditionFailed = "Failed"
+
+	// ConditionNeedsInput indicates that the porter job has been running for
+	// longer than expected, and may be waiting for input that it will never get.
+	ConditionNeedsInput = "NeedsInput"
+
+	// ConditionSchedulingFailed indicates that the porter agent pod cannot be
+	// scheduled, for example because of insufficient resources.
+	ConditionSchedulingFailed = "SchedulingFailed"
+
+	// ConditionDrifted indicates that the bundle's status action found that the
+	// installed resources have drifted from the bundle.
+	ConditionDrifted = "Drifted"
+
+	// ConditionBundleResolved indicates whether the bundle's reference could be
+	// resolved in its registry before the porter job is created.
+	ConditionBundleResolved = "BundleResolved"
+
+	// ConditionPending indicates that the porter job is waiting to be created,
+	// for example until it fits in the namespace's resource budget.
+	ConditionPending = "Pending"
+
+	// ConditionDeletionFailed indicates that the bundle could not be
+	// uninstalled when the Installation was deleted.
+	ConditionDeletionFailed = "DeletionFailed"
+
+	// ConditionReconcileActionFailed indicates whether the last scheduled run
+	// of the Installation's ReconcileAction failed.
+	ConditionReconcileActionFailed = "ReconcileActionFailed"
+
+	// ConditionWaitingForDependencies indicates that the Installation is not
+	// run until the Installations that it depends on have succeeded.
+	ConditionWaitingForDependencies = "WaitingForDependencies"
+
+	// ConditionOutputsTooLarge indicates that some outputs were not
+	// published to the outputs Secret, or some file outputs to the outputs
+	// ConfigMap, because they do not fit in it.
+	ConditionOutputsTooLarge = "OutputsTooLarge"
+)
+
+// InstallationPhase is a summary of the job that ran the Installation's action.
+// +kubebuilder:validation:Enum=Running;Succeeded;Failed
+type InstallationPhase string
+
+const (
+	// PhaseRunning indicates that the porter agent job is running.
+	PhaseRunning InstallationPhase = "Running"
+
+	// PhaseSucceeded indicates that the porter agent job completed.
+	PhaseSucceeded InstallationPhase = "Succeeded"
+
+	// PhaseFailed indicates that the porter agent job failed.
+	PhaseFailed InstallationPhase = "Failed"
+)
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
@@ -14,25 +108,356 @@ type InstallationSpec struct {
 	// Important: Run "make" to regenerate code after modifying this file
 
 	// Reference to the bundle in an OCI Registry, e.g. getporter/porter-hello:v0.1.1.
-	Reference string `json:"reference"`
+	// Either Reference or BundleRef is required.
+	Reference string `json:"reference,omitempty"`
+
+	// BundleRef is the name of an approved Bundle from the catalog to run,
+	// instead of specifying the Reference. The Bundle's default parameters are
+	// used for any parameters that the Installation does not set.
+	BundleRef string `json:"bundleRef,omitempty"`
+
+	// BundleConfigMap is the name of a ConfigMap, in the Installation's
+	// namespace, with a copy of the bundle's definition in the bundle.json key.
+	// When set, the bundle definition is read from the ConfigMap instead of
+	// resolving the Reference, so that the bundle can be validated and run
+	// without pulling it from the registry.
+	BundleConfigMap string `json:"bundleConfigMap,omitempty"`
+
+	// RelocationMapConfigMap is the name of a ConfigMap, in the Installation's
+	// namespace, with a CNAB relocation mapping in the relocation-mapping.json
+	// key. Porter uses the mapping to pull the bundle's images from the
+	// registry that they were relocated to, e.g. a mirror in an air-gapped
+	// cluster. Can not be used with Apply.
+	RelocationMapConfigMap string `json:"relocationMapConfigMap,omitempty"`
+
+	// CABundleConfigMap is the name of a ConfigMap, in the Installation's
+	// namespace, with additional CA certificates that the porter agent should
+	// trust in the ca.crt key, for example a private registry's CA.
+	CABundleConfigMap string `json:"caBundleConfigMap,omitempty"`
 
-	// Action defined in the bundle to execute. If unspecified, Porter will run an
-	// install if the installation does not exist, or an upgrade otherwise.
-	Action string `json:"action"`
+	// Action defined in the bundle to execute. If unspecified, the operator
+	// runs install until the bundle is installed, and upgrade when the
+	// Installation is changed afterwards.
+	// +optional
+	Action string `json:"action,omitempty"`
+
+	// Apply runs porter installation apply with an installation file generated
+	// from the Installation, instead of running the Action. Porter installs the
+	// bundle when the installation does not exist, and upgrades it otherwise.
+	// Requires a porter agent that supports installation apply.
+	// ParameterSetRefs and ParametersFromInstallation can not be used with Apply.
+	Apply bool `json:"apply,omitempty"`
+
+	// ValidateOnly runs porter explain on the bundle instead of the Action,
+	// and records the parameters, credentials and outputs that the bundle
+	// declares in the Installation's status. The bundle is not installed, so
+	// ValidateOnly can not be used with Apply, UninstallOnDelete or
+	// DriftCheckInterval.
+	ValidateOnly bool `json:"validateOnly,omitempty"`
+
+	// PorterConfig selects a porter configuration profile, e.g. prod, so that
+	// Installations in the same namespace can use different porter storage and
+	// secrets backends. The porter agent uses the porter-config-PROFILE and
+	// porter-env-PROFILE secrets instead of porter-config and porter-env, and
+	// does not start until the porter-config-PROFILE secret exists.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	PorterConfig string `json:"porterConfig,omitempty"`
+
+	// PluginConfig configures the porter plugins of the Installation, so that
+	// Installations in the same namespace can use different secrets and
+	// storage backends without a profile for each. The operator renders it
+	// into the config.toml of the porter agent, which is used instead of the
+	// porter-config secret. The plugins' credentials are still read from the
+	// porter-env secret.
+	PluginConfig *PorterPluginConfig `json:"pluginConfig,omitempty"`
+
+	// PorterHome is the porter home directory in the porter agent, passed in
+	// PORTER_HOME, where porter finds its configuration, plugins and mixins.
+	// Must be an absolute path, and either a directory where the agent image
+	// has porter installed, /root/.porter or /app/.porter, or mounted from
+	// PorterHomeVolumeClaimName. When not set, the porterHome from the porter
+	// ConfigMap is used, otherwise the home directory of the agent image.
+	PorterHome string `json:"porterHome,omitempty"`
+
+	// PorterHomeVolumeClaimName is the name of an existing
+	// PersistentVolumeClaim, in the Installation's namespace, that is mounted
+	// at the porter home, e.g. a porter home with plugins and configuration
+	// baked in. Requires a porter home from PorterHome or the porter ConfigMap.
+	PorterHomeVolumeClaimName string `json:"porterHomeVolumeClaimName,omitempty"`
+
+	// PorterNamespace is the porter namespace of the installation, which
+	// isolates installations that share porter's storage, e.g. by environment.
+	// Defaults to the porterNamespace in the porter ConfigMap, or porter's
+	// global namespace.
+	PorterNamespace string `json:"porterNamespace,omitempty"`
 
 	// PorterVersion is the version of the Porter CLI to use when executing the bundle.
+	// A semver range, e.g. ~1.0, uses the highest published version in the range.
 	// Defaults to "latest"
 	PorterVersion string `json:"porterVersion,omitempty"`
 
+	// ImagePullPolicy of the porter agent image. Defaults to Always when
+	// PorterVersion is latest or canary, and IfNotPresent otherwise.
+	// +kubebuilder:validation:Enum=Always;IfNotPresent;Never
+	ImagePullPolicy v1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// InvocationImagePullPolicy of the bundle's invocation image, which
+	// porter's kubernetes driver runs in a separate pod, e.g. Always for a
+	// bundle with a mutable tag. Unlike ImagePullPolicy, it does not apply to
+	// the porter agent image. Defaults to the driver's pull policy.
+	// +kubebuilder:validation:Enum=Always;IfNotPresent;Never
+	InvocationImagePullPolicy v1.PullPolicy `json:"invocationImagePullPolicy,omitempty"`
+
 	ServiceAccount string `json:"serviceAccount,omitempty"`
 
+	// AgentPermissions are the permissions that the bundle needs in the
+	// Installation's namespace. The operator grants them to the porter agent's
+	// service account with a Role and RoleBinding that are removed with the
+	// Installation.
+	AgentPermissions []rbacv1.PolicyRule `json:"agentPermissions,omitempty"`
+
+	// OutputsVolumeStorageClass is the name of the storage class used for the
+	// volume shared between porter and the bundle. Defaults to the cluster's
+	// default storage class.
+	OutputsVolumeStorageClass string `json:"outputsVolumeStorageClass,omitempty"`
+
+	// OutputsVolumeAccessModes are the access modes requested for the volume
+	// shared between porter and the bundle. Defaults to ReadWriteOnce.
+	OutputsVolumeAccessModes []v1.PersistentVolumeAccessMode `json:"outputsVolumeAccessModes,omitempty"`
+
+	// ReuseOutputsVolume uses a single volume, named after the Installation,
+	// for every run instead of creating a new volume for each job.
+	ReuseOutputsVolume bool `json:"reuseOutputsVolume,omitempty"`
+
+	// OutputsVolumeClaimName is the name of an existing PersistentVolumeClaim,
+	// in the Installation's namespace, to use as the volume shared between
+	// porter and the bundle. The claim must be bound before the job is
+	// created. When set, the operator does not create a volume and the other
+	// outputs volume settings are ignored.
+	OutputsVolumeClaimName string `json:"outputsVolumeClaimName,omitempty"`
+
+	// OutputsVolumeFSGroup is the fsGroup of the porter agent pod, so that the
+	// shared volume is owned by the group and a porter agent that runs as a
+	// non-root user can write to it. Defaults to the volume's own permissions.
+	// +kubebuilder:validation:Minimum=0
+	OutputsVolumeFSGroup *int64 `json:"outputsVolumeFSGroup,omitempty"`
+
+	// AllowDockerHostAccess is not supported. The bundle runs in a pod created
+	// by porter's kubernetes driver, which does not give it access to the
+	// node's docker daemon, so Installations that set it are not run.
+	// Defaults to false.
+	AllowDockerHostAccess bool `json:"allowDockerHostAccess,omitempty"`
+
+	// AgentArgs are extra flags appended to the porter command, after the
+	// flags managed by the operator, for porter flags that the Installation
+	// does not have a field for yet. Each flag must be in the --flag=value
+	// form. Flags managed by the operator, such as --driver, are rejected.
+	AgentArgs []string `json:"agentArgs,omitempty"`
+
+	// AgentCommand overrides the entrypoint of the porter agent image, e.g.
+	// for a wrapper image that does extra setup before it runs porter. The
+	// operator still passes the porter arguments, which the command must
+	// forward to porter. Defaults to the image's entrypoint.
+	AgentCommand []string `json:"agentCommand,omitempty"`
+
+	// AgentResources are the compute resources of the porter agent container.
+	// The requests count against the operator's namespaceResourceBudget.
+	// Defaults to no requests or limits.
+	AgentResources v1.ResourceRequirements `json:"agentResources,omitempty"`
+
+	// InitContainers are run in the porter agent pod before porter executes
+	// the bundle. They run sequentially, in the order listed, and each must
+	// complete successfully before the next one starts. Mount the
+	// "porter-shared" volume to stage data for the porter run.
+	InitContainers []v1.Container `json:"initContainers,omitempty"`
+
+	// SecretsStore mounts a volume from the Secrets Store CSI driver in the
+	// porter agent pod, so that credentials are read from an external secret
+	// manager when the pod starts, instead of being copied into Secrets. Use
+	// credential sets with a path source under /porter-secrets-store.
+	SecretsStore *SecretsStoreVolume `json:"secretsStore,omitempty"`
+
+	// TerminationGracePeriodSeconds is how long the porter agent pod is given
+	// to stop after it is asked to terminate, e.g. when it is evicted. Increase
+	// it for bundles that clean up when they are stopped, especially when
+	// uninstalling. Defaults to the Kubernetes default of 30 seconds.
+	// +kubebuilder:validation:Minimum=0
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+
+	// DNSPolicy of the porter agent pod, e.g. None to only use the DNSConfig.
+	// Defaults to the Kubernetes default of ClusterFirst.
+	// +kubebuilder:validation:Enum=ClusterFirstWithHostNet;ClusterFirst;Default;None
+	DNSPolicy v1.DNSPolicy `json:"dnsPolicy,omitempty"`
+
+	// DNSConfig adds nameservers, search domains and resolver options to the
+	// porter agent pod's DNS configuration, e.g. so that porter can resolve the
+	// hostnames of an internal registry.
+	DNSConfig *v1.PodDNSConfig `json:"dnsConfig,omitempty"`
+
+	// HostNetwork runs the porter agent pod in the node's network namespace,
+	// so that porter can reach services that are only exposed on the node.
+	// The DNSPolicy defaults to ClusterFirstWithHostNet when it is set.
+	HostNetwork bool `json:"hostNetwork,omitempty"`
+
+	// PriorityClassName is the name of the PriorityClass of the porter agent
+	// pods, so that install and uninstall jobs are scheduled ahead of, and are
+	// not preempted by, lower priority workloads. When not set, the
+	// priorityClassName from the porter ConfigMap is used.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// TopologySpreadConstraints control how the porter agent pods are spread
+	// across the cluster, for example across zones or nodes. When not set,
+	// the topologySpreadConstraints from the porter ConfigMap are used.
+	TopologySpreadConstraints []v1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+	// NoCleanup keeps the porter agent job, and the invocation image job
+	// that porter runs, after the run completes so that they can be inspected
+	// when debugging the bundle. The jobTTLSecondsAfterFinished setting from
+	// the porter ConfigMap is not applied. Defaults to false.
+	NoCleanup bool `json:"noCleanup,omitempty"`
+
+	// CleanupSubJobs lets porter's kubernetes driver remove the invocation
+	// image job, and the secrets it created for it, when the run finishes.
+	// They are kept by default so that a failed run can be inspected.
+	// Ignored when NoCleanup is set. Defaults to false.
+	CleanupSubJobs bool `json:"cleanupSubJobs,omitempty"`
+
+	// UninstallOnDelete uninstalls the bundle when the Installation is
+	// deleted. The Installation is only removed after the uninstall succeeds.
+	UninstallOnDelete bool `json:"uninstallOnDelete,omitempty"`
+
+	// Paused stops the operator from running the bundle until it is unpaused.
+	// Jobs that are already running are not affected. The porter.sh/paused
+	// annotation may be used instead of this field.
+	Paused bool `json:"paused,omitempty"`
+
+	// Schedule is a cron expression, e.g. "0 2 * * *", for running the action
+	// periodically. When set, the action only runs at the scheduled times, and
+	// a scheduled run is skipped while a previous job is still running.
+	// When empty, the action runs each time the Installation is changed.
+	Schedule string `json:"schedule,omitempty"`
+
+	// ReconcileAction is the bundle action, e.g. status, that runs at the
+	// scheduled times once the Installation's action succeeds, instead of
+	// running the Installation's action again. The Installation's action still
+	// runs each time the Installation is changed. Requires Schedule, and can
+	// not be uninstall. When empty, the scheduled runs use the Installation's
+	// action.
+	ReconcileAction string `json:"reconcileAction,omitempty"`
+
+	// DriftCheckInterval is how often, e.g. 1h, to run the bundle's status
+	// action after the Installation succeeds, to detect when the installed
+	// resources have drifted from the bundle. The bundle's status action must
+	// fail when it finds drift. The result is recorded in the Drifted
+	// condition, and drift is not remediated. Ignored when Schedule is set.
+	DriftCheckInterval *metav1.Duration `json:"driftCheckInterval,omitempty"`
+
 	// TODO: Force pull, debug and other flags
 
-	// Credentials is a list of credential set names.
+	// Credentials is a list of credential set names, which porter looks up in
+	// the Installation's porter namespace.
 	Credentials []string `json:"credentials,omitempty"`
 
-	// Parameters is a list of parameter set names.
+	// Parameters is a list of parameter set names, which porter looks up in
+	// the Installation's porter namespace, or NAME=VALUE parameters.
 	Parameters []string `json:"parameters,omitempty"`
+
+	// ParameterValues are parameters with typed values, such as numbers,
+	// booleans and objects, so that they keep their type when they are passed
+	// to porter. Strings are passed as is, and other values as JSON.
+	ParameterValues map[string]apiextensionsv1.JSON `json:"parameterValues,omitempty"`
+
+	// ParameterSetRefs are Secrets or ConfigMaps in the Installation's namespace
+	// that are passed to porter as an ephemeral parameter set. Each key in the
+	// referenced object is used as a parameter name.
+	ParameterSetRefs []ParameterSetReference `json:"parameterSetRefs,omitempty"`
+
+	// ParametersFromInstallation sources parameters from the outputs of other
+	// Installations in the same namespace. The Installation is not run until
+	// the other Installations have succeeded.
+	ParametersFromInstallation []ParameterFromInstallation `json:"parametersFromInstallation,omitempty"`
+
+	// DependsOn are the names of other Installations, in the same namespace,
+	// that must succeed before the Installation runs. The Installations used
+	// by ParametersFromInstallation are waited on as well.
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// ParameterSetReference refers to a Secret or ConfigMap whose keys are used as
+// parameters for the bundle.
+type ParameterSetReference struct {
+	// Kind of the referenced object, either Secret or ConfigMap.
+	// +kubebuilder:validation:Enum=Secret;ConfigMap
+	Kind string `json:"kind"`
+
+	// Name of the Secret or ConfigMap in the Installation's namespace.
+	Name string `json:"name"`
+
+	// Watch upgrades the Installation when the referenced object changes,
+	// once the Installation has been installed. Off by default, so changing a
+	// shared Secret or ConfigMap does not run its Installations.
+	Watch bool `json:"watch,omitempty"`
+}
+
+// ParameterSetVersion is the resource version of a watched Secret or ConfigMap
+// used by a run of the Installation.
+type ParameterSetVersion struct {
+	// Kind of the object, either Secret or ConfigMap.
+	Kind string `json:"kind"`
+
+	// Name of the object in the Installation's namespace.
+	Name string `json:"name"`
+
+	// ResourceVersion of the object when the run was created.
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+// PorterPluginConfig selects the plugins that porter uses for secrets and
+// storage.
+type PorterPluginConfig struct {
+	// Secrets is the plugin that resolves the secrets of credential and
+	// parameter sets, e.g. kubernetes.secrets or azure.keyvault.
+	Secrets *PluginConfig `json:"secrets,omitempty"`
+
+	// Storage is the plugin that stores porter's installations and runs,
+	// e.g. mongodb.
+	Storage *PluginConfig `json:"storage,omitempty"`
+}
+
+// PluginConfig is a porter plugin and its settings.
+type PluginConfig struct {
+	// Plugin is the name of the plugin, e.g. azure.keyvault.
+	Plugin string `json:"plugin"`
+
+	// Config are the settings of the plugin, e.g. vault: mykeyvault.
+	Config map[string]string `json:"config,omitempty"`
+}
+
+// SecretsStoreVolume refers to a SecretProviderClass of the Secrets Store CSI
+// driver.
+type SecretsStoreVolume struct {
+	// SecretProviderClass is the name of the SecretProviderClass, in the
+	// Installation's namespace, that selects the secrets to mount.
+	// +kubebuilder:validation:MinLength=1
+	SecretProviderClass string `json:"secretProviderClass"`
+
+	// NodePublishSecretRef is the name of a Secret, in the Installation's
+	// namespace, with the credentials that the provider uses to access the
+	// external secret manager. Only needed by some providers.
+	NodePublishSecretRef string `json:"nodePublishSecretRef,omitempty"`
+}
+
+// ParameterFromInstallation sources a parameter from an output of another
+// Installation.
+type ParameterFromInstallation struct {
+	// Name of the parameter.
+	Name string `json:"name"`
+
+	// Installation is the name of the Installation, in the same namespace, that has the output.
+	Installation string `json:"installation"`
+
+	// Output is the name of the output.
+	Output string `json:"output"`
 }
 
 // InstallationStatus defines the observed state of Installation
@@ -42,6 +467,204 @@ type InstallationStatus struct {
 	ActiveJob v1.LocalObjectReference `json:"activeJob,omitempty"`
 	LastJob   v1.LocalObjectReference `json:"lastJob,omitempty"`
 	// TODO: Include values from the claim such as success/failure, last action
+
+	// ObservedGeneration is the generation of the Installation that was last run.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// ObservedRerun is the porter.sh/rerun annotation of the Installation
+	// when it was last run.
+	ObservedRerun string `json:"observedRerun,omitempty"`
+
+	// PendingGeneration is the generation of the Installation that is
+	// waiting for the stabilizationDelay before it runs.
+	PendingGeneration int64 `json:"pendingGeneration,omitempty"`
+
+	// PendingRunTime is when the PendingGeneration will run, once no more
+	// changes are made to the Installation. Cleared when its job is created.
+	PendingRunTime *metav1.Time `json:"pendingRunTime,omitempty"`
+
+	// Phase of the job that ran the observed generation of the Installation.
+	Phase InstallationPhase `json:"phase,omitempty"`
+
+	// Message is the latest progress reported by the running porter job, e.g.
+	// "pulling image". It is kept after the job finishes, and cleared when a
+	// run does not report progress.
+	Message string `json:"message,omitempty"`
+
+	// StartedAt is when the job of the last porter run started.
+	StartedAt *metav1.Time `json:"startedAt,omitempty"`
+
+	// FinishedAt is when the job of the last porter run finished. Empty
+	// while the job is running.
+	FinishedAt *metav1.Time `json:"finishedAt,omitempty"`
+
+	// Duration of the last porter run, once it has finished.
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// RecentDurations are the durations of the most recent successful runs,
+	// oldest first.
+	RecentDurations []metav1.Duration `json:"recentDurations,omitempty"`
+
+	// EstimatedDuration is the average of the RecentDurations, an estimate of
+	// how long a run takes.
+	EstimatedDuration *metav1.Duration `json:"estimatedDuration,omitempty"`
+
+	// Result of the last porter run, as reported by the porter agent.
+	Result *InstallationResult `json:"result,omitempty"`
+
+	// LastExitCode is the exit code of the porter agent in the last porter
+	// run, e.g. 0 when it succeeded. Empty when the agent's pod was removed
+	// before the operator saw it finish.
+	LastExitCode *int32 `json:"lastExitCode,omitempty"`
+
+	// LastExitReason is why the porter agent's container terminated in the
+	// last porter run, e.g. Completed, Error or OOMKilled.
+	LastExitReason string `json:"lastExitReason,omitempty"`
+
+	// InstalledBundleVersion is the version of the bundle from the last
+	// successful run, even when the Reference is a floating tag.
+	InstalledBundleVersion string `json:"installedBundleVersion,omitempty"`
+
+	// InstalledBundleDigest is the digest of the bundle from the last
+	// successful run, e.g. sha256:abc123.
+	InstalledBundleDigest string `json:"installedBundleDigest,omitempty"`
+
+	// InstalledBundleReference is the reference of the bundle from the last
+	// successful run that installed or upgraded it, e.g.
+	// getporter/porter-hello:v0.1.1. Cleared when the bundle is uninstalled.
+	InstalledBundleReference string `json:"installedBundleReference,omitempty"`
+
+	// Installed indicates that a run installed the bundle, and it has not
+	// been uninstalled since. Changes to an Installation without an Action
+	// are then run as an upgrade.
+	Installed bool `json:"installed,omitempty"`
+
+	// Dependencies are the bundles that the bundle depends on, in the order
+	// that porter runs them, and their outcome in the last run.
+	Dependencies []DependencyStatus `json:"dependencies,omitempty"`
+
+	// ParameterSetVersions are the resource versions of the ParameterSetRefs
+	// with Watch set, when the last run of the Installation was created.
+	ParameterSetVersions []ParameterSetVersion `json:"parameterSetVersions,omitempty"`
+
+	// Explanation is the interface of the bundle, as explained by porter,
+	// when the Installation uses ValidateOnly.
+	Explanation *BundleExplanation `json:"explanation,omitempty"`
+
+	// LastDriftCheckTime is the last time that the bundle's status action was
+	// run to check for drift.
+	LastDriftCheckTime *metav1.Time `json:"lastDriftCheckTime,omitempty"`
+
+	// LastScheduledTime is the last time that the action was scheduled to run.
+	LastScheduledTime *metav1.Time `json:"lastScheduledTime,omitempty"`
+
+	// Conditions store a list of states that have been reached.
+	// Each condition refers to the status of the Installation.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// InstallationResult is the outcome of a porter run, reported by the porter
+// agent in the termination message of its container.
+type InstallationResult struct {
+	// Action that porter ran, e.g. install.
+	Action string `json:"action,omitempty"`
+
+	// Status of the run, e.g. succeeded or failed.
+	Status string `json:"status,omitempty"`
+
+	// BundleVersion is the version of the bundle that porter ran.
+	BundleVersion string `json:"bundleVersion,omitempty"`
+
+	// BundleDigest is the digest of the bundle that porter ran, resolved from
+	// the Reference.
+	BundleDigest string `json:"bundleDigest,omitempty"`
+
+	// Message explains why the run failed. When the porter agent fails
+	// without reporting a result, this is the end of the agent's logs.
+	Message string `json:"message,omitempty"`
+
+	// Dependencies are the results of the bundle's dependencies that porter
+	// ran before the bundle, when the porter agent reports them.
+	Dependencies []DependencyStatus `json:"dependencies,omitempty"`
+}
+
+// DependencyStatus is the outcome of a dependency of the bundle in the last
+// porter run.
+type DependencyStatus struct {
+	// Name of the dependency in the bundle, e.g. mysql.
+	Name string `json:"name"`
+
+	// Bundle is the reference of the dependency's bundle, e.g. getporter/mysql:v0.1.0.
+	Bundle string `json:"bundle,omitempty"`
+
+	// Status of the dependency in the run, e.g. succeeded or failed. Empty
+	// when it is not known.
+	Status string `json:"status,omitempty"`
+}
+
+// BundleExplanation is what a bundle declares, from the output of
+// porter explain.
+type BundleExplanation struct {
+	// Name of the bundle.
+	Name string `json:"name,omitempty"`
+
+	// Description of the bundle.
+	Description string `json:"description,omitempty"`
+
+	// Version of the bundle.
+	Version string `json:"version,omitempty"`
+
+	// Parameters that the bundle accepts.
+	Parameters []ExplainedParameter `json:"parameters,omitempty"`
+
+	// Credentials that the bundle accepts.
+	Credentials []ExplainedCredential `json:"credentials,omitempty"`
+
+	// Outputs that the bundle produces.
+	Outputs []ExplainedOutput `json:"outputs,omitempty"`
+}
+
+// ExplainedParameter is a parameter declared by a bundle.
+type ExplainedParameter struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Required parameters must be set when the bundle runs.
+	Required bool `json:"required,omitempty"`
+
+	// Sensitive parameters should be set from a secret.
+	Sensitive bool `json:"sensitive,omitempty"`
+
+	// ApplyTo lists the actions that use the parameter, e.g. All or install,upgrade.
+	ApplyTo string `json:"applyTo,omitempty"`
+}
+
+// ExplainedCredential is a credential declared by a bundle.
+type ExplainedCredential struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// Required credentials must be set when the bundle runs.
+	Required bool `json:"required,omitempty"`
+
+	// ApplyTo lists the actions that use the credential, e.g. All or install,upgrade.
+	ApplyTo string `json:"applyTo,omitempty"`
+}
+
+// ExplainedOutput is an output declared by a bundle.
+type ExplainedOutput struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// ApplyTo lists the actions that produce the output, e.g. All or install,upgrade.
+	ApplyTo string `json:"applyTo,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -56,6 +679,32 @@ type Installation struct {
 	Status InstallationStatus `json:"status,omitempty"`
 }
 
+// IsPaused determines if the operator should stop running the Installation,
+// either through the Paused field or the porter.sh/paused annotation.
+func (i *Installation) IsPaused() bool {
+	return i.Spec.Paused || i.Annotations[AnnotationPaused] == "true"
+}
+
+// IsForceDeleted determines if the Installation should be removed without
+// uninstalling the bundle.
+func (i *Installation) IsForceDeleted() bool {
+	return i.Annotations[AnnotationForceDelete] == "true"
+}
+
+// GetRerun returns the value of the Installation's porter.sh/rerun annotation.
+func (i *Installation) GetRerun() string {
+	return i.Annotations[AnnotationRerun]
+}
+
+// IsDone determines if the current generation of the Installation, and the
+// latest rerun, has finished running, either successfully or not.
+func (i *Installation) IsDone() bool {
+	if i.Status.ObservedGeneration != i.Generation || i.Status.ObservedRerun != i.GetRerun() || i.Status.ActiveJob.Name != "" {
+		return false
+	}
+	return i.Status.Phase == PhaseSucceeded || i.Status.Phase == PhaseFailed
+}
+
 // +kubebuilder:object:root=true
 
 // InstallationList contains a list of Installation
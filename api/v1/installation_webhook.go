@@ -0,0 +1,413 @@
+package v1
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var installationlog = logf.Log.WithName("installation-resource")
+
+func (i *Installation) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(i).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-porter-sh-v1-installation,mutating=false,failurePolicy=fail,sideEffects=None,groups=porter.sh,resources=installations,verbs=create;update,versions=v1,name=vinstallation.kb.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Validator = &Installation{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (i *Installation) ValidateCreate() error {
+	installationlog.Info("validate create", "name", i.Name)
+
+	return i.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (i *Installation) ValidateUpdate(old runtime.Object) error {
+	installationlog.Info("validate update", "name", i.Name)
+
+	var errs field.ErrorList
+	if oldInst, ok := old.(*Installation); ok {
+		errs = ValidateReferenceUpdate(oldInst, i, field.NewPath("spec", "reference"))
+	}
+	return i.validate(errs...)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (i *Installation) ValidateDelete() error {
+	return nil
+}
+
+func (i *Installation) validate(errs ...*field.Error) error {
+	errs = append(errs, ValidateTopologySpreadConstraints(i.Spec.TopologySpreadConstraints, field.NewPath("spec", "topologySpreadConstraints"))...)
+	errs = append(errs, ValidateAgentArgs(i.Spec.AgentArgs, field.NewPath("spec", "agentArgs"))...)
+	errs = append(errs, ValidateAgentCommand(i.Spec.AgentCommand, field.NewPath("spec", "agentCommand"))...)
+	errs = append(errs, ValidateInitContainers(i.Spec.InitContainers, field.NewPath("spec", "initContainers"))...)
+	errs = append(errs, ValidateTerminationGracePeriodSeconds(i.Spec.TerminationGracePeriodSeconds, field.NewPath("spec", "terminationGracePeriodSeconds"))...)
+	errs = append(errs, ValidateBundleRef(i.Spec, field.NewPath("spec"))...)
+	errs = append(errs, ValidateApply(i.Spec, field.NewPath("spec"))...)
+	errs = append(errs, ValidateValidateOnly(i.Spec, field.NewPath("spec"))...)
+	errs = append(errs, ValidateDockerHostAccess(i.Spec, field.NewPath("spec", "allowDockerHostAccess"))...)
+	errs = append(errs, ValidateReconcileAction(i.Spec, field.NewPath("spec"))...)
+	errs = append(errs, ValidateDependsOn(i.Name, i.Spec.DependsOn, field.NewPath("spec", "dependsOn"))...)
+	errs = append(errs, ValidatePluginConfig(i.Spec.PluginConfig, field.NewPath("spec", "pluginConfig"))...)
+	errs = append(errs, ValidateSetReferences(i.Spec, field.NewPath("spec"))...)
+	if i.Spec.PorterHome != "" {
+		errs = append(errs, ValidatePorterHome(i.Spec.PorterHome, field.NewPath("spec", "porterHome"))...)
+		errs = append(errs, ValidatePorterHomeVolume(i.Spec.PorterHome, i.Spec.PorterHomeVolumeClaimName, field.NewPath("spec", "porterHome"))...)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(schema.GroupKind{Group: GroupVersion.Group, Kind: "Installation"}, i.Name, errs)
+}
+
+// ValidateTopologySpreadConstraints checks the constraints that the API server
+// would otherwise only reject when the agent's job is created.
+func ValidateTopologySpreadConstraints(constraints []v1.TopologySpreadConstraint, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, c := range constraints {
+		idxPath := fldPath.Index(i)
+		if c.MaxSkew <= 0 {
+			errs = append(errs, field.Invalid(idxPath.Child("maxSkew"), c.MaxSkew, "must be greater than zero"))
+		}
+		if c.TopologyKey == "" {
+			errs = append(errs, field.Required(idxPath.Child("topologyKey"), "can not be empty"))
+		}
+		switch c.WhenUnsatisfiable {
+		case v1.DoNotSchedule, v1.ScheduleAnyway:
+		default:
+			errs = append(errs, field.NotSupported(idxPath.Child("whenUnsatisfiable"), c.WhenUnsatisfiable,
+				[]string{string(v1.DoNotSchedule), string(v1.ScheduleAnyway)}))
+		}
+	}
+	return errs
+}
+
+// managedAgentFlags are the porter flags set by the operator, which would
+// break the porter agent job if they were overridden.
+var managedAgentFlags = map[string]bool{
+	"allow-docker-host-access": true,
+	"cnab-file":                true,
+	"cred":                     true,
+	"c":                        true,
+	"dir":                      true,
+	"driver":                   true,
+	"d":                        true,
+	"file":                     true,
+	"f":                        true,
+	"namespace":                true,
+	"n":                        true,
+	"param":                    true,
+	"parameter-set":            true,
+	"p":                        true,
+	"reference":                true,
+	"r":                        true,
+	"relocation-mapping":       true,
+	"tag":                      true,
+	"t":                        true,
+}
+
+// ValidateAgentArgs checks that the extra porter flags are in the --flag=value
+// form and do not override the flags managed by the operator.
+func ValidateAgentArgs(args []string, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, arg := range args {
+		idxPath := fldPath.Index(i)
+		if !strings.HasPrefix(arg, "-") || arg == "-" || arg == "--" {
+			errs = append(errs, field.Invalid(idxPath, arg, "must be a flag, e.g. --flag=value"))
+			continue
+		}
+		flag := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		if managedAgentFlags[flag] {
+			errs = append(errs, field.Forbidden(idxPath, "the --"+flag+" flag is managed by the operator"))
+		}
+	}
+	return errs
+}
+
+// ValidateAgentCommand checks that the agent's command starts with an
+// executable, and does not set the porter flags that the operator passes in
+// the agent's arguments.
+func ValidateAgentCommand(command []string, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, arg := range command {
+		idxPath := fldPath.Index(i)
+		if strings.TrimSpace(arg) == "" {
+			errs = append(errs, field.Invalid(idxPath, arg, "must not be empty"))
+			continue
+		}
+		if i == 0 && strings.HasPrefix(arg, "-") {
+			errs = append(errs, field.Invalid(idxPath, arg, "must be an executable, e.g. /app/porter-wrapper"))
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			flag := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+			if managedAgentFlags[flag] {
+				errs = append(errs, field.Forbidden(idxPath, "the --"+flag+" flag is managed by the operator"))
+			}
+		}
+	}
+	return errs
+}
+
+// ValidateInitContainers checks the init containers that the API server would
+// otherwise only reject when the agent's job is created.
+func ValidateInitContainers(containers []v1.Container, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	names := make(map[string]bool, len(containers))
+	for i, c := range containers {
+		idxPath := fldPath.Index(i)
+		if c.Name == "" {
+			errs = append(errs, field.Required(idxPath.Child("name"), "can not be empty"))
+		} else {
+			for _, msg := range validation.IsDNS1123Label(c.Name) {
+				errs = append(errs, field.Invalid(idxPath.Child("name"), c.Name, msg))
+			}
+			if names[c.Name] {
+				errs = append(errs, field.Duplicate(idxPath.Child("name"), c.Name))
+			}
+			names[c.Name] = true
+		}
+		if strings.TrimSpace(c.Image) == "" {
+			errs = append(errs, field.Required(idxPath.Child("image"), "can not be empty"))
+		}
+	}
+	return errs
+}
+
+// ValidateTerminationGracePeriodSeconds checks that the agent pod's grace
+// period is not negative, which the API server would otherwise only reject
+// when the agent's job is created.
+func ValidateTerminationGracePeriodSeconds(seconds *int64, fldPath *field.Path) field.ErrorList {
+	if seconds == nil || *seconds >= 0 {
+		return nil
+	}
+	return field.ErrorList{field.Invalid(fldPath, *seconds, "must be greater than or equal to 0")}
+}
+
+// ValidateApply checks that an Installation that uses apply only has settings
+// that porter can read from the installation file.
+func ValidateApply(spec InstallationSpec, fldPath *field.Path) field.ErrorList {
+	if !spec.Apply {
+		return nil
+	}
+
+	var errs field.ErrorList
+	if len(spec.ParameterSetRefs) > 0 {
+		errs = append(errs, field.Forbidden(fldPath.Child("parameterSetRefs"), "can not be used with apply"))
+	}
+	if len(spec.ParametersFromInstallation) > 0 {
+		errs = append(errs, field.Forbidden(fldPath.Child("parametersFromInstallation"), "can not be used with apply"))
+	}
+	if spec.RelocationMapConfigMap != "" {
+		errs = append(errs, field.Forbidden(fldPath.Child("relocationMapConfigMap"), "can not be used with apply"))
+	}
+	return errs
+}
+
+// ValidateSetReferences checks the names of the Installation's credential and
+// parameter sets. Porter looks up the sets by name in the Installation's
+// porter namespace, so a reference qualified with a namespace, e.g.
+// shared/azure, would silently use a set from the wrong namespace, and is
+// rejected. Parameters set with NAME=VALUE are not sets.
+func ValidateSetReferences(spec InstallationSpec, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	validate := func(idxPath *field.Path, ref string) {
+		switch {
+		case ref == "":
+			errs = append(errs, field.Required(idxPath, "the name of the set can not be empty"))
+		case strings.Contains(ref, "/"):
+			errs = append(errs, field.Invalid(idxPath, ref, "namespace-qualified references are not supported, porter looks up sets by name in the Installation's porter namespace"))
+		}
+	}
+	for i, c := range spec.Credentials {
+		validate(fldPath.Child("credentials").Index(i), c)
+	}
+	for i, p := range spec.Parameters {
+		if !strings.Contains(p, "=") {
+			validate(fldPath.Child("parameters").Index(i), p)
+		}
+	}
+	return errs
+}
+
+// ValidateDockerHostAccess rejects AllowDockerHostAccess. The bundle runs in
+// a pod created by porter's kubernetes driver, which can not mount the node's
+// docker socket, and porter refuses --allow-docker-host-access with that
+// driver.
+func ValidateDockerHostAccess(spec InstallationSpec, fldPath *field.Path) field.ErrorList {
+	if !spec.AllowDockerHostAccess {
+		return nil
+	}
+	return field.ErrorList{field.Forbidden(fldPath, "is not supported by porter's kubernetes driver, which runs the bundle")}
+}
+
+// ValidateReconcileAction checks that the action run at the scheduled times
+// of an Installation is scheduled, and does not uninstall the bundle.
+func ValidateReconcileAction(spec InstallationSpec, fldPath *field.Path) field.ErrorList {
+	if spec.ReconcileAction == "" {
+		return nil
+	}
+
+	var errs field.ErrorList
+	if spec.Schedule == "" {
+		errs = append(errs, field.Required(fldPath.Child("schedule"), "must be set with reconcileAction"))
+	}
+	if spec.ReconcileAction == "uninstall" {
+		errs = append(errs, field.Invalid(fldPath.Child("reconcileAction"), spec.ReconcileAction, "can not uninstall the bundle"))
+	}
+	return errs
+}
+
+// ValidateDependsOn checks that an Installation does not depend on itself,
+// which it would wait for forever.
+func ValidateDependsOn(name string, dependsOn []string, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, dep := range dependsOn {
+		if dep == name {
+			errs = append(errs, field.Invalid(fldPath.Index(i), dep, "an Installation can not depend on itself"))
+		}
+	}
+	return errs
+}
+
+// ValidatePluginConfig checks that the Installation's plugin configuration
+// selects at least one plugin, by name.
+func ValidatePluginConfig(cfg *PorterPluginConfig, fldPath *field.Path) field.ErrorList {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.Secrets == nil && cfg.Storage == nil {
+		return field.ErrorList{field.Required(fldPath, "must configure the secrets or storage plugin")}
+	}
+
+	var errs field.ErrorList
+	plugins := []struct {
+		name   string
+		plugin *PluginConfig
+	}{{"secrets", cfg.Secrets}, {"storage", cfg.Storage}}
+	for _, p := range plugins {
+		name, plugin := p.name, p.plugin
+		if plugin == nil {
+			continue
+		}
+		pluginPath := fldPath.Child(name, "plugin")
+		if plugin.Plugin == "" {
+			errs = append(errs, field.Required(pluginPath, "must be the name of a porter plugin"))
+		} else if strings.ContainsAny(plugin.Plugin, " \t\n\"'") {
+			errs = append(errs, field.Invalid(pluginPath, plugin.Plugin, "must be the name of a porter plugin, e.g. azure.keyvault"))
+		}
+		for key := range plugin.Config {
+			if key == "" {
+				errs = append(errs, field.Invalid(fldPath.Child(name, "config"), key, "keys can not be empty"))
+			}
+		}
+	}
+	return errs
+}
+
+// porterAgentPaths are the directories where the operator mounts volumes in
+// the porter agent, which can not be the porter home.
+var porterAgentPaths = []string{"/porter-shared", "/porter-config"}
+
+// ValidatePorterHome checks that the porter home directory of the agent is an
+// absolute path, and is not a directory that the operator mounts.
+func ValidatePorterHome(porterHome string, fldPath *field.Path) field.ErrorList {
+	if !path.IsAbs(porterHome) {
+		return field.ErrorList{field.Invalid(fldPath, porterHome, "must be an absolute path")}
+	}
+	for _, p := range porterAgentPaths {
+		if path.Clean(porterHome) == p {
+			return field.ErrorList{field.Invalid(fldPath, porterHome, "is used by the operator")}
+		}
+	}
+	return nil
+}
+
+// PorterImageHomes are the porter homes where the porter agent images have
+// porter installed, which can be used without a PorterHomeVolumeClaimName.
+var PorterImageHomes = []string{"/root/.porter", "/app/.porter"}
+
+// ValidatePorterHomeVolume checks that a porter home which is not one of the
+// PorterImageHomes is mounted from a volume, which has porter installed. The
+// agent image does not have porter in other directories.
+func ValidatePorterHomeVolume(porterHome string, claimName string, fldPath *field.Path) field.ErrorList {
+	if claimName != "" {
+		return nil
+	}
+	for _, p := range PorterImageHomes {
+		if path.Clean(porterHome) == p {
+			return nil
+		}
+	}
+	return field.ErrorList{field.Invalid(fldPath, porterHome, fmt.Sprintf("must be one of %s, where the agent image has porter installed, unless porterHomeVolumeClaimName is set", strings.Join(PorterImageHomes, ", ")))}
+}
+
+// ValidateValidateOnly checks that an Installation that only validates the
+// bundle does not have settings that install or uninstall it.
+func ValidateValidateOnly(spec InstallationSpec, fldPath *field.Path) field.ErrorList {
+	if !spec.ValidateOnly {
+		return nil
+	}
+
+	var errs field.ErrorList
+	if spec.Apply {
+		errs = append(errs, field.Forbidden(fldPath.Child("apply"), "can not be used with validateOnly"))
+	}
+	if spec.UninstallOnDelete {
+		errs = append(errs, field.Forbidden(fldPath.Child("uninstallOnDelete"), "can not be used with validateOnly"))
+	}
+	if spec.DriftCheckInterval != nil {
+		errs = append(errs, field.Forbidden(fldPath.Child("driftCheckInterval"), "can not be used with validateOnly"))
+	}
+	return errs
+}
+
+// ValidateBundleRef checks that the Installation uses either a bundle
+// Reference or a Bundle from the catalog.
+func ValidateBundleRef(spec InstallationSpec, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if spec.Reference == "" && spec.BundleRef == "" {
+		errs = append(errs, field.Required(fldPath.Child("reference"), "either reference or bundleRef is required"))
+	}
+	if spec.Reference != "" && spec.BundleRef != "" {
+		errs = append(errs, field.Forbidden(fldPath.Child("bundleRef"), "can not be used with reference"))
+	}
+	return errs
+}
+
+// ValidateReferenceUpdate checks that an Installation that is installed keeps
+// using the installed bundle. Changing the tag or digest, e.g. to upgrade to a
+// new version, is allowed, but changing the repository would run the action on
+// an unrelated bundle with the installation record of the installed bundle.
+// Like the operator, the update is allowed once the bundle is uninstalled, when
+// it uninstalls the bundle, or when the porter.sh/allow-bundle-swap annotation
+// is "true".
+func ValidateReferenceUpdate(old *Installation, inst *Installation, fldPath *field.Path) field.ErrorList {
+	installed := old.Status.InstalledBundleReference
+	if !old.Status.Installed || installed == "" || inst.Spec.Reference == "" || inst.Spec.Action == "uninstall" {
+		return nil
+	}
+	if inst.Annotations[AnnotationAllowBundleSwap] == "true" || SameBundleRepository(installed, inst.Spec.Reference) {
+		return nil
+	}
+	return field.ErrorList{field.Forbidden(fldPath, fmt.Sprintf(
+		"can not change the bundle from %s to %s while it is installed, only its tag or digest. Uninstall it first, or set the %s annotation to \"true\" to run the new bundle anyway",
+		installed, inst.Spec.Reference, AnnotationAllowBundleSwap))}
+}
@@ -0,0 +1,147 @@
+package v1
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/pointer"
+)
+
+func TestValidateReferenceUpdate(t *testing.T) {
+	testcases := []struct {
+		name      string
+		installed bool
+		reference string
+		action    string
+		allowSwap bool
+		wantErr   bool
+	}{
+		{name: "new version", installed: true, reference: "getporter/porter-hello:v0.1.1"},
+		{name: "pin to digest", installed: true, reference: "getporter/porter-hello:v0.1.0@sha256:abc123"},
+		{name: "different bundle", installed: true, reference: "getporter/wordpress:v0.1.0", wantErr: true},
+		{name: "allowed swap", installed: true, reference: "getporter/wordpress:v0.1.0", allowSwap: true},
+		{name: "uninstall", installed: true, reference: "getporter/wordpress:v0.1.0", action: "uninstall"},
+		{name: "uninstalled", reference: "getporter/wordpress:v0.1.0"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			old := &Installation{Spec: InstallationSpec{Reference: "getporter/porter-hello:v0.1.0"}}
+			old.Status.Installed = tc.installed
+			old.Status.InstalledBundleReference = "getporter/porter-hello:v0.1.0"
+			inst := old.DeepCopy()
+			inst.Spec.Reference = tc.reference
+			inst.Spec.Action = tc.action
+			if tc.allowSwap {
+				inst.Annotations = map[string]string{AnnotationAllowBundleSwap: "true"}
+			}
+
+			errs := ValidateReferenceUpdate(old, inst, field.NewPath("spec", "reference"))
+			if tc.wantErr {
+				g.Expect(errs.ToAggregate()).To(MatchError(ContainSubstring("can not change the bundle")))
+			} else {
+				g.Expect(errs).To(BeEmpty())
+			}
+		})
+	}
+}
+
+func TestValidateInitContainers(t *testing.T) {
+	testcases := []struct {
+		name       string
+		containers []v1.Container
+		wantErr    string
+	}{
+		{name: "valid", containers: []v1.Container{{Name: "fetch-secrets", Image: "example.com/vault-fetch:v1"}, {Name: "check", Image: "example.com/check:v1"}}},
+		{name: "no name", containers: []v1.Container{{Image: "example.com/check:v1"}}, wantErr: "spec.initContainers[0].name: Required value"},
+		{name: "invalid name", containers: []v1.Container{{Name: "Fetch_Secrets", Image: "example.com/check:v1"}}, wantErr: `spec.initContainers[0].name: Invalid value: "Fetch_Secrets"`},
+		{name: "duplicate name", containers: []v1.Container{{Name: "check", Image: "example.com/check:v1"}, {Name: "check", Image: "example.com/check:v2"}}, wantErr: `spec.initContainers[1].name: Duplicate value: "check"`},
+		{name: "no image", containers: []v1.Container{{Name: "check"}}, wantErr: "spec.initContainers[0].image: Required value"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			errs := ValidateInitContainers(tc.containers, field.NewPath("spec", "initContainers"))
+			if tc.wantErr == "" {
+				g.Expect(errs).To(BeEmpty())
+				return
+			}
+			g.Expect(errs.ToAggregate()).To(MatchError(ContainSubstring(tc.wantErr)))
+		})
+	}
+}
+
+func TestValidateTerminationGracePeriodSeconds(t *testing.T) {
+	g := NewWithT(t)
+	fldPath := field.NewPath("spec", "terminationGracePeriodSeconds")
+
+	g.Expect(ValidateTerminationGracePeriodSeconds(nil, fldPath)).To(BeEmpty())
+	g.Expect(ValidateTerminationGracePeriodSeconds(pointer.Int64Ptr(0), fldPath)).To(BeEmpty())
+	g.Expect(ValidateTerminationGracePeriodSeconds(pointer.Int64Ptr(600), fldPath)).To(BeEmpty())
+	errs := ValidateTerminationGracePeriodSeconds(pointer.Int64Ptr(-1), fldPath)
+	g.Expect(errs.ToAggregate()).To(MatchError(ContainSubstring("spec.terminationGracePeriodSeconds: Invalid value: -1")))
+}
+
+func TestValidatePorterHomeVolume(t *testing.T) {
+	testcases := []struct {
+		name       string
+		porterHome string
+		claimName  string
+		wantErr    bool
+	}{
+		{name: "image home", porterHome: "/root/.porter"},
+		{name: "image home with a trailing slash", porterHome: "/app/.porter/"},
+		{name: "volume", porterHome: "/porter-home", claimName: "porter-home"},
+		{name: "not in the image", porterHome: "/porter-home", wantErr: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			errs := ValidatePorterHomeVolume(tc.porterHome, tc.claimName, field.NewPath("spec", "porterHome"))
+			if tc.wantErr {
+				g.Expect(errs.ToAggregate()).To(MatchError(ContainSubstring("unless porterHomeVolumeClaimName is set")))
+				return
+			}
+			g.Expect(errs).To(BeEmpty())
+		})
+	}
+}
+
+func TestValidateDockerHostAccess(t *testing.T) {
+	g := NewWithT(t)
+	fldPath := field.NewPath("spec", "allowDockerHostAccess")
+
+	g.Expect(ValidateDockerHostAccess(InstallationSpec{}, fldPath)).To(BeEmpty())
+	errs := ValidateDockerHostAccess(InstallationSpec{AllowDockerHostAccess: true}, fldPath)
+	g.Expect(errs.ToAggregate()).To(MatchError(ContainSubstring("spec.allowDockerHostAccess: Forbidden: is not supported by porter's kubernetes driver")))
+}
+
+func TestValidateSetReferences(t *testing.T) {
+	testcases := []struct {
+		name        string
+		credentials []string
+		parameters  []string
+		wantErr     string
+	}{
+		{name: "names", credentials: []string{"azure"}, parameters: []string{"settings", "name=hello"}},
+		{name: "qualified value", parameters: []string{"path=shared/settings"}},
+		{name: "qualified credential set", credentials: []string{"shared/azure"}, wantErr: `spec.credentials[0]: Invalid value: "shared/azure"`},
+		{name: "qualified parameter set", parameters: []string{"name=hello", "shared/settings"}, wantErr: `spec.parameters[1]: Invalid value: "shared/settings"`},
+		{name: "empty parameter set", parameters: []string{""}, wantErr: "spec.parameters[0]: Required value"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			spec := InstallationSpec{Credentials: tc.credentials, Parameters: tc.parameters}
+
+			errs := ValidateSetReferences(spec, field.NewPath("spec"))
+			if tc.wantErr == "" {
+				g.Expect(errs).To(BeEmpty())
+				return
+			}
+			g.Expect(errs.ToAggregate()).To(MatchError(ContainSubstring(tc.wantErr)))
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package v1
+
+import "strings"
+
+// DockerHubRegistry is the registry of bundle repositories without a registry
+// host, e.g. getporter/porter-hello.
+const DockerHubRegistry = "docker.io"
+
+// ParseBundleReference splits a bundle reference, such as
+// getporter/porter-hello:v0.1.1, into its repository and its tag and digest.
+// A reference may have both, e.g. getporter/porter-hello:v0.1.1@sha256:abc,
+// in which case the digest identifies the bundle.
+func ParseBundleReference(ref string) (repository string, tag string, digest string) {
+	repository = ref
+	if i := strings.Index(repository, "@"); i >= 0 {
+		repository, digest = repository[:i], repository[i+1:]
+	}
+	// A colon before the last slash separates the registry's port
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository, tag = repository[:i], repository[i+1:]
+	}
+	return repository, tag, digest
+}
+
+// ParseBundleRepository splits a bundle repository, such as
+// ghcr.io/getporter/porter-hello, into the host of its registry and the name
+// of the repository in the registry. It uses the same rules as docker for
+// repositories on Docker Hub, getporter/porter-hello is
+// docker.io/getporter/porter-hello and porter-hello is
+// docker.io/library/porter-hello.
+func ParseBundleRepository(repository string) (registry string, name string) {
+	parts := strings.SplitN(repository, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return NormalizeRegistry(parts[0]), parts[1]
+	}
+	if len(parts) == 1 {
+		return DockerHubRegistry, "library/" + repository
+	}
+	return DockerHubRegistry, repository
+}
+
+// NormalizeRegistry returns the same host for the aliases of Docker Hub.
+func NormalizeRegistry(registry string) string {
+	switch registry {
+	case "index.docker.io", "registry-1.docker.io":
+		return DockerHubRegistry
+	}
+	return registry
+}
+
+// SameBundleRepository determines if two bundle references are in the same
+// repository, e.g. getporter/porter-hello:v0.1.1 and
+// docker.io/getporter/porter-hello@sha256:abc123.
+func SameBundleRepository(a string, b string) bool {
+	aRepository, _, _ := ParseBundleReference(a)
+	bRepository, _, _ := ParseBundleReference(b)
+	aRegistry, aName := ParseBundleRepository(aRepository)
+	bRegistry, bName := ParseBundleRepository(bRepository)
+	return aRegistry == bRegistry && aName == bName
+}
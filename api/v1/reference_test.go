@@ -0,0 +1,75 @@
+package v1
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseBundleReference(t *testing.T) {
+	testcases := []struct {
+		reference      string
+		wantRepository string
+		wantTag        string
+		wantDigest     string
+	}{
+		{reference: "getporter/porter-hello:v0.1.1", wantRepository: "getporter/porter-hello", wantTag: "v0.1.1"},
+		{reference: "getporter/porter-hello", wantRepository: "getporter/porter-hello"},
+		{reference: "localhost:5000/porter-hello", wantRepository: "localhost:5000/porter-hello"},
+		{reference: "localhost:5000/porter-hello:v0.1.1", wantRepository: "localhost:5000/porter-hello", wantTag: "v0.1.1"},
+		{reference: "ghcr.io/getporter/porter-hello@sha256:abc123", wantRepository: "ghcr.io/getporter/porter-hello", wantDigest: "sha256:abc123"},
+		{reference: "getporter/porter-hello:v0.1.1@sha256:abc123", wantRepository: "getporter/porter-hello", wantTag: "v0.1.1", wantDigest: "sha256:abc123"},
+		{reference: "localhost:5000/porter-hello:v0.1.1@sha256:abc123", wantRepository: "localhost:5000/porter-hello", wantTag: "v0.1.1", wantDigest: "sha256:abc123"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.reference, func(t *testing.T) {
+			g := NewWithT(t)
+			repository, tag, digest := ParseBundleReference(tc.reference)
+			g.Expect(repository).To(Equal(tc.wantRepository))
+			g.Expect(tag).To(Equal(tc.wantTag))
+			g.Expect(digest).To(Equal(tc.wantDigest))
+		})
+	}
+}
+
+func TestParseBundleRepository(t *testing.T) {
+	testcases := []struct {
+		repository   string
+		wantRegistry string
+		wantName     string
+	}{
+		{repository: "ghcr.io/getporter/porter", wantRegistry: "ghcr.io", wantName: "getporter/porter"},
+		{repository: "localhost:5000/porter", wantRegistry: "localhost:5000", wantName: "porter"},
+		{repository: "localhost/porter", wantRegistry: "localhost", wantName: "porter"},
+		{repository: "getporter/porter", wantRegistry: DockerHubRegistry, wantName: "getporter/porter"},
+		{repository: "index.docker.io/getporter/porter", wantRegistry: DockerHubRegistry, wantName: "getporter/porter"},
+		{repository: "porter", wantRegistry: DockerHubRegistry, wantName: "library/porter"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.repository, func(t *testing.T) {
+			g := NewWithT(t)
+			registry, name := ParseBundleRepository(tc.repository)
+			g.Expect(registry).To(Equal(tc.wantRegistry))
+			g.Expect(name).To(Equal(tc.wantName))
+		})
+	}
+}
+
+func TestSameBundleRepository(t *testing.T) {
+	testcases := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "getporter/porter-hello:v0.1.0", b: "getporter/porter-hello:v0.1.1", want: true},
+		{a: "getporter/porter-hello:v0.1.0", b: "docker.io/getporter/porter-hello@sha256:abc123", want: true},
+		{a: "getporter/porter-hello:v0.1.1", b: "getporter/porter-hello:v0.1.1@sha256:abc123", want: true},
+		{a: "ghcr.io/getporter/porter-hello:v0.1.0", b: "ghcr.io/getporter/porter-hello", want: true},
+		{a: "getporter/porter-hello:v0.1.0", b: "getporter/wordpress:v0.1.0"},
+		{a: "getporter/porter-hello:v0.1.0", b: "ghcr.io/getporter/porter-hello:v0.1.0"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			NewWithT(t).Expect(SameBundleRepository(tc.a, tc.b)).To(Equal(tc.want))
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+const (
+	// installationFilePath is where the generated installation file is mounted in the agent.
+	installationFilePath = "/porter-installation"
+
+	// installationFileName is the key of the installation file in its ConfigMap.
+	installationFileName = "installation.yaml"
+)
+
+// installationFile is the porter installation file format, read by
+// porter installation apply.
+type installationFile struct {
+	SchemaVersion  string                 `json:"schemaVersion"`
+	Name           string                 `json:"name"`
+	Namespace      string                 `json:"namespace,omitempty"`
+	Bundle         installationBundle     `json:"bundle"`
+	CredentialSets []string               `json:"credentialSets,omitempty"`
+	ParameterSets  []string               `json:"parameterSets,omitempty"`
+	Parameters     map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type installationBundle struct {
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+}
+
+// ephemeralInstallationFile describes how to make the generated installation
+// file available to the porter agent.
+type ephemeralInstallationFile struct {
+	Args         []string
+	Volumes      []corev1.Volume
+	VolumeMounts []corev1.VolumeMount
+}
+
+// checkApply validates the Installation's settings when it uses apply, in
+// case the Installation was created without the webhook. An Installation
+// with invalid settings is not run until it is fixed.
+func (r *InstallationReconciler) checkApply(ctx context.Context, inst *porterv1.Installation) (bool, error) {
+	errs := porterv1.ValidateApply(inst.Spec, field.NewPath("spec"))
+	if len(errs) == 0 {
+		return true, nil
+	}
+
+	msg := fmt.Sprintf("Invalid apply: %s", errs.ToAggregate())
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonInvalidApply, msg)
+
+	return false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonInvalidApply, msg)
+}
+
+// createInstallationFile generates the porter installation file for the
+// Installation, in a ConfigMap that is labeled with the job and owned by the
+// Installation.
+func (r *InstallationReconciler) createInstallationFile(ctx context.Context, jobName string, inst *porterv1.Installation, porterNamespace string, labels map[string]string) (ephemeralInstallationFile, error) {
+	var result ephemeralInstallationFile
+
+	repository, tag, digest := porterv1.ParseBundleReference(inst.Spec.Reference)
+	if digest != "" {
+		// The digest identifies the bundle, the tag of a pinned reference is informational
+		tag = ""
+	}
+	f := installationFile{
+		SchemaVersion: "1.0.0",
+		Name:          inst.Name,
+		Namespace:     porterNamespace,
+		Bundle:        installationBundle{Repository: repository, Tag: tag, Digest: digest},
+	}
+	f.CredentialSets = append(f.CredentialSets, inst.Spec.Credentials...)
+	for _, p := range inst.Spec.Parameters {
+		if kv := strings.SplitN(p, "=", 2); len(kv) == 2 {
+			if f.Parameters == nil {
+				f.Parameters = map[string]interface{}{}
+			}
+			f.Parameters[kv[0]] = kv[1]
+			continue
+		}
+		f.ParameterSets = append(f.ParameterSets, p)
+	}
+	for name, v := range inst.Spec.ParameterValues {
+		// Keep the type of the value in the installation file
+		var value interface{}
+		if err := json.Unmarshal(v.Raw, &value); err != nil {
+			return result, newTerminalError(ReasonInvalidSetting, errors.Wrapf(err, "invalid value for parameter %s of Installation %s/%s", name, inst.Namespace, inst.Name))
+		}
+		if f.Parameters == nil {
+			f.Parameters = map[string]interface{}{}
+		}
+		f.Parameters[name] = value
+	}
+
+	fB, err := yaml.Marshal(f)
+	if err != nil {
+		return result, errors.Wrapf(err, "error generating the installation file for Installation %s/%s", inst.Namespace, inst.Name)
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            jobName + "-installation",
+			Namespace:       inst.Namespace,
+			Labels:          labels,
+			OwnerReferences: getOwnerReferences(inst),
+		},
+		Data: map[string]string{
+			installationFileName: string(fB),
+		},
+	}
+	err = r.Create(ctx, cm, &client.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// A previous reconcile was interrupted before it created the job
+		r.getLogger(ctx).Info("using existing installation file", "configMap", cm.Name)
+	} else if err != nil {
+		return result, errors.Wrapf(err, "error creating the installation file for Installation %s/%s@%s", inst.Namespace, inst.Name, inst.ResourceVersion)
+	}
+
+	result.Volumes = append(result.Volumes, corev1.Volume{
+		Name: "porter-installation",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: cm.Name},
+			},
+		},
+	})
+	result.VolumeMounts = append(result.VolumeMounts, corev1.VolumeMount{
+		Name:      "porter-installation",
+		MountPath: installationFilePath,
+		ReadOnly:  true,
+	})
+	result.Args = []string{"installation", "apply", path.Join(installationFilePath, installationFileName)}
+
+	return result, nil
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestParseBundleReference(t *testing.T) {
+	testcases := []struct {
+		ref            string
+		wantRepository string
+		wantTag        string
+		wantDigest     string
+	}{
+		{ref: "getporter/porter-hello:v0.1.1", wantRepository: "getporter/porter-hello", wantTag: "v0.1.1"},
+		{ref: "localhost:5000/porter-hello", wantRepository: "localhost:5000/porter-hello"},
+		{ref: "localhost:5000/porter-hello:v0.1.1", wantRepository: "localhost:5000/porter-hello", wantTag: "v0.1.1"},
+		{ref: "getporter/porter-hello@sha256:abc123", wantRepository: "getporter/porter-hello", wantDigest: "sha256:abc123"},
+		{ref: "getporter/porter-hello:v0.1.1@sha256:abc123", wantRepository: "getporter/porter-hello", wantTag: "v0.1.1", wantDigest: "sha256:abc123"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.ref, func(t *testing.T) {
+			g := NewWithT(t)
+			repository, tag, digest := porterv1.ParseBundleReference(tc.ref)
+			g.Expect(repository).To(Equal(tc.wantRepository))
+			g.Expect(tag).To(Equal(tc.wantTag))
+			g.Expect(digest).To(Equal(tc.wantDigest))
+		})
+	}
+}
+
+func TestCreateJobForInstallation_Apply(t *testing.T) {
+	t.Run("installation file", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		inst.Spec.Apply = true
+		inst.Spec.Credentials = []string{"azure"}
+		inst.Spec.Parameters = []string{"settings", "name=hello"}
+		inst.Spec.ParameterValues = map[string]apiextensionsv1.JSON{"replicas": {Raw: []byte(`3`)}}
+		jobName := makeJobName(inst)
+		r := newTestReconciler(t, inst)
+
+		g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+		job := &batchv1.Job{}
+		g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+		g.Expect(job.Spec.Template.Spec.Containers[0].Args[:3]).To(Equal([]string{"installation", "apply", "/porter-installation/installation.yaml"}))
+		g.Expect(job.Annotations).To(HaveKeyWithValue(annotationApply, "true"))
+		g.Expect(job.Annotations).ToNot(HaveKey(annotationAction))
+
+		cm := &corev1.ConfigMap{}
+		g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName + "-installation"}, cm)).To(Succeed())
+		var f installationFile
+		g.Expect(yaml.Unmarshal([]byte(cm.Data[installationFileName]), &f)).To(Succeed())
+		g.Expect(f).To(Equal(installationFile{
+			SchemaVersion:  "1.0.0",
+			Name:           inst.Name,
+			Bundle:         installationBundle{Repository: "getporter/porter-hello", Tag: "v0.1.1"},
+			CredentialSets: []string{"azure"},
+			ParameterSets:  []string{"settings"},
+			Parameters:     map[string]interface{}{"name": "hello", "replicas": float64(3)},
+		}))
+	})
+
+	t.Run("pinned reference", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		inst.Spec.Apply = true
+		inst.Spec.Reference = "getporter/porter-hello:v0.1.1@sha256:abc123"
+		jobName := makeJobName(inst)
+		r := newTestReconciler(t, inst)
+
+		g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+		cm := &corev1.ConfigMap{}
+		g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName + "-installation"}, cm)).To(Succeed())
+		var f installationFile
+		g.Expect(yaml.Unmarshal([]byte(cm.Data[installationFileName]), &f)).To(Succeed())
+		g.Expect(f.Bundle).To(Equal(installationBundle{Repository: "getporter/porter-hello", Digest: "sha256:abc123"}))
+	})
+
+	t.Run("parameter set refs", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		inst.Spec.Apply = true
+		inst.Spec.ParameterSetRefs = []porterv1.ParameterSetReference{{Kind: "Secret", Name: "settings"}}
+		jobName := makeJobName(inst)
+		r := newTestReconciler(t, inst)
+
+		g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+		jobs := &batchv1.JobList{}
+		g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+		g.Expect(jobs.Items).To(BeEmpty())
+		cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+		g.Expect(cond).ToNot(BeNil())
+		g.Expect(cond.Reason).To(Equal(ReasonInvalidApply))
+	})
+}
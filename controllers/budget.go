@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// getNamespaceResourceBudget returns the resources that the porter agent
+// jobs in a namespace may request at the same time, e.g. cpu=4,memory=8Gi.
+// The budget is set for the whole operator, with the namespaceResourceBudget
+// key of the porter ConfigMap in the operator's namespace, or the operator's
+// defaults. The ConfigMaps in the Installations' namespaces can not change it.
+func (r *InstallationReconciler) getNamespaceResourceBudget(ctx context.Context) (corev1.ResourceList, error) {
+	v, source := r.getOperatorSetting(ctx, "namespaceResourceBudget")
+	if v == "" {
+		return nil, nil
+	}
+
+	budget := corev1.ResourceList{}
+	for _, pair := range strings.Split(v, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 {
+			return nil, invalidSettingf("invalid namespaceResourceBudget %q in %s, must be RESOURCE=QUANTITY pairs separated by commas", v, source)
+		}
+		quantity, err := resource.ParseQuantity(parts[1])
+		if err != nil {
+			return nil, invalidSettingf("invalid namespaceResourceBudget in %s, %s is not a valid quantity for %s", source, parts[1], parts[0])
+		}
+		budget[corev1.ResourceName(parts[0])] = quantity
+	}
+	r.getLogger(ctx).V(1).Info("namespace resource budget defaulted", "source", source, "namespaceResourceBudget", v)
+	return budget, nil
+}
+
+// getAgentRequests returns the resources requested by the porter agent
+// container. Like the scheduler, a limit is used when there is no request.
+func getAgentRequests(resources corev1.ResourceRequirements) corev1.ResourceList {
+	requests := resources.Requests.DeepCopy()
+	if requests == nil {
+		requests = corev1.ResourceList{}
+	}
+	for name, limit := range resources.Limits {
+		if _, ok := requests[name]; !ok {
+			requests[name] = limit.DeepCopy()
+		}
+	}
+	return requests
+}
+
+// checkResourceBudget determines if the Installation's porter agent job fits
+// in the namespace's resource budget, along with the porter jobs that are
+// already running there. When the job would go over the budget, the
+// Installation gets the Pending condition with the OverBudget reason and the
+// job is not created. An Installation whose agentResources alone go over the
+// budget would never run, and fails with a terminal error instead.
+func (r *InstallationReconciler) checkResourceBudget(ctx context.Context, inst *porterv1.Installation) (bool, error) {
+	budget, err := r.getNamespaceResourceBudget(ctx)
+	if err != nil {
+		return false, err
+	}
+	if len(budget) == 0 {
+		return true, nil
+	}
+
+	jobs := &batchv1.JobList{}
+	err = r.List(ctx, jobs, client.InNamespace(inst.Namespace), client.MatchingLabels{"porter": "true"})
+	if err != nil {
+		return false, errors.Wrapf(err, "could not list the porter jobs in namespace %s", inst.Namespace)
+	}
+
+	projected := getAgentRequests(inst.Spec.AgentResources)
+	var tooLarge []string
+	for name, limit := range budget {
+		if requested, ok := projected[name]; ok && requested.Cmp(limit) > 0 {
+			tooLarge = append(tooLarge, fmt.Sprintf("%s %s of %s", name, requested.String(), limit.String()))
+		}
+	}
+	if len(tooLarge) > 0 {
+		sort.Strings(tooLarge)
+		return false, invalidSettingf("the agentResources of Installation %s/%s request %s, more than the namespaceResourceBudget of namespace %s",
+			inst.Namespace, inst.Name, strings.Join(tooLarge, ", "), inst.Namespace)
+	}
+
+	for _, job := range jobs.Items {
+		if isJobDone(job.Status) {
+			continue
+		}
+		for _, c := range job.Spec.Template.Spec.Containers {
+			for name, quantity := range getAgentRequests(c.Resources) {
+				total := projected[name]
+				total.Add(quantity)
+				projected[name] = total
+			}
+		}
+	}
+
+	var over []string
+	for name, limit := range budget {
+		if requested, ok := projected[name]; ok && requested.Cmp(limit) > 0 {
+			over = append(over, fmt.Sprintf("%s %s of %s", name, requested.String(), limit.String()))
+		}
+	}
+	if len(over) > 0 {
+		sort.Strings(over)
+		msg := fmt.Sprintf("Waiting for the porter jobs in namespace %s to fit in the resource budget, the job would request %s", inst.Namespace, strings.Join(over, ", "))
+		r.getLogger(ctx).Info("waiting to run Installation, namespace is over its resource budget", "reason", msg)
+		if !meta.IsStatusConditionTrue(inst.Status.Conditions, porterv1.ConditionPending) {
+			r.Recorder.Event(inst, corev1.EventTypeNormal, ReasonOverBudget, msg)
+		}
+		return false, r.setCondition(ctx, inst, porterv1.ConditionPending, metav1.ConditionTrue, ReasonOverBudget, msg)
+	}
+
+	if meta.IsStatusConditionTrue(inst.Status.Conditions, porterv1.ConditionPending) {
+		return true, r.setCondition(ctx, inst, porterv1.ConditionPending, metav1.ConditionFalse, ReasonWithinBudget, "The porter job fits in the resource budget of namespace "+inst.Namespace)
+	}
+	return true, nil
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestCheckResourceBudget(t *testing.T) {
+	runningJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "porter-other", Namespace: "test", Labels: map[string]string{"porter": "true"}},
+		Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "porter-other",
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+				Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+			},
+		}}}}},
+	}
+	doneJob := runningJob.DeepCopy()
+	doneJob.Name = "porter-done"
+	doneJob.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+
+	testcases := []struct {
+		name    string
+		budget  string
+		jobs    []client.Object
+		wantOK  bool
+		wantErr string
+	}{
+		{name: "no budget", jobs: []client.Object{runningJob}, wantOK: true},
+		{name: "within budget", budget: "cpu=2,memory=2Gi", jobs: []client.Object{runningJob, doneJob}, wantOK: true},
+		{name: "over cpu", budget: "cpu=1500m", jobs: []client.Object{runningJob}},
+		{name: "over memory limit", budget: "memory=1536Mi", jobs: []client.Object{runningJob}},
+		{name: "finished jobs are not counted", budget: "cpu=1", jobs: []client.Object{doneJob}, wantOK: true},
+		{name: "invalid", budget: "cpu=lots", wantErr: "lots is not a valid quantity for cpu"},
+		{name: "agent over budget", budget: "cpu=500m,memory=2Gi", jobs: []client.Object{runningJob}, wantErr: "request cpu 1 of 500m, more than the namespaceResourceBudget"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.AgentResources = corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1"), corev1.ResourceMemory: resource.MustParse("1Gi")},
+			}
+			objs := append([]client.Object{inst}, tc.jobs...)
+			if tc.budget != "" {
+				objs = append(objs, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: porterConfigMapName, Namespace: "porter-operator-system"},
+					Data:       map[string]string{"namespaceResourceBudget": tc.budget},
+				})
+			}
+			r := newTestReconciler(t, objs...)
+			r.OperatorNamespace = "porter-operator-system"
+
+			ok, err := r.checkResourceBudget(context.Background(), inst)
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.wantErr)))
+				_, terminal := classifyError(err)
+				g.Expect(terminal).To(BeTrue(), "a budget that can never be met should not be retried")
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(Equal(tc.wantOK))
+			cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionPending)
+			if tc.wantOK {
+				g.Expect(cond).To(BeNil())
+				return
+			}
+			g.Expect(cond).ToNot(BeNil())
+			g.Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			g.Expect(cond.Reason).To(Equal(ReasonOverBudget))
+		})
+	}
+}
+
+func TestCheckResourceBudget_ClearsPending(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Status.Conditions = []metav1.Condition{{Type: porterv1.ConditionPending, Status: metav1.ConditionTrue, Reason: ReasonOverBudget}}
+	r := newTestReconciler(t, inst)
+	r.Defaults = map[string]string{"namespaceResourceBudget": "cpu=1"}
+
+	ok, err := r.checkResourceBudget(context.Background(), inst)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ok).To(BeTrue())
+	cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionPending)
+	g.Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+	g.Expect(cond.Reason).To(Equal(ReasonWithinBudget))
+}
@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+const (
+	// bundleConfigPath is where the Installation's BundleConfigMap is mounted in the agent.
+	bundleConfigPath = "/porter-bundle"
+
+	// bundleFileName is the key in the BundleConfigMap that contains the bundle definition.
+	bundleFileName = "bundle.json"
+)
+
+// bundleDefinition is the subset of a CNAB bundle.json used by the operator.
+type bundleDefinition struct {
+	Name        string                      `json:"name"`
+	Version     string                      `json:"version"`
+	Definitions map[string]bundleSchema     `json:"definitions,omitempty"`
+	Parameters  map[string]bundleParameter  `json:"parameters,omitempty"`
+	Credentials map[string]bundleCredential `json:"credentials,omitempty"`
+	Outputs     map[string]bundleOutput     `json:"outputs,omitempty"`
+	Custom      map[string]json.RawMessage  `json:"custom,omitempty"`
+}
+
+type bundleSchema struct {
+	Default interface{} `json:"default,omitempty"`
+
+	// ContentEncoding is base64 for the files that porter passes to and from
+	// the bundle.
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+
+	// WriteOnly is set on sensitive parameters and outputs.
+	WriteOnly bool `json:"writeOnly,omitempty"`
+}
+
+type bundleOutput struct {
+	Definition string `json:"definition"`
+}
+
+type bundleParameter struct {
+	Definition string   `json:"definition"`
+	Required   bool     `json:"required,omitempty"`
+	ApplyTo    []string `json:"applyTo,omitempty"`
+}
+
+type bundleCredential struct {
+	Required bool     `json:"required,omitempty"`
+	ApplyTo  []string `json:"applyTo,omitempty"`
+}
+
+// appliesTo determines if a parameter or credential is used by the action.
+func appliesTo(applyTo []string, action string) bool {
+	if len(applyTo) == 0 {
+		return true
+	}
+	for _, a := range applyTo {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveBundle returns the definition of the bundle used by the Installation,
+// from the Installation's BundleConfigMap, or from the registry of its
+// Reference. When the definition is not available, nil is returned and the
+// pre-flight checks are skipped, leaving porter to validate the bundle's
+// inputs.
+func (r *InstallationReconciler) resolveBundle(ctx context.Context, inst *porterv1.Installation) (*bundleDefinition, error) {
+	if inst.Spec.BundleConfigMap == "" {
+		return r.getReferenceBundle(ctx, inst), nil
+	}
+
+	cm := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: inst.Spec.BundleConfigMap, Namespace: inst.Namespace}, cm)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not retrieve the bundle configmap %s/%s", inst.Namespace, inst.Spec.BundleConfigMap)
+	}
+
+	data, ok := cm.Data[bundleFileName]
+	if !ok {
+		return nil, errors.Errorf("the bundle configmap %s/%s does not contain %s", inst.Namespace, inst.Spec.BundleConfigMap, bundleFileName)
+	}
+
+	bun := &bundleDefinition{}
+	err = json.Unmarshal([]byte(data), bun)
+	return bun, errors.Wrapf(err, "could not parse %s from the bundle configmap %s/%s", bundleFileName, inst.Namespace, inst.Spec.BundleConfigMap)
+}
+
+// getReferenceBundle reads the bundle.json of the Installation's Reference
+// from its registry, with the image pull secrets of the porter agent's
+// service account, like checkBundleReference. Bundles are cached per
+// namespace. Nothing is read when resolveBundleReference is false, and a
+// bundle that can not be read is only logged, checkBundleReference reports
+// the registries that can not be reached.
+func (r *InstallationReconciler) getReferenceBundle(ctx context.Context, inst *porterv1.Installation) *bundleDefinition {
+	if inst.Spec.Reference == "" {
+		return nil
+	}
+	log := r.getLogger(ctx)
+	cfg := r.getPorterConfig(ctx, inst)
+	if resolve, err := r.getResolveBundleReference(ctx, cfg); err != nil || !resolve {
+		return nil
+	}
+
+	key := inst.Namespace + "/" + inst.Spec.Reference
+	if data, ok := r.bundleDefinitions.get(key); ok {
+		bun := &bundleDefinition{}
+		if err := json.Unmarshal([]byte(data), bun); err == nil {
+			return bun
+		}
+	}
+
+	auth, err := r.getRegistryAuth(ctx, inst.Namespace, r.getPorterAgentServiceAccount(ctx, inst, cfg))
+	if err != nil {
+		log.Info("could not read the bundle, skipping its pre-flight checks", "reference", inst.Spec.Reference, "reason", err.Error())
+		return nil
+	}
+	getBundle := r.getBundle
+	if getBundle == nil {
+		getBundle = getRegistryBundle
+	}
+	bun, err := getBundle(ctx, inst.Spec.Reference, auth)
+	if err != nil || bun == nil {
+		if err != nil {
+			log.Info("could not read the bundle, skipping its pre-flight checks", "reference", inst.Spec.Reference, "reason", err.Error())
+		}
+		return nil
+	}
+
+	if data, err := json.Marshal(bun); err == nil {
+		r.bundleDefinitions.set(key, string(data))
+	}
+	return bun
+}
+
+// getMissingInputs returns the names of the required parameters and
+// credentials for the Installation's action that are not provided.
+//
+// Named parameter and credential sets are stored in porter, so their contents
+// are unknown to the operator. When they are used, the corresponding inputs
+// are assumed to be satisfied.
+func getMissingInputs(bun *bundleDefinition, inst *porterv1.Installation, providedParams []string) (missingParams []string, missingCreds []string) {
+	action := getAction(inst)
+
+	provided := make(map[string]bool, len(providedParams))
+	usesParameterSets := false
+	for _, p := range providedParams {
+		provided[p] = true
+	}
+	for _, p := range inst.Spec.Parameters {
+		name := strings.SplitN(p, "=", 2)
+		if len(name) == 1 {
+			usesParameterSets = true
+			continue
+		}
+		provided[name[0]] = true
+	}
+
+	if !usesParameterSets {
+		for name, param := range bun.Parameters {
+			if !param.Required || !appliesTo(param.ApplyTo, action) || provided[name] {
+				continue
+			}
+			if def, ok := bun.Definitions[param.Definition]; ok && def.Default != nil {
+				continue
+			}
+			missingParams = append(missingParams, name)
+		}
+	}
+
+	if len(inst.Spec.Credentials) == 0 {
+		for name, cred := range bun.Credentials {
+			if cred.Required && appliesTo(cred.ApplyTo, action) {
+				missingCreds = append(missingCreds, name)
+			}
+		}
+	}
+
+	sort.Strings(missingParams)
+	sort.Strings(missingCreds)
+	return missingParams, missingCreds
+}
+
+// getUnknownParameters returns the names of the parameters that the bundle
+// does not declare, sorted and without duplicates.
+func getUnknownParameters(bun *bundleDefinition, names []string) []string {
+	var unknown []string
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, ok := bun.Parameters[name]; ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		unknown = append(unknown, name)
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// checkBundleInputs validates that the Installation provides the inputs
+// required by the bundle, and only parameters that the bundle declares,
+// before a job is created to run it. When inputs are missing or unknown, the
+// Installation is marked as failed and false is returned.
+func (r *InstallationReconciler) checkBundleInputs(ctx context.Context, inst *porterv1.Installation) (bool, error) {
+	bun, err := r.resolveBundle(ctx, inst)
+	if err != nil || bun == nil {
+		return err == nil, err
+	}
+
+	var refKeys []string
+	for _, ref := range inst.Spec.ParameterSetRefs {
+		keys, _, err := r.getParameterSetRefSource(ctx, inst.Namespace, ref)
+		if err != nil {
+			return false, err
+		}
+		refKeys = append(refKeys, keys...)
+	}
+	var named []string
+	for _, p := range inst.Spec.Parameters {
+		if name := strings.SplitN(p, "=", 2); len(name) == 2 {
+			named = append(named, name[0])
+		}
+	}
+	for _, p := range inst.Spec.ParametersFromInstallation {
+		named = append(named, p.Name)
+	}
+	for name := range inst.Spec.ParameterValues {
+		named = append(named, name)
+	}
+
+	// A misspelled parameter would otherwise only fail, or be ignored, in porter
+	if unknown := getUnknownParameters(bun, named); len(unknown) > 0 {
+		msg := fmt.Sprintf("Cannot run %s on bundle %s: unknown parameters: %s", getAction(inst), inst.Spec.Reference, strings.Join(unknown, ", "))
+		r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+		r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonUnknownParameters, msg)
+		return false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonUnknownParameters, msg)
+	}
+	// The objects referenced by ParameterSetRefs may be shared with other
+	// bundles, so their other keys are only reported
+	if unknown := getUnknownParameters(bun, refKeys); len(unknown) > 0 {
+		msg := fmt.Sprintf("The parameterSetRefs have keys that bundle %s does not declare as parameters: %s", inst.Spec.Reference, strings.Join(unknown, ", "))
+		r.getLogger(ctx).Info("parameter set references have unknown parameters", "parameters", unknown)
+		r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonUnknownParameters, msg)
+	}
+	refParams := append(refKeys, named...)
+
+	missingParams, missingCreds := getMissingInputs(bun, inst, refParams)
+	if len(missingParams) == 0 && len(missingCreds) == 0 {
+		return true, nil
+	}
+
+	var problems []string
+	if len(missingParams) > 0 {
+		problems = append(problems, "missing required parameters: "+strings.Join(missingParams, ", "))
+	}
+	if len(missingCreds) > 0 {
+		problems = append(problems, "missing required credentials: "+strings.Join(missingCreds, ", "))
+	}
+	msg := fmt.Sprintf("Cannot run %s on bundle %s: %s", getAction(inst), inst.Spec.Reference, strings.Join(problems, "; "))
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonMissingInputs, msg)
+
+	return false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonMissingInputs, msg)
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// getResolveBundleReference determines if bundle references are resolved in
+// their registry before the porter job is created. Defaults to true.
+func (r *InstallationReconciler) getResolveBundleReference(ctx context.Context, cfg porterConfig) (bool, error) {
+	v, source, ok := cfg.get("resolveBundleReference")
+	if !ok {
+		return true, nil
+	}
+
+	resolve, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, invalidSettingf("invalid resolveBundleReference %q in %s, must be true or false", v, source)
+	}
+	r.getLogger(ctx).Info("resolve bundle reference defaulted", "source", source, "resolveBundleReference", resolve)
+	return resolve, nil
+}
+
+// getRegistryAuth returns the registry credentials in the image pull secrets
+// of the porter agent's service account, so that bundles in private
+// registries are resolved with the credentials that the cluster pulls their
+// images with. Pull secrets that do not exist are skipped.
+func (r *InstallationReconciler) getRegistryAuth(ctx context.Context, namespace string, serviceAccount string) (registryAuth, error) {
+	if serviceAccount == "" {
+		serviceAccount = defaultServiceAccount
+	}
+	sa := &corev1.ServiceAccount{}
+	err := r.Get(ctx, types.NamespacedName{Name: serviceAccount, Namespace: namespace}, sa)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not retrieve the porter agent service account %s/%s", namespace, serviceAccount)
+	}
+
+	auth := registryAuth{}
+	for _, ref := range sa.ImagePullSecrets {
+		secret := &corev1.Secret{}
+		err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, secret)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not retrieve the image pull secret %s/%s", namespace, ref.Name)
+		}
+		creds, err := parseDockerConfig(secret)
+		if err != nil {
+			return nil, err
+		}
+		for registry, c := range creds {
+			if _, ok := auth[registry]; !ok {
+				auth[registry] = c
+			}
+		}
+	}
+	return auth, nil
+}
+
+// checkBundleReference resolves the Installation's bundle reference in its
+// registry, so that a bad reference or a missing tag is reported on the
+// Installation instead of failing in the porter job. The registry is accessed
+// with the image pull secrets of the porter agent's service account. The
+// result is recorded in the BundleResolved condition. When the registry
+// reports that the reference does not exist, an error is returned so that
+// the Installation is retried. When the registry can not be reached or
+// denies access, such as a private registry without a pull secret or a
+// plain HTTP registry, the condition is Unknown and the Installation runs
+// anyway, porter reports the failure if it can not pull the bundle either.
+// Successful resolutions are cached. Bundles from a BundleConfigMap are not
+// resolved, porter does not pull them unless the Installation uses Apply.
+func (r *InstallationReconciler) checkBundleReference(ctx context.Context, inst *porterv1.Installation, cfg porterConfig, serviceAccount string) (bool, error) {
+	if (inst.Spec.BundleConfigMap != "" && !inst.Spec.Apply) || inst.Spec.Reference == "" {
+		return true, nil
+	}
+	resolve, err := r.getResolveBundleReference(ctx, cfg)
+	if err != nil {
+		return false, err
+	}
+	if !resolve {
+		return true, nil
+	}
+
+	// Cache per namespace, the credentials to resolve the reference are
+	// from the namespace
+	key := inst.Namespace + "/" + inst.Spec.Reference
+	digest, ok := r.bundleDigests.get(key)
+	if !ok {
+		auth, err := r.getRegistryAuth(ctx, inst.Namespace, serviceAccount)
+		if err != nil {
+			return false, err
+		}
+		getDigest := r.getDigest
+		if getDigest == nil {
+			getDigest = getRegistryDigest
+		}
+		digest, err = getDigest(ctx, inst.Spec.Reference, auth)
+		if isManifestNotFound(err) {
+			msg := fmt.Sprintf("Could not resolve bundle %s: %s", inst.Spec.Reference, err)
+			r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+			r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonBundleNotResolved, msg)
+			if err := r.setCondition(ctx, inst, porterv1.ConditionBundleResolved, metav1.ConditionFalse, ReasonBundleNotResolved, msg); err != nil {
+				return false, err
+			}
+			return false, errors.Wrapf(err, "could not resolve the bundle of Installation %s/%s", inst.Namespace, inst.Name)
+		}
+		if err != nil {
+			msg := fmt.Sprintf("Could not verify bundle %s, running it anyway: %s", inst.Spec.Reference, err)
+			r.getLogger(ctx).Info("could not resolve bundle reference", "reference", inst.Spec.Reference, "reason", err.Error())
+			existing := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionBundleResolved)
+			if existing == nil || existing.Reason != ReasonBundleUnverified || existing.Message != msg {
+				r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonBundleUnverified, msg)
+			}
+			return true, r.setCondition(ctx, inst, porterv1.ConditionBundleResolved, metav1.ConditionUnknown, ReasonBundleUnverified, msg)
+		}
+		r.getLogger(ctx).Info("resolved bundle reference", "reference", inst.Spec.Reference, "digest", digest)
+		r.bundleDigests.set(key, digest)
+	}
+
+	msg := fmt.Sprintf("Resolved bundle %s to %s", inst.Spec.Reference, digest)
+	return true, r.setCondition(ctx, inst, porterv1.ConditionBundleResolved, metav1.ConditionTrue, ReasonBundleResolved, msg)
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestCheckBundleReference(t *testing.T) {
+	testcases := []struct {
+		name          string
+		bundleCM      string
+		defaults      map[string]string
+		digestErr     error
+		wantErr       bool
+		wantEvent     string
+		wantCondition metav1.ConditionStatus
+		wantLookups   int
+	}{
+		{name: "resolved", wantCondition: metav1.ConditionTrue, wantLookups: 1},
+		{name: "not found", digestErr: &manifestNotFoundError{reference: "getporter/porter-helo:v0.1.1", registry: porterv1.DockerHubRegistry}, wantErr: true, wantEvent: ReasonBundleNotResolved, wantCondition: metav1.ConditionFalse, wantLookups: 1},
+		{name: "denied", digestErr: errors.New("registry-1.docker.io denied access to getporter/porter-hello:v0.1.1"), wantEvent: ReasonBundleUnverified, wantCondition: metav1.ConditionUnknown, wantLookups: 1},
+		{name: "unreachable", digestErr: errors.New("dial tcp: lookup registry.local: no such host"), wantEvent: ReasonBundleUnverified, wantCondition: metav1.ConditionUnknown, wantLookups: 1},
+		{name: "disabled", defaults: map[string]string{"resolveBundleReference": "false"}},
+		{name: "offline bundle", bundleCM: "porter-hello-bundle"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.BundleConfigMap = tc.bundleCM
+			r := newTestReconciler(t, inst)
+			r.Defaults = tc.defaults
+			lookups := 0
+			r.getDigest = func(ctx context.Context, reference string, auth registryAuth) (string, error) {
+				lookups++
+				g.Expect(reference).To(Equal(inst.Spec.Reference))
+				return testBundleDigest, tc.digestErr
+			}
+
+			ok, err := r.checkBundleReference(context.Background(), inst, r.getPorterConfig(context.Background(), inst), "")
+			if tc.wantErr {
+				g.Expect(err).To(MatchError(ContainSubstring("was not found")))
+				g.Expect(ok).To(BeFalse())
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(ok).To(BeTrue(), "only a reference that does not exist should block the Installation")
+			}
+			if tc.wantEvent != "" {
+				g.Expect(r.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring(tc.wantEvent)))
+			}
+
+			cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionBundleResolved)
+			if tc.wantCondition == "" {
+				g.Expect(cond).To(BeNil())
+			} else {
+				g.Expect(cond).ToNot(BeNil())
+				g.Expect(cond.Status).To(Equal(tc.wantCondition))
+			}
+
+			// Only successful resolutions are cached
+			r.checkBundleReference(context.Background(), inst, r.getPorterConfig(context.Background(), inst), "")
+			if tc.digestErr != nil {
+				tc.wantLookups++
+			}
+			g.Expect(lookups).To(Equal(tc.wantLookups))
+			if tc.wantEvent == ReasonBundleUnverified {
+				g.Expect(r.Recorder.(*record.FakeRecorder).Events).ToNot(Receive(), "the same warning should not be recorded again")
+			}
+		})
+	}
+}
+
+func TestCheckBundleReference_ImagePullSecrets(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.Reference = "example.azurecr.io/porter-hello:v0.1.1"
+	config, _ := json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{
+			"https://example.azurecr.io": map[string]string{"username": "porter", "password": "secret"},
+		},
+	})
+	sa := &corev1.ServiceAccount{
+		ObjectMeta:       metav1.ObjectMeta{Name: "porter-agent", Namespace: inst.Namespace},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "missing"}, {Name: "acr"}},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "acr", Namespace: inst.Namespace},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: config},
+	}
+	// Another namespace must not use the resolution that was made with this namespace's credentials
+	other := newTestInstallation()
+	other.Namespace = "other"
+	other.Spec.Reference = inst.Spec.Reference
+	r := newTestReconciler(t, inst, other, sa, secret)
+	var gotAuth registryAuth
+	lookups := 0
+	r.getDigest = func(ctx context.Context, reference string, auth registryAuth) (string, error) {
+		lookups++
+		gotAuth = auth
+		return testBundleDigest, nil
+	}
+
+	ok, err := r.checkBundleReference(context.Background(), inst, r.getPorterConfig(context.Background(), inst), "porter-agent")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ok).To(BeTrue())
+	g.Expect(gotAuth.get("example.azurecr.io")).To(Equal(&registryCredentials{Username: "porter", Password: "secret"}))
+
+	gotAuth = nil
+	_, err = r.checkBundleReference(context.Background(), other, r.getPorterConfig(context.Background(), other), "porter-agent")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(lookups).To(Equal(2), "the resolution should not be shared with another namespace")
+	g.Expect(gotAuth).To(BeEmpty(), "the other namespace has no pull secrets")
+}
@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// checkBundleSwap stops the Installation from running a different bundle
+// than the one that is installed, which would upgrade the installation with
+// an unrelated bundle. The bundles are compared by repository, so that
+// changing the tag or digest is still an upgrade. Uninstalling is allowed, so
+// that the bundle can be uninstalled before the new one is installed, and
+// the porter.sh/allow-bundle-swap annotation allows a deliberate swap.
+func (r *InstallationReconciler) checkBundleSwap(ctx context.Context, inst *porterv1.Installation) (bool, error) {
+	installed := inst.Status.InstalledBundleReference
+	if !inst.Status.Installed || installed == "" || inst.Spec.ValidateOnly || getAction(inst) == "uninstall" {
+		return true, nil
+	}
+	if porterv1.SameBundleRepository(installed, inst.Spec.Reference) {
+		return true, nil
+	}
+	if inst.Annotations[porterv1.AnnotationAllowBundleSwap] == "true" {
+		r.getLogger(ctx).Info("running a different bundle than the installed bundle", "installed", installed, "reference", inst.Spec.Reference)
+		return true, nil
+	}
+
+	msg := fmt.Sprintf("Cannot run %s on bundle %s, bundle %s is installed. Uninstall it first, or set the %s annotation to \"true\" to run the new bundle anyway",
+		getAction(inst), inst.Spec.Reference, installed, porterv1.AnnotationAllowBundleSwap)
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonReferenceMismatch, msg)
+
+	return false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonReferenceMismatch, msg)
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestCreateJobForInstallation_BundleSwap(t *testing.T) {
+	testcases := []struct {
+		name        string
+		reference   string
+		action      string
+		installed   bool
+		allowSwap   bool
+		wantBlocked bool
+	}{
+		{name: "new version", reference: "getporter/porter-hello:v0.1.1", installed: true},
+		{name: "different bundle", reference: "getporter/wordpress:v0.1.0", installed: true, wantBlocked: true},
+		{name: "allowed swap", reference: "getporter/wordpress:v0.1.0", installed: true, allowSwap: true},
+		{name: "uninstall", reference: "getporter/wordpress:v0.1.0", action: "uninstall", installed: true},
+		{name: "not installed", reference: "getporter/wordpress:v0.1.0"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.Reference = tc.reference
+			inst.Spec.Action = tc.action
+			inst.Status.Installed = tc.installed
+			inst.Status.InstalledBundleReference = "getporter/porter-hello:v0.1.0"
+			if tc.allowSwap {
+				inst.Annotations = map[string]string{porterv1.AnnotationAllowBundleSwap: "true"}
+			}
+			jobName := makeJobName(inst)
+			r := newTestReconciler(t, inst)
+
+			g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+			jobs := &batchv1.JobList{}
+			g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+			cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+			if tc.wantBlocked {
+				g.Expect(jobs.Items).To(BeEmpty())
+				g.Expect(cond).ToNot(BeNil())
+				g.Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+				g.Expect(cond.Reason).To(Equal(ReasonReferenceMismatch))
+				g.Expect(cond.Message).To(ContainSubstring("bundle getporter/porter-hello:v0.1.0 is installed"))
+				return
+			}
+			g.Expect(jobs.Items).To(HaveLen(1))
+			g.Expect(jobs.Items[0].Annotations).To(HaveKeyWithValue(annotationReference, tc.reference))
+		})
+	}
+}
+
+func TestSetJobStatus_InstalledBundleReference(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	r := newTestReconciler(t, inst)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: makeJobName(inst), Namespace: inst.Namespace, Annotations: map[string]string{
+			annotationAction:    "install",
+			annotationReference: "getporter/porter-hello:v0.1.1",
+		}},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}},
+	}
+
+	g.Expect(r.setJobStatus(context.Background(), inst, job)).To(Succeed())
+	g.Expect(inst.Status.InstalledBundleReference).To(Equal("getporter/porter-hello:v0.1.1"))
+
+	uninstall := job.DeepCopy()
+	uninstall.Name = "hello-uninstall"
+	uninstall.Annotations[annotationAction] = "uninstall"
+	g.Expect(r.setJobStatus(context.Background(), inst, uninstall)).To(Succeed())
+	g.Expect(inst.Status.InstalledBundleReference).To(BeEmpty())
+}
@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestGetMissingInputs(t *testing.T) {
+	bun := &bundleDefinition{
+		Definitions: map[string]bundleSchema{
+			"string":         {},
+			"string-default": {Default: "default"},
+		},
+		Parameters: map[string]bundleParameter{
+			"name":      {Definition: "string", Required: true},
+			"region":    {Definition: "string-default", Required: true},
+			"optional":  {Definition: "string"},
+			"upgrading": {Definition: "string", Required: true, ApplyTo: []string{"upgrade"}},
+		},
+		Credentials: map[string]bundleCredential{
+			"kubeconfig": {Required: true},
+			"token":      {Required: true, ApplyTo: []string{"upgrade"}},
+		},
+	}
+
+	testcases := []struct {
+		name          string
+		spec          porterv1.InstallationSpec
+		refParams     []string
+		wantMissingPs []string
+		wantMissingCs []string
+	}{
+		{
+			name:          "nothing provided",
+			spec:          porterv1.InstallationSpec{Action: "install"},
+			wantMissingPs: []string{"name"},
+			wantMissingCs: []string{"kubeconfig"},
+		},
+		{
+			name:          "action specific inputs",
+			spec:          porterv1.InstallationSpec{Action: "upgrade"},
+			wantMissingPs: []string{"name", "upgrading"},
+			wantMissingCs: []string{"kubeconfig", "token"},
+		},
+		{
+			name: "all provided",
+			spec: porterv1.InstallationSpec{Action: "install", Parameters: []string{"name=porter"}, Credentials: []string{"mycreds"}},
+		},
+		{
+			name:          "provided by parameter set refs",
+			spec:          porterv1.InstallationSpec{Action: "install"},
+			refParams:     []string{"name"},
+			wantMissingCs: []string{"kubeconfig"},
+		},
+		{
+			name:          "named parameter sets are not validated",
+			spec:          porterv1.InstallationSpec{Action: "install", Parameters: []string{"myparams"}},
+			wantMissingCs: []string{"kubeconfig"},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := &porterv1.Installation{Spec: tc.spec}
+
+			missingPs, missingCs := getMissingInputs(bun, inst, tc.refParams)
+			g.Expect(missingPs).To(Equal(tc.wantMissingPs))
+			g.Expect(missingCs).To(Equal(tc.wantMissingCs))
+		})
+	}
+}
+
+func TestCheckBundleInputs_UnknownParameters(t *testing.T) {
+	bundleJSON := `{
+  "name": "hello",
+  "version": "0.1.0",
+  "definitions": {"string": {"type": "string"}},
+  "parameters": {
+    "name": {"definition": "string"},
+    "replicas": {"definition": "string"}
+  }
+}`
+
+	testcases := []struct {
+		name            string
+		parameters      []string
+		parameterValues map[string]apiextensionsv1.JSON
+		refKeys         map[string]string
+		wantOK          bool
+		wantUnknown     string
+	}{
+		{name: "declared", parameters: []string{"name=llama"}, parameterValues: map[string]apiextensionsv1.JSON{"replicas": {Raw: []byte(`3`)}}, wantOK: true},
+		{name: "misspelled parameter", parameters: []string{"nmae=llama"}, wantUnknown: "nmae"},
+		{name: "misspelled parameter value", parameterValues: map[string]apiextensionsv1.JSON{"replica": {Raw: []byte(`3`)}}, wantUnknown: "replica"},
+		{name: "named parameter set", parameters: []string{"myparams"}, wantOK: true},
+		{name: "other keys in parameter set refs", refKeys: map[string]string{"name": "llama", "color": "blue"}, wantOK: true},
+	}
+	for _, tc := range testcases {
+		for _, source := range []string{"configmap", "registry"} {
+			t.Run(tc.name+" from "+source, func(t *testing.T) {
+				g := NewWithT(t)
+				inst := newTestInstallation()
+				inst.Spec.Parameters = tc.parameters
+				inst.Spec.ParameterValues = tc.parameterValues
+				objs := []client.Object{inst}
+				if source == "configmap" {
+					inst.Spec.BundleConfigMap = "hello-bundle"
+					objs = append(objs, &corev1.ConfigMap{
+						ObjectMeta: metav1.ObjectMeta{Name: "hello-bundle", Namespace: inst.Namespace},
+						Data:       map[string]string{bundleFileName: bundleJSON},
+					})
+				}
+				if tc.refKeys != nil {
+					inst.Spec.ParameterSetRefs = []porterv1.ParameterSetReference{{Kind: "ConfigMap", Name: "shared-params"}}
+					objs = append(objs, &corev1.ConfigMap{
+						ObjectMeta: metav1.ObjectMeta{Name: "shared-params", Namespace: inst.Namespace},
+						Data:       tc.refKeys,
+					})
+				}
+				r := newTestReconciler(t, objs...)
+				if source == "registry" {
+					r.getBundle = func(ctx context.Context, reference string, auth registryAuth) (*bundleDefinition, error) {
+						bun := &bundleDefinition{}
+						return bun, json.Unmarshal([]byte(bundleJSON), bun)
+					}
+				}
+
+				ok, err := r.checkBundleInputs(context.Background(), inst)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(ok).To(Equal(tc.wantOK))
+				if tc.wantUnknown != "" {
+					cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+					g.Expect(cond).ToNot(BeNil())
+					g.Expect(cond.Reason).To(Equal(ReasonUnknownParameters))
+					g.Expect(cond.Message).To(ContainSubstring("unknown parameters: " + tc.wantUnknown))
+				}
+			})
+		}
+	}
+}
+
+func TestCheckBundleInputs_Reference(t *testing.T) {
+	testcases := []struct {
+		name        string
+		defaults    map[string]string
+		bundleErr   error
+		wantOK      bool
+		wantLookups int
+	}{
+		{name: "from the registry", wantLookups: 1},
+		{name: "registry unavailable", bundleErr: errors.New("dial tcp: lookup registry.local: no such host"), wantOK: true, wantLookups: 2},
+		{name: "resolution disabled", defaults: map[string]string{"resolveBundleReference": "false"}, wantOK: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			r := newTestReconciler(t, inst)
+			r.Defaults = tc.defaults
+			lookups := 0
+			r.getBundle = func(ctx context.Context, reference string, auth registryAuth) (*bundleDefinition, error) {
+				lookups++
+				g.Expect(reference).To(Equal(inst.Spec.Reference))
+				if tc.bundleErr != nil {
+					return nil, tc.bundleErr
+				}
+				return &bundleDefinition{
+					Definitions: map[string]bundleSchema{"string": {}},
+					Parameters:  map[string]bundleParameter{"name": {Definition: "string", Required: true}},
+				}, nil
+			}
+
+			for i := 0; i < 2; i++ {
+				ok, err := r.checkBundleInputs(context.Background(), inst)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(ok).To(Equal(tc.wantOK))
+			}
+			g.Expect(lookups).To(Equal(tc.wantLookups), "only bundles that were read should be cached")
+			if !tc.wantOK {
+				cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+				g.Expect(cond).ToNot(BeNil())
+				g.Expect(cond.Reason).To(Equal(ReasonMissingInputs))
+				g.Expect(cond.Message).To(ContainSubstring("missing required parameters: name"))
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// resolveBundleRef returns the Installation to run with the Reference and
+// default parameters of the Bundle from the catalog, when it uses BundleRef.
+// The Bundle is looked up each time that the Installation runs, so changes to
+// the catalog apply to the next run. When the Bundle does not exist, or is not
+// approved, the Installation is marked as failed and false is returned.
+func (r *InstallationReconciler) resolveBundleRef(ctx context.Context, inst *porterv1.Installation) (*porterv1.Installation, bool, error) {
+	// Check again in case the Installation was created without the webhook
+	if errs := porterv1.ValidateBundleRef(inst.Spec, field.NewPath("spec")); len(errs) > 0 {
+		ok, err := r.failBundleRef(ctx, inst, fmt.Sprintf("Invalid bundleRef: %s", errs.ToAggregate()))
+		return inst, ok, err
+	}
+	if inst.Spec.BundleRef == "" {
+		return inst, true, nil
+	}
+
+	bun := &porterv1.Bundle{}
+	err := r.Get(ctx, types.NamespacedName{Name: inst.Spec.BundleRef}, bun)
+	if apierrors.IsNotFound(err) {
+		ok, err := r.failBundleRef(ctx, inst, fmt.Sprintf("Bundle %s does not exist in the catalog", inst.Spec.BundleRef))
+		return inst, ok, err
+	}
+	if err != nil {
+		return inst, false, errors.Wrapf(err, "could not retrieve Bundle %s for Installation %s/%s", inst.Spec.BundleRef, inst.Namespace, inst.Name)
+	}
+	if !bun.Spec.Approved {
+		ok, err := r.failBundleRef(ctx, inst, fmt.Sprintf("Bundle %s is not approved", bun.Name))
+		return inst, ok, err
+	}
+
+	r.getLogger(ctx).Info("resolved bundle from the catalog", "bundle", bun.Name, "reference", bun.Spec.Reference)
+	resolved := inst.DeepCopy()
+	resolved.Spec.Reference = bun.Spec.Reference
+	resolved.Spec.ParameterValues = mergeBundleParameters(inst, bun)
+	return resolved, true, nil
+}
+
+// mergeBundleParameters returns the Installation's typed parameter values,
+// with the Bundle's defaults for the parameters that the Installation does
+// not set, either as a typed value or with NAME=VALUE.
+func mergeBundleParameters(inst *porterv1.Installation, bun *porterv1.Bundle) map[string]apiextensionsv1.JSON {
+	if len(bun.Spec.Parameters) == 0 {
+		return inst.Spec.ParameterValues
+	}
+
+	set := make(map[string]bool, len(inst.Spec.Parameters))
+	for _, p := range inst.Spec.Parameters {
+		if parts := strings.SplitN(p, "=", 2); len(parts) == 2 {
+			set[parts[0]] = true
+		}
+	}
+
+	values := make(map[string]apiextensionsv1.JSON, len(bun.Spec.Parameters)+len(inst.Spec.ParameterValues))
+	for name, value := range bun.Spec.Parameters {
+		if !set[name] {
+			values[name] = value
+		}
+	}
+	for name, value := range inst.Spec.ParameterValues {
+		values[name] = value
+	}
+	return values
+}
+
+func (r *InstallationReconciler) failBundleRef(ctx context.Context, inst *porterv1.Installation, msg string) (bool, error) {
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonInvalidBundleRef, msg)
+
+	return false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonInvalidBundleRef, msg)
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestResolveBundleRef(t *testing.T) {
+	catalog := []client.Object{
+		&porterv1.Bundle{
+			ObjectMeta: metav1.ObjectMeta{Name: "hello"},
+			Spec: porterv1.BundleSpec{
+				Reference: "getporter/porter-hello:v0.1.1",
+				Approved:  true,
+				Parameters: map[string]apiextensionsv1.JSON{
+					"name":     {Raw: []byte(`"catalog"`)},
+					"replicas": {Raw: []byte(`1`)},
+					"debug":    {Raw: []byte(`false`)},
+				},
+			},
+		},
+		&porterv1.Bundle{
+			ObjectMeta: metav1.ObjectMeta{Name: "unapproved"},
+			Spec:       porterv1.BundleSpec{Reference: "getporter/porter-hello:v0.2.0"},
+		},
+	}
+
+	testcases := []struct {
+		name          string
+		reference     string
+		bundleRef     string
+		wantOK        bool
+		wantReference string
+		wantParams    map[string]apiextensionsv1.JSON
+		wantReason    string
+	}{
+		{name: "reference", reference: "getporter/porter-hello:v0.1.1", wantOK: true, wantReference: "getporter/porter-hello:v0.1.1",
+			wantParams: map[string]apiextensionsv1.JSON{"replicas": {Raw: []byte(`3`)}}},
+		{name: "catalog", bundleRef: "hello", wantOK: true, wantReference: "getporter/porter-hello:v0.1.1",
+			wantParams: map[string]apiextensionsv1.JSON{"replicas": {Raw: []byte(`3`)}, "debug": {Raw: []byte(`false`)}}},
+		{name: "missing", bundleRef: "missing", wantReason: ReasonInvalidBundleRef},
+		{name: "not approved", bundleRef: "unapproved", wantReason: ReasonInvalidBundleRef},
+		{name: "both", reference: "getporter/porter-hello:v0.1.1", bundleRef: "hello", wantReason: ReasonInvalidBundleRef},
+		{name: "neither", wantReason: ReasonInvalidBundleRef},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.Reference = tc.reference
+			inst.Spec.BundleRef = tc.bundleRef
+			inst.Spec.Parameters = []string{"name=llama"}
+			inst.Spec.ParameterValues = map[string]apiextensionsv1.JSON{"replicas": {Raw: []byte(`3`)}}
+			r := newTestReconciler(t, append(catalog, inst)...)
+
+			got, ok, err := r.resolveBundleRef(context.Background(), inst)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(Equal(tc.wantOK))
+			if !tc.wantOK {
+				cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+				g.Expect(cond).ToNot(BeNil())
+				g.Expect(cond.Reason).To(Equal(tc.wantReason))
+				return
+			}
+			g.Expect(got.Spec.Reference).To(Equal(tc.wantReference))
+			g.Expect(got.Spec.ParameterValues).To(Equal(tc.wantParams))
+			g.Expect(inst.Spec.BundleRef).To(Equal(tc.bundleRef), "the Installation should not be modified")
+		})
+	}
+}
+
+func TestRunJob_KeepsResolvedStatus(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.Reference = ""
+	inst.Spec.BundleRef = "hello"
+	bun := &porterv1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Name: "hello"},
+		Spec:       porterv1.BundleSpec{Reference: "getporter/porter-hello:v0.1.1", Approved: true},
+	}
+	r := newTestReconciler(t, inst, bun)
+
+	_, err := r.runJob(context.Background(), makeJobName(inst), inst, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(inst.Status.ActiveJob.Name).To(Equal(makeJobName(inst)))
+
+	// Later status updates, e.g. by a scheduled run, do not conflict
+	g.Expect(r.Status().Update(context.Background(), inst)).To(Succeed())
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// getArtifactRetention returns how long the secrets and volumes of a porter
+// job are kept before they are removed. When zero, they are kept until the
+// Installation is deleted.
+func (r *InstallationReconciler) getArtifactRetention(ctx context.Context, cfg porterConfig) (time.Duration, error) {
+	v, source, ok := cfg.get("artifactRetention")
+	if !ok {
+		return 0, nil
+	}
+
+	retention, err := time.ParseDuration(v)
+	if err != nil || retention < 0 {
+		return 0, invalidSettingf("invalid artifactRetention %q in %s, must be a duration, e.g. 168h", v, source)
+	}
+	r.getLogger(ctx).Info("porter job artifact retention defaulted", "source", source, "artifactRetention", retention)
+	return retention, nil
+}
+
+// cleanupArtifacts removes the secrets and volumes left by previous porter
+// jobs of the Installation, once they are older than the artifactRetention.
+// These are labeled with the job that they were created for, both by the
+// operator and by porter's kubernetes driver, and are otherwise only removed
+// when the Installation is deleted. The artifacts of a job that is still
+// running are kept. The time until the next artifact expires is returned.
+func (r *InstallationReconciler) cleanupArtifacts(ctx context.Context, inst *porterv1.Installation) (time.Duration, error) {
+	if inst.Spec.NoCleanup {
+		return 0, nil
+	}
+	retention, err := r.getArtifactRetention(ctx, r.getPorterConfig(ctx, inst))
+	if err != nil || retention == 0 {
+		return 0, err
+	}
+
+	jobs, err := r.listJobs(ctx, inst)
+	if err != nil {
+		return 0, err
+	}
+	running := map[string]bool{}
+	if inst.Status.ActiveJob.Name != "" {
+		running[inst.Status.ActiveJob.Name] = true
+	}
+	for _, job := range jobs {
+		if !isJobDone(job.Status) {
+			running[job.Name] = true
+		}
+	}
+
+	selector := []client.ListOption{
+		client.InNamespace(inst.Namespace),
+		client.MatchingLabels{"porter": "true", "installation": inst.Name},
+		// Shared objects, such as a reused outputs volume, do not have a job
+		client.HasLabels{"job"},
+	}
+	secrets := &corev1.SecretList{}
+	if err = r.List(ctx, secrets, selector...); err != nil {
+		return 0, errors.Wrapf(err, "could not list the porter secrets for Installation %s/%s", inst.Namespace, inst.Name)
+	}
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err = r.List(ctx, pvcs, selector...); err != nil {
+		return 0, errors.Wrapf(err, "could not list the porter volumes for Installation %s/%s", inst.Namespace, inst.Name)
+	}
+
+	var artifacts []client.Object
+	for i := range secrets.Items {
+		artifacts = append(artifacts, &secrets.Items[i])
+	}
+	for i := range pvcs.Items {
+		artifacts = append(artifacts, &pvcs.Items[i])
+	}
+
+	var next time.Duration
+	for _, obj := range artifacts {
+		if running[obj.GetLabels()["job"]] {
+			continue
+		}
+		age := time.Since(obj.GetCreationTimestamp().Time)
+		if age < retention {
+			if remaining := retention - age; next == 0 || remaining < next {
+				next = remaining
+			}
+			continue
+		}
+
+		r.getLogger(ctx).Info("removing porter job artifact", "kind", getKind(obj), "name", obj.GetName(), "job", obj.GetLabels()["job"])
+		err = r.Delete(ctx, obj)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return 0, errors.Wrapf(err, "could not remove %s %s/%s left by porter job %s", getKind(obj), inst.Namespace, obj.GetName(), obj.GetLabels()["job"])
+		}
+	}
+	return next, nil
+}
+
+// getKind returns the kind of a porter job artifact, for messages.
+func getKind(obj client.Object) string {
+	if _, ok := obj.(*corev1.PersistentVolumeClaim); ok {
+		return "PersistentVolumeClaim"
+	}
+	return "Secret"
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestCleanupArtifacts(t *testing.T) {
+	newMeta := func(name string, job string, age time.Duration) metav1.ObjectMeta {
+		labels := map[string]string{"porter": "true", "installation": "hello"}
+		if job != "" {
+			labels["job"] = job
+		}
+		return metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "test",
+			Labels:            labels,
+			CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+		}
+	}
+	newObjects := func() []client.Object {
+		return []client.Object{
+			&corev1.Secret{ObjectMeta: newMeta("old-params", "hello-1", 48*time.Hour)},
+			&corev1.Secret{ObjectMeta: newMeta("new-params", "hello-2", time.Hour)},
+			&corev1.PersistentVolumeClaim{ObjectMeta: newMeta("old-volume", "hello-1", 48*time.Hour)},
+			&corev1.PersistentVolumeClaim{ObjectMeta: newMeta("reused-volume", "", 48*time.Hour)},
+			&corev1.Secret{ObjectMeta: newMeta("running-params", "hello-3", 48*time.Hour)},
+			&batchv1.Job{ObjectMeta: newMeta("hello-3", "", 48*time.Hour)},
+		}
+	}
+	exists := func(r *InstallationReconciler, obj client.Object) bool {
+		err := r.Get(context.Background(), client.ObjectKey{Namespace: "test", Name: obj.GetName()}, obj)
+		if apierrors.IsNotFound(err) {
+			return false
+		}
+		NewWithT(t).Expect(err).ToNot(HaveOccurred())
+		return true
+	}
+
+	testcases := []struct {
+		name      string
+		retention string
+		noCleanup bool
+		removed   bool
+	}{
+		{name: "not configured"},
+		{name: "past the retention", retention: "24h", removed: true},
+		{name: "no cleanup", retention: "24h", noCleanup: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.NoCleanup = tc.noCleanup
+			r := newTestReconciler(t, append(newObjects(), inst)...)
+			if tc.retention != "" {
+				r.Defaults = map[string]string{"artifactRetention": tc.retention}
+			}
+
+			after, err := r.cleanupArtifacts(context.Background(), inst)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(exists(r, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "old-params"}})).To(Equal(!tc.removed))
+			g.Expect(exists(r, &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "old-volume"}})).To(Equal(!tc.removed))
+			g.Expect(exists(r, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "new-params"}})).To(BeTrue(), "artifacts within the retention are kept")
+			g.Expect(exists(r, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "running-params"}})).To(BeTrue(), "artifacts of a running job are kept")
+			g.Expect(exists(r, &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "reused-volume"}})).To(BeTrue(), "shared artifacts are kept")
+			if tc.removed {
+				g.Expect(after).To(BeNumerically("~", 23*time.Hour, time.Minute))
+			} else {
+				g.Expect(after).To(BeZero())
+			}
+		})
+	}
+
+	t.Run("invalid retention", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		r := newTestReconciler(t, inst)
+		r.Defaults = map[string]string{"artifactRetention": "7d"}
+
+		_, err := r.cleanupArtifacts(context.Background(), inst)
+		g.Expect(err).To(MatchError(ContainSubstring(`invalid artifactRetention "7d"`)))
+	})
+}
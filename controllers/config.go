@@ -0,0 +1,355 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/yaml"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+const (
+	// porterConfigMapName is the name of the ConfigMap with the operator's configuration.
+	porterConfigMapName = "porter"
+
+	// defaultPorterRepository is the repository of the porter agent image.
+	defaultPorterRepository = "ghcr.io/getporter/porter"
+
+	// defaultPorterVersion is the version of the porter agent image.
+	defaultPorterVersion = "latest"
+
+	// defaultOutputsVolumeSize is the storage requested for the volume shared
+	// between porter and the bundle.
+	defaultOutputsVolumeSize = "64Mi"
+)
+
+// porterConfig is the operator configuration used when a setting is not
+// specified on the Installation. When a setting is defined in more than one
+// source, the first source wins. Sources are ordered by precedence:
+//
+//  1. The porter ConfigMap in the Installation's namespace.
+//  2. The porter ConfigMap in the operator's namespace.
+//  3. The defaults set with the operator's command-line flags.
+//  4. The built-in defaults.
+type porterConfig struct {
+	sources []configSource
+}
+
+type configSource struct {
+	name string
+	data map[string]string
+}
+
+// get looks up a setting, returning the value and the name of the source that defined it.
+func (c porterConfig) get(key string) (value string, source string, ok bool) {
+	for _, src := range c.sources {
+		if v, ok := src.data[key]; ok && v != "" {
+			return v, src.name, true
+		}
+	}
+	return "", "", false
+}
+
+// getOperatorSetting returns a setting that applies to the whole operator,
+// from the porter ConfigMap in the operator's namespace, or the operator's
+// defaults, and the name of its source. The ConfigMaps in the Installations'
+// namespaces can not change it.
+func (r *InstallationReconciler) getOperatorSetting(ctx context.Context, key string) (value string, source string) {
+	if r.OperatorNamespace != "" {
+		cm := &corev1.ConfigMap{}
+		err := r.Get(ctx, types.NamespacedName{Name: porterConfigMapName, Namespace: r.OperatorNamespace}, cm)
+		if err == nil && cm.Data[key] != "" {
+			return cm.Data[key], "configmap " + r.OperatorNamespace + "/" + porterConfigMapName
+		}
+	}
+	if v := r.Defaults[key]; v != "" {
+		return v, "operator defaults"
+	}
+	return "", ""
+}
+
+// getPorterConfig retrieves the operator configuration that applies to the Installation.
+func (r *InstallationReconciler) getPorterConfig(ctx context.Context, inst *porterv1.Installation) porterConfig {
+	ctx, span := r.startSpan(ctx, "getPorterConfig")
+	defer span.End()
+
+	var cfg porterConfig
+
+	namespaces := []string{inst.Namespace}
+	if r.OperatorNamespace != "" && r.OperatorNamespace != inst.Namespace {
+		namespaces = append(namespaces, r.OperatorNamespace)
+	}
+	for _, ns := range namespaces {
+		cm := &corev1.ConfigMap{}
+		err := r.Get(ctx, types.NamespacedName{Name: porterConfigMapName, Namespace: ns}, cm)
+		if err != nil {
+			r.getLogger(ctx).Info("WARN: cannot retrieve porter configmap, using default configuration", "namespace", ns, "reason", err.Error())
+			continue
+		}
+		cfg.sources = append(cfg.sources, configSource{name: "configmap " + ns + "/" + porterConfigMapName, data: cm.Data})
+	}
+
+	cfg.sources = append(cfg.sources,
+		configSource{name: "operator flags", data: r.Defaults},
+		configSource{name: "built-in defaults", data: map[string]string{
+			"porterRepository": defaultPorterRepository,
+			"porterVersion":    defaultPorterVersion,
+		}},
+	)
+	return cfg
+}
+
+// isOperatorPaused determines if the operator is paused for all
+// Installations, either with the operator's Paused flag or the paused key of
+// the porter ConfigMap in the operator's namespace. The ConfigMaps in the
+// Installations' namespaces can not pause the operator.
+func (r *InstallationReconciler) isOperatorPaused(ctx context.Context) (paused bool, source string) {
+	if r.Paused {
+		return true, "operator flags"
+	}
+	if r.OperatorNamespace == "" {
+		return false, ""
+	}
+
+	cm := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: porterConfigMapName, Namespace: r.OperatorNamespace}, cm)
+	if err != nil {
+		return false, ""
+	}
+	v, ok := cm.Data["paused"]
+	if !ok {
+		return false, ""
+	}
+	paused, err = strconv.ParseBool(v)
+	if err != nil {
+		r.getLogger(ctx).Info("WARN: ignoring invalid paused setting, must be true or false", "namespace", r.OperatorNamespace, "paused", v)
+		return false, ""
+	}
+	return paused, "configmap " + r.OperatorNamespace + "/" + porterConfigMapName
+}
+
+func (r *InstallationReconciler) getPorterImageRepository(ctx context.Context, cfg porterConfig) string {
+	porterRepository, source, _ := cfg.get("porterRepository")
+	r.getLogger(ctx).Info("porter image repository defaulted", "source", source, "repository", porterRepository)
+
+	return porterRepository
+}
+
+func (r *InstallationReconciler) getPorterImageVersion(ctx context.Context, inst *porterv1.Installation, cfg porterConfig) (porterVersion string, pullPolicy corev1.PullPolicy) {
+	log := r.getLogger(ctx)
+	if inst.Spec.PorterVersion != "" {
+		log.Info("porter image version override", "version", inst.Spec.PorterVersion)
+		// Use the version specified by the instance
+		porterVersion = inst.Spec.PorterVersion
+	} else {
+		var source string
+		porterVersion, source, _ = cfg.get("porterVersion")
+		log.Info("porter image version defaulted", "source", source, "version", porterVersion)
+	}
+
+	log.Info("resolved porter image version", "version", porterVersion)
+
+	switch inst.Spec.ImagePullPolicy {
+	case corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+		log.Info("porter image pull policy override", "pullPolicy", inst.Spec.ImagePullPolicy)
+		pullPolicy = inst.Spec.ImagePullPolicy
+	default:
+		if inst.Spec.ImagePullPolicy != "" {
+			log.Info("WARN: ignoring invalid porter image pull policy", "pullPolicy", inst.Spec.ImagePullPolicy)
+		}
+		pullPolicy = corev1.PullIfNotPresent
+		if porterVersion == "canary" || porterVersion == "latest" {
+			pullPolicy = corev1.PullAlways
+		}
+	}
+
+	return porterVersion, pullPolicy
+}
+
+func (r *InstallationReconciler) getPorterNamespace(ctx context.Context, inst *porterv1.Installation, cfg porterConfig) string {
+	log := r.getLogger(ctx)
+	if inst.Spec.PorterNamespace != "" {
+		log.Info("porter namespace override", "porterNamespace", inst.Spec.PorterNamespace)
+		return inst.Spec.PorterNamespace
+	}
+	if v, source, ok := cfg.get("porterNamespace"); ok {
+		log.Info("porter namespace defaulted", "source", source, "porterNamespace", v)
+		return v
+	}
+	return ""
+}
+
+func (r *InstallationReconciler) getPriorityClassName(ctx context.Context, inst *porterv1.Installation, cfg porterConfig) string {
+	log := r.getLogger(ctx)
+	if inst.Spec.PriorityClassName != "" {
+		log.Info("porter agent priority class override", "priorityClassName", inst.Spec.PriorityClassName)
+		return inst.Spec.PriorityClassName
+	}
+	if v, source, ok := cfg.get("priorityClassName"); ok {
+		log.Info("porter agent priority class defaulted", "source", source, "priorityClassName", v)
+		return v
+	}
+	return ""
+}
+
+func (r *InstallationReconciler) getPorterAgentServiceAccount(ctx context.Context, inst *porterv1.Installation, cfg porterConfig) string {
+	log := r.getLogger(ctx)
+	serviceAccount := ""
+	if inst.Spec.ServiceAccount != "" {
+		log.Info("porter agent service account override", "serviceAccount", inst.Spec.ServiceAccount)
+		// Use the version specified by the instance
+		serviceAccount = inst.Spec.ServiceAccount
+	} else if v, source, ok := cfg.get("serviceAccount"); ok {
+		// Check if the namespace has a default service account configured
+		log.Info("porter agent service account defaulted", "source", source, "serviceAccount", v)
+		serviceAccount = v
+	}
+
+	log.Info("resolved porter agent service account", "serviceAccount", serviceAccount)
+
+	return serviceAccount
+}
+
+func (r *InstallationReconciler) getOutputsVolumeSettings(ctx context.Context, inst *porterv1.Installation, cfg porterConfig) (storageClass *string, accessModes []corev1.PersistentVolumeAccessMode, err error) {
+	log := r.getLogger(ctx)
+	if inst.Spec.OutputsVolumeStorageClass != "" {
+		log.Info("porter outputs volume storage class override", "storageClass", inst.Spec.OutputsVolumeStorageClass)
+		storageClass = pointer.StringPtr(inst.Spec.OutputsVolumeStorageClass)
+	} else if v, source, ok := cfg.get("outputsVolumeStorageClass"); ok {
+		log.Info("porter outputs volume storage class defaulted", "source", source, "storageClass", v)
+		storageClass = pointer.StringPtr(v)
+	}
+
+	if len(inst.Spec.OutputsVolumeAccessModes) > 0 {
+		log.Info("porter outputs volume access modes override", "accessModes", inst.Spec.OutputsVolumeAccessModes)
+		accessModes = inst.Spec.OutputsVolumeAccessModes
+	} else if v, source, ok := cfg.get("outputsVolumeAccessModes"); ok {
+		log.Info("porter outputs volume access modes defaulted", "source", source, "accessModes", v)
+		for _, mode := range strings.Split(v, ",") {
+			accessModes = append(accessModes, corev1.PersistentVolumeAccessMode(strings.TrimSpace(mode)))
+		}
+	} else {
+		accessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	}
+
+	for _, mode := range accessModes {
+		switch mode {
+		case corev1.ReadWriteOnce, corev1.ReadOnlyMany, corev1.ReadWriteMany:
+		default:
+			return nil, nil, invalidSettingf("invalid outputs volume access mode %q for Installation %s/%s, must be one of %s, %s or %s",
+				mode, inst.Namespace, inst.Name, corev1.ReadWriteOnce, corev1.ReadOnlyMany, corev1.ReadWriteMany)
+		}
+	}
+
+	log.Info("resolved porter outputs volume settings", "storageClass", storageClass, "accessModes", accessModes)
+
+	return storageClass, accessModes, nil
+}
+
+// getOutputsVolumeSize returns the storage requested for the volume shared
+// between porter and the bundle, from the outputsVolumeSize setting, e.g. 1Gi.
+func (r *InstallationReconciler) getOutputsVolumeSize(ctx context.Context, cfg porterConfig) (resource.Quantity, error) {
+	v, source, ok := cfg.get("outputsVolumeSize")
+	if !ok {
+		return resource.MustParse(defaultOutputsVolumeSize), nil
+	}
+
+	size, err := resource.ParseQuantity(v)
+	if err != nil {
+		return resource.Quantity{}, invalidSettingf("invalid outputsVolumeSize %q in %s, must be a quantity, e.g. 1Gi", v, source)
+	}
+	r.getLogger(ctx).Info("porter outputs volume size defaulted", "source", source, "outputsVolumeSize", v)
+	return size, nil
+}
+
+func (r *InstallationReconciler) getJobTTLSecondsAfterFinished(ctx context.Context, inst *porterv1.Installation, cfg porterConfig) (*int32, error) {
+	if inst.Spec.NoCleanup {
+		r.getLogger(ctx).Info("keeping the porter agent job after it finishes because noCleanup is set")
+		return nil, nil
+	}
+
+	v, source, ok := cfg.get("jobTTLSecondsAfterFinished")
+	if !ok {
+		return nil, nil
+	}
+
+	ttl, err := strconv.ParseInt(v, 10, 32)
+	if err != nil || ttl < 0 {
+		return nil, invalidSettingf("invalid jobTTLSecondsAfterFinished %q in %s, must be a number of seconds", v, source)
+	}
+	r.getLogger(ctx).Info("porter agent job ttl defaulted", "source", source, "ttlSecondsAfterFinished", ttl)
+	return pointer.Int32Ptr(int32(ttl)), nil
+}
+
+// managedJobLabels are the labels that the operator sets on porter jobs and
+// their pods to find them again, which the jobLabels can not override.
+var managedJobLabels = map[string]bool{
+	"porter":             true,
+	"installation":       true,
+	"job":                true,
+	"job-name":           true,
+	"controller-uid":     true,
+	labelDriftCheck:      true,
+	labelReconcileAction: true,
+}
+
+// getJobLabels returns the extra labels for the porter agent job and pod,
+// from the comma separated KEY=VALUE pairs of the jobLabels setting, e.g.
+// team=blue,cost-center=42.
+func (r *InstallationReconciler) getJobLabels(ctx context.Context, cfg porterConfig) (map[string]string, error) {
+	v, source, ok := cfg.get("jobLabels")
+	if !ok {
+		return nil, nil
+	}
+
+	labels := map[string]string{}
+	for _, pair := range strings.Split(v, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 {
+			return nil, invalidSettingf("invalid jobLabels %q in %s, must be KEY=VALUE pairs separated by commas", v, source)
+		}
+		key, value := parts[0], parts[1]
+		if managedJobLabels[key] {
+			return nil, invalidSettingf("invalid jobLabels in %s, the %s label is managed by the operator", source, key)
+		}
+		errs := append(validation.IsQualifiedName(key), validation.IsValidLabelValue(value)...)
+		if len(errs) > 0 {
+			return nil, invalidSettingf("invalid jobLabels in %s, %s=%s is not a valid label: %s", source, key, value, strings.Join(errs, ", "))
+		}
+		labels[key] = value
+	}
+	r.getLogger(ctx).Info("porter agent job labels defaulted", "source", source, "labels", labels)
+	return labels, nil
+}
+
+func (r *InstallationReconciler) getTopologySpreadConstraints(ctx context.Context, inst *porterv1.Installation, cfg porterConfig) ([]corev1.TopologySpreadConstraint, error) {
+	constraints := inst.Spec.TopologySpreadConstraints
+	source := "the Installation"
+	if len(constraints) > 0 {
+		r.getLogger(ctx).Info("porter agent topology spread constraints override")
+	} else if v, src, ok := cfg.get("topologySpreadConstraints"); ok {
+		r.getLogger(ctx).Info("porter agent topology spread constraints defaulted", "source", src)
+		source = src
+		err := yaml.Unmarshal([]byte(v), &constraints)
+		if err != nil {
+			return nil, newTerminalError(ReasonInvalidSetting, errors.Wrapf(err, "invalid topologySpreadConstraints in %s", source))
+		}
+	}
+
+	// Validate again in case the Installation was created without the webhook
+	errs := porterv1.ValidateTopologySpreadConstraints(constraints, field.NewPath("topologySpreadConstraints"))
+	if len(errs) > 0 {
+		return nil, errors.Wrapf(errs.ToAggregate(), "invalid topologySpreadConstraints in %s", source)
+	}
+
+	return constraints, nil
+}
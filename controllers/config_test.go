@@ -0,0 +1,360 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestGetTopologySpreadConstraints(t *testing.T) {
+	zones := corev1.TopologySpreadConstraint{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: corev1.ScheduleAnyway}
+
+	testcases := []struct {
+		name      string
+		spec      []corev1.TopologySpreadConstraint
+		configMap string
+		want      []corev1.TopologySpreadConstraint
+		wantErr   string
+	}{
+		{name: "not set"},
+		{name: "spec", spec: []corev1.TopologySpreadConstraint{zones}, configMap: "invalid", want: []corev1.TopologySpreadConstraint{zones}},
+		{name: "configmap", configMap: "- maxSkew: 1\n  topologyKey: topology.kubernetes.io/zone\n  whenUnsatisfiable: ScheduleAnyway\n", want: []corev1.TopologySpreadConstraint{zones}},
+		{name: "invalid spec", spec: []corev1.TopologySpreadConstraint{{TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: corev1.DoNotSchedule}}, wantErr: "invalid topologySpreadConstraints in the Installation"},
+		{name: "invalid yaml", configMap: "maxSkew: 1", wantErr: "invalid topologySpreadConstraints in configmap"},
+		{name: "invalid maxSkew", configMap: "- maxSkew: 0\n  topologyKey: topology.kubernetes.io/zone\n  whenUnsatisfiable: ScheduleAnyway\n", wantErr: "must be greater than zero"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			r := &InstallationReconciler{Log: ctrl.Log.WithName("test")}
+			inst := &porterv1.Installation{Spec: porterv1.InstallationSpec{TopologySpreadConstraints: tc.spec}}
+			cfg := porterConfig{sources: []configSource{{name: "configmap", data: map[string]string{"topologySpreadConstraints": tc.configMap}}}}
+
+			got, err := r.getTopologySpreadConstraints(context.Background(), inst, cfg)
+			if tc.wantErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tc.wantErr))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tc.want))
+		})
+	}
+}
+
+func TestGetJobTTLSecondsAfterFinished(t *testing.T) {
+	testcases := []struct {
+		name      string
+		noCleanup bool
+		configMap string
+		want      *int32
+		wantErr   string
+	}{
+		{name: "not set"},
+		{name: "configmap", configMap: "300", want: pointer.Int32Ptr(300)},
+		{name: "no cleanup", noCleanup: true, configMap: "300"},
+		{name: "invalid", configMap: "5m", wantErr: `invalid jobTTLSecondsAfterFinished "5m" in configmap`},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			r := &InstallationReconciler{Log: ctrl.Log.WithName("test")}
+			inst := &porterv1.Installation{Spec: porterv1.InstallationSpec{NoCleanup: tc.noCleanup}}
+			cfg := porterConfig{sources: []configSource{{name: "configmap", data: map[string]string{"jobTTLSecondsAfterFinished": tc.configMap}}}}
+
+			got, err := r.getJobTTLSecondsAfterFinished(context.Background(), inst, cfg)
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tc.want))
+		})
+	}
+}
+
+func TestGetPriorityClassName(t *testing.T) {
+	testcases := []struct {
+		name      string
+		spec      string
+		configMap string
+		want      string
+	}{
+		{name: "not set"},
+		{name: "configmap", configMap: "porter-low", want: "porter-low"},
+		{name: "override", spec: "porter-critical", configMap: "porter-low", want: "porter-critical"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			r := &InstallationReconciler{Log: ctrl.Log.WithName("test")}
+			inst := &porterv1.Installation{Spec: porterv1.InstallationSpec{PriorityClassName: tc.spec}}
+			cfg := porterConfig{sources: []configSource{{name: "configmap", data: map[string]string{"priorityClassName": tc.configMap}}}}
+
+			g.Expect(r.getPriorityClassName(context.Background(), inst, cfg)).To(Equal(tc.want))
+		})
+	}
+}
+
+func TestGetOutputsVolumeSettings(t *testing.T) {
+	testcases := []struct {
+		name             string
+		specClass        string
+		specModes        []corev1.PersistentVolumeAccessMode
+		namespace        map[string]string
+		operator         map[string]string
+		wantStorageClass *string
+		wantAccessModes  []corev1.PersistentVolumeAccessMode
+		wantErr          string
+	}{
+		{name: "not set", wantAccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}},
+		{
+			name:             "operator configmap",
+			operator:         map[string]string{"outputsVolumeStorageClass": "standard"},
+			wantStorageClass: pointer.StringPtr("standard"),
+			wantAccessModes:  []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+		},
+		{
+			name:             "namespace configmap",
+			namespace:        map[string]string{"outputsVolumeStorageClass": "fast"},
+			operator:         map[string]string{"outputsVolumeStorageClass": "standard"},
+			wantStorageClass: pointer.StringPtr("fast"),
+			wantAccessModes:  []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+		},
+		{
+			name:             "spec",
+			specClass:        "premium",
+			specModes:        []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+			namespace:        map[string]string{"outputsVolumeStorageClass": "fast", "outputsVolumeAccessModes": "ReadOnlyMany"},
+			wantStorageClass: pointer.StringPtr("premium"),
+			wantAccessModes:  []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+		},
+		{
+			name:            "comma-separated access modes",
+			operator:        map[string]string{"outputsVolumeAccessModes": "ReadWriteOnce, ReadWriteMany"},
+			wantAccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce, corev1.ReadWriteMany},
+		},
+		{
+			name:     "invalid configmap access mode",
+			operator: map[string]string{"outputsVolumeAccessModes": "ReadWriteOnce,ReadWriteAll"},
+			wantErr:  `invalid outputs volume access mode "ReadWriteAll" for Installation test/hello`,
+		},
+		{
+			name:      "invalid spec access mode",
+			specModes: []corev1.PersistentVolumeAccessMode{"ReadWriteOncePod"},
+			wantErr:   `invalid outputs volume access mode "ReadWriteOncePod" for Installation test/hello`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.OutputsVolumeStorageClass = tc.specClass
+			inst.Spec.OutputsVolumeAccessModes = tc.specModes
+			var objs []client.Object
+			if tc.namespace != nil {
+				objs = append(objs, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: porterConfigMapName, Namespace: inst.Namespace}, Data: tc.namespace})
+			}
+			if tc.operator != nil {
+				objs = append(objs, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: porterConfigMapName, Namespace: "porter-operator-system"}, Data: tc.operator})
+			}
+			r := newTestReconciler(t, objs...)
+			r.OperatorNamespace = "porter-operator-system"
+
+			cfg := r.getPorterConfig(context.Background(), inst)
+			storageClass, accessModes, err := r.getOutputsVolumeSettings(context.Background(), inst, cfg)
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(storageClass).To(Equal(tc.wantStorageClass))
+			g.Expect(accessModes).To(Equal(tc.wantAccessModes))
+		})
+	}
+}
+
+func TestGetPorterImageVersion(t *testing.T) {
+	testcases := []struct {
+		name           string
+		spec           string
+		configMap      string
+		pullPolicy     corev1.PullPolicy
+		wantVersion    string
+		wantPullPolicy corev1.PullPolicy
+	}{
+		{name: "pinned", configMap: "v1.0.0", wantVersion: "v1.0.0", wantPullPolicy: corev1.PullIfNotPresent},
+		{name: "latest", configMap: "latest", wantVersion: "latest", wantPullPolicy: corev1.PullAlways},
+		{name: "canary", spec: "canary", configMap: "v1.0.0", wantVersion: "canary", wantPullPolicy: corev1.PullAlways},
+		{name: "override pinned", configMap: "v1.0.0", pullPolicy: corev1.PullAlways, wantVersion: "v1.0.0", wantPullPolicy: corev1.PullAlways},
+		{name: "override latest", configMap: "latest", pullPolicy: corev1.PullNever, wantVersion: "latest", wantPullPolicy: corev1.PullNever},
+		{name: "invalid override", configMap: "latest", pullPolicy: "Sometimes", wantVersion: "latest", wantPullPolicy: corev1.PullAlways},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			r := &InstallationReconciler{Log: ctrl.Log.WithName("test")}
+			inst := &porterv1.Installation{Spec: porterv1.InstallationSpec{PorterVersion: tc.spec, ImagePullPolicy: tc.pullPolicy}}
+			cfg := porterConfig{sources: []configSource{{name: "configmap", data: map[string]string{"porterVersion": tc.configMap}}}}
+
+			version, pullPolicy := r.getPorterImageVersion(context.Background(), inst, cfg)
+			g.Expect(version).To(Equal(tc.wantVersion))
+			g.Expect(pullPolicy).To(Equal(tc.wantPullPolicy))
+		})
+	}
+}
+
+func TestGetPorterConfig_Defaults(t *testing.T) {
+	testcases := []struct {
+		name           string
+		spec           string
+		namespace      map[string]string
+		operator       map[string]string
+		flags          map[string]string
+		wantVersion    string
+		wantRepository string
+	}{
+		{name: "built-in", wantVersion: "latest", wantRepository: "ghcr.io/getporter/porter"},
+		{
+			name:           "flags",
+			flags:          map[string]string{"porterVersion": "v1.0.0", "porterRepository": "example.com/porter"},
+			wantVersion:    "v1.0.0",
+			wantRepository: "example.com/porter",
+		},
+		{
+			name:           "unset flags",
+			flags:          map[string]string{"porterVersion": "", "porterRepository": ""},
+			wantVersion:    "latest",
+			wantRepository: "ghcr.io/getporter/porter",
+		},
+		{
+			name:           "operator configmap",
+			operator:       map[string]string{"porterVersion": "v1.1.0"},
+			flags:          map[string]string{"porterVersion": "v1.0.0", "porterRepository": "example.com/porter"},
+			wantVersion:    "v1.1.0",
+			wantRepository: "example.com/porter",
+		},
+		{
+			name:           "namespace configmap",
+			namespace:      map[string]string{"porterVersion": "v1.2.0", "porterRepository": "example.com/team/porter"},
+			operator:       map[string]string{"porterVersion": "v1.1.0"},
+			flags:          map[string]string{"porterVersion": "v1.0.0", "porterRepository": "example.com/porter"},
+			wantVersion:    "v1.2.0",
+			wantRepository: "example.com/team/porter",
+		},
+		{
+			name:           "spec",
+			spec:           "v1.3.0",
+			namespace:      map[string]string{"porterVersion": "v1.2.0"},
+			flags:          map[string]string{"porterVersion": "v1.0.0"},
+			wantVersion:    "v1.3.0",
+			wantRepository: "ghcr.io/getporter/porter",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.PorterVersion = tc.spec
+			var objs []client.Object
+			if tc.namespace != nil {
+				objs = append(objs, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: porterConfigMapName, Namespace: inst.Namespace}, Data: tc.namespace})
+			}
+			if tc.operator != nil {
+				objs = append(objs, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: porterConfigMapName, Namespace: "porter-operator-system"}, Data: tc.operator})
+			}
+			r := newTestReconciler(t, objs...)
+			r.OperatorNamespace = "porter-operator-system"
+			r.Defaults = tc.flags
+
+			cfg := r.getPorterConfig(context.Background(), inst)
+			version, _ := r.getPorterImageVersion(context.Background(), inst, cfg)
+			g.Expect(version).To(Equal(tc.wantVersion))
+			g.Expect(r.getPorterImageRepository(context.Background(), cfg)).To(Equal(tc.wantRepository))
+		})
+	}
+}
+
+func TestCreateJobForInstallation_DefaultPorterImage(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst)
+	r.Defaults = map[string]string{"porterVersion": "v1.0.0", "porterRepository": "example.com/porter"}
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	g.Expect(job.Spec.Template.Spec.Containers[0].Image).To(Equal("example.com/porter:kubernetes-v1.0.0"))
+}
+
+func TestGetPorterNamespace(t *testing.T) {
+	testcases := []struct {
+		name      string
+		spec      string
+		configMap string
+		want      string
+	}{
+		{name: "not set"},
+		{name: "configmap", configMap: "dev", want: "dev"},
+		{name: "override", spec: "prod", configMap: "dev", want: "prod"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			r := &InstallationReconciler{Log: ctrl.Log.WithName("test")}
+			inst := &porterv1.Installation{Spec: porterv1.InstallationSpec{PorterNamespace: tc.spec}}
+			cfg := porterConfig{sources: []configSource{{name: "configmap", data: map[string]string{"porterNamespace": tc.configMap}}}}
+
+			g.Expect(r.getPorterNamespace(context.Background(), inst, cfg)).To(Equal(tc.want))
+		})
+	}
+}
+
+func TestGetJobLabels(t *testing.T) {
+	testcases := []struct {
+		name    string
+		value   string
+		want    map[string]string
+		wantErr string
+	}{
+		{name: "not set"},
+		{name: "labels", value: "team=blue, example.com/cost-center=42", want: map[string]string{"team": "blue", "example.com/cost-center": "42"}},
+		{name: "not a pair", value: "team", wantErr: "must be KEY=VALUE pairs"},
+		{name: "managed label", value: "installation=other", wantErr: "the installation label is managed by the operator"},
+		{name: "invalid value", value: "team=blue green", wantErr: "team=blue green is not a valid label"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			r := &InstallationReconciler{Log: ctrl.Log.WithName("test")}
+			cfg := porterConfig{sources: []configSource{{name: "configmap", data: map[string]string{"jobLabels": tc.value}}}}
+
+			got, err := r.getJobLabels(context.Background(), cfg)
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tc.want))
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// resolveDefaultAction returns a copy of the Installation that runs the
+// defaultAction from the porter ConfigMaps, when the Installation does not set
+// an Action. Otherwise the Installation is returned unchanged, and its action
+// is inferred by getAction. The defaultAction can not be uninstall, so that a
+// namespace default never removes bundles.
+func (r *InstallationReconciler) resolveDefaultAction(ctx context.Context, inst *porterv1.Installation) (*porterv1.Installation, error) {
+	if inst.Spec.Action != "" || inst.Spec.Apply || inst.Spec.ValidateOnly {
+		return inst, nil
+	}
+
+	cfg := r.getPorterConfig(ctx, inst)
+	action, source, ok := cfg.get("defaultAction")
+	if !ok || action == "" {
+		return inst, nil
+	}
+	if action == "uninstall" {
+		return inst, invalidSettingf("invalid defaultAction %q in %s, the default action can not uninstall the bundle", action, source)
+	}
+	if strings.ContainsAny(action, " \t\n") {
+		return inst, invalidSettingf("invalid defaultAction %q in %s, must be the name of a bundle action", action, source)
+	}
+
+	r.getLogger(ctx).Info("porter action defaulted", "source", source, "action", action)
+	defaulted := inst.DeepCopy()
+	defaulted.Spec.Action = action
+	return defaulted, nil
+}
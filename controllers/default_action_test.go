@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestResolveDefaultAction(t *testing.T) {
+	testcases := []struct {
+		name          string
+		action        string
+		apply         bool
+		defaultAction string
+		want          string
+		wantErr       string
+	}{
+		{name: "no default", want: ""},
+		{name: "default", defaultAction: "upgrade", want: "upgrade"},
+		{name: "spec wins", action: "install", defaultAction: "upgrade", want: "install"},
+		{name: "custom action", defaultAction: "deploy", want: "deploy"},
+		{name: "apply", apply: true, defaultAction: "upgrade", want: ""},
+		{name: "uninstall", defaultAction: "uninstall", wantErr: "can not uninstall the bundle"},
+		{name: "invalid", defaultAction: "up grade", wantErr: "must be the name of a bundle action"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.Action = tc.action
+			inst.Spec.Apply = tc.apply
+			r := newTestReconciler(t, inst, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: porterConfigMapName, Namespace: inst.Namespace},
+				Data:       map[string]string{"defaultAction": tc.defaultAction},
+			})
+
+			run, err := r.resolveDefaultAction(context.Background(), inst)
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.wantErr)))
+				_, terminal := classifyError(err)
+				g.Expect(terminal).To(BeTrue(), "an invalid setting should not be retried")
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(run.Spec.Action).To(Equal(tc.want))
+			g.Expect(inst.Spec.Action).To(Equal(tc.action), "the Installation should not be modified")
+		})
+	}
+}
+
+func TestRunJob_DefaultAction(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.Action = ""
+	inst.Status.Installed = true
+	r := newTestReconciler(t, inst)
+	r.OperatorNamespace = "porter-operator"
+	r.Defaults = map[string]string{"defaultAction": "deploy"}
+	jobName := makeJobName(inst)
+
+	_, err := r.runJob(context.Background(), jobName, inst, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	g.Expect(job.Spec.Template.Spec.Containers[0].Args).To(ContainElement("--action=deploy"))
+	g.Expect(job.Annotations).To(HaveKeyWithValue(annotationAction, "deploy"))
+}
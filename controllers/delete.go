@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// reconcileFinalizer adds the uninstall finalizer to Installations that
+// uninstall the bundle when they are deleted, and removes it when the
+// setting is turned off.
+func (r *InstallationReconciler) reconcileFinalizer(ctx context.Context, inst *porterv1.Installation) error {
+	hasFinalizer := controllerutil.ContainsFinalizer(inst, porterv1.FinalizerUninstall)
+	if inst.Spec.UninstallOnDelete == hasFinalizer {
+		return nil
+	}
+
+	if inst.Spec.UninstallOnDelete {
+		controllerutil.AddFinalizer(inst, porterv1.FinalizerUninstall)
+	} else {
+		controllerutil.RemoveFinalizer(inst, porterv1.FinalizerUninstall)
+	}
+	err := r.Update(ctx, inst)
+	return errors.Wrapf(err, "could not update the finalizers of Installation %s/%s", inst.Namespace, inst.Name)
+}
+
+// reconcileDelete uninstalls the bundle of a deleted Installation. The
+// finalizer is only removed once the uninstall job succeeds, so that an
+// Installation whose bundle could not be uninstalled stays visible.
+func (r *InstallationReconciler) reconcileDelete(ctx context.Context, inst *porterv1.Installation) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(inst, porterv1.FinalizerUninstall) {
+		return ctrl.Result{}, nil
+	}
+
+	if inst.IsForceDeleted() {
+		r.getLogger(ctx).Info("removing Installation without uninstalling the bundle")
+		r.Recorder.Event(inst, corev1.EventTypeNormal, ReasonForceDeleted, "Removed the Installation without uninstalling the bundle")
+		return ctrl.Result{}, r.removeFinalizer(ctx, inst)
+	}
+
+	job := &batchv1.Job{}
+	jobName, err := r.getJobName(ctx, inst, makeUninstallJobName(inst))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	err = r.Get(ctx, types.NamespacedName{Name: jobName, Namespace: inst.Namespace}, job)
+	jobExists := !apierrors.IsNotFound(err)
+	if err != nil && jobExists {
+		return ctrl.Result{}, errors.Wrapf(err, "could not query for the uninstall job %s/%s", inst.Namespace, jobName)
+	}
+	if !jobExists || !isJobDone(job.Status) {
+		// Jobs can not be created in a namespace that is being deleted, and
+		// the finalizer would keep the namespace from being removed
+		result, terminating, err := r.reconcileNamespaceTerminating(ctx, inst, jobExists)
+		if err != nil || terminating {
+			return result, err
+		}
+	}
+	if !jobExists {
+		jobs, err := r.listJobs(ctx, inst)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if activeJob := getActiveJob(jobs); activeJob != nil {
+			r.getLogger(ctx).Info("waiting for porter job to complete before uninstalling Installation", "job", activeJob.Name)
+			return ctrl.Result{RequeueAfter: activeJobRequeueDelay}, nil
+		}
+
+		uninstall := inst.DeepCopy()
+		uninstall.Spec.Action = "uninstall"
+		// porter installation apply does not uninstall bundles
+		uninstall.Spec.Apply = false
+		return r.runJob(ctx, jobName, uninstall, nil)
+	}
+
+	err = r.setJobStatus(ctx, inst, job)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !isJobDone(job.Status) {
+		return ctrl.Result{}, nil
+	}
+
+	if inst.Status.Phase == porterv1.PhaseFailed {
+		msg := fmt.Sprintf("Could not uninstall the bundle, porter job %s failed. Set the %s annotation to true to remove the Installation without uninstalling the bundle", job.Name, porterv1.AnnotationForceDelete)
+		r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonUninstallFailed, msg)
+		return ctrl.Result{}, r.setCondition(ctx, inst, porterv1.ConditionDeletionFailed, metav1.ConditionTrue, ReasonUninstallFailed, msg)
+	}
+
+	r.getLogger(ctx).Info("uninstalled Installation")
+	return ctrl.Result{}, r.removeFinalizer(ctx, inst)
+}
+
+// getNamespaceDeletionTimeout returns how long a running uninstall job is
+// given to finish once the Installation's namespace is being deleted.
+func (r *InstallationReconciler) getNamespaceDeletionTimeout(ctx context.Context, cfg porterConfig) (time.Duration, error) {
+	v, source, ok := cfg.get("namespaceDeletionTimeout")
+	if !ok {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(v)
+	if err != nil || timeout < 0 {
+		return 0, invalidSettingf("invalid namespaceDeletionTimeout %q in %s, must be a duration, e.g. 5m", v, source)
+	}
+	r.getLogger(ctx).Info("namespace deletion timeout defaulted", "source", source, "namespaceDeletionTimeout", timeout)
+	return timeout, nil
+}
+
+// reconcileNamespaceTerminating removes the finalizer from an Installation
+// whose namespace is being deleted, without uninstalling the bundle, so that
+// the namespace can finish deleting. An uninstall job that is already running
+// is given until the namespaceDeletionTimeout, counted from when the namespace
+// was deleted, to finish. Returns false when the namespace is not being
+// deleted.
+func (r *InstallationReconciler) reconcileNamespaceTerminating(ctx context.Context, inst *porterv1.Installation, jobRunning bool) (ctrl.Result, bool, error) {
+	ns := &corev1.Namespace{}
+	err := r.Get(ctx, types.NamespacedName{Name: inst.Namespace}, ns)
+	if apierrors.IsNotFound(err) {
+		return ctrl.Result{}, false, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, false, errors.Wrapf(err, "could not retrieve the namespace %s", inst.Namespace)
+	}
+	if ns.DeletionTimestamp.IsZero() && ns.Status.Phase != corev1.NamespaceTerminating {
+		return ctrl.Result{}, false, nil
+	}
+
+	log := r.getLogger(ctx)
+	if jobRunning {
+		timeout, err := r.getNamespaceDeletionTimeout(ctx, r.getPorterConfig(ctx, inst))
+		if err != nil {
+			return ctrl.Result{}, true, err
+		}
+		deleted := time.Now()
+		if ns.DeletionTimestamp != nil {
+			deleted = ns.DeletionTimestamp.Time
+		}
+		if wait := time.Until(deleted.Add(timeout)); wait > 0 {
+			log.Info("waiting for the uninstall job to complete before the namespace is deleted", "namespaceDeletionTimeout", timeout)
+			return ctrl.Result{RequeueAfter: wait}, true, nil
+		}
+	}
+
+	msg := fmt.Sprintf("Removed the Installation without uninstalling the bundle, the namespace %s is being deleted", inst.Namespace)
+	log.Info("removing Installation without uninstalling the bundle, the namespace is being deleted")
+	r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonNamespaceTerminating, msg)
+	err = r.setCondition(ctx, inst, porterv1.ConditionDeletionFailed, metav1.ConditionTrue, ReasonNamespaceTerminating, msg)
+	if err != nil {
+		return ctrl.Result{}, true, err
+	}
+	return ctrl.Result{}, true, r.removeFinalizer(ctx, inst)
+}
+
+func (r *InstallationReconciler) removeFinalizer(ctx context.Context, inst *porterv1.Installation) error {
+	controllerutil.RemoveFinalizer(inst, porterv1.FinalizerUninstall)
+	err := r.Update(ctx, inst)
+	return errors.Wrapf(err, "could not remove the finalizer from Installation %s/%s", inst.Namespace, inst.Name)
+}
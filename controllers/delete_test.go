@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func newDeletedInstallation() *porterv1.Installation {
+	inst := newTestInstallation()
+	inst.Spec.UninstallOnDelete = true
+	inst.Finalizers = []string{porterv1.FinalizerUninstall}
+	now := metav1.Now()
+	inst.DeletionTimestamp = &now
+	return inst
+}
+
+func reconcileInstallation(t *testing.T, r *InstallationReconciler, inst *porterv1.Installation) *porterv1.Installation {
+	g := NewWithT(t)
+	_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(inst)})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	updated := &porterv1.Installation{}
+	g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(inst), updated)).To(Succeed())
+	return updated
+}
+
+func TestReconcile_AddsFinalizer(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.UninstallOnDelete = true
+	r := newTestReconciler(t, inst)
+
+	inst = reconcileInstallation(t, r, inst)
+	g.Expect(inst.Finalizers).To(ContainElement(porterv1.FinalizerUninstall))
+
+	inst.Spec.UninstallOnDelete = false
+	g.Expect(r.Update(context.Background(), inst)).To(Succeed())
+	inst = reconcileInstallation(t, r, inst)
+	g.Expect(inst.Finalizers).To(BeEmpty())
+}
+
+func TestReconcile_Delete(t *testing.T) {
+	g := NewWithT(t)
+	inst := newDeletedInstallation()
+	r := newTestReconciler(t, inst)
+
+	// The first reconcile starts the uninstall
+	inst = reconcileInstallation(t, r, inst)
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: makeUninstallJobName(inst)}, job)).To(Succeed())
+	g.Expect(job.Spec.Template.Spec.Containers[0].Args[0]).To(Equal("uninstall"))
+	g.Expect(inst.Finalizers).To(ContainElement(porterv1.FinalizerUninstall))
+
+	// The finalizer is removed once the uninstall completes
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	g.Expect(r.Status().Update(context.Background(), job)).To(Succeed())
+	inst = reconcileInstallation(t, r, inst)
+	g.Expect(inst.Finalizers).To(BeEmpty())
+}
+
+func TestReconcile_DeleteFailed(t *testing.T) {
+	g := NewWithT(t)
+	inst := newDeletedInstallation()
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: makeUninstallJobName(inst), Namespace: inst.Namespace},
+		Status:     batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}},
+	}
+	r := newTestReconciler(t, inst, job)
+
+	inst = reconcileInstallation(t, r, inst)
+	g.Expect(inst.Finalizers).To(ContainElement(porterv1.FinalizerUninstall))
+	cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionDeletionFailed)
+	g.Expect(cond).ToNot(BeNil())
+	g.Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+	g.Expect(cond.Reason).To(Equal(ReasonUninstallFailed))
+	g.Expect(r.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring(ReasonUninstallFailed)))
+}
+
+func TestReconcile_ForceDelete(t *testing.T) {
+	g := NewWithT(t)
+	inst := newDeletedInstallation()
+	inst.Annotations = map[string]string{porterv1.AnnotationForceDelete: "true"}
+	r := newTestReconciler(t, inst)
+
+	inst = reconcileInstallation(t, r, inst)
+	g.Expect(inst.Finalizers).To(BeEmpty())
+
+	jobs := &batchv1.JobList{}
+	g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+	g.Expect(jobs.Items).To(BeEmpty())
+}
+
+func TestReconcile_DeleteNamespaceTerminating(t *testing.T) {
+	testcases := []struct {
+		name          string
+		jobRunning    bool
+		timeout       string
+		deletedAgo    time.Duration
+		wantFinalizer bool
+	}{
+		{name: "no uninstall job"},
+		{name: "uninstall job running, no timeout", jobRunning: true},
+		{name: "uninstall job running", jobRunning: true, timeout: "5m", deletedAgo: time.Minute, wantFinalizer: true},
+		{name: "uninstall job timed out", jobRunning: true, timeout: "5m", deletedAgo: 10 * time.Minute},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newDeletedInstallation()
+			deleted := metav1.NewTime(time.Now().Add(-tc.deletedAgo))
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: inst.Namespace, DeletionTimestamp: &deleted},
+				Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating},
+			}
+			objs := []client.Object{inst, ns}
+			if tc.jobRunning {
+				objs = append(objs, &batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{Name: makeUninstallJobName(inst), Namespace: inst.Namespace},
+				})
+			}
+			r := newTestReconciler(t, objs...)
+			if tc.timeout != "" {
+				r.Defaults = map[string]string{"namespaceDeletionTimeout": tc.timeout}
+			}
+
+			result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(inst)})
+			g.Expect(err).ToNot(HaveOccurred())
+			updated := &porterv1.Installation{}
+			g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(inst), updated)).To(Succeed())
+
+			jobs := &batchv1.JobList{}
+			g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+			g.Expect(len(jobs.Items) > 0).To(Equal(tc.jobRunning), "an uninstall job should not be created in a terminating namespace")
+
+			if tc.wantFinalizer {
+				g.Expect(updated.Finalizers).To(ContainElement(porterv1.FinalizerUninstall))
+				g.Expect(result.RequeueAfter).To(BeNumerically("~", 4*time.Minute, time.Second))
+				return
+			}
+			g.Expect(updated.Finalizers).To(BeEmpty())
+			cond := meta.FindStatusCondition(updated.Status.Conditions, porterv1.ConditionDeletionFailed)
+			g.Expect(cond).ToNot(BeNil())
+			g.Expect(cond.Reason).To(Equal(ReasonNamespaceTerminating))
+			g.Expect(r.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring(ReasonNamespaceTerminating)))
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// dependenciesExtension is the custom section of a bundle.json where porter
+// declares the bundle's dependencies.
+const dependenciesExtension = "io.cnab.dependencies"
+
+// bundleDependencies is the subset of porter's dependencies extension used by
+// the operator.
+type bundleDependencies struct {
+	// Sequence is the order that the dependencies are run in.
+	Sequence []string                    `json:"sequence,omitempty"`
+	Requires map[string]bundleDependency `json:"requires,omitempty"`
+}
+
+type bundleDependency struct {
+	Bundle string `json:"bundle"`
+}
+
+// getDependencies returns the dependencies declared by the bundle, in the
+// order that porter runs them.
+func (b *bundleDefinition) getDependencies() ([]porterv1.DependencyStatus, error) {
+	data, ok := b.Custom[dependenciesExtension]
+	if !ok {
+		return nil, nil
+	}
+
+	deps := bundleDependencies{}
+	if err := json.Unmarshal(data, &deps); err != nil {
+		return nil, errors.Wrapf(err, "could not parse the %s section of bundle %s", dependenciesExtension, b.Name)
+	}
+
+	// Dependencies that are not in the sequence are run afterwards, sorted by name
+	names := make([]string, 0, len(deps.Requires))
+	seen := make(map[string]bool, len(deps.Requires))
+	for _, name := range deps.Sequence {
+		if _, ok := deps.Requires[name]; ok && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+	var rest []string
+	for name := range deps.Requires {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	names = append(names, rest...)
+
+	result := make([]porterv1.DependencyStatus, 0, len(names))
+	for _, name := range names {
+		result = append(result, porterv1.DependencyStatus{Name: name, Bundle: deps.Requires[name].Bundle})
+	}
+	return result, nil
+}
+
+// getDependencyStatus returns the dependencies of the Installation's bundle
+// and their outcome in a finished run. The dependencies are declared in the
+// bundle's definition, see resolveBundle, and their status comes from
+// the result reported by the porter agent. Porter only runs the bundle once
+// its dependencies succeed, so when the agent does not report a dependency,
+// it succeeded if the run did. Otherwise its status is not known.
+func (r *InstallationReconciler) getDependencyStatus(ctx context.Context, inst *porterv1.Installation, result *porterv1.InstallationResult, succeeded bool) []porterv1.DependencyStatus {
+	var reported []porterv1.DependencyStatus
+	if result != nil {
+		reported = result.Dependencies
+	}
+
+	bun, err := r.resolveBundle(ctx, inst)
+	if err == nil && bun != nil {
+		var declared []porterv1.DependencyStatus
+		declared, err = bun.getDependencies()
+		if err == nil {
+			return mergeDependencyStatus(declared, reported, succeeded)
+		}
+	}
+	if err != nil {
+		r.getLogger(ctx).Info("could not read the dependencies of the bundle", "reason", err.Error())
+	}
+	return reported
+}
+
+// mergeDependencyStatus sets the status of each declared dependency from the
+// dependencies reported by the porter agent, keeping the order of the
+// declared dependencies.
+func mergeDependencyStatus(declared []porterv1.DependencyStatus, reported []porterv1.DependencyStatus, succeeded bool) []porterv1.DependencyStatus {
+	statuses := make(map[string]string, len(reported))
+	for _, dep := range reported {
+		statuses[dep.Name] = dep.Status
+	}
+	for i := range declared {
+		if status, ok := statuses[declared[i].Name]; ok {
+			declared[i].Status = status
+		} else if succeeded {
+			declared[i].Status = resultSucceeded
+		}
+	}
+	return declared
+}
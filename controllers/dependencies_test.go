@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestGetDependencyStatus(t *testing.T) {
+	bundleJSON := `{
+  "name": "wordpress",
+  "version": "0.1.0",
+  "requiredExtensions": ["io.cnab.dependencies"],
+  "custom": {
+    "io.cnab.dependencies": {
+      "sequence": ["mysql", "redis"],
+      "requires": {
+        "cache": {"bundle": "getporter/memcached:v0.1.0"},
+        "redis": {"bundle": "getporter/redis:v0.2.0"},
+        "mysql": {"bundle": "getporter/mysql:v0.1.0"}
+      }
+    }
+  }
+}`
+
+	testcases := []struct {
+		name      string
+		bundle    string
+		result    *porterv1.InstallationResult
+		succeeded bool
+		want      []porterv1.DependencyStatus
+	}{
+		{
+			name:      "succeeded",
+			bundle:    bundleJSON,
+			result:    &porterv1.InstallationResult{Status: resultSucceeded},
+			succeeded: true,
+			want: []porterv1.DependencyStatus{
+				{Name: "mysql", Bundle: "getporter/mysql:v0.1.0", Status: resultSucceeded},
+				{Name: "redis", Bundle: "getporter/redis:v0.2.0", Status: resultSucceeded},
+				{Name: "cache", Bundle: "getporter/memcached:v0.1.0", Status: resultSucceeded},
+			},
+		},
+		{
+			name:   "failed",
+			bundle: bundleJSON,
+			result: &porterv1.InstallationResult{Status: resultFailed, Dependencies: []porterv1.DependencyStatus{
+				{Name: "mysql", Status: resultSucceeded},
+				{Name: "redis", Status: resultFailed},
+			}},
+			want: []porterv1.DependencyStatus{
+				{Name: "mysql", Bundle: "getporter/mysql:v0.1.0", Status: resultSucceeded},
+				{Name: "redis", Bundle: "getporter/redis:v0.2.0", Status: resultFailed},
+				{Name: "cache", Bundle: "getporter/memcached:v0.1.0"},
+			},
+		},
+		{
+			name:      "no dependencies",
+			bundle:    `{"name": "hello", "version": "0.1.0"}`,
+			succeeded: true,
+		},
+		{
+			name: "no bundle definition",
+			result: &porterv1.InstallationResult{Status: resultSucceeded, Dependencies: []porterv1.DependencyStatus{
+				{Name: "mysql", Status: resultSucceeded},
+			}},
+			succeeded: true,
+			want:      []porterv1.DependencyStatus{{Name: "mysql", Status: resultSucceeded}},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			r := newTestReconciler(t, inst)
+			if tc.bundle != "" {
+				inst.Spec.BundleConfigMap = "wordpress-bundle"
+				r = newTestReconciler(t, inst, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "wordpress-bundle", Namespace: inst.Namespace},
+					Data:       map[string]string{bundleFileName: tc.bundle},
+				})
+			}
+
+			got := r.getDependencyStatus(context.Background(), inst, tc.result, tc.succeeded)
+			g.Expect(got).To(Equal(tc.want))
+		})
+	}
+}
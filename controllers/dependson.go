@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// defaultDependencyWaitInterval is how often an Installation checks on the
+// Installations that it depends on while it waits for them to succeed.
+const defaultDependencyWaitInterval = 15 * time.Second
+
+// getDependencyWaitInterval returns how long to wait before checking the
+// Installation's dependencies again, from the dependencyWaitInterval setting.
+func (r *InstallationReconciler) getDependencyWaitInterval(ctx context.Context, cfg porterConfig) (time.Duration, error) {
+	v, source, ok := cfg.get("dependencyWaitInterval")
+	if !ok {
+		return defaultDependencyWaitInterval, nil
+	}
+
+	interval, err := time.ParseDuration(v)
+	if err != nil || interval <= 0 {
+		return 0, invalidSettingf("invalid dependencyWaitInterval %q in %s, must be a duration, e.g. 15s", v, source)
+	}
+	r.getLogger(ctx).Info("dependency wait interval defaulted", "source", source, "dependencyWaitInterval", interval)
+	return interval, nil
+}
+
+// getInstallationDependencies returns the names of the Installations that
+// must succeed before the Installation runs: its DependsOn, and the
+// Installations whose outputs it uses as parameters.
+func getInstallationDependencies(inst *porterv1.Installation) []string {
+	var names []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		if !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+	for _, name := range inst.Spec.DependsOn {
+		add(name)
+	}
+	for _, p := range inst.Spec.ParametersFromInstallation {
+		add(p.Installation)
+	}
+	return names
+}
+
+// getUnmetDependencies returns the Installation's dependencies that have not
+// succeeded, with their state, e.g. mysql (Running). A dependency has only
+// succeeded once the run of its current generation succeeded, until then it
+// is Pending.
+func (r *InstallationReconciler) getUnmetDependencies(ctx context.Context, inst *porterv1.Installation) ([]string, error) {
+	var unmet []string
+	for _, name := range getInstallationDependencies(inst) {
+		dep := &porterv1.Installation{}
+		err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: inst.Namespace}, dep)
+		if apierrors.IsNotFound(err) {
+			unmet = append(unmet, name+" (not found)")
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not retrieve Installation %s/%s that Installation %s depends on", inst.Namespace, name, inst.Name)
+		}
+		if dep.IsDone() && dep.Status.Phase == porterv1.PhaseSucceeded {
+			continue
+		}
+
+		state := "Pending"
+		if dep.IsDone() || dep.Status.Phase == porterv1.PhaseRunning {
+			state = string(dep.Status.Phase)
+		}
+		unmet = append(unmet, fmt.Sprintf("%s (%s)", name, state))
+	}
+	return unmet, nil
+}
+
+// waitForDependencies delays running the Installation until the
+// Installations that it depends on have succeeded, and records the unmet
+// dependencies in the WaitingForDependencies condition. The condition is
+// cleared once they all succeed. The time to wait before checking again is
+// returned.
+func (r *InstallationReconciler) waitForDependencies(ctx context.Context, inst *porterv1.Installation) (time.Duration, error) {
+	unmet, err := r.getUnmetDependencies(ctx, inst)
+	if err != nil {
+		return 0, err
+	}
+	if len(unmet) == 0 {
+		if meta.IsStatusConditionTrue(inst.Status.Conditions, porterv1.ConditionWaitingForDependencies) {
+			return 0, r.setCondition(ctx, inst, porterv1.ConditionWaitingForDependencies, metav1.ConditionFalse, ReasonDependenciesSucceeded, "The Installations that it depends on have succeeded")
+		}
+		return 0, nil
+	}
+
+	interval, err := r.getDependencyWaitInterval(ctx, r.getPorterConfig(ctx, inst))
+	if err != nil {
+		return 0, err
+	}
+	msg := "Waiting for Installations to succeed: " + strings.Join(unmet, ", ")
+	r.getLogger(ctx).Info("waiting for dependencies before running Installation", "dependencies", unmet, "dependencyWaitInterval", interval)
+	return interval, r.setCondition(ctx, inst, porterv1.ConditionWaitingForDependencies, metav1.ConditionTrue, ReasonWaitingForDependencies, msg)
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func newTestDependency(name string, phase porterv1.InstallationPhase) *porterv1.Installation {
+	dep := newTestInstallation()
+	dep.Name = name
+	dep.Status.ObservedGeneration = dep.Generation
+	dep.Status.Phase = phase
+	return dep
+}
+
+func TestGetInstallationDependencies(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.DependsOn = []string{"mysql", "redis"}
+	inst.Spec.ParametersFromInstallation = []porterv1.ParameterFromInstallation{
+		{Name: "connstr", Installation: "mysql", Output: "connstr"},
+		{Name: "bucket", Installation: "storage", Output: "bucket"},
+	}
+
+	g.Expect(getInstallationDependencies(inst)).To(Equal([]string{"mysql", "redis", "storage"}))
+}
+
+func TestGetUnmetDependencies(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.DependsOn = []string{"mysql", "redis", "cache", "queue", "storage"}
+	changed := newTestDependency("storage", porterv1.PhaseSucceeded)
+	changed.Generation = 2
+	r := newTestReconciler(t, inst,
+		newTestDependency("mysql", porterv1.PhaseSucceeded),
+		newTestDependency("redis", porterv1.PhaseRunning),
+		newTestDependency("cache", porterv1.PhaseFailed),
+		changed,
+	)
+
+	unmet, err := r.getUnmetDependencies(context.Background(), inst)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(unmet).To(Equal([]string{"redis (Running)", "cache (Failed)", "queue (not found)", "storage (Pending)"}))
+}
+
+func TestReconcile_WaitsForDependencies(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.DependsOn = []string{"mysql"}
+	dep := newTestDependency("mysql", porterv1.PhaseRunning)
+	r := newTestReconciler(t, inst, dep)
+	r.Defaults = map[string]string{"dependencyWaitInterval": "30s"}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(inst)}
+
+	result, err := r.Reconcile(context.Background(), req)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.RequeueAfter).To(Equal(30 * time.Second))
+	updated := &porterv1.Installation{}
+	g.Expect(r.Get(context.Background(), req.NamespacedName, updated)).To(Succeed())
+	cond := meta.FindStatusCondition(updated.Status.Conditions, porterv1.ConditionWaitingForDependencies)
+	g.Expect(cond).ToNot(BeNil())
+	g.Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+	g.Expect(cond.Message).To(ContainSubstring("mysql (Running)"))
+	jobs := &batchv1.JobList{}
+	g.Expect(r.List(context.Background(), jobs, client.InNamespace(inst.Namespace))).To(Succeed())
+	g.Expect(jobs.Items).To(BeEmpty(), "the job should wait for its dependencies")
+
+	// Once the dependency succeeds, the condition is cleared and the job is created
+	dep.Status.Phase = porterv1.PhaseSucceeded
+	g.Expect(r.Status().Update(context.Background(), dep)).To(Succeed())
+	_, err = r.Reconcile(context.Background(), req)
+	g.Expect(err).ToNot(HaveOccurred())
+	updated = &porterv1.Installation{}
+	g.Expect(r.Get(context.Background(), req.NamespacedName, updated)).To(Succeed())
+	g.Expect(meta.IsStatusConditionFalse(updated.Status.Conditions, porterv1.ConditionWaitingForDependencies)).To(BeTrue())
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: makeJobName(inst)}, &batchv1.Job{})).To(Succeed())
+}
+
+func TestGetDependencyWaitInterval(t *testing.T) {
+	testcases := []struct {
+		name      string
+		configMap string
+		want      time.Duration
+		wantErr   string
+	}{
+		{name: "not set", want: defaultDependencyWaitInterval},
+		{name: "configmap", configMap: "1m", want: time.Minute},
+		{name: "invalid", configMap: "soon", wantErr: `invalid dependencyWaitInterval "soon" in configmap`},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			r := &InstallationReconciler{Log: ctrl.Log.WithName("test")}
+			cfg := porterConfig{sources: []configSource{{name: "configmap", data: map[string]string{"dependencyWaitInterval": tc.configMap}}}}
+
+			got, err := r.getDependencyWaitInterval(context.Background(), cfg)
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tc.want))
+		})
+	}
+}
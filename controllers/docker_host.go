@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// checkDockerHostAccess rejects Installations that set AllowDockerHostAccess,
+// in case the Installation was created without the webhook. Porter's
+// kubernetes driver runs the bundle in a pod that can not reach the node's
+// docker daemon, so the Installation is not run until the field is removed.
+func (r *InstallationReconciler) checkDockerHostAccess(ctx context.Context, inst *porterv1.Installation) (bool, error) {
+	errs := porterv1.ValidateDockerHostAccess(inst.Spec, field.NewPath("spec", "allowDockerHostAccess"))
+	if len(errs) == 0 {
+		return true, nil
+	}
+
+	msg := fmt.Sprintf("Unsupported allowDockerHostAccess: %s", errs.ToAggregate())
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonDockerHostAccessUnsupported, msg)
+
+	return false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonDockerHostAccessUnsupported, msg)
+}
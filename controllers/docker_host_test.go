@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestCreateJobForInstallation_DockerHostAccess(t *testing.T) {
+	testcases := []struct {
+		name         string
+		allow        bool
+		validateOnly bool
+		wantRejected bool
+	}{
+		{name: "not allowed"},
+		{name: "validate only", validateOnly: true},
+		{name: "allowed", allow: true, wantRejected: true},
+		{name: "allowed and validate only", allow: true, validateOnly: true, wantRejected: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.AllowDockerHostAccess = tc.allow
+			inst.Spec.ValidateOnly = tc.validateOnly
+			jobName := makeJobName(inst)
+			r := newTestReconciler(t, inst)
+
+			g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+			jobs := &batchv1.JobList{}
+			g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+			if tc.wantRejected {
+				g.Expect(jobs.Items).To(BeEmpty())
+				cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+				g.Expect(cond).ToNot(BeNil())
+				g.Expect(cond.Reason).To(Equal(ReasonDockerHostAccessUnsupported))
+				g.Expect(cond.Message).To(ContainSubstring("spec.allowDockerHostAccess: Forbidden"))
+				g.Expect(r.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring(ReasonDockerHostAccessUnsupported)))
+				return
+			}
+
+			job := &batchv1.Job{}
+			g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+			for _, arg := range job.Spec.Template.Spec.Containers[0].Args {
+				g.Expect(arg).ToNot(Equal("--allow-docker-host-access"))
+			}
+			for _, v := range job.Spec.Template.Spec.Volumes {
+				g.Expect(v.HostPath).To(BeNil(), "the agent should not mount a path from the node")
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+const (
+	// driftCheckAction is the bundle action that checks the installed
+	// resources, and fails when they have drifted from the bundle.
+	driftCheckAction = "status"
+
+	// labelDriftCheck marks the porter jobs that check an Installation for drift.
+	labelDriftCheck = "drift-check"
+)
+
+// isDriftCheckJob determines if the job checks the Installation for drift,
+// instead of running the Installation's action.
+func isDriftCheckJob(job *batchv1.Job) bool {
+	return job.Labels[labelDriftCheck] == "true"
+}
+
+// getLatestDriftCheckJob returns the most recently created drift check job for
+// the current generation of the Installation, if any.
+func getLatestDriftCheckJob(jobs []batchv1.Job, inst *porterv1.Installation) *batchv1.Job {
+	var latest *batchv1.Job
+	for i := range jobs {
+		if !isDriftCheckJob(&jobs[i]) {
+			continue
+		}
+		if gen, ok := getJobGeneration(&jobs[i], inst); !ok || gen != inst.Generation {
+			continue
+		}
+		if latest == nil || latest.CreationTimestamp.Before(&jobs[i].CreationTimestamp) {
+			latest = &jobs[i]
+		}
+	}
+	return latest
+}
+
+// reconcileDrift periodically runs the bundle's status action on an
+// Installation that succeeded, when DriftCheckInterval is set, and records
+// the result of the last check in the Drifted condition. Drift is only
+// reported, the Installation's action is not run again.
+func (r *InstallationReconciler) reconcileDrift(ctx context.Context, inst *porterv1.Installation) (ctrl.Result, error) {
+	if inst.Spec.DriftCheckInterval == nil || inst.Spec.DriftCheckInterval.Duration <= 0 || inst.Status.Phase != porterv1.PhaseSucceeded {
+		return ctrl.Result{}, nil
+	}
+
+	jobs, err := r.listJobs(ctx, inst)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// The Installation is reconciled again when the job finishes
+	if activeJob := getActiveJob(jobs); activeJob != nil {
+		return ctrl.Result{}, nil
+	}
+	if latest := getLatestDriftCheckJob(jobs, inst); latest != nil {
+		if err = r.setDriftStatus(ctx, inst, latest); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	interval := inst.Spec.DriftCheckInterval.Duration
+	now := time.Now()
+	if last := inst.Status.LastDriftCheckTime; last != nil {
+		if next := last.Add(interval); now.Before(next) {
+			return ctrl.Result{RequeueAfter: next.Sub(now)}, nil
+		}
+	}
+
+	// porter invoke INSTALLATION_NAME --action=status
+	check := inst.DeepCopy()
+	check.Spec.Action = driftCheckAction
+	check.Spec.Apply = false
+	jobName, err := r.getJobName(ctx, inst, makeDriftCheckJobName(inst, now))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	r.getLogger(ctx).Info("checking Installation for drift", "job", jobName)
+	result, err := r.runJob(ctx, jobName, check, map[string]string{labelDriftCheck: "true"})
+	if err != nil || !result.IsZero() {
+		return result, err
+	}
+
+	// The drift check is not recorded until the job is created
+	inst.Status.LastDriftCheckTime = &metav1.Time{Time: now}
+	return ctrl.Result{RequeueAfter: interval}, r.updateStatus(ctx, inst)
+}
+
+// setDriftStatus records the result of a drift check job that is done in the
+// Installation's Drifted condition. An event is recorded when drift is first
+// detected.
+func (r *InstallationReconciler) setDriftStatus(ctx context.Context, inst *porterv1.Installation, job *batchv1.Job) error {
+	if !isJobDone(job.Status) {
+		return nil
+	}
+
+	result, err := r.getAgentResult(ctx, job)
+	if err != nil {
+		return err
+	}
+	if getPhase(job, result) == porterv1.PhaseSucceeded {
+		msg := fmt.Sprintf("The installed resources match the bundle, checked by porter job %s", job.Name)
+		return r.setCondition(ctx, inst, porterv1.ConditionDrifted, metav1.ConditionFalse, ReasonNoDrift, msg)
+	}
+
+	msg := fmt.Sprintf("The %s action of porter job %s failed, the installed resources may have drifted from the bundle. See the job's logs for details", driftCheckAction, job.Name)
+	if !meta.IsStatusConditionTrue(inst.Status.Conditions, porterv1.ConditionDrifted) {
+		r.getLogger(ctx).Info("detected drift", "job", job.Name)
+		r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonDriftDetected, msg)
+	}
+	return r.setCondition(ctx, inst, porterv1.ConditionDrifted, metav1.ConditionTrue, ReasonDriftDetected, msg)
+}
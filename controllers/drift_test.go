@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func newTestDriftCheckInstallation() *porterv1.Installation {
+	inst := newTestInstallation()
+	inst.Spec.DriftCheckInterval = &metav1.Duration{Duration: time.Hour}
+	inst.Status.ObservedGeneration = inst.Generation
+	inst.Status.Phase = porterv1.PhaseSucceeded
+	return inst
+}
+
+func TestReconcileDrift_RunsStatusAction(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestDriftCheckInstallation()
+	r := newTestReconciler(t, inst)
+
+	result, err := r.reconcileDrift(context.Background(), inst)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.RequeueAfter).To(Equal(time.Hour))
+	g.Expect(inst.Status.LastDriftCheckTime).ToNot(BeNil())
+
+	jobs := &batchv1.JobList{}
+	g.Expect(r.List(context.Background(), jobs, client.InNamespace(inst.Namespace))).To(Succeed())
+	g.Expect(jobs.Items).To(HaveLen(1))
+	job := jobs.Items[0]
+	g.Expect(isDriftCheckJob(&job)).To(BeTrue())
+	args := job.Spec.Template.Spec.Containers[0].Args
+	g.Expect(args[:2]).To(Equal([]string{"invoke", inst.Name}))
+	g.Expect(args).To(ContainElement("--action=status"))
+
+	// The drift check job is not adopted as the Installation's job
+	g.Expect(getLatestJob(jobs.Items)).To(BeNil())
+}
+
+func TestReconcileDrift_NotDue(t *testing.T) {
+	testcases := []struct {
+		name      string
+		interval  *metav1.Duration
+		phase     porterv1.InstallationPhase
+		lastCheck time.Duration
+	}{
+		{name: "not enabled", phase: porterv1.PhaseSucceeded},
+		{name: "failed", interval: &metav1.Duration{Duration: time.Hour}, phase: porterv1.PhaseFailed},
+		{name: "checked recently", interval: &metav1.Duration{Duration: time.Hour}, phase: porterv1.PhaseSucceeded, lastCheck: 10 * time.Minute},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestDriftCheckInstallation()
+			inst.Spec.DriftCheckInterval = tc.interval
+			inst.Status.Phase = tc.phase
+			if tc.lastCheck > 0 {
+				inst.Status.LastDriftCheckTime = &metav1.Time{Time: time.Now().Add(-tc.lastCheck)}
+			}
+			r := newTestReconciler(t, inst)
+
+			result, err := r.reconcileDrift(context.Background(), inst)
+			g.Expect(err).ToNot(HaveOccurred())
+			if tc.lastCheck > 0 {
+				g.Expect(result.RequeueAfter).To(BeNumerically("~", 50*time.Minute, time.Minute))
+			} else {
+				g.Expect(result.IsZero()).To(BeTrue())
+			}
+
+			jobs := &batchv1.JobList{}
+			g.Expect(r.List(context.Background(), jobs, client.InNamespace(inst.Namespace))).To(Succeed())
+			g.Expect(jobs.Items).To(BeEmpty())
+		})
+	}
+}
+
+func TestReconcileDrift_SetsCondition(t *testing.T) {
+	testcases := []struct {
+		name       string
+		jobStatus  batchv1.JobConditionType
+		wantStatus metav1.ConditionStatus
+		wantReason string
+	}{
+		{name: "drifted", jobStatus: batchv1.JobFailed, wantStatus: metav1.ConditionTrue, wantReason: ReasonDriftDetected},
+		{name: "in sync", jobStatus: batchv1.JobComplete, wantStatus: metav1.ConditionFalse, wantReason: ReasonNoDrift},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestDriftCheckInstallation()
+			inst.Status.LastDriftCheckTime = &metav1.Time{Time: time.Now()}
+			job := &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        makeDriftCheckJobName(inst, inst.Status.LastDriftCheckTime.Time),
+					Namespace:   inst.Namespace,
+					Labels:      map[string]string{"porter": "true", "installation": inst.Name, labelDriftCheck: "true"},
+					Annotations: map[string]string{annotationGeneration: "1"},
+				},
+				Status: batchv1.JobStatus{
+					Conditions: []batchv1.JobCondition{{Type: tc.jobStatus, Status: corev1.ConditionTrue}},
+				},
+			}
+			r := newTestReconciler(t, inst, job)
+
+			_, err := r.reconcileDrift(context.Background(), inst)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionDrifted)
+			g.Expect(cond).ToNot(BeNil())
+			g.Expect(cond.Status).To(Equal(tc.wantStatus))
+			g.Expect(cond.Reason).To(Equal(tc.wantReason))
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// The settings of porter's kubernetes driver, named after the environment
+// variables that the driver reads them from.
+const (
+	driverNamespace       = "KUBE_NAMESPACE"
+	driverInCluster       = "IN_CLUSTER"
+	driverJobVolumeName   = "JOB_VOLUME_NAME"
+	driverJobVolumePath   = "JOB_VOLUME_PATH"
+	driverCleanupJobs     = "CLEANUP_JOBS"
+	driverServiceAccount  = "SERVICE_ACCOUNT"
+	driverLabels          = "LABELS"
+	driverImagePullPolicy = "IMAGE_PULL_POLICY"
+)
+
+// driverSettings are the settings that the operator passes to porter's
+// kubernetes driver, in the order they are set on the porter agent container.
+var driverSettings = []string{
+	driverNamespace,
+	driverInCluster,
+	driverJobVolumeName,
+	driverJobVolumePath,
+	driverCleanupJobs,
+	driverServiceAccount,
+	driverLabels,
+	driverImagePullPolicy,
+}
+
+// driverConfig changes how the operator passes settings to porter's
+// kubernetes driver, for driver versions that read other environment
+// variables than the operator's defaults.
+type driverConfig struct {
+	// names maps a driver setting to the environment variable that it is
+	// passed in, when it is not the setting's name.
+	names map[string]string
+
+	// extra are additional environment variables for the driver, for
+	// settings that the operator does not manage.
+	extra map[string]string
+}
+
+// getDriverConfig returns the changes to the driver's environment variables,
+// from the driverEnvNames setting, comma separated SETTING=NAME pairs, e.g.
+// JOB_VOLUME_NAME=PORTER_JOB_VOLUME_NAME, and the driverEnv setting, comma
+// separated NAME=VALUE pairs, e.g. JOB_TIMEOUT=30m.
+func (r *InstallationReconciler) getDriverConfig(ctx context.Context, cfg porterConfig) (driverConfig, error) {
+	var dc driverConfig
+	managed := map[string]bool{}
+	for _, setting := range driverSettings {
+		managed[setting] = true
+	}
+
+	if v, source, ok := cfg.get("driverEnvNames"); ok {
+		dc.names = map[string]string{}
+		for _, pair := range strings.Split(v, ",") {
+			parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(parts) != 2 {
+				return driverConfig{}, invalidSettingf("invalid driverEnvNames %q in %s, must be SETTING=NAME pairs separated by commas", v, source)
+			}
+			setting, name := parts[0], parts[1]
+			if !managed[setting] {
+				return driverConfig{}, invalidSettingf("invalid driverEnvNames in %s, %s is not a driver setting, must be one of %s", source, setting, strings.Join(driverSettings, ", "))
+			}
+			if errs := validation.IsEnvVarName(name); len(errs) > 0 {
+				return driverConfig{}, invalidSettingf("invalid driverEnvNames in %s, %s is not a valid environment variable name: %s", source, name, strings.Join(errs, ", "))
+			}
+			dc.names[setting] = name
+		}
+		r.getLogger(ctx).Info("porter driver environment variable names defaulted", "source", source, "driverEnvNames", v)
+	}
+
+	if v, source, ok := cfg.get("driverEnv"); ok {
+		dc.extra = map[string]string{}
+		for _, pair := range strings.Split(v, ",") {
+			parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(parts) != 2 {
+				return driverConfig{}, invalidSettingf("invalid driverEnv %q in %s, must be NAME=VALUE pairs separated by commas", v, source)
+			}
+			name, value := parts[0], parts[1]
+			if errs := validation.IsEnvVarName(name); len(errs) > 0 {
+				return driverConfig{}, invalidSettingf("invalid driverEnv in %s, %s is not a valid environment variable name: %s", source, name, strings.Join(errs, ", "))
+			}
+			if managed[name] || dc.isRenamedTo(name) {
+				return driverConfig{}, invalidSettingf("invalid driverEnv in %s, the %s setting is managed by the operator", source, name)
+			}
+			dc.extra[name] = value
+		}
+		r.getLogger(ctx).Info("porter driver environment defaulted", "source", source, "driverEnv", v)
+	}
+
+	return dc, nil
+}
+
+// isRenamedTo determines if a driver setting is passed in the environment variable.
+func (dc driverConfig) isRenamedTo(name string) bool {
+	for _, renamed := range dc.names {
+		if renamed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// makeDriverEnv returns the environment variables that configure porter's
+// kubernetes driver. Settings without a value are not set, and the extra
+// environment variables are added after the operator's settings, sorted by
+// name.
+func (dc driverConfig) makeDriverEnv(settings map[string]string) []corev1.EnvVar {
+	env := make([]corev1.EnvVar, 0, len(settings)+len(dc.extra))
+	for _, setting := range driverSettings {
+		value, ok := settings[setting]
+		if !ok || value == "" {
+			continue
+		}
+		name := setting
+		if renamed, ok := dc.names[setting]; ok {
+			name = renamed
+		}
+		env = append(env, corev1.EnvVar{Name: name, Value: value})
+	}
+
+	names := make([]string, 0, len(dc.extra))
+	for name := range dc.extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, corev1.EnvVar{Name: name, Value: dc.extra[name]})
+	}
+	return env
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestGetDriverConfig(t *testing.T) {
+	testcases := []struct {
+		name      string
+		config    map[string]string
+		wantNames map[string]string
+		wantExtra map[string]string
+		wantErr   string
+	}{
+		{name: "not set"},
+		{
+			name:      "renamed and extra",
+			config:    map[string]string{"driverEnvNames": "JOB_VOLUME_NAME=PORTER_JOB_VOLUME", "driverEnv": "JOB_TIMEOUT=30m, DEBUG=true"},
+			wantNames: map[string]string{driverJobVolumeName: "PORTER_JOB_VOLUME"},
+			wantExtra: map[string]string{"JOB_TIMEOUT": "30m", "DEBUG": "true"},
+		},
+		{name: "unknown setting", config: map[string]string{"driverEnvNames": "TIMEOUT=JOB_TIMEOUT"}, wantErr: "TIMEOUT is not a driver setting"},
+		{name: "invalid name", config: map[string]string{"driverEnvNames": "LABELS=job labels"}, wantErr: "not a valid environment variable name"},
+		{name: "invalid pair", config: map[string]string{"driverEnv": "JOB_TIMEOUT"}, wantErr: `invalid driverEnv "JOB_TIMEOUT" in configmap`},
+		{name: "managed setting", config: map[string]string{"driverEnv": "CLEANUP_JOBS=true"}, wantErr: "the CLEANUP_JOBS setting is managed by the operator"},
+		{
+			name:    "renamed setting",
+			config:  map[string]string{"driverEnvNames": "LABELS=JOB_LABELS", "driverEnv": "JOB_LABELS=team=blue"},
+			wantErr: "the JOB_LABELS setting is managed by the operator",
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			r := &InstallationReconciler{Log: ctrl.Log.WithName("test")}
+			cfg := porterConfig{sources: []configSource{{name: "configmap", data: tc.config}}}
+
+			got, err := r.getDriverConfig(context.Background(), cfg)
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got.names).To(Equal(tc.wantNames))
+			g.Expect(got.extra).To(Equal(tc.wantExtra))
+		})
+	}
+}
+
+func TestMakeDriverEnv(t *testing.T) {
+	g := NewWithT(t)
+	dc := driverConfig{
+		names: map[string]string{driverJobVolumeName: "PORTER_JOB_VOLUME"},
+		extra: map[string]string{"JOB_TIMEOUT": "30m", "DEBUG": "true"},
+	}
+
+	env := dc.makeDriverEnv(map[string]string{
+		driverNamespace:       "test",
+		driverJobVolumeName:   "hello-outputs",
+		driverCleanupJobs:     "false",
+		driverImagePullPolicy: "",
+	})
+	g.Expect(env).To(Equal([]corev1.EnvVar{
+		{Name: "KUBE_NAMESPACE", Value: "test"},
+		{Name: "PORTER_JOB_VOLUME", Value: "hello-outputs"},
+		{Name: "CLEANUP_JOBS", Value: "false"},
+		{Name: "DEBUG", Value: "true"},
+		{Name: "JOB_TIMEOUT", Value: "30m"},
+	}))
+}
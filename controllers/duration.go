@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// maxRecentDurations is how many successful runs are averaged to estimate
+// the duration of the next run.
+const maxRecentDurations = 5
+
+// getJobFinishTime returns when a job that is done finished. Kubernetes only
+// sets the completion time of a job that succeeded, a failed job finished
+// when it got the Failed condition.
+func getJobFinishTime(job *batchv1.Job) *metav1.Time {
+	if job.Status.CompletionTime != nil {
+		return job.Status.CompletionTime
+	}
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			t := c.LastTransitionTime
+			return &t
+		}
+	}
+	return nil
+}
+
+// setRunTimes records when the Installation's job started and finished, and
+// how long it took, in the status. When a run that succeeded is recorded for
+// the first time, its duration is added to the recent durations that
+// estimate how long the next run takes.
+func setRunTimes(status *porterv1.InstallationStatus, job *batchv1.Job, firstRecorded bool) {
+	status.StartedAt = job.Status.StartTime
+	status.FinishedAt = nil
+	status.Duration = nil
+	if !isJobDone(job.Status) {
+		return
+	}
+
+	status.FinishedAt = getJobFinishTime(job)
+	if status.StartedAt == nil || status.FinishedAt == nil {
+		return
+	}
+	duration := metav1.Duration{Duration: status.FinishedAt.Sub(status.StartedAt.Time)}
+	status.Duration = &duration
+	if !firstRecorded || status.Phase != porterv1.PhaseSucceeded {
+		return
+	}
+
+	status.RecentDurations = append(status.RecentDurations, duration)
+	if n := len(status.RecentDurations); n > maxRecentDurations {
+		status.RecentDurations = status.RecentDurations[n-maxRecentDurations:]
+	}
+	var total time.Duration
+	for _, d := range status.RecentDurations {
+		total += d.Duration
+	}
+	status.EstimatedDuration = &metav1.Duration{Duration: total / time.Duration(len(status.RecentDurations))}
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestSetJobStatus_RunTimes(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Status.RecentDurations = []metav1.Duration{{Duration: time.Minute}, {Duration: 3 * time.Minute}}
+	r := newTestReconciler(t, inst)
+
+	start := metav1.NewTime(time.Now().Add(-10 * time.Minute).Truncate(time.Second))
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: makeJobName(inst), Namespace: inst.Namespace}}
+	job.Status.StartTime = &start
+
+	// While the job runs, only the start time is known
+	g.Expect(r.setJobStatus(context.Background(), inst, job)).To(Succeed())
+	g.Expect(inst.Status.StartedAt).To(Equal(&start))
+	g.Expect(inst.Status.FinishedAt).To(BeNil())
+	g.Expect(inst.Status.Duration).To(BeNil())
+
+	finish := metav1.NewTime(start.Add(5 * time.Minute))
+	job.Status.CompletionTime = &finish
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	g.Expect(r.setJobStatus(context.Background(), inst, job)).To(Succeed())
+	g.Expect(inst.Status.FinishedAt).To(Equal(&finish))
+	g.Expect(inst.Status.Duration).To(Equal(&metav1.Duration{Duration: 5 * time.Minute}))
+	g.Expect(inst.Status.RecentDurations).To(HaveLen(3))
+	g.Expect(inst.Status.EstimatedDuration).To(Equal(&metav1.Duration{Duration: 3 * time.Minute}))
+
+	// The same run is only averaged once
+	g.Expect(r.setJobStatus(context.Background(), inst, job)).To(Succeed())
+	g.Expect(inst.Status.RecentDurations).To(HaveLen(3))
+	g.Expect(inst.Status.Phase).To(Equal(porterv1.PhaseSucceeded))
+}
+
+func TestGetJobFinishTime(t *testing.T) {
+	g := NewWithT(t)
+	failedAt := metav1.NewTime(time.Now().Truncate(time.Second))
+	job := &batchv1.Job{}
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, LastTransitionTime: failedAt}}
+
+	g.Expect(getJobFinishTime(job)).To(Equal(&failedAt))
+	g.Expect(getJobFinishTime(&batchv1.Job{})).To(BeNil())
+}
@@ -0,0 +1,220 @@
+package controllers
+
+// Reasons used on the Events and status conditions that the operator records
+// against an Installation.
+// These are a stable contract for tooling built on top of the operator, so
+// existing values must not be changed once released.
+const (
+	// ReasonJobCreated is recorded when a porter agent job is created for an Installation.
+	ReasonJobCreated = "JobCreated"
+
+	// ReasonJobCreateFailed is recorded when the porter agent job could not be created.
+	ReasonJobCreateFailed = "JobCreateFailed"
+
+	// ReasonJobRejected is used when the porter agent job was refused by an
+	// admission webhook or admission plugin, e.g. a policy engine.
+	ReasonJobRejected = "JobRejected"
+
+	// ReasonJobInvalid is used when the API server rejected the porter agent
+	// job because it failed validation, e.g. a field that the cluster's
+	// version of the Job API does not support.
+	ReasonJobInvalid = "JobInvalid"
+
+	// ReasonJobAPIUnavailable is used when the cluster does not serve the
+	// batch/v1 Job API that the operator uses.
+	ReasonJobAPIUnavailable = "JobAPIUnavailable"
+
+	// ReasonQuotaExceeded is recorded when the porter job cannot be created yet
+	// because of the namespace's resource quota.
+	ReasonQuotaExceeded = "QuotaExceeded"
+
+	// ReasonOverBudget is used when the porter job is not created yet because
+	// it would go over the namespace's resource budget.
+	ReasonOverBudget = "OverBudget"
+
+	// ReasonWithinBudget is used when a porter job that was waiting for the
+	// namespace's resource budget fits in it.
+	ReasonWithinBudget = "WithinBudget"
+
+	// ReasonImagePullFailed is used when an image of the porter agent pod
+	// cannot be pulled, for example ImagePullBackOff.
+	ReasonImagePullFailed = "ImagePullFailed"
+
+	// ReasonUnschedulable is used when the porter agent pod cannot be
+	// scheduled, for example no node has enough resources or matches its
+	// node selector.
+	ReasonUnschedulable = "Unschedulable"
+
+	// ReasonScheduled is used when the porter agent pod that could not be
+	// scheduled is scheduled.
+	ReasonScheduled = "Scheduled"
+
+	// ReasonMissingInputs is used when the Installation does not provide the
+	// parameters or credentials required by the bundle.
+	ReasonMissingInputs = "MissingInputs"
+
+	// ReasonUnknownParameters is used when the Installation sets parameters
+	// that its bundle does not declare.
+	ReasonUnknownParameters = "UnknownParameters"
+
+	// ReasonReferenceMismatch is used when the Installation's reference is a
+	// different bundle than the one that is installed.
+	ReasonReferenceMismatch = "ReferenceMismatch"
+
+	// ReasonNeedsInput is used when the porter job has been running for longer
+	// than the needsInputTimeout, and may be waiting for input.
+	ReasonNeedsInput = "NeedsInput"
+
+	// ReasonJobFinished is used when the porter job that may have been waiting
+	// for input finished.
+	ReasonJobFinished = "JobFinished"
+
+	// ReasonDriftDetected is used when the bundle's status action reports that
+	// the installed resources have drifted from the bundle.
+	ReasonDriftDetected = "DriftDetected"
+
+	// ReasonNoDrift is used when the bundle's status action reports that the
+	// installed resources match the bundle.
+	ReasonNoDrift = "NoDrift"
+
+	// ReasonOutputsTooLarge is used when outputs are left out of the outputs
+	// Secret, or file outputs out of the outputs ConfigMap, because they
+	// would go over its size limit.
+	ReasonOutputsTooLarge = "OutputsTooLarge"
+
+	// ReasonOutputsPublished is used when every output fits in the outputs
+	// Secret, and every file output in the outputs ConfigMap, again.
+	ReasonOutputsPublished = "OutputsPublished"
+
+	// ReasonMissingServiceAccount is used when the porter agent's service
+	// account does not exist.
+	ReasonMissingServiceAccount = "MissingServiceAccount"
+
+	// ReasonMissingAgentPermissions is used when the porter agent's service
+	// account is not permitted to run the bundle with the kubernetes driver.
+	ReasonMissingAgentPermissions = "MissingAgentPermissions"
+
+	// ReasonInvalidReference is used when the Installation references a
+	// credential or parameter set that is invalid, or qualified with a
+	// namespace that porter can not look it up in.
+	ReasonInvalidReference = "InvalidReference"
+
+	// ReasonInvalidBundleRef is used when the Installation's bundleRef is not
+	// a Bundle in the catalog, or the Bundle is not approved.
+	ReasonInvalidBundleRef = "InvalidBundleRef"
+
+	// ReasonInvalidAgentArgs is used when the Installation's agentArgs are not
+	// valid porter flags, or override a flag managed by the operator.
+	ReasonInvalidAgentArgs = "InvalidAgentArgs"
+
+	// ReasonInvalidAgentCommand is used when the Installation's agentCommand
+	// does not start with an executable, or sets a flag managed by the operator.
+	ReasonInvalidAgentCommand = "InvalidAgentCommand"
+
+	// ReasonInvalidApply is used when the Installation uses apply with settings
+	// that can not be described in a porter installation file.
+	ReasonInvalidApply = "InvalidApply"
+
+	// ReasonInvalidValidateOnly is used when the Installation uses
+	// validateOnly with settings that install or uninstall the bundle.
+	ReasonInvalidValidateOnly = "InvalidValidateOnly"
+
+	// ReasonDockerHostAccessUnsupported is used when the Installation sets
+	// allowDockerHostAccess, which porter's kubernetes driver does not support.
+	ReasonDockerHostAccessUnsupported = "DockerHostAccessUnsupported"
+
+	// ReasonInvalidPorterHome is used when the Installation's porter home is
+	// not an absolute path, does not have porter installed, or its volume
+	// does not have a porter home.
+	ReasonInvalidPorterHome = "InvalidPorterHome"
+
+	// ReasonAgentPermissionsNotAllowed is used when the Installation's
+	// agentPermissions are not granted, because the Installation does not
+	// set a service account, the operator's allowedAgentPermissions do not
+	// allow them, or the operator does not hold them.
+	ReasonAgentPermissionsNotAllowed = "AgentPermissionsNotAllowed"
+
+	// ReasonInvalidPluginConfig is used when the Installation's pluginConfig
+	// does not name a plugin, or cannot be rendered into porter's config file.
+	ReasonInvalidPluginConfig = "InvalidPluginConfig"
+
+	// ReasonBundleResolved is used when the Installation's bundle reference
+	// was found in its registry.
+	ReasonBundleResolved = "BundleResolved"
+
+	// ReasonBundleNotResolved is used when the Installation's bundle reference
+	// could not be found in its registry, for example because of a typo or a
+	// missing tag.
+	ReasonBundleNotResolved = "BundleNotResolved"
+
+	// ReasonBundleUnverified is used when the Installation's bundle reference
+	// could not be looked up because its registry could not be reached or
+	// denied access. The Installation runs anyway.
+	ReasonBundleUnverified = "BundleUnverified"
+
+	// ReasonInvalidRelocationMap is used when the Installation's
+	// RelocationMapConfigMap does not have a valid relocation mapping.
+	ReasonInvalidRelocationMap = "InvalidRelocationMap"
+
+	// ReasonInvalidReconcileAction is used when the Installation's
+	// reconcileAction is not scheduled, or uninstalls the bundle.
+	ReasonInvalidReconcileAction = "InvalidReconcileAction"
+
+	// ReasonReconcileActionSucceeded is used when the Installation's
+	// reconcileAction succeeded at its scheduled time.
+	ReasonReconcileActionSucceeded = "ReconcileActionSucceeded"
+
+	// ReasonReconcileActionFailed is used when the Installation's
+	// reconcileAction failed at its scheduled time.
+	ReasonReconcileActionFailed = "ReconcileActionFailed"
+
+	// ReasonInvalidSetting is used when a setting of the Installation, or of
+	// a porter ConfigMap, can not be used, and the Installation is not retried
+	// until it is fixed.
+	ReasonInvalidSetting = "InvalidSetting"
+
+	// ReasonWaitingForDependencies is used when the Installation waits for
+	// the Installations that it depends on to succeed.
+	ReasonWaitingForDependencies = "WaitingForDependencies"
+
+	// ReasonDependenciesSucceeded is used when the Installations that the
+	// Installation depends on have succeeded.
+	ReasonDependenciesSucceeded = "DependenciesSucceeded"
+
+	// ReasonInvalidParameterTemplate is used when a template in the
+	// Installation's parameters can not be resolved.
+	ReasonInvalidParameterTemplate = "InvalidParameterTemplate"
+
+	// ReasonInvalidSchedule is used when the Installation's schedule is not a valid cron expression.
+	ReasonInvalidSchedule = "InvalidSchedule"
+
+	// ReasonScheduledRunSkipped is recorded when a scheduled run is skipped
+	// because a previous job is still running.
+	ReasonScheduledRunSkipped = "ScheduledRunSkipped"
+
+	// ReasonRetryFailed is recorded when a failed Installation is run again
+	// because of the porter.sh/retry-failed annotation.
+	ReasonRetryFailed = "RetryFailed"
+
+	// ReasonParametersChanged is used when an Installation is upgraded because
+	// a watched parameter set changed.
+	ReasonParametersChanged = "ParametersChanged"
+
+	// ReasonPaused is used when the Installation is paused.
+	ReasonPaused = "Paused"
+
+	// ReasonResumed is used when a paused Installation is resumed.
+	ReasonResumed = "Resumed"
+
+	// ReasonUninstallFailed is used when the bundle could not be uninstalled
+	// after the Installation was deleted.
+	ReasonUninstallFailed = "UninstallFailed"
+
+	// ReasonForceDeleted is recorded when the Installation is removed without
+	// uninstalling the bundle.
+	ReasonForceDeleted = "ForceDeleted"
+
+	// ReasonNamespaceTerminating is recorded when the Installation is removed
+	// without uninstalling the bundle because its namespace is being deleted.
+	ReasonNamespaceTerminating = "NamespaceTerminating"
+)
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// PodLogReader reads the logs of a container in a pod.
+type PodLogReader interface {
+	GetLogs(ctx context.Context, namespace string, pod string, container string) ([]byte, error)
+}
+
+// NewPodLogReader returns a PodLogReader that reads logs from the cluster.
+func NewPodLogReader(clientset kubernetes.Interface) PodLogReader {
+	return clientsetLogReader{clientset}
+}
+
+type clientsetLogReader struct {
+	clientset kubernetes.Interface
+}
+
+func (c clientsetLogReader) GetLogs(ctx context.Context, namespace string, pod string, container string) ([]byte, error) {
+	return c.clientset.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{Container: container}).DoRaw(ctx)
+}
+
+// checkValidateOnly validates the Installation's settings when it uses
+// validateOnly, in case the Installation was created without the webhook. An
+// Installation with invalid settings is not run until it is fixed.
+func (r *InstallationReconciler) checkValidateOnly(ctx context.Context, inst *porterv1.Installation) (bool, error) {
+	errs := porterv1.ValidateValidateOnly(inst.Spec, field.NewPath("spec"))
+	if len(errs) == 0 {
+		return true, nil
+	}
+
+	msg := fmt.Sprintf("Invalid validateOnly: %s", errs.ToAggregate())
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonInvalidValidateOnly, msg)
+
+	return false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonInvalidValidateOnly, msg)
+}
+
+// makeExplainArgs returns the porter flags that explain the Installation's
+// bundle, porter explain --reference=REFERENCE --output=json. Debug output is
+// not enabled because the explanation is read from the agent's logs.
+func makeExplainArgs(bundleArg string) []string {
+	return []string{"explain", bundleArg, "--output=json"}
+}
+
+// getExplanation reads the output of porter explain from the logs of a
+// validateOnly job that succeeded. The explanation is left out of the status,
+// instead of failing the Installation, when the logs can not be read.
+func (r *InstallationReconciler) getExplanation(ctx context.Context, job *batchv1.Job) *porterv1.BundleExplanation {
+	log := r.getLogger(ctx)
+	if r.PodLogs == nil {
+		log.Info("could not read the bundle's explanation, pod logs are not available", "job", job.Name)
+		return nil
+	}
+
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name})
+	if err != nil {
+		log.Info("could not read the bundle's explanation", "job", job.Name, "reason", err.Error())
+		return nil
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded {
+			continue
+		}
+		logs, err := r.PodLogs.GetLogs(ctx, pod.Namespace, pod.Name, job.Name)
+		if err != nil {
+			log.Info("could not read the bundle's explanation", "job", job.Name, "pod", pod.Name, "reason", err.Error())
+			return nil
+		}
+		explanation, err := parseExplanation(logs)
+		if err != nil {
+			log.Info("could not read the bundle's explanation", "job", job.Name, "pod", pod.Name, "reason", err.Error())
+			return nil
+		}
+		return explanation
+	}
+	return nil
+}
+
+// parseExplanation finds the JSON output of porter explain in the agent's
+// logs, which may start with messages from the agent before porter runs.
+func parseExplanation(logs []byte) (*porterv1.BundleExplanation, error) {
+	for i := 0; i < len(logs); i++ {
+		if logs[i] != '{' || (i > 0 && logs[i-1] != '\n') {
+			continue
+		}
+		explanation := &porterv1.BundleExplanation{}
+		if err := json.NewDecoder(bytes.NewReader(logs[i:])).Decode(explanation); err == nil && explanation.Name != "" {
+			return explanation, nil
+		}
+	}
+	return nil, errors.New("the output of porter explain was not found in the logs")
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// staticPodLogs returns the same logs for every container.
+type staticPodLogs string
+
+func (l staticPodLogs) GetLogs(ctx context.Context, namespace string, pod string, container string) ([]byte, error) {
+	return []byte(l), nil
+}
+
+const testExplainLogs = `Setting up porter home...
+{
+  "name": "porter-hello",
+  "description": "An example Porter configuration",
+  "version": "0.1.1",
+  "credentials": [
+    {"name": "kubeconfig", "description": "", "required": true, "applyTo": "All"}
+  ],
+  "parameters": [
+    {"name": "name", "type": "string", "default": "porter", "applyTo": "install,upgrade", "description": "", "required": false, "sensitive": false}
+  ],
+  "outputs": [
+    {"name": "greeting", "type": "string", "applyTo": "All", "description": ""}
+  ]
+}
+`
+
+func TestParseExplanation(t *testing.T) {
+	g := NewWithT(t)
+
+	explanation, err := parseExplanation([]byte(testExplainLogs))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(explanation).To(Equal(&porterv1.BundleExplanation{
+		Name:        "porter-hello",
+		Description: "An example Porter configuration",
+		Version:     "0.1.1",
+		Credentials: []porterv1.ExplainedCredential{{Name: "kubeconfig", Required: true, ApplyTo: "All"}},
+		Parameters:  []porterv1.ExplainedParameter{{Name: "name", Type: "string", ApplyTo: "install,upgrade"}},
+		Outputs:     []porterv1.ExplainedOutput{{Name: "greeting", Type: "string", ApplyTo: "All"}},
+	}))
+
+	_, err = parseExplanation([]byte("Error: bundle not found\n"))
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestCreateJobForInstallation_ValidateOnly(t *testing.T) {
+	t.Run("explain", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		inst.Spec.ValidateOnly = true
+		inst.Spec.Parameters = []string{"name=hello"}
+		jobName := makeJobName(inst)
+		r := newTestReconciler(t, inst)
+
+		g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+		job := &batchv1.Job{}
+		g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+		g.Expect(job.Spec.Template.Spec.Containers[0].Args).To(Equal([]string{"explain", "--reference=" + inst.Spec.Reference, "--output=json"}))
+	})
+
+	t.Run("uninstall on delete", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		inst.Spec.ValidateOnly = true
+		inst.Spec.UninstallOnDelete = true
+		r := newTestReconciler(t, inst)
+
+		g.Expect(r.createJobForInstallation(context.Background(), makeJobName(inst), inst, nil)).To(Succeed())
+
+		jobs := &batchv1.JobList{}
+		g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+		g.Expect(jobs.Items).To(BeEmpty())
+		cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+		g.Expect(cond).ToNot(BeNil())
+		g.Expect(cond.Reason).To(Equal(ReasonInvalidValidateOnly))
+	})
+}
+
+func TestSetJobStatus_ValidateOnly(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.ValidateOnly = true
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: makeJobName(inst), Namespace: inst.Namespace}}
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: job.Name + "-abc12", Namespace: inst.Namespace, Labels: map[string]string{"job-name": job.Name}},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodSucceeded,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: job.Name, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					Message: `{"action":"explain","status":"succeeded","bundleVersion":"0.1.1"}`,
+				}}},
+			},
+		},
+	}
+	r := newTestReconciler(t, inst, pod)
+	r.PodLogs = staticPodLogs(testExplainLogs)
+
+	g.Expect(r.setJobStatus(context.Background(), inst, job)).To(Succeed())
+	g.Expect(inst.Status.Phase).To(Equal(porterv1.PhaseSucceeded))
+	g.Expect(inst.Status.Explanation).ToNot(BeNil())
+	g.Expect(inst.Status.Explanation.Name).To(Equal("porter-hello"))
+	g.Expect(inst.Status.InstalledBundleVersion).To(BeEmpty(), "nothing was installed")
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// getImagePullFailure returns why the image of a container in the porter
+// agent pod, including its init containers, cannot be pulled. An empty
+// message is returned when the images are pulling normally.
+func (r *InstallationReconciler) getImagePullFailure(ctx context.Context, job *batchv1.Job) (string, error) {
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name})
+	if err != nil {
+		return "", errors.Wrapf(err, "could not list the pods for porter job %s/%s", job.Namespace, job.Name)
+	}
+
+	for _, pod := range pods.Items {
+		var statuses []corev1.ContainerStatus
+		statuses = append(statuses, pod.Status.InitContainerStatuses...)
+		statuses = append(statuses, pod.Status.ContainerStatuses...)
+		for _, c := range statuses {
+			if c.State.Waiting == nil {
+				continue
+			}
+			switch c.State.Waiting.Reason {
+			case "ErrImagePull", "ImagePullBackOff":
+				return fmt.Sprintf("Could not pull image %s for porter job %s: %s", c.Image, job.Name, c.State.Waiting.Message), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// checkImagePull reports on the Installation when the porter agent pod is
+// stuck because an image cannot be pulled, instead of the run hanging
+// silently, and clears the Failed condition once the image is pulled.
+func (r *InstallationReconciler) checkImagePull(ctx context.Context, inst *porterv1.Installation, job *batchv1.Job) (bool, error) {
+	msg, err := r.getImagePullFailure(ctx, job)
+	if err != nil {
+		return false, err
+	}
+
+	existing := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+	failing := existing != nil && existing.Status == metav1.ConditionTrue && existing.Reason == ReasonImagePullFailed
+	if msg == "" {
+		if failing {
+			return false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionFalse, ReasonJobCreated, "Pulled the images for porter job "+job.Name)
+		}
+		return false, nil
+	}
+
+	r.getLogger(ctx).Info("porter job is waiting on an image that cannot be pulled", "job", job.Name, "reason", msg)
+	if !failing || existing.Message != msg {
+		r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonImagePullFailed, msg)
+	}
+	return true, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonImagePullFailed, msg)
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestCheckImagePull(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: makeJobName(inst), Namespace: inst.Namespace}}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: job.Name + "-abc12", Namespace: inst.Namespace, Labels: map[string]string{"job-name": job.Name}},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name:  job.Name,
+					Image: "ghcr.io/getporter/porter:kubernetes-v1.0.0",
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+						Reason:  "ImagePullBackOff",
+						Message: "Back-off pulling image",
+					}},
+				},
+			},
+		},
+	}
+	r := newTestReconciler(t, inst, pod)
+	recorder := r.Recorder.(*record.FakeRecorder)
+
+	failed, err := r.checkImagePull(context.Background(), inst, job)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(failed).To(BeTrue())
+	cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+	g.Expect(cond).ToNot(BeNil())
+	g.Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+	g.Expect(cond.Reason).To(Equal(ReasonImagePullFailed))
+	g.Expect(cond.Message).To(ContainSubstring("Back-off pulling image"))
+	g.Expect(recorder.Events).To(HaveLen(1))
+
+	// The event is only recorded once while the pod is stuck
+	_, err = r.checkImagePull(context.Background(), inst, job)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(recorder.Events).To(HaveLen(1))
+
+	// Clear the condition once the image is pulled
+	pod.Status.ContainerStatuses[0].State = corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	g.Expect(r.Status().Update(context.Background(), pod)).To(Succeed())
+	failed, err = r.checkImagePull(context.Background(), inst, job)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(failed).To(BeFalse())
+	g.Expect(meta.IsStatusConditionTrue(inst.Status.Conditions, porterv1.ConditionFailed)).To(BeFalse())
+}
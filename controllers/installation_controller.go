@@ -3,36 +3,181 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/trace"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	porterv1 "get.porter.sh/operator/api/v1"
 )
 
+const (
+	// caBundlePath is where the Installation's CABundleConfigMap is mounted in the agent.
+	caBundlePath = "/porter-ca"
+
+	// caBundleKey is the key in the CABundleConfigMap with the CA certificates.
+	caBundleKey = "ca.crt"
+
+	// secretsStorePath is where the Installation's SecretsStore volume is mounted in the agent.
+	secretsStorePath = "/porter-secrets-store"
+
+	// secretsStoreDriver is the name of the Secrets Store CSI driver.
+	secretsStoreDriver = "secrets-store.csi.k8s.io"
+
+	// systemCertsPath is the directory with the CA certificates of the agent image.
+	systemCertsPath = "/etc/ssl/certs"
+
+	// annotationGeneration is the generation of the Installation that a job runs.
+	annotationGeneration = "porter.sh/generation"
+
+	// annotationAction is the bundle action that a job runs, e.g. install.
+	annotationAction = "porter.sh/action"
+
+	// annotationApply is set to true on a job that applies an installation
+	// file instead of running an action.
+	annotationApply = "porter.sh/apply"
+
+	// annotationReference is the reference of the bundle that a job runs.
+	annotationReference = "porter.sh/reference"
+
+	// annotationBundleDigest is the digest that the reference of the bundle
+	// that a job runs resolved to when the job was created.
+	annotationBundleDigest = "porter.sh/bundle-digest"
+
+	// annotationBundleVersion is the version of the bundle that a job runs,
+	// when the operator could read its bundle.json.
+	annotationBundleVersion = "porter.sh/bundle-version"
+
+	// activeJobRequeueDelay is how long to wait before checking again if an
+	// Installation's active job has completed.
+	activeJobRequeueDelay = 10 * time.Second
+
+	// operatorPausedRequeueDelay is how long to wait before checking again if
+	// the operator is still paused. Changes to the porter ConfigMap do not
+	// trigger a reconcile.
+	operatorPausedRequeueDelay = time.Minute
+)
+
 // InstallationReconciler reconciles a Installation object
 type InstallationReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// OperatorNamespace is the namespace where the operator is deployed. The
+	// porter ConfigMap in this namespace configures defaults for all Installations.
+	OperatorNamespace string
+
+	// Defaults are the lowest precedence configuration for the porter agent,
+	// using the same keys as the porter ConfigMap.
+	Defaults map[string]string
+
+	// MaxJobsPerNamespace limits how many porter jobs run at the same time in
+	// a namespace. When zero, the number of jobs is not limited.
+	MaxJobsPerNamespace int
+
+	// MaxRequeueDelay caps the backoff between retries of an Installation that
+	// failed to reconcile. When zero, the controller's default backoff is used.
+	MaxRequeueDelay time.Duration
+
+	// InstallationSelector limits the operator to Installations with matching
+	// labels. When nil, all Installations are reconciled.
+	InstallationSelector labels.Selector
+
+	// WatchNamespaces limits the operator to Installations in these
+	// namespaces. When empty, Installations in every namespace are reconciled.
+	WatchNamespaces []string
+
+	// ExcludeNamespaces are namespaces whose Installations are ignored, even
+	// when they are in WatchNamespaces.
+	ExcludeNamespaces []string
+
+	// Paused stops the operator from running any Installation, as if each
+	// one was paused. Deleted Installations are still uninstalled.
+	Paused bool
+
+	// PodLogs reads the logs of the porter agent, which has the bundle's
+	// explanation when the Installation uses ValidateOnly.
+	PodLogs PodLogReader
+
+	// TracerProvider records spans of each reconcile, such as resolving the
+	// configuration and creating the job. When nil, reconciles are not traced.
+	TracerProvider trace.TracerProvider
+
+	// porterVersions caches the porter versions that version ranges resolved to.
+	porterVersions registryCache
+
+	// bundleDigests caches the digests that bundle references resolved to.
+	bundleDigests registryCache
+
+	// bundleDefinitions caches the bundle.json of bundle references.
+	bundleDefinitions registryCache
+
+	// listTags lists the tags of an image repository. When nil, the tags are
+	// listed from the registry.
+	listTags func(ctx context.Context, repository string) ([]string, error)
+
+	// getDigest returns the digest of the manifest of an image reference,
+	// using the credentials in auth. When nil, the manifest is looked up in
+	// the registry.
+	getDigest func(ctx context.Context, reference string, auth registryAuth) (string, error)
+
+	// getBundle returns the bundle.json of a bundle reference, using the
+	// credentials in auth. When nil, the bundle is read from the registry.
+	getBundle func(ctx context.Context, reference string, auth registryAuth) (*bundleDefinition, error)
+}
+
+// getLogger returns the logger for the current request, which Reconcile tags
+// with the Installation, falling back to the reconciler's logger.
+func (r *InstallationReconciler) getLogger(ctx context.Context) logr.Logger {
+	if log := logr.FromContext(ctx); log != nil {
+		return log
+	}
+	return r.Log
 }
 
 // +kubebuilder:rbac:groups=porter.sh,resources=installations,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=porter.sh,resources=installations/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=porter.sh,resources=installations/finalizers,verbs=update
+// +kubebuilder:rbac:groups=porter.sh,resources=bundles,verbs=get;list;watch
 // +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
-// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=pods/log,verbs=get
+// +kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -44,33 +189,193 @@ type InstallationReconciler struct {
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.7.0/pkg/reconcile
 func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := r.startSpan(ctx, "Reconcile",
+		label.String("namespace", req.Namespace), label.String("installation", req.Name))
+	defer span.End()
+
 	// Retrieve the Installation
 	inst := &porterv1.Installation{}
 	err := r.Get(ctx, req.NamespacedName, inst)
 	if err != nil {
-		return ctrl.Result{}, errors.Wrapf(err, "could not find bundle installation %s/%s", req.Namespace, req.Name)
+		err = errors.Wrapf(err, "could not find bundle installation %s/%s", req.Namespace, req.Name)
+		recordSpanError(span, err)
+		return ctrl.Result{}, err
+	}
+	span.SetAttributes(label.Int64("generation", inst.Generation))
+
+	// Tag every log message for this request with the Installation
+	log := r.Log.WithValues("installation", req.NamespacedName, "generation", inst.Generation)
+	ctx = logr.NewContext(ctx, log)
+
+	result, err := r.reconcileInstallation(ctx, inst)
+	recordSpanError(span, err)
+	return r.handleReconcileError(ctx, inst, result, err)
+}
+
+// reconcileInstallation moves the Installation towards the state in its spec,
+// creating the porter job that runs its action when needed.
+func (r *InstallationReconciler) reconcileInstallation(ctx context.Context, inst *porterv1.Installation) (ctrl.Result, error) {
+	log := r.getLogger(ctx)
+	var err error
+
+	// Another instance of the operator handles Installations that are not selected
+	if !r.isSelected(inst) {
+		return ctrl.Result{}, nil
+	}
+
+	if !inst.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, inst)
+	}
+	if err = r.reconcileFinalizer(ctx, inst); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Leave paused installations alone, including any job that is already running
+	if inst.IsPaused() {
+		log.Info("skipping paused Installation")
+		err = r.setCondition(ctx, inst, porterv1.ConditionPaused, metav1.ConditionTrue, ReasonPaused, "The Installation is paused")
+		return ctrl.Result{}, err
+	}
+	if paused, source := r.isOperatorPaused(ctx); paused {
+		log.Info("skipping Installation, the operator is paused", "source", source)
+		err = r.setCondition(ctx, inst, porterv1.ConditionPaused, metav1.ConditionTrue, ReasonPaused, "The operator is paused by "+source)
+		return ctrl.Result{RequeueAfter: operatorPausedRequeueDelay}, err
+	}
+	if meta.IsStatusConditionTrue(inst.Status.Conditions, porterv1.ConditionPaused) {
+		err = r.setCondition(ctx, inst, porterv1.ConditionPaused, metav1.ConditionFalse, ReasonResumed, "The Installation was resumed")
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err = r.reconcileRetryFailed(ctx, inst); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err = r.reconcileParameterSetChanges(ctx, inst); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// An Installation with a ReconcileAction runs its action when it is
+	// changed, and the ReconcileAction at the scheduled times
+	if inst.Spec.Schedule != "" && inst.Spec.ReconcileAction == "" {
+		return r.reconcileSchedule(ctx, inst)
+	}
+
+	// Nothing to do until the Installation is changed, other than checking for
+	// drift, running the ReconcileAction, publishing its outputs and removing
+	// the artifacts of previous jobs
+	if inst.IsDone() {
+		var result ctrl.Result
+		if inst.Spec.ReconcileAction != "" {
+			result, err = r.reconcileScheduledAction(ctx, inst)
+		} else {
+			result, err = r.reconcileDrift(ctx, inst)
+		}
+		if err != nil {
+			return result, err
+		}
+		if err = r.publishOutputs(ctx, inst); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err = r.publishFileOutputs(ctx, inst); err != nil {
+			return ctrl.Result{}, err
+		}
+		cleanupAfter, err := r.cleanupArtifacts(ctx, inst)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if cleanupAfter > 0 && (result.RequeueAfter == 0 || cleanupAfter < result.RequeueAfter) {
+			result.RequeueAfter = cleanupAfter
+		}
+		return result, nil
 	}
 
 	// Retrieve the Job running the porter action
 	//  - job metadata contains a reference to the bundle installation and CRD revision
 	porterJob := &batchv1.Job{}
-	jobName := req.Name + "-" + inst.ResourceVersion
-	err = r.Get(ctx, types.NamespacedName{Name: jobName, Namespace: req.Namespace}, porterJob)
+	jobName, err := r.getJobName(ctx, inst, makeJobName(inst))
 	if err != nil {
-		// Create the Job if not found
-		if apierrors.IsNotFound(err) {
-			err = r.createJobForInstallation(ctx, jobName, inst)
-			if err != nil {
-				return ctrl.Result{}, err
-			}
-		} else {
-			return ctrl.Result{}, errors.Wrapf(err, "could not query for the bundle installation job %s/%s", req.Namespace, porterJob.Name)
+		return ctrl.Result{}, err
+	}
+	err = r.Get(ctx, types.NamespacedName{Name: jobName, Namespace: inst.Namespace}, porterJob)
+	if err == nil {
+		// Keep the status in sync with the job as it runs
+		err = r.setJobStatus(ctx, inst, porterJob)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		needsInputAfter, err := r.checkNeedsInput(ctx, inst, porterJob)
+		if err != nil || isJobDone(porterJob.Status) {
+			return ctrl.Result{}, err
+		}
+		if err = r.reconcileProgress(ctx, inst, porterJob); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// Check back on a pod that is stuck pulling an image, or cannot be
+		// scheduled, to notice when it recovers
+		pullFailed, err := r.checkImagePull(ctx, inst, porterJob)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		unschedulable, err := r.checkScheduling(ctx, inst, porterJob)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if pullFailed || unschedulable {
+			return ctrl.Result{RequeueAfter: activeJobRequeueDelay}, nil
+		}
+		// Check back when the job would be waiting on input for too long
+		return ctrl.Result{RequeueAfter: needsInputAfter}, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, errors.Wrapf(err, "could not query for the bundle installation job %s/%s", inst.Namespace, porterJob.Name)
+	}
+
+	jobs, err := r.listJobs(ctx, inst)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Pick up the latest job, which may have been created while the operator was
+	// offline, or named differently by a previous version of the operator
+	if latestJob := getLatestJob(jobs); latestJob != nil {
+		err = r.setJobStatus(ctx, inst, latestJob)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if isCurrentJob(latestJob, inst) {
+			log.Info("adopted porter job", "job", latestJob.Name)
+			return ctrl.Result{}, nil
 		}
 	}
 
+	// Create the Job if not found, only running one job at a time for an installation
+	if activeJob := getActiveJob(jobs); activeJob != nil {
+		log.Info("waiting for porter job to complete before running Installation", "job", activeJob.Name)
+		return ctrl.Result{RequeueAfter: activeJobRequeueDelay}, nil
+	}
+
+	// Let a burst of changes settle before running the Installation
+	wait, err := r.waitForStabilization(ctx, inst)
+	if err != nil || wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, err
+	}
+
+	// Check back on the Installations that it depends on until they succeed
+	wait, err = r.waitForDependencies(ctx, inst)
+	if err != nil || wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, err
+	}
+
+	result, err := r.runJob(ctx, jobName, inst, nil)
+	if err != nil || !result.IsZero() {
+		return result, err
+	}
+
 	// How to prevent concurrent jobs?
 	//  1. Have porter itself wait for pending actions to complete, i.e. storage locks (added to backlog)
-	//  1. * Requeue with backoff until we can run it (May run into problematic backoff behavior)
+	//  1. * Requeue with backoff until we can run it (May run into problematic backoff behavior) <- current approach
 	//  1. Use job dependencies with either init container (problematic because of init container timeouts)
 
 	// Update Installation events with job created
@@ -81,29 +386,409 @@ func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	return ctrl.Result{}, nil
 }
 
-func (r *InstallationReconciler) createJobForInstallation(ctx context.Context, name string, inst *porterv1.Installation) error {
-	r.Log.Info(fmt.Sprintf("creating porter job %s/%s for Installation %s/%s", inst.Namespace, name, inst.Namespace, inst.Name))
+// listJobs returns the porter jobs created for the Installation.
+func (r *InstallationReconciler) listJobs(ctx context.Context, inst *porterv1.Installation) ([]batchv1.Job, error) {
+	jobs := &batchv1.JobList{}
+	err := r.List(ctx, jobs, client.InNamespace(inst.Namespace), client.MatchingLabels{
+		"porter":       "true",
+		"installation": inst.Name,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not list the porter jobs for Installation %s/%s", inst.Namespace, inst.Name)
+	}
+	return jobs.Items, nil
+}
+
+// getActiveJob returns the porter job that is still running, if any.
+func getActiveJob(jobs []batchv1.Job) *batchv1.Job {
+	for i := range jobs {
+		if !isJobDone(jobs[i].Status) {
+			return &jobs[i]
+		}
+	}
+	return nil
+}
+
+// getLatestJob returns the most recently created porter job that ran the
+// Installation's action, if any.
+func getLatestJob(jobs []batchv1.Job) *batchv1.Job {
+	var latest *batchv1.Job
+	for i := range jobs {
+		if isMaintenanceJob(&jobs[i]) {
+			continue
+		}
+		if latest == nil || latest.CreationTimestamp.Before(&jobs[i].CreationTimestamp) {
+			latest = &jobs[i]
+		}
+	}
+	return latest
+}
+
+// getJobGeneration returns the generation of the Installation that the job
+// ran. Jobs created before the generation annotation was added are only
+// recognized when they have the name of the current generation's job.
+func getJobGeneration(job *batchv1.Job, inst *porterv1.Installation) (int64, bool) {
+	if v, ok := job.Annotations[annotationGeneration]; ok {
+		gen, err := strconv.ParseInt(v, 10, 64)
+		return gen, err == nil
+	}
+	if job.Name == makeJobName(inst) {
+		return inst.Generation, true
+	}
+	return 0, false
+}
+
+// isCurrentJob determines if the job ran the current generation, and rerun,
+// of the Installation.
+func isCurrentJob(job *batchv1.Job, inst *porterv1.Installation) bool {
+	gen, ok := getJobGeneration(job, inst)
+	return ok && gen == inst.Generation && job.Annotations[porterv1.AnnotationRerun] == inst.GetRerun()
+}
+
+// isJobDone determines if the job has either completed or failed.
+func isJobDone(status batchv1.JobStatus) bool {
+	for _, c := range status.Conditions {
+		if (c.Type == batchv1.JobFailed || c.Type == batchv1.JobComplete) && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// isJobFailed determines if the job has failed.
+func isJobFailed(status batchv1.JobStatus) bool {
+	for _, c := range status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// runJob creates a job to run the Installation's action, after resolving the
+// bundle from the catalog, the parameter templates and the default action,
+// and checking that the bundle can be run. When the namespace
+// does not have room for another job, either because of the operator's limits
+// or the namespace's resource quota, the Installation is requeued instead.
+func (r *InstallationReconciler) runJob(ctx context.Context, jobName string, inst *porterv1.Installation, jobLabels map[string]string) (ctrl.Result, error) {
+	run, ok, err := r.resolveBundleRef(ctx, inst)
+	if err == nil && ok {
+		run, ok, err = r.renderParameters(ctx, run)
+	}
+	if err == nil && ok {
+		run, err = r.resolveDefaultAction(ctx, run)
+	}
+	// The status is updated on the resolved copy, keep it for the caller's later updates
+	defer func() {
+		if run != inst {
+			inst.ResourceVersion = run.ResourceVersion
+			inst.Status = *run.Status.DeepCopy()
+		}
+	}()
+	if err != nil || !ok {
+		return ctrl.Result{}, err
+	}
+
+	// Explaining the bundle does not need its inputs
+	if !run.Spec.ValidateOnly {
+		ok, err = r.checkBundleInputs(ctx, run)
+		if err != nil || !ok {
+			return ctrl.Result{}, err
+		}
+	}
+
+	ok, err = r.hasJobCapacity(ctx, run.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !ok {
+		r.getLogger(ctx).Info("waiting to run Installation, namespace is at the limit of running porter jobs", "maxJobsPerNamespace", r.MaxJobsPerNamespace)
+		return ctrl.Result{RequeueAfter: activeJobRequeueDelay}, nil
+	}
+	ok, err = r.checkResourceBudget(ctx, run)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !ok {
+		return ctrl.Result{RequeueAfter: activeJobRequeueDelay}, nil
+	}
+
+	err = r.createJobForInstallation(ctx, jobName, run, jobLabels)
+	if isQuotaExceeded(err) {
+		r.getLogger(ctx).Info("waiting to run Installation, resource quota exceeded", "reason", err.Error())
+		r.Recorder.Eventf(run, corev1.EventTypeNormal, ReasonQuotaExceeded, "Waiting for resource quota in namespace %s: %s", run.Namespace, err)
+		// Retry with the controller's backoff
+		return ctrl.Result{Requeue: true}, nil
+	}
+	return ctrl.Result{}, err
+}
+
+// hasJobCapacity determines if another porter job can run in the namespace,
+// without going over the operator's MaxJobsPerNamespace limit.
+func (r *InstallationReconciler) hasJobCapacity(ctx context.Context, namespace string) (bool, error) {
+	if r.MaxJobsPerNamespace <= 0 {
+		return true, nil
+	}
 
-	porterVersion, pullPolicy := r.getPorterImageVersion(ctx, inst)
-	serviceAccount := r.getPorterAgentServiceAccount(ctx, inst)
+	jobs := &batchv1.JobList{}
+	err := r.List(ctx, jobs, client.InNamespace(namespace), client.MatchingLabels{"porter": "true"})
+	if err != nil {
+		return false, errors.Wrapf(err, "could not list the porter jobs in namespace %s", namespace)
+	}
 
-	// porter ACTION INSTALLATION_NAME --tag=REFERENCE --debug
-	// TODO: For now require the action, and when porter supports installorupgrade switch
-	args := []string{
-		inst.Spec.Action,
-		inst.Name,
-		"--reference=" + inst.Spec.Reference,
-		"--debug",
-		"--debug-plugins",
-		"--driver=kubernetes",
+	running := 0
+	for _, job := range jobs.Items {
+		if !isJobDone(job.Status) {
+			running++
+		}
 	}
-	for _, c := range inst.Spec.Credentials {
-		args = append(args, "--cred="+c)
+	return running < r.MaxJobsPerNamespace, nil
+}
+
+// checkAgentArgs validates the extra porter flags, in case the Installation
+// was created without the webhook. An Installation with invalid flags is not
+// run until it is fixed.
+func (r *InstallationReconciler) checkAgentArgs(ctx context.Context, inst *porterv1.Installation) (bool, error) {
+	errs := porterv1.ValidateAgentArgs(inst.Spec.AgentArgs, field.NewPath("agentArgs"))
+	if len(errs) == 0 {
+		return true, nil
 	}
-	for _, p := range inst.Spec.Parameters {
-		args = append(args, "--param="+p)
+
+	msg := fmt.Sprintf("Invalid agentArgs: %s", errs.ToAggregate())
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonInvalidAgentArgs, msg)
+
+	return false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonInvalidAgentArgs, msg)
+}
+
+// checkAgentCommand validates the agent's command, in case the Installation
+// was created without the webhook. An Installation with an invalid command is
+// not run until it is fixed.
+func (r *InstallationReconciler) checkAgentCommand(ctx context.Context, inst *porterv1.Installation) (bool, error) {
+	errs := porterv1.ValidateAgentCommand(inst.Spec.AgentCommand, field.NewPath("agentCommand"))
+	if len(errs) == 0 {
+		return true, nil
 	}
 
+	msg := fmt.Sprintf("Invalid agentCommand: %s", errs.ToAggregate())
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonInvalidAgentCommand, msg)
+
+	return false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonInvalidAgentCommand, msg)
+}
+
+// isQuotaExceeded determines if the error is from a request that was rejected
+// because it would exceed the namespace's resource quota.
+func isQuotaExceeded(err error) bool {
+	return apierrors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota")
+}
+
+// getJobCreateFailure classifies why the API server did not create the porter
+// agent job, and returns the API server's message. Jobs that are refused by
+// an admission webhook or plugin, that fail validation, or that the cluster
+// has no API for, get their own reason. Other errors, which are usually
+// temporary, use the JobCreateFailed reason.
+func getJobCreateFailure(err error) (reason string, msg string) {
+	msg = err.Error()
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		msg = status.Status().Message
+	}
+
+	switch {
+	case strings.Contains(msg, "admission webhook") && strings.Contains(msg, "denied the request"):
+		return ReasonJobRejected, msg
+	case apierrors.IsForbidden(err) && !strings.Contains(msg, "cannot create resource"):
+		// Denied by an admission plugin, e.g. pod security, rather than RBAC
+		return ReasonJobRejected, msg
+	case apierrors.IsInvalid(err):
+		return ReasonJobInvalid, msg
+	case meta.IsNoMatchError(err) || apierrors.IsNotFound(err) || apierrors.IsMethodNotSupported(err):
+		return ReasonJobAPIUnavailable, msg
+	default:
+		return ReasonJobCreateFailed, msg
+	}
+}
+
+// createJobForInstallation creates the porter agent job, and the objects that
+// it uses, to run the Installation's action. The jobLabels are added to the
+// job's labels.
+func (r *InstallationReconciler) createJobForInstallation(ctx context.Context, name string, inst *porterv1.Installation, jobLabels map[string]string) error {
+	log := r.getLogger(ctx)
+	log.Info("creating porter job", "job", name)
+
+	cfg := r.getPorterConfig(ctx, inst)
+	porterRepository := r.getPorterImageRepository(ctx, cfg)
+	porterVersion, pullPolicy := r.getPorterImageVersion(ctx, inst, cfg)
+	serviceAccount := r.getPorterAgentServiceAccount(ctx, inst, cfg)
+	porterNamespace := r.getPorterNamespace(ctx, inst, cfg)
+	priorityClassName := r.getPriorityClassName(ctx, inst, cfg)
+	topologySpreadConstraints, err := r.getTopologySpreadConstraints(ctx, inst, cfg)
+	if err != nil {
+		return err
+	}
+	porterVersion, err = r.resolvePorterVersion(ctx, porterRepository, porterVersion)
+	if err != nil {
+		return err
+	}
+	jobTTL, err := r.getJobTTLSecondsAfterFinished(ctx, inst, cfg)
+	if err != nil {
+		return err
+	}
+	configuredLabels, err := r.getJobLabels(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	driver, err := r.getDriverConfig(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	porterHome, err := r.getPorterHome(ctx, inst, cfg)
+	if err != nil {
+		return err
+	}
+	ok, err := r.checkSetReferences(ctx, inst)
+	if err != nil || !ok {
+		return err
+	}
+	ok, err = r.checkPorterHome(ctx, inst, porterHome)
+	if err != nil || !ok {
+		return err
+	}
+	ok, err = r.checkPluginConfig(ctx, inst)
+	if err != nil || !ok {
+		return err
+	}
+	ok, err = r.checkAgentArgs(ctx, inst)
+	if err != nil || !ok {
+		return err
+	}
+	ok, err = r.checkAgentCommand(ctx, inst)
+	if err != nil || !ok {
+		return err
+	}
+	ok, err = r.checkApply(ctx, inst)
+	if err != nil || !ok {
+		return err
+	}
+	ok, err = r.checkValidateOnly(ctx, inst)
+	if err != nil || !ok {
+		return err
+	}
+	ok, err = r.checkDockerHostAccess(ctx, inst)
+	if err != nil || !ok {
+		return err
+	}
+	ok, err = r.checkReconcileAction(ctx, inst)
+	if err != nil || !ok {
+		return err
+	}
+	ok, err = r.checkBundleSwap(ctx, inst)
+	if err != nil || !ok {
+		return err
+	}
+	ok, err = r.checkRelocationMap(ctx, inst)
+	if err != nil || !ok {
+		return err
+	}
+	ok, err = r.checkBundleReference(ctx, inst, cfg, serviceAccount)
+	if err != nil || !ok {
+		return err
+	}
+	// Check the account before granting it the agentPermissions
+	ok, err = r.checkServiceAccount(ctx, inst, serviceAccount)
+	if err != nil || !ok {
+		return err
+	}
+	ok, err = r.checkAgentPermissions(ctx, inst, serviceAccount)
+	if err != nil || !ok {
+		return err
+	}
+	ok, err = r.reconcileAgentPermissions(ctx, inst, serviceAccount)
+	if err != nil || !ok {
+		return err
+	}
+	porterSecrets, ok, err := r.mirrorPorterSecrets(ctx, inst, cfg, serviceAccount)
+	if err != nil || !ok {
+		return err
+	}
+	sharedLabels := map[string]string{
+		"porter":       "true",
+		"installation": inst.Name,
+		"job":          name,
+	}
+
+	// Resolve the parameters first, which may need to wait on other
+	// Installations. Explaining the bundle does not use them.
+	var paramSet ephemeralParameterSet
+	var paramSetVersions []porterv1.ParameterSetVersion
+	if !inst.Spec.ValidateOnly {
+		paramSet, err = r.createEphemeralParameterSet(ctx, name, inst, sharedLabels)
+		if err != nil {
+			return err
+		}
+		paramSetVersions, err = r.getParameterSetVersions(ctx, inst)
+		if err != nil {
+			return err
+		}
+	}
+
+	var installFile ephemeralInstallationFile
+	if inst.Spec.Apply {
+		installFile, err = r.createInstallationFile(ctx, name, inst, porterNamespace, sharedLabels)
+		if err != nil {
+			return err
+		}
+	}
+
+	if inst.Spec.PluginConfig != nil {
+		// The plugins are merged into the config file of the porter-config secret
+		porterSecrets.Config, err = r.createPluginConfig(ctx, name, inst, porterSecrets.Config, sharedLabels)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Create a volume to share data between porter and the invocation image
+	pvc, err := r.createOutputsVolume(ctx, name, inst, cfg, sharedLabels)
+	if err != nil {
+		return err
+	}
+
+	bundleArg := "--reference=" + inst.Spec.Reference
+	if inst.Spec.BundleConfigMap != "" {
+		// Use the local copy of the bundle instead of resolving the reference
+		bundleArg = "--cnab-file=" + path.Join(bundleConfigPath, bundleFileName)
+	}
+
+	var args []string
+	if inst.Spec.ValidateOnly {
+		args = makeExplainArgs(bundleArg)
+	} else if inst.Spec.Apply {
+		// porter installation apply FILE --debug, the installation file has
+		// the bundle, credentials and parameters
+		args = append(installFile.Args, "--debug", "--debug-plugins", "--driver=kubernetes")
+	} else {
+		args, err = buildPorterArgs(inst, bundleArg, paramSet.Args, porterNamespace)
+		if err != nil {
+			return err
+		}
+	}
+	args = append(args, inst.Spec.AgentArgs...)
+
+	driverEnv := driver.makeDriverEnv(map[string]string{
+		driverNamespace:     inst.Namespace,
+		driverInCluster:     "true",
+		driverJobVolumeName: pvc.Name,
+		driverJobVolumePath: "/porter-shared",
+		// Keep the invocation image job for debugging unless the Installation opts in
+		driverCleanupJobs:    strconv.FormatBool(inst.Spec.CleanupSubJobs && !inst.Spec.NoCleanup),
+		driverServiceAccount: serviceAccount,
+		driverLabels:         makeDriverLabels(inst, name, configuredLabels),
+		// The driver sets the pull policy of the invocation image's pod, when set
+		driverImagePullPolicy: string(inst.Spec.InvocationImagePullPolicy),
+	})
+
 	porterJob := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
@@ -112,10 +797,20 @@ func (r *InstallationReconciler) createJobForInstallation(ctx context.Context, n
 				"porter":       "true",
 				"installation": inst.Name,
 			},
+			Annotations: map[string]string{
+				annotationGeneration: strconv.FormatInt(inst.Generation, 10),
+			},
+			OwnerReferences: getOwnerReferences(inst),
 		},
 		Spec: batchv1.JobSpec{
-			Completions:  pointer.Int32Ptr(1),
+			Completions: pointer.Int32Ptr(1),
+			// Only one agent may run the installation at a time, porter's storage
+			// is not locked against concurrent runs. Keep this at 1 even if the
+			// number of completions is changed.
+			Parallelism:  pointer.Int32Ptr(1),
 			BackoffLimit: pointer.Int32Ptr(0),
+			// Removes the job and its pod after it finishes, unless noCleanup is set
+			TTLSecondsAfterFinished: jobTTL,
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					GenerateName: name,
@@ -136,12 +831,23 @@ func (r *InstallationReconciler) createJobForInstallation(ctx context.Context, n
 				},
 				Spec: corev1.PodSpec{
 					Volumes: []corev1.Volume{
+						{
+							// The kubernetes driver mounts the same claim in the bundle's pod,
+							// so this can not be an emptyDir
+							Name: "porter-shared",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: pvc.Name,
+								},
+							},
+						},
 						{
 							Name: "porter-config",
 							VolumeSource: corev1.VolumeSource{
 								Secret: &corev1.SecretVolumeSource{
-									SecretName: "porter-config",
-									Optional:   pointer.BoolPtr(true),
+									SecretName: porterSecrets.Config,
+									// A selected profile must exist, instead of falling back to porter's default storage
+									Optional: pointer.BoolPtr(inst.Spec.PorterConfig == ""),
 								},
 							},
 						},
@@ -149,26 +855,24 @@ func (r *InstallationReconciler) createJobForInstallation(ctx context.Context, n
 					Containers: []corev1.Container{
 						{
 							Name:            name,
-							Image:           "ghcr.io/getporter/porter:kubernetes-" + porterVersion,
+							Image:           porterRepository + ":kubernetes-" + porterVersion,
 							ImagePullPolicy: pullPolicy,
+							Command:         inst.Spec.AgentCommand,
 							Args:            args,
-							Env: []corev1.EnvVar{
-								// Configuration for the Kubernetes Driver
-								{
-									Name:  "KUBE_NAMESPACE",
-									Value: inst.Namespace,
-								},
-								{
-									Name:  "IN_CLUSTER",
-									Value: "true",
-								},
-							},
+							Resources:       inst.Spec.AgentResources,
+							// Without a terminal, porter fails instead of prompting for missing inputs
+							Stdin: false,
+							TTY:   false,
+							// The agent reports the result of the run in the termination message
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+							// Configuration for the Kubernetes Driver
+							Env: driverEnv,
 							EnvFrom: []corev1.EnvFromSource{
 								// Environtment variables for the plugins
 								{
 									SecretRef: &corev1.SecretEnvSource{
 										LocalObjectReference: corev1.LocalObjectReference{
-											Name: "porter-env",
+											Name: porterSecrets.Env,
 										},
 										Optional: pointer.BoolPtr(true),
 									},
@@ -176,81 +880,520 @@ func (r *InstallationReconciler) createJobForInstallation(ctx context.Context, n
 							},
 							VolumeMounts: []corev1.VolumeMount{
 								{
+									Name:      "porter-shared",
+									MountPath: "/porter-shared",
+								},
+								{
+									// The agent copies the config into porter's home directory
+									// and never writes to it
 									Name:      "porter-config",
 									MountPath: "/porter-config/",
+									ReadOnly:  true,
 								},
 							},
 						},
 					},
-					RestartPolicy:      "Never", // TODO: Make the retry policy configurable on the Installation
-					ServiceAccountName: serviceAccount,
-					ImagePullSecrets:   nil, // TODO: Make pulling from a private registry possible
+					InitContainers:                inst.Spec.InitContainers,
+					TopologySpreadConstraints:     topologySpreadConstraints,
+					PriorityClassName:             priorityClassName,
+					TerminationGracePeriodSeconds: inst.Spec.TerminationGracePeriodSeconds,
+					HostNetwork:                   inst.Spec.HostNetwork,
+					DNSPolicy:                     getDNSPolicy(inst),
+					DNSConfig:                     inst.Spec.DNSConfig,
+					RestartPolicy:                 "Never", // TODO: Make the retry policy configurable on the Installation
+					ServiceAccountName:            serviceAccount,
+					ImagePullSecrets:              nil, // TODO: Make pulling from a private registry possible
 				},
 			},
 		},
 	}
 
-	err := r.Create(ctx, porterJob, &client.CreateOptions{})
-	return errors.Wrapf(err, "error creating job for Installation %s/%s@%s", inst.Namespace, inst.Name, inst.ResourceVersion)
-}
+	if rerun := inst.GetRerun(); rerun != "" {
+		porterJob.Annotations[porterv1.AnnotationRerun] = rerun
+	}
+	for k, v := range configuredLabels {
+		porterJob.Labels[k] = v
+		porterJob.Spec.Template.Labels[k] = v
+	}
+	for k, v := range getInstallationLabels(inst) {
+		porterJob.Labels[k] = v
+		porterJob.Spec.Template.Labels[k] = v
+	}
+	for k, v := range jobLabels {
+		porterJob.Labels[k] = v
+	}
 
-func (r *InstallationReconciler) getPorterImageVersion(ctx context.Context, inst *porterv1.Installation) (porterVersion string, pullPolicy corev1.PullPolicy) {
-	porterVersion = "latest"
-	if inst.Spec.PorterVersion != "" {
-		r.Log.Info(fmt.Sprintf("porter image version override: %s", inst.Spec.PorterVersion))
-		// Use the version specified by the instance
-		porterVersion = inst.Spec.PorterVersion
-	} else {
-		// Check if the namespace has a default porter version configured
-		cfg := &corev1.ConfigMap{}
-		err := r.Get(ctx, types.NamespacedName{Name: "porter", Namespace: inst.Namespace}, cfg)
+	porterJob.Spec.Template.Spec.Volumes = append(porterJob.Spec.Template.Spec.Volumes, paramSet.Volumes...)
+	porterJob.Spec.Template.Spec.Containers[0].VolumeMounts = append(porterJob.Spec.Template.Spec.Containers[0].VolumeMounts, paramSet.VolumeMounts...)
+	porterJob.Spec.Template.Spec.Volumes = append(porterJob.Spec.Template.Spec.Volumes, installFile.Volumes...)
+	porterJob.Spec.Template.Spec.Containers[0].VolumeMounts = append(porterJob.Spec.Template.Spec.Containers[0].VolumeMounts, installFile.VolumeMounts...)
+
+	if inst.Spec.BundleConfigMap != "" {
+		porterJob.Spec.Template.Spec.Volumes = append(porterJob.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name: "porter-bundle",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: inst.Spec.BundleConfigMap},
+				},
+			},
+		})
+		porterJob.Spec.Template.Spec.Containers[0].VolumeMounts = append(porterJob.Spec.Template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "porter-bundle",
+			MountPath: bundleConfigPath,
+			ReadOnly:  true,
+		})
+	}
+
+	if inst.Spec.RelocationMapConfigMap != "" {
+		porterJob.Spec.Template.Spec.Volumes = append(porterJob.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name: "porter-relocation",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: inst.Spec.RelocationMapConfigMap},
+					Items:                []corev1.KeyToPath{{Key: relocationMapKey, Path: relocationMapKey}},
+				},
+			},
+		})
+		porterJob.Spec.Template.Spec.Containers[0].VolumeMounts = append(porterJob.Spec.Template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "porter-relocation",
+			MountPath: relocationMapPath,
+			ReadOnly:  true,
+		})
+	}
+
+	if inst.Spec.CABundleConfigMap != "" {
+		// Trust the additional certificates along with the ones in the agent image
+		porterJob.Spec.Template.Spec.Volumes = append(porterJob.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name: "porter-ca",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: inst.Spec.CABundleConfigMap},
+					Items:                []corev1.KeyToPath{{Key: caBundleKey, Path: caBundleKey}},
+				},
+			},
+		})
+		agent := &porterJob.Spec.Template.Spec.Containers[0]
+		agent.VolumeMounts = append(agent.VolumeMounts, corev1.VolumeMount{
+			Name:      "porter-ca",
+			MountPath: caBundlePath,
+			ReadOnly:  true,
+		})
+		agent.Env = append(agent.Env, corev1.EnvVar{
+			Name:  "SSL_CERT_DIR",
+			Value: systemCertsPath + ":" + caBundlePath,
+		})
+	}
+
+	if porterHome != "" {
+		// Otherwise porter uses the home directory of the agent image
+		agent := &porterJob.Spec.Template.Spec.Containers[0]
+		agent.Env = append(agent.Env, corev1.EnvVar{
+			Name:  "PORTER_HOME",
+			Value: porterHome,
+		})
+		if inst.Spec.PorterHomeVolumeClaimName != "" {
+			porterJob.Spec.Template.Spec.Volumes = append(porterJob.Spec.Template.Spec.Volumes, corev1.Volume{
+				Name: "porter-home",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+						ClaimName: inst.Spec.PorterHomeVolumeClaimName,
+					},
+				},
+			})
+			agent.VolumeMounts = append(agent.VolumeMounts, corev1.VolumeMount{
+				Name:      "porter-home",
+				MountPath: porterHome,
+			})
+		}
+	}
+
+	// The agent reports the result of the run in its termination message,
+	// see parseAgentResult, and prints the outputs once porter succeeds, see
+	// publishOutputs
+	agent := &porterJob.Spec.Template.Spec.Containers[0]
+	resultAction := getAction(inst)
+	switch {
+	case inst.Spec.ValidateOnly:
+		resultAction = "explain"
+	case inst.Spec.Apply:
+		resultAction = "apply"
+	}
+	agent.Env = append(agent.Env, corev1.EnvVar{
+		Name:  "PORTER_RESULT_ACTION",
+		Value: resultAction,
+	})
+	if !inst.Spec.ValidateOnly {
+		agent.Env = append(agent.Env, corev1.EnvVar{
+			Name:  "PORTER_INSTALLATION",
+			Value: inst.Name,
+		})
+		if porterNamespace != "" {
+			agent.Env = append(agent.Env, corev1.EnvVar{
+				Name:  "PORTER_INSTALLATION_NAMESPACE",
+				Value: porterNamespace,
+			})
+		}
+		if getAction(inst) != "uninstall" {
+			agent.Env = append(agent.Env, corev1.EnvVar{
+				Name:  "PORTER_PUBLISH_OUTPUTS",
+				Value: "true",
+			})
+		}
+	}
+
+	if store := inst.Spec.SecretsStore; store != nil {
+		// The driver fetches the secrets from the external secret manager when the pod starts
+		csi := &corev1.CSIVolumeSource{
+			Driver:           secretsStoreDriver,
+			ReadOnly:         pointer.BoolPtr(true),
+			VolumeAttributes: map[string]string{"secretProviderClass": store.SecretProviderClass},
+		}
+		if store.NodePublishSecretRef != "" {
+			csi.NodePublishSecretRef = &corev1.LocalObjectReference{Name: store.NodePublishSecretRef}
+		}
+		porterJob.Spec.Template.Spec.Volumes = append(porterJob.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name:         "porter-secrets-store",
+			VolumeSource: corev1.VolumeSource{CSI: csi},
+		})
+		agent.VolumeMounts = append(agent.VolumeMounts, corev1.VolumeMount{
+			Name:      "porter-secrets-store",
+			MountPath: secretsStorePath,
+			ReadOnly:  true,
+		})
+		agent.Env = append(agent.Env, corev1.EnvVar{
+			Name:  "SECRETS_STORE_PATH",
+			Value: secretsStorePath,
+		})
+	}
+
+	if inst.Spec.Apply {
+		// Remember that the job applied the bundle, the spec can change while it runs
+		porterJob.Annotations[annotationApply] = "true"
+	} else if !inst.Spec.ValidateOnly {
+		// Remember the action, which may be inferred, to know what the job installed
+		porterJob.Annotations[annotationAction] = getAction(inst)
+	}
+	if !inst.Spec.ValidateOnly {
+		// The reference may come from the catalog, which can change after the job is created
+		porterJob.Annotations[annotationReference] = inst.Spec.Reference
+		// Remember what the reference resolved to, in case the agent does not report it
+		if digest, ok := r.bundleDigests.get(inst.Namespace + "/" + inst.Spec.Reference); ok {
+			porterJob.Annotations[annotationBundleDigest] = digest
+		}
+		// The version is best-effort, the status falls back to what the agent
+		// reports. The bundle was resolved by checkBundleInputs, and a bundle
+		// from the registry is read from the cache.
+		bun, err := r.resolveBundle(ctx, inst)
 		if err != nil {
-			r.Log.Info(fmt.Sprintf("WARN: cannot retrieve porter configmap %q, using default configuration", err))
+			log.Info("WARN: could not resolve the bundle version for the job", "job", name, "reason", err.Error())
+		} else if bun != nil && bun.Version != "" {
+			porterJob.Annotations[annotationBundleVersion] = bun.Version
 		}
-		if v, ok := cfg.Data["porterVersion"]; ok {
-			r.Log.Info(fmt.Sprintf("porter image version defaulted from configmap to %s", v))
-			porterVersion = v
+	}
+
+	if inst.Spec.OutputsVolumeFSGroup != nil {
+		// Let a non-root agent write to the shared volume
+		porterJob.Spec.Template.Spec.SecurityContext = &corev1.PodSecurityContext{
+			FSGroup: inst.Spec.OutputsVolumeFSGroup,
 		}
 	}
 
-	r.Log.Info("resolved porter image version", "version", porterVersion)
+	// Stop before creating the job when the operator is shutting down. The
+	// volume and parameter set are reused when the job is created by the
+	// next reconcile.
+	if err = ctx.Err(); err != nil {
+		return errors.Wrapf(err, "stopped before creating job for Installation %s/%s", inst.Namespace, inst.Name)
+	}
 
-	pullPolicy = corev1.PullIfNotPresent
-	if porterVersion == "canary" || porterVersion == "latest" {
-		pullPolicy = corev1.PullAlways
+	createCtx, span := r.startSpan(ctx, "createJob", label.String("job", name))
+	err = r.Create(createCtx, porterJob, &client.CreateOptions{})
+	if !apierrors.IsAlreadyExists(err) {
+		recordSpanError(span, err)
+	}
+	span.End()
+	if apierrors.IsAlreadyExists(err) {
+		// The job was created by a previous reconcile that did not finish, e.g. the operator crashed before it updated the status
+		err = r.Get(ctx, types.NamespacedName{Name: name, Namespace: inst.Namespace}, porterJob)
+		if err != nil {
+			return errors.Wrapf(err, "could not query for the existing porter job %s/%s", inst.Namespace, name)
+		}
+		log.Info("adopting existing porter job", "job", name)
+		if isMaintenanceJob(porterJob) {
+			return nil
+		}
+		return r.setJobStatus(ctx, inst, porterJob)
+	}
+	if err != nil {
+		if isQuotaExceeded(err) {
+			return errors.Wrapf(err, "error creating job for Installation %s/%s@%s", inst.Namespace, inst.Name, inst.ResourceVersion)
+		}
+		reason, apiMsg := getJobCreateFailure(err)
+		msg := fmt.Sprintf("Could not create porter job %s: %s", name, apiMsg)
+		r.Recorder.Event(inst, corev1.EventTypeWarning, reason, msg)
+		if reason != ReasonJobCreateFailed {
+			// Show why the cluster refused the job on the Installation, the
+			// job is still retried in case the cluster's policy changes
+			if statusErr := r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, reason, msg); statusErr != nil {
+				log.Error(statusErr, "could not record why the porter job was not created")
+			}
+		}
+		return errors.Wrapf(err, "error creating job for Installation %s/%s@%s", inst.Namespace, inst.Name, inst.ResourceVersion)
 	}
 
-	return porterVersion, pullPolicy
+	r.Recorder.Eventf(inst, corev1.EventTypeNormal, ReasonJobCreated, "Created porter job %s", name)
+	// Drift checks and ReconcileAction runs do not change the status of the
+	// Installation's action
+	if isMaintenanceJob(porterJob) {
+		return nil
+	}
+	// Remember what the run used, to upgrade when a watched parameter set changes
+	inst.Status.ParameterSetVersions = paramSetVersions
+	err = r.setJobStatus(ctx, inst, porterJob)
+	if err != nil {
+		return err
+	}
+	if meta.IsStatusConditionTrue(inst.Status.Conditions, porterv1.ConditionFailed) {
+		return r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionFalse, ReasonJobCreated, "Created porter job "+name)
+	}
+	return nil
 }
 
-func (r *InstallationReconciler) getPorterAgentServiceAccount(ctx context.Context, inst *porterv1.Installation) string {
-	serviceAccount := ""
-	if inst.Spec.ServiceAccount != "" {
-		r.Log.Info(fmt.Sprintf("porter agent service account override: %s", inst.Spec.ServiceAccount))
-		// Use the version specified by the instance
-		serviceAccount = inst.Spec.ServiceAccount
-	} else {
-		// Check if the namespace has a default service account configured
-		cfg := &corev1.ConfigMap{}
-		err := r.Get(ctx, types.NamespacedName{Name: "porter", Namespace: inst.Namespace}, cfg)
-		if err != nil {
-			r.Log.Info(fmt.Sprintf("WARN: cannot retrieve porter configmap %q, using default configuration", err))
+// makeDriverLabels returns the labels that porter's kubernetes driver sets on
+// the objects it creates for the bundle, as space separated KEY=VALUE pairs.
+func makeDriverLabels(inst *porterv1.Installation, jobName string, configuredLabels map[string]string) string {
+	labels := fmt.Sprintf("porter=true installation=%s job=%s", inst.Name, jobName)
+	keys := make([]string, 0, len(configuredLabels))
+	for k := range configuredLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		labels += " " + k + "=" + configuredLabels[k]
+	}
+	return labels
+}
+
+// getInstallationLabels returns the Installation's labels that are copied to
+// the jobs, pods and volumes created for it, so that tooling that selects on
+// them, e.g. for cost reports, finds those objects too. The labels managed by
+// the operator, and labels under the kubernetes.io and k8s.io prefixes, which
+// Kubernetes and its tools manage, are not copied.
+func getInstallationLabels(inst *porterv1.Installation) map[string]string {
+	labels := make(map[string]string, len(inst.Labels))
+	for k, v := range inst.Labels {
+		if !managedJobLabels[k] && !isKubernetesLabel(k) {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// isKubernetesLabel determines if a label has a prefix that is reserved for
+// Kubernetes, e.g. kubernetes.io/metadata.name or app.kubernetes.io/managed-by.
+func isKubernetesLabel(key string) bool {
+	i := strings.Index(key, "/")
+	if i < 0 {
+		return false
+	}
+	prefix := key[:i]
+	for _, domain := range []string{"kubernetes.io", "k8s.io"} {
+		if prefix == domain || strings.HasSuffix(prefix, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// getDNSPolicy returns the DNS policy of the porter agent pod. A pod on the
+// host network uses the node's resolver by default, so it uses
+// ClusterFirstWithHostNet to keep resolving cluster services, unless the
+// Installation sets its DNSPolicy.
+func getDNSPolicy(inst *porterv1.Installation) corev1.DNSPolicy {
+	if inst.Spec.DNSPolicy == "" && inst.Spec.HostNetwork {
+		return corev1.DNSClusterFirstWithHostNet
+	}
+	return inst.Spec.DNSPolicy
+}
+
+// createOutputsVolume creates the volume shared between porter and the
+// invocation image. By default a new volume is created for each job. When
+// ReuseOutputsVolume is set, a single volume named after the Installation is
+// created once and then used by every job. Only one job runs at a time for an
+// Installation, so the volume is never mounted by concurrent runs.
+func (r *InstallationReconciler) createOutputsVolume(ctx context.Context, jobName string, inst *porterv1.Installation, cfg porterConfig, labels map[string]string) (_ *corev1.PersistentVolumeClaim, err error) {
+	ctx, span := r.startSpan(ctx, "createOutputsVolume")
+	defer func() {
+		recordSpanError(span, err)
+		span.End()
+	}()
+
+	if inst.Spec.OutputsVolumeClaimName != "" {
+		return r.getExistingOutputsVolume(ctx, inst)
+	}
+
+	pvcName := jobName
+	if inst.Spec.ReuseOutputsVolume {
+		pvcName = inst.Name
+		labels = map[string]string{
+			"porter":       "true",
+			"installation": inst.Name,
+		}
+
+		existing := &corev1.PersistentVolumeClaim{}
+		err := r.Get(ctx, types.NamespacedName{Name: pvcName, Namespace: inst.Namespace}, existing)
+		if err == nil {
+			r.getLogger(ctx).Info("reusing porter shared volume", "persistentVolumeClaim", pvcName)
+			return existing, nil
 		}
-		if v, ok := cfg.Data["serviceAccount"]; ok {
-			r.Log.Info(fmt.Sprintf("porter agent service account defaulted from configmap to %s", v))
-			serviceAccount = v
+		if !apierrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "could not query for the porter shared volume %s/%s", inst.Namespace, pvcName)
 		}
 	}
 
-	r.Log.Info("resolved porter agent service account", "serviceAccount", serviceAccount)
+	storageClass, accessModes, err := r.getOutputsVolumeSettings(ctx, inst, cfg)
+	if err != nil {
+		return nil, err
+	}
+	size, err := r.getOutputsVolumeSize(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	pvcLabels := getInstallationLabels(inst)
+	for k, v := range labels {
+		pvcLabels[k] = v
+	}
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            pvcName,
+			Namespace:       inst.Namespace,
+			Labels:          pvcLabels,
+			OwnerReferences: getOwnerReferences(inst),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: storageClass,
+			AccessModes:      accessModes,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: size,
+				},
+			},
+		},
+	}
+	err = r.Create(ctx, pvc, &client.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// A previous reconcile was interrupted before it created the job
+		existing := &corev1.PersistentVolumeClaim{}
+		err = r.Get(ctx, types.NamespacedName{Name: pvcName, Namespace: inst.Namespace}, existing)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not query for the porter shared volume %s/%s", inst.Namespace, pvcName)
+		}
+		r.getLogger(ctx).Info("using existing porter shared volume", "persistentVolumeClaim", pvcName)
+		return existing, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating the porter shared volume for Installation %s/%s@%s", inst.Namespace, inst.Name, inst.ResourceVersion)
+	}
 
-	return serviceAccount
+	return pvc, nil
+}
+
+// getExistingOutputsVolume returns the claim that the Installation specified
+// for the shared volume, when it is ready to be used.
+func (r *InstallationReconciler) getExistingOutputsVolume(ctx context.Context, inst *porterv1.Installation) (*corev1.PersistentVolumeClaim, error) {
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := r.Get(ctx, types.NamespacedName{Name: inst.Spec.OutputsVolumeClaimName, Namespace: inst.Namespace}, pvc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not retrieve the outputs volume claim %s/%s", inst.Namespace, inst.Spec.OutputsVolumeClaimName)
+	}
+	if pvc.Status.Phase != corev1.ClaimBound {
+		return nil, errors.Errorf("the outputs volume claim %s/%s is not bound", inst.Namespace, pvc.Name)
+	}
+
+	r.getLogger(ctx).Info("using the outputs volume claim", "persistentVolumeClaim", pvc.Name)
+	return pvc, nil
+}
+
+// getOwnerReferences returns the owner references for objects created on behalf of the Installation.
+// The Installation is the controller of the objects, so that changes to them
+// trigger a reconcile of the Installation.
+func getOwnerReferences(inst *porterv1.Installation) []metav1.OwnerReference {
+	return []metav1.OwnerReference{
+		{
+			// The type is not always set on objects read from the client
+			APIVersion:         porterv1.GroupVersion.String(),
+			Kind:               "Installation",
+			Name:               inst.Name,
+			UID:                inst.UID,
+			Controller:         pointer.BoolPtr(true),
+			BlockOwnerDeletion: pointer.BoolPtr(true),
+		},
+	}
+}
+
+// isSelected determines if the Installation is handled by this operator,
+// from its namespace and labels.
+func (r *InstallationReconciler) isSelected(inst client.Object) bool {
+	if !isNamespaceAllowed(inst.GetNamespace(), r.WatchNamespaces, r.ExcludeNamespaces) {
+		return false
+	}
+	return r.InstallationSelector == nil || r.InstallationSelector.Matches(labels.Set(inst.GetLabels()))
+}
+
+// isNamespaceAllowed determines if a namespace is in the allow list, when
+// there is one, and is not excluded.
+func isNamespaceAllowed(namespace string, allowed []string, excluded []string) bool {
+	for _, ns := range excluded {
+		if ns == namespace {
+			return false
+		}
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, ns := range allowed {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *InstallationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	selected := predicate.NewPredicateFuncs(r.isSelected)
+
+	// Ignore updates that only change the status, which the operator makes itself.
+	// Labels and annotations do not change the generation but select and pause
+	// Installations, so those updates are still reconciled. Periodic resyncs
+	// have the same resource version and are always reconciled.
+	specChanged := predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return e.ObjectOld.GetResourceVersion() == e.ObjectNew.GetResourceVersion() ||
+				e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration() ||
+				(e.ObjectOld.GetDeletionTimestamp() == nil) != (e.ObjectNew.GetDeletionTimestamp() == nil) ||
+				!reflect.DeepEqual(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels()) ||
+				!reflect.DeepEqual(e.ObjectOld.GetAnnotations(), e.ObjectNew.GetAnnotations())
+		},
+	}
+
+	var opts controller.Options
+	if r.MaxRequeueDelay > 0 {
+		opts.RateLimiter = newRequeueRateLimiter(r.MaxRequeueDelay)
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&porterv1.Installation{}).
+		For(&porterv1.Installation{}, builder.WithPredicates(selected, specChanged)).
+		// Wake up when a job finishes or its volume changes, instead of waiting for a resync
+		Owns(&batchv1.Job{}).
+		Owns(&corev1.PersistentVolumeClaim{}).
 		Owns(&corev1.Pod{}).
+		// Pick up the progress that porter jobs report on their pods
+		Watches(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(mapPodToInstallation), builder.WithPredicates(progressChanged)).
+		// Upgrade the Installations that watch their parameter sets when they
+		// change, only their metadata is cached, see main.go
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.mapParameterSetToInstallations("ConfigMap")), builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}), builder.OnlyMetadata).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.mapParameterSetToInstallations("Secret")), builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}), builder.OnlyMetadata).
+		WithOptions(opts).
 		Complete(r)
 }
@@ -0,0 +1,1293 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// testBundleDigest is the digest that every bundle resolves to in the tests.
+const testBundleDigest = "sha256:8b06c3da72dc9fa7002b9bc1f73a7421b4287c9cf0d3b08633287473707f9a63"
+
+// newTestReconciler creates a reconciler backed by a fake client with the
+// specified objects. Like a cluster, the test namespace has a default service
+// account, which is permitted to run the kubernetes driver.
+func newTestReconciler(t *testing.T, objs ...client.Object) *InstallationReconciler {
+	scheme := runtime.NewScheme()
+	NewWithT(t).Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	NewWithT(t).Expect(porterv1.AddToScheme(scheme)).To(Succeed())
+
+	objs = append(objs, &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: defaultServiceAccount, Namespace: "test"}})
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	return &InstallationReconciler{
+		Client:   accessReviewClient{Client: fakeClient, allowedNamespaces: map[string]bool{"test": true}},
+		Log:      ctrl.Log.WithName("test"),
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+		// Bundles are not resolved in a registry
+		getDigest: func(ctx context.Context, reference string, auth registryAuth) (string, error) {
+			return testBundleDigest, nil
+		},
+		getBundle: func(ctx context.Context, reference string, auth registryAuth) (*bundleDefinition, error) {
+			return nil, nil
+		},
+	}
+}
+
+func newTestInstallation() *porterv1.Installation {
+	return &porterv1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "hello", Namespace: "test", Generation: 1},
+		Spec: porterv1.InstallationSpec{
+			Reference: "getporter/porter-hello:v0.1.1",
+			Action:    "install",
+		},
+	}
+}
+
+func TestCreateOutputsVolume_AlreadyExists(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	jobName := makeJobName(inst)
+	existing := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: jobName, Namespace: inst.Namespace},
+	}
+	r := newTestReconciler(t, existing)
+
+	pvc, err := r.createOutputsVolume(context.Background(), jobName, inst, porterConfig{}, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pvc.Name).To(Equal(jobName))
+	g.Expect(pvc.ResourceVersion).To(Equal(existing.ResourceVersion))
+}
+
+func TestCreateOutputsVolume_Reuse(t *testing.T) {
+	testcases := []struct {
+		name      string
+		reuse     bool
+		existing  bool
+		wantName  string
+		wantLabel bool
+	}{
+		{name: "per job", wantName: "hello-1", wantLabel: true},
+		{name: "reused", reuse: true, wantName: "hello"},
+		{name: "reused existing", reuse: true, existing: true, wantName: "hello"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.ReuseOutputsVolume = tc.reuse
+			var objs []client.Object
+			if tc.existing {
+				// Created by a previous run
+				objs = append(objs, &corev1.PersistentVolumeClaim{
+					ObjectMeta: metav1.ObjectMeta{Name: inst.Name, Namespace: inst.Namespace, Labels: map[string]string{"porter": "true", "installation": inst.Name}},
+				})
+			}
+			r := newTestReconciler(t, objs...)
+
+			pvc, err := r.createOutputsVolume(context.Background(), "hello-1", inst, porterConfig{}, map[string]string{"job": "hello-1"})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(pvc.Name).To(Equal(tc.wantName))
+			if tc.wantLabel {
+				g.Expect(pvc.Labels).To(HaveKeyWithValue("job", "hello-1"))
+			} else {
+				g.Expect(pvc.Labels).ToNot(HaveKey("job"), "a reused volume should not be cleaned up with the job's artifacts")
+			}
+
+			// The next run uses the same volume only when it is reused
+			pvc, err = r.createOutputsVolume(context.Background(), "hello-2", inst, porterConfig{}, map[string]string{"job": "hello-2"})
+			g.Expect(err).ToNot(HaveOccurred())
+			pvcs := &corev1.PersistentVolumeClaimList{}
+			g.Expect(r.List(context.Background(), pvcs)).To(Succeed())
+			if tc.reuse {
+				g.Expect(pvc.Name).To(Equal(inst.Name))
+				g.Expect(pvcs.Items).To(HaveLen(1))
+			} else {
+				g.Expect(pvc.Name).To(Equal("hello-2"))
+				g.Expect(pvcs.Items).To(HaveLen(2))
+			}
+		})
+	}
+}
+
+func TestReconcile_OutputsVolumeAlreadyExists(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	jobName := makeJobName(inst)
+	// Left behind by a reconcile that failed before creating the job
+	existing := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: jobName, Namespace: inst.Namespace},
+	}
+	r := newTestReconciler(t, inst, existing)
+
+	_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(inst)})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	g.Expect(job.Spec.Template.Spec.Volumes).To(ContainElement(WithTransform(func(v corev1.Volume) string {
+		if v.PersistentVolumeClaim == nil {
+			return ""
+		}
+		return v.PersistentVolumeClaim.ClaimName
+	}, Equal(existing.Name))))
+}
+
+func TestCreateJobForInstallation_Cancelled(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := r.createJobForInstallation(ctx, jobName, inst, nil)
+	g.Expect(err).To(MatchError(ContainSubstring("stopped before creating job")))
+
+	jobs := &batchv1.JobList{}
+	g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+	g.Expect(jobs.Items).To(BeEmpty())
+
+	// The retry reuses the volume and parameter set from the interrupted reconcile
+	err = r.createJobForInstallation(context.Background(), jobName, inst, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+	g.Expect(jobs.Items).To(HaveLen(1))
+}
+
+func TestCreateJobForInstallation_AdoptsExistingJob(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	jobName := makeJobName(inst)
+	existing := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: jobName, Namespace: inst.Namespace},
+	}
+	r := newTestReconciler(t, inst, existing)
+
+	err := r.createJobForInstallation(context.Background(), jobName, inst, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(inst.Status.ActiveJob.Name).To(Equal(jobName))
+
+	jobs := &batchv1.JobList{}
+	g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+	g.Expect(jobs.Items).To(HaveLen(1))
+}
+
+func TestCreateJobForInstallation_Owned(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.UID = "abc123"
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst)
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+	// The Installation is reconciled when the objects that it controls change
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	pvc := &corev1.PersistentVolumeClaim{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, pvc)).To(Succeed())
+	for _, obj := range []metav1.Object{job, pvc} {
+		owner := metav1.GetControllerOf(obj)
+		g.Expect(owner).ToNot(BeNil())
+		g.Expect(owner.APIVersion).To(Equal(porterv1.GroupVersion.String()))
+		g.Expect(owner.Kind).To(Equal("Installation"))
+		g.Expect(owner.UID).To(Equal(inst.UID))
+	}
+}
+
+func TestSetJobStatus(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	r := newTestReconciler(t, inst)
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: makeJobName(inst), Namespace: inst.Namespace}}
+
+	g.Expect(r.setJobStatus(context.Background(), inst, job)).To(Succeed())
+	g.Expect(inst.Status.ActiveJob.Name).To(Equal(job.Name))
+	g.Expect(inst.Status.LastJob.Name).To(BeEmpty())
+	g.Expect(inst.Status.Phase).To(Equal(porterv1.PhaseRunning))
+	g.Expect(inst.IsDone()).To(BeFalse())
+
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	g.Expect(r.setJobStatus(context.Background(), inst, job)).To(Succeed())
+	g.Expect(inst.Status.ActiveJob.Name).To(BeEmpty())
+	g.Expect(inst.Status.LastJob.Name).To(Equal(job.Name))
+	g.Expect(inst.Status.Phase).To(Equal(porterv1.PhaseSucceeded))
+	g.Expect(inst.Status.ObservedGeneration).To(Equal(inst.Generation))
+	g.Expect(inst.IsDone()).To(BeTrue())
+}
+
+func TestSetJobStatus_Installed(t *testing.T) {
+	testcases := []struct {
+		name          string
+		action        string
+		apply         bool
+		specApply     bool
+		jobStatus     batchv1.JobConditionType
+		wasInstalled  bool
+		wantInstalled bool
+	}{
+		{name: "installed", action: "install", jobStatus: batchv1.JobComplete, wantInstalled: true},
+		{name: "upgraded", action: "upgrade", jobStatus: batchv1.JobComplete, wasInstalled: true, wantInstalled: true},
+		{name: "install failed", action: "install", jobStatus: batchv1.JobFailed},
+		{name: "upgrade failed", action: "upgrade", jobStatus: batchv1.JobFailed, wasInstalled: true, wantInstalled: true},
+		{name: "uninstalled", action: "uninstall", jobStatus: batchv1.JobComplete, wasInstalled: true},
+		{name: "custom action", action: "backup", jobStatus: batchv1.JobComplete},
+		{name: "applied", apply: true, specApply: true, jobStatus: batchv1.JobComplete, wantInstalled: true},
+		{name: "applied, apply turned off while running", apply: true, jobStatus: batchv1.JobComplete, wantInstalled: true},
+		{name: "uninstalled, apply turned on while running", action: "uninstall", specApply: true, jobStatus: batchv1.JobComplete, wasInstalled: true},
+		{name: "applied before the apply annotation", specApply: true, jobStatus: batchv1.JobComplete, wantInstalled: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.Apply = tc.specApply
+			inst.Status.Installed = tc.wasInstalled
+			r := newTestReconciler(t, inst)
+			job := &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: makeJobName(inst), Namespace: inst.Namespace},
+				Status: batchv1.JobStatus{
+					Conditions: []batchv1.JobCondition{{Type: tc.jobStatus, Status: corev1.ConditionTrue}},
+				},
+			}
+			job.Annotations = map[string]string{}
+			if tc.action != "" {
+				job.Annotations[annotationAction] = tc.action
+			}
+			if tc.apply {
+				job.Annotations[annotationApply] = "true"
+			}
+
+			g.Expect(r.setJobStatus(context.Background(), inst, job)).To(Succeed())
+			g.Expect(inst.Status.Installed).To(Equal(tc.wantInstalled))
+		})
+	}
+}
+
+func TestSetJobStatus_InstalledBundle(t *testing.T) {
+	testcases := []struct {
+		name        string
+		annotations map[string]string
+		message     string
+		jobStatus   batchv1.JobConditionType
+		wantVersion string
+		wantDigest  string
+	}{
+		{name: "reported", message: `{"status":"succeeded","bundleVersion":"0.2.0","bundleDigest":"sha256:reported"}`,
+			annotations: map[string]string{annotationBundleVersion: "0.1.1", annotationBundleDigest: testBundleDigest},
+			jobStatus:   batchv1.JobComplete, wantVersion: "0.2.0", wantDigest: "sha256:reported"},
+		{name: "resolved", annotations: map[string]string{annotationBundleVersion: "0.1.1", annotationBundleDigest: testBundleDigest},
+			jobStatus: batchv1.JobComplete, wantVersion: "0.1.1", wantDigest: testBundleDigest},
+		{name: "only the digest reported", message: `{"status":"succeeded","bundleDigest":"sha256:reported"}`,
+			annotations: map[string]string{annotationBundleVersion: "0.1.1", annotationBundleDigest: testBundleDigest},
+			jobStatus:   batchv1.JobComplete, wantVersion: "0.1.1", wantDigest: "sha256:reported"},
+		{name: "unknown", jobStatus: batchv1.JobComplete, wantVersion: "0.0.1", wantDigest: "sha256:previous"},
+		{name: "failed", annotations: map[string]string{annotationBundleVersion: "0.1.1", annotationBundleDigest: testBundleDigest},
+			jobStatus: batchv1.JobFailed, wantVersion: "0.0.1", wantDigest: "sha256:previous"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Status.InstalledBundleVersion = "0.0.1"
+			inst.Status.InstalledBundleDigest = "sha256:previous"
+			job := &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: makeJobName(inst), Namespace: inst.Namespace, Annotations: tc.annotations},
+				Status: batchv1.JobStatus{
+					Conditions: []batchv1.JobCondition{{Type: tc.jobStatus, Status: corev1.ConditionTrue}},
+				},
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: job.Name + "-abc12", Namespace: inst.Namespace, Labels: map[string]string{"job-name": job.Name}},
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{
+						{Name: job.Name, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: tc.message}}},
+					},
+				},
+			}
+			r := newTestReconciler(t, inst, pod)
+
+			g.Expect(r.setJobStatus(context.Background(), inst, job)).To(Succeed())
+			g.Expect(inst.Status.InstalledBundleVersion).To(Equal(tc.wantVersion))
+			g.Expect(inst.Status.InstalledBundleDigest).To(Equal(tc.wantDigest))
+		})
+	}
+}
+
+func TestCreateJobForInstallation_BundleDigest(t *testing.T) {
+	testcases := []struct {
+		name         string
+		defaults     map[string]string
+		validateOnly bool
+		wantDigest   bool
+	}{
+		{name: "resolved", wantDigest: true},
+		{name: "resolution disabled", defaults: map[string]string{"resolveBundleReference": "false"}},
+		{name: "validate only", validateOnly: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.ValidateOnly = tc.validateOnly
+			jobName := makeJobName(inst)
+			r := newTestReconciler(t, inst)
+			r.Defaults = tc.defaults
+			r.getBundle = func(ctx context.Context, reference string, auth registryAuth) (*bundleDefinition, error) {
+				return &bundleDefinition{Name: "porter-hello", Version: "0.1.1"}, nil
+			}
+
+			g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+			job := &batchv1.Job{}
+			g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+			if !tc.wantDigest {
+				g.Expect(job.Annotations).ToNot(HaveKey(annotationBundleDigest))
+				g.Expect(job.Annotations).ToNot(HaveKey(annotationBundleVersion))
+				return
+			}
+			g.Expect(job.Annotations).To(HaveKeyWithValue(annotationBundleDigest, testBundleDigest))
+			g.Expect(job.Annotations).To(HaveKeyWithValue(annotationBundleVersion, "0.1.1"))
+		})
+	}
+}
+
+func TestCreateJobForInstallation_BundleVersionUnresolved(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.BundleConfigMap = "missing"
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst)
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed(), "the bundle version is best-effort")
+
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	g.Expect(job.Annotations).ToNot(HaveKey(annotationBundleVersion))
+}
+
+func TestCreateJobForInstallation_InfersUpgrade(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.Action = ""
+	inst.Status.Installed = true
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst)
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	g.Expect(job.Spec.Template.Spec.Containers[0].Args[:2]).To(Equal([]string{"upgrade", inst.Name}))
+	g.Expect(job.Annotations).To(HaveKeyWithValue(annotationAction, "upgrade"))
+}
+
+func TestReconcile_SkipsWhenDone(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Status.ObservedGeneration = inst.Generation
+	inst.Status.Phase = porterv1.PhaseSucceeded
+	r := newTestReconciler(t, inst)
+
+	// The job was cleaned up, but the Installation has not changed so it is not run again
+	_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(inst)})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	jobs := &batchv1.JobList{}
+	g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+	g.Expect(jobs.Items).To(BeEmpty())
+}
+
+func TestCreateJobForInstallation_CABundle(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.CABundleConfigMap = "internal-ca"
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst)
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	podSpec := job.Spec.Template.Spec
+	g.Expect(podSpec.Volumes).To(ContainElement(WithTransform(func(v corev1.Volume) string {
+		if v.ConfigMap == nil {
+			return ""
+		}
+		return v.ConfigMap.Name
+	}, Equal("internal-ca"))))
+	g.Expect(podSpec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: "porter-ca", MountPath: "/porter-ca", ReadOnly: true}))
+	g.Expect(podSpec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "SSL_CERT_DIR", Value: "/etc/ssl/certs:/porter-ca"}))
+}
+
+func TestCreateJobForInstallation_SecretsStore(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.SecretsStore = &porterv1.SecretsStoreVolume{SecretProviderClass: "hello-vault", NodePublishSecretRef: "vault-creds"}
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst)
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	podSpec := job.Spec.Template.Spec
+	g.Expect(podSpec.Volumes).To(ContainElement(corev1.Volume{
+		Name: "porter-secrets-store",
+		VolumeSource: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{
+			Driver:               "secrets-store.csi.k8s.io",
+			ReadOnly:             pointer.BoolPtr(true),
+			VolumeAttributes:     map[string]string{"secretProviderClass": "hello-vault"},
+			NodePublishSecretRef: &corev1.LocalObjectReference{Name: "vault-creds"},
+		}},
+	}))
+	g.Expect(podSpec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: "porter-secrets-store", MountPath: "/porter-secrets-store", ReadOnly: true}))
+	g.Expect(podSpec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "SECRETS_STORE_PATH", Value: "/porter-secrets-store"}))
+}
+
+func TestCreateJobForInstallation_ImagePullPolicy(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.PorterVersion = "v1.0.0"
+	inst.Spec.ImagePullPolicy = corev1.PullAlways
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst)
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	agent := job.Spec.Template.Spec.Containers[0]
+	g.Expect(agent.Image).To(HaveSuffix("-v1.0.0"))
+	g.Expect(agent.ImagePullPolicy).To(Equal(corev1.PullAlways), "the pull policy should override the one derived from the version")
+	for _, env := range agent.Env {
+		g.Expect(env.Name).ToNot(Equal("IMAGE_PULL_POLICY"), "the agent's pull policy should not apply to the invocation image")
+	}
+}
+
+func TestCreateJobForInstallation_InvocationImagePullPolicy(t *testing.T) {
+	testcases := []struct {
+		name       string
+		pullPolicy corev1.PullPolicy
+	}{
+		{name: "driver default"},
+		{name: "always", pullPolicy: corev1.PullAlways},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.InvocationImagePullPolicy = tc.pullPolicy
+			jobName := makeJobName(inst)
+			r := newTestReconciler(t, inst)
+
+			g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+			job := &batchv1.Job{}
+			g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+			agent := job.Spec.Template.Spec.Containers[0]
+			g.Expect(agent.ImagePullPolicy).To(Equal(corev1.PullAlways), "the agent image uses its own pull policy")
+			envNames := make([]string, 0, len(agent.Env))
+			for _, env := range agent.Env {
+				envNames = append(envNames, env.Name)
+			}
+			if tc.pullPolicy == "" {
+				g.Expect(envNames).ToNot(ContainElement("IMAGE_PULL_POLICY"))
+				return
+			}
+			g.Expect(agent.Env).To(ContainElement(corev1.EnvVar{Name: "IMAGE_PULL_POLICY", Value: string(tc.pullPolicy)}))
+		})
+	}
+}
+
+func TestCreateJobForInstallation_CleanupSubJobs(t *testing.T) {
+	testcases := []struct {
+		name           string
+		cleanupSubJobs bool
+		noCleanup      bool
+		want           string
+	}{
+		{name: "default", want: "false"},
+		{name: "enabled", cleanupSubJobs: true, want: "true"},
+		{name: "no cleanup wins", cleanupSubJobs: true, noCleanup: true, want: "false"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.CleanupSubJobs = tc.cleanupSubJobs
+			inst.Spec.NoCleanup = tc.noCleanup
+			jobName := makeJobName(inst)
+			r := newTestReconciler(t, inst)
+
+			g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+			job := &batchv1.Job{}
+			g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+			g.Expect(job.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "CLEANUP_JOBS", Value: tc.want}))
+		})
+	}
+}
+
+func TestCreateJobForInstallation_AgentArgs(t *testing.T) {
+	t.Run("appended", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		inst.Spec.AgentArgs = []string{"--verbosity=debug"}
+		jobName := makeJobName(inst)
+		r := newTestReconciler(t, inst)
+
+		g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+		job := &batchv1.Job{}
+		g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+		args := job.Spec.Template.Spec.Containers[0].Args
+		g.Expect(args[len(args)-1]).To(Equal("--verbosity=debug"))
+	})
+
+	t.Run("porter namespace", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		inst.Spec.PorterNamespace = "dev"
+		inst.Spec.AgentArgs = []string{"--verbosity=debug"}
+		jobName := makeJobName(inst)
+		r := newTestReconciler(t, inst)
+
+		g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+		job := &batchv1.Job{}
+		g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+		args := job.Spec.Template.Spec.Containers[0].Args
+		g.Expect(args).To(ContainElement("--namespace=dev"))
+		// The operator's flags come before the extra flags
+		g.Expect(args[len(args)-1]).To(Equal("--verbosity=debug"))
+	})
+
+	t.Run("managed flag", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		inst.Spec.AgentArgs = []string{"--driver=docker"}
+		jobName := makeJobName(inst)
+		r := newTestReconciler(t, inst)
+
+		g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+		jobs := &batchv1.JobList{}
+		g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+		g.Expect(jobs.Items).To(BeEmpty())
+		cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+		g.Expect(cond).ToNot(BeNil())
+		g.Expect(cond.Reason).To(Equal(ReasonInvalidAgentArgs))
+		g.Expect(cond.Message).To(ContainSubstring("the --driver flag is managed by the operator"))
+	})
+}
+
+func TestCreateJobForInstallation_AgentCommand(t *testing.T) {
+	testcases := []struct {
+		name       string
+		command    []string
+		wantReason string
+	}{
+		{name: "image entrypoint"},
+		{name: "wrapper", command: []string{"/app/porter-wrapper", "--setup=corp-proxy"}},
+		{name: "flag", command: []string{"--setup=corp-proxy"}, wantReason: ReasonInvalidAgentCommand},
+		{name: "managed flag", command: []string{"/app/porter-wrapper", "--driver=docker"}, wantReason: ReasonInvalidAgentCommand},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.AgentCommand = tc.command
+			jobName := makeJobName(inst)
+			r := newTestReconciler(t, inst)
+
+			g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+			job := &batchv1.Job{}
+			err := r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)
+			if tc.wantReason != "" {
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+				cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+				g.Expect(cond).ToNot(BeNil())
+				g.Expect(cond.Reason).To(Equal(tc.wantReason))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			agent := job.Spec.Template.Spec.Containers[0]
+			g.Expect(agent.Command).To(Equal(tc.command))
+			g.Expect(agent.Args[:2]).To(Equal([]string{inst.Spec.Action, inst.Name}), "the operator should still pass the porter arguments")
+		})
+	}
+}
+
+func TestCreateJobForInstallation_PorterConfig(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.PorterConfig = "prod"
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst)
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	podSpec := job.Spec.Template.Spec
+	g.Expect(podSpec.Volumes).To(ContainElement(corev1.Volume{
+		Name: "porter-config",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: "porter-config-prod", Optional: pointer.BoolPtr(false)},
+		},
+	}))
+	g.Expect(podSpec.Containers[0].EnvFrom[0].SecretRef.Name).To(Equal("porter-env-prod"))
+}
+
+func TestCreateJobForInstallation_ReadOnlyMounts(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.CABundleConfigMap = "internal-ca"
+	inst.Spec.ParameterSetRefs = []porterv1.ParameterSetReference{{Kind: "ConfigMap", Name: "settings"}}
+	settings := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: inst.Namespace},
+		Data:       map[string]string{"name": "llama"},
+	}
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst, settings)
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+	// Only the volume shared with the bundle, where the outputs are written, is writable
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	for _, m := range job.Spec.Template.Spec.Containers[0].VolumeMounts {
+		g.Expect(m.ReadOnly).To(Equal(m.Name != "porter-shared"), "mount %s", m.Name)
+	}
+}
+
+func TestCreateJobForInstallation_SingleRun(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst)
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	g.Expect(job.Spec.Parallelism).To(Equal(pointer.Int32Ptr(1)), "only one agent pod should run at a time")
+	g.Expect(job.Spec.Completions).To(Equal(pointer.Int32Ptr(1)))
+	g.Expect(job.Spec.BackoffLimit).To(Equal(pointer.Int32Ptr(0)))
+}
+
+func TestCreateJobForInstallation_DNS(t *testing.T) {
+	testcases := []struct {
+		name        string
+		policy      corev1.DNSPolicy
+		config      *corev1.PodDNSConfig
+		hostNetwork bool
+		wantPolicy  corev1.DNSPolicy
+	}{
+		{name: "cluster default"},
+		{name: "custom", policy: corev1.DNSNone, wantPolicy: corev1.DNSNone, config: &corev1.PodDNSConfig{
+			Nameservers: []string{"10.0.0.10"},
+			Searches:    []string{"corp.example.com"},
+		}},
+		{name: "host network", hostNetwork: true, wantPolicy: corev1.DNSClusterFirstWithHostNet},
+		{name: "host network with policy", hostNetwork: true, policy: corev1.DNSDefault, wantPolicy: corev1.DNSDefault},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.DNSPolicy = tc.policy
+			inst.Spec.DNSConfig = tc.config
+			inst.Spec.HostNetwork = tc.hostNetwork
+			jobName := makeJobName(inst)
+			r := newTestReconciler(t, inst)
+
+			g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+			job := &batchv1.Job{}
+			g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+			g.Expect(job.Spec.Template.Spec.HostNetwork).To(Equal(tc.hostNetwork))
+			g.Expect(job.Spec.Template.Spec.DNSPolicy).To(Equal(tc.wantPolicy))
+			g.Expect(job.Spec.Template.Spec.DNSConfig).To(Equal(tc.config))
+		})
+	}
+}
+
+func TestCreateJobForInstallation_OutputsVolumeFSGroup(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.OutputsVolumeFSGroup = pointer.Int64Ptr(65532)
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst)
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	g.Expect(job.Spec.Template.Spec.SecurityContext).ToNot(BeNil())
+	g.Expect(job.Spec.Template.Spec.SecurityContext.FSGroup).To(Equal(pointer.Int64Ptr(65532)))
+}
+
+func TestCreateJobForInstallation_InitContainers(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.InitContainers = []corev1.Container{
+		{
+			Name:         "fetch-secrets",
+			Image:        "example.com/vault-fetch:v1",
+			VolumeMounts: []corev1.VolumeMount{{Name: "porter-shared", MountPath: "/porter-shared"}},
+		},
+		{Name: "check", Image: "example.com/check:v1"},
+	}
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst)
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	g.Expect(job.Spec.Template.Spec.InitContainers).To(Equal(inst.Spec.InitContainers))
+	g.Expect(job.Spec.Template.Spec.Volumes).To(ContainElement(WithTransform(func(v corev1.Volume) string {
+		return v.Name
+	}, Equal("porter-shared"))), "the init containers should be able to mount the shared volume")
+}
+
+func TestCreateJobForInstallation_TerminationGracePeriodSeconds(t *testing.T) {
+	testcases := []struct {
+		name    string
+		seconds *int64
+	}{
+		{name: "kubernetes default"},
+		{name: "set", seconds: pointer.Int64Ptr(600)},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.TerminationGracePeriodSeconds = tc.seconds
+			jobName := makeJobName(inst)
+			r := newTestReconciler(t, inst)
+
+			g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+			job := &batchv1.Job{}
+			g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+			g.Expect(job.Spec.Template.Spec.TerminationGracePeriodSeconds).To(Equal(tc.seconds))
+		})
+	}
+}
+
+func TestCreateJobForInstallation_JobLabels(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst)
+	r.Defaults = map[string]string{"jobLabels": "team=blue,cost-center=42"}
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	for _, labels := range []map[string]string{job.Labels, job.Spec.Template.Labels} {
+		g.Expect(labels).To(HaveKeyWithValue("team", "blue"))
+		g.Expect(labels).To(HaveKeyWithValue("cost-center", "42"))
+		g.Expect(labels).To(HaveKeyWithValue("installation", inst.Name), "the operator's labels should be kept")
+	}
+	g.Expect(job.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{
+		Name:  "LABELS",
+		Value: "porter=true installation=hello job=" + jobName + " cost-center=42 team=blue",
+	}))
+}
+
+func TestCreateJobForInstallation_InstallationLabels(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Labels = map[string]string{
+		"team":                         "blue",
+		"environment":                  "prod",
+		"installation":                 "other",
+		"app.kubernetes.io/managed-by": "Helm",
+	}
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst)
+	r.Defaults = map[string]string{"jobLabels": "team=default,cost-center=42"}
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	pvc := &corev1.PersistentVolumeClaim{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, pvc)).To(Succeed())
+	for _, labels := range []map[string]string{job.Labels, job.Spec.Template.Labels, pvc.Labels} {
+		g.Expect(labels).To(HaveKeyWithValue("environment", "prod"))
+		g.Expect(labels).To(HaveKeyWithValue("installation", inst.Name), "the operator's labels should not be overridden")
+		g.Expect(labels).ToNot(HaveKey("app.kubernetes.io/managed-by"), "labels managed by Kubernetes tools should not be copied")
+	}
+	for _, labels := range []map[string]string{job.Labels, job.Spec.Template.Labels} {
+		g.Expect(labels).To(HaveKeyWithValue("team", "blue"), "the Installation's labels should override the jobLabels")
+		g.Expect(labels).To(HaveKeyWithValue("cost-center", "42"))
+	}
+	g.Expect(pvc.Labels).To(HaveKeyWithValue("team", "blue"))
+}
+
+func TestIsKubernetesLabel(t *testing.T) {
+	g := NewWithT(t)
+	g.Expect(isKubernetesLabel("kubernetes.io/metadata.name")).To(BeTrue())
+	g.Expect(isKubernetesLabel("app.kubernetes.io/name")).To(BeTrue())
+	g.Expect(isKubernetesLabel("k8s.io/cluster-service")).To(BeTrue())
+	g.Expect(isKubernetesLabel("team")).To(BeFalse())
+	g.Expect(isKubernetesLabel("example.com/team")).To(BeFalse())
+	g.Expect(isKubernetesLabel("notkubernetes.io/team")).To(BeFalse())
+}
+
+func TestReconcile_AdoptsLatestJob(t *testing.T) {
+	completed := batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}}
+	labels := map[string]string{"porter": "true", "installation": "hello"}
+
+	t.Run("current generation", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "hello-renamed", Namespace: inst.Namespace, Labels: labels,
+				Annotations: map[string]string{annotationGeneration: "1"}},
+			Status: completed,
+		}
+		r := newTestReconciler(t, inst, job)
+
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(inst)})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(inst), inst)).To(Succeed())
+		g.Expect(inst.Status.LastJob.Name).To(Equal(job.Name))
+		g.Expect(inst.IsDone()).To(BeTrue())
+
+		jobs := &batchv1.JobList{}
+		g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+		g.Expect(jobs.Items).To(HaveLen(1))
+	})
+
+	t.Run("previous generation", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		inst.Generation = 2
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "hello-v1", Namespace: inst.Namespace, Labels: labels},
+			Status:     completed,
+		}
+		r := newTestReconciler(t, inst, job)
+
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(inst)})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(inst), inst)).To(Succeed())
+		g.Expect(inst.Status.LastJob.Name).To(Equal(job.Name))
+		g.Expect(inst.Status.ActiveJob.Name).To(Equal(makeJobName(inst)))
+
+		jobs := &batchv1.JobList{}
+		g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+		g.Expect(jobs.Items).To(HaveLen(2))
+	})
+}
+
+func TestReconcile_Paused(t *testing.T) {
+	testcases := []struct {
+		name       string
+		spec       bool
+		annotation string
+		paused     bool
+	}{
+		{name: "not paused"},
+		{name: "paused by spec", spec: true, paused: true},
+		{name: "paused by annotation", annotation: "true", paused: true},
+		{name: "annotation not true", annotation: "false"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.Paused = tc.spec
+			if tc.annotation != "" {
+				inst.Annotations = map[string]string{porterv1.AnnotationPaused: tc.annotation}
+			}
+			r := newTestReconciler(t, inst)
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(inst)}
+
+			result, err := r.Reconcile(context.Background(), req)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			err = r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: makeJobName(inst)}, &batchv1.Job{})
+			g.Expect(apierrors.IsNotFound(err)).To(Equal(tc.paused), "a job should only be created when the Installation is not paused")
+			g.Expect(r.Get(context.Background(), req.NamespacedName, inst)).To(Succeed())
+			g.Expect(meta.IsStatusConditionTrue(inst.Status.Conditions, porterv1.ConditionPaused)).To(Equal(tc.paused))
+			if !tc.paused {
+				return
+			}
+			g.Expect(result.RequeueAfter).To(BeZero(), "unpausing the Installation triggers a reconcile")
+			g.Expect(inst.Status.ActiveJob.Name).To(BeEmpty())
+
+			// Changes made while paused are picked up once resumed
+			inst.Spec.Paused = false
+			delete(inst.Annotations, porterv1.AnnotationPaused)
+			inst.Spec.Action = "upgrade"
+			inst.Generation = 2
+			g.Expect(r.Update(context.Background(), inst)).To(Succeed())
+
+			_, err = r.Reconcile(context.Background(), req)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			g.Expect(r.Get(context.Background(), req.NamespacedName, inst)).To(Succeed())
+			cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionPaused)
+			g.Expect(cond).ToNot(BeNil())
+			g.Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			g.Expect(cond.Reason).To(Equal(ReasonResumed))
+			job := &batchv1.Job{}
+			g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: makeJobName(inst)}, job)).To(Succeed())
+			g.Expect(job.Annotations).To(HaveKeyWithValue("porter.sh/action", "upgrade"))
+		})
+	}
+}
+
+func TestReconcile_PausedLeavesActiveJob(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	r := newTestReconciler(t, inst)
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(inst)}
+
+	_, err := r.Reconcile(context.Background(), req)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(r.Get(context.Background(), req.NamespacedName, inst)).To(Succeed())
+	activeJob := inst.Status.ActiveJob.Name
+	g.Expect(activeJob).ToNot(BeEmpty())
+
+	inst.Spec.Paused = true
+	g.Expect(r.Update(context.Background(), inst)).To(Succeed())
+	_, err = r.Reconcile(context.Background(), req)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: activeJob}, &batchv1.Job{})).To(Succeed(), "the running job should be left alone")
+	g.Expect(r.Get(context.Background(), req.NamespacedName, inst)).To(Succeed())
+	g.Expect(inst.Status.ActiveJob.Name).To(Equal(activeJob))
+	g.Expect(inst.Status.Phase).To(Equal(porterv1.PhaseRunning))
+	g.Expect(meta.IsStatusConditionTrue(inst.Status.Conditions, porterv1.ConditionPaused)).To(BeTrue())
+}
+
+func TestReconcile_OperatorPaused(t *testing.T) {
+	testcases := []struct {
+		name   string
+		flag   bool
+		config map[string]string
+		paused bool
+	}{
+		{name: "not paused"},
+		{name: "paused by flag", flag: true, paused: true},
+		{name: "paused by configmap", config: map[string]string{"paused": "true"}, paused: true},
+		{name: "unpaused by configmap", config: map[string]string{"paused": "false"}},
+		{name: "invalid setting", config: map[string]string{"paused": "yes please"}},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			objs := []client.Object{inst}
+			if tc.config != nil {
+				objs = append(objs, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: porterConfigMapName, Namespace: "porter-operator-system"},
+					Data:       tc.config,
+				})
+			}
+			r := newTestReconciler(t, objs...)
+			r.OperatorNamespace = "porter-operator-system"
+			r.Paused = tc.flag
+
+			result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(inst)})
+			g.Expect(err).ToNot(HaveOccurred())
+
+			err = r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: makeJobName(inst)}, &batchv1.Job{})
+			g.Expect(apierrors.IsNotFound(err)).To(Equal(tc.paused), "a job should only be created when the operator is not paused")
+			g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(inst), inst)).To(Succeed())
+			g.Expect(meta.IsStatusConditionTrue(inst.Status.Conditions, porterv1.ConditionPaused)).To(Equal(tc.paused))
+			if tc.paused {
+				g.Expect(result.RequeueAfter).To(Equal(operatorPausedRequeueDelay), "check back for when the operator is unpaused")
+			}
+		})
+	}
+}
+
+func TestReconcile_Rerun(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	r := newTestReconciler(t, inst)
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(inst)}
+	completeJobs := func() {
+		jobs := &batchv1.JobList{}
+		g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+		for i := range jobs.Items {
+			jobs.Items[i].Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+			g.Expect(r.Status().Update(context.Background(), &jobs.Items[i])).To(Succeed())
+		}
+	}
+	countJobs := func() int {
+		jobs := &batchv1.JobList{}
+		g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+		return len(jobs.Items)
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	g.Expect(err).ToNot(HaveOccurred())
+	completeJobs()
+	_, err = r.Reconcile(context.Background(), req)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(countJobs()).To(Equal(1))
+
+	// Changing the annotation runs the Installation exactly once more
+	g.Expect(r.Get(context.Background(), req.NamespacedName, inst)).To(Succeed())
+	inst.Annotations = map[string]string{porterv1.AnnotationRerun: "1"}
+	g.Expect(r.Update(context.Background(), inst)).To(Succeed())
+	for i := 0; i < 3; i++ {
+		_, err = r.Reconcile(context.Background(), req)
+		g.Expect(err).ToNot(HaveOccurred())
+		completeJobs()
+	}
+	g.Expect(countJobs()).To(Equal(2))
+
+	g.Expect(r.Get(context.Background(), req.NamespacedName, inst)).To(Succeed())
+	g.Expect(inst.Status.ObservedRerun).To(Equal("1"))
+	g.Expect(inst.IsDone()).To(BeTrue())
+}
+
+func TestCreateJobForInstallation_OutputsVolumeClaimName(t *testing.T) {
+	t.Run("bound", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		inst.Spec.OutputsVolumeClaimName = "hello-outputs"
+		claim := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "hello-outputs", Namespace: inst.Namespace},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+		}
+		jobName := makeJobName(inst)
+		r := newTestReconciler(t, inst, claim)
+
+		g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+		job := &batchv1.Job{}
+		g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+		g.Expect(job.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("hello-outputs"))
+
+		pvcs := &corev1.PersistentVolumeClaimList{}
+		g.Expect(r.List(context.Background(), pvcs)).To(Succeed())
+		g.Expect(pvcs.Items).To(HaveLen(1))
+	})
+
+	t.Run("not bound", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		inst.Spec.OutputsVolumeClaimName = "hello-outputs"
+		claim := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "hello-outputs", Namespace: inst.Namespace},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+		}
+		r := newTestReconciler(t, inst, claim)
+
+		err := r.createJobForInstallation(context.Background(), makeJobName(inst), inst, nil)
+		g.Expect(err).To(MatchError(ContainSubstring("is not bound")))
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		inst.Spec.OutputsVolumeClaimName = "hello-outputs"
+		r := newTestReconciler(t, inst)
+
+		err := r.createJobForInstallation(context.Background(), makeJobName(inst), inst, nil)
+		g.Expect(err).To(MatchError(ContainSubstring("could not retrieve the outputs volume claim")))
+	})
+}
+
+func TestHasJobCapacity(t *testing.T) {
+	running := func(name string) *batchv1.Job {
+		return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test", Labels: map[string]string{"porter": "true"}}}
+	}
+	done := running("done")
+	done.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+
+	testcases := []struct {
+		name string
+		max  int
+		want bool
+	}{
+		{name: "unlimited", max: 0, want: true},
+		{name: "room for another job", max: 3, want: true},
+		{name: "at the limit", max: 2, want: false},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			r := newTestReconciler(t, running("a"), running("b"), done)
+			r.MaxJobsPerNamespace = tc.max
+
+			got, err := r.hasJobCapacity(context.Background(), "test")
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tc.want))
+		})
+	}
+}
+
+func TestIsQuotaExceeded(t *testing.T) {
+	g := NewWithT(t)
+	jobs := schema.GroupResource{Group: "batch", Resource: "jobs"}
+
+	quotaErr := apierrors.NewForbidden(jobs, "hello", errors.New("exceeded quota: compute, requested: count/jobs.batch=1, used: count/jobs.batch=5, limited: count/jobs.batch=5"))
+	g.Expect(isQuotaExceeded(errors.Wrap(quotaErr, "error creating job"))).To(BeTrue())
+	g.Expect(isQuotaExceeded(apierrors.NewForbidden(jobs, "hello", errors.New("not allowed")))).To(BeFalse())
+	g.Expect(isQuotaExceeded(nil)).To(BeFalse())
+}
+
+func TestGetJobCreateFailure(t *testing.T) {
+	jobs := schema.GroupResource{Group: "batch", Resource: "jobs"}
+	webhookErr := &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusBadRequest,
+		Message: `admission webhook "validate.kyverno.svc" denied the request: hostPath volumes are not allowed`,
+	}}
+	testcases := []struct {
+		name       string
+		err        error
+		wantReason string
+		wantMsg    string
+	}{
+		{name: "webhook", err: webhookErr, wantReason: ReasonJobRejected, wantMsg: webhookErr.ErrStatus.Message},
+		{name: "admission plugin", err: apierrors.NewForbidden(jobs, "hello", errors.New("violates PodSecurity")), wantReason: ReasonJobRejected, wantMsg: `jobs.batch "hello" is forbidden: violates PodSecurity`},
+		{name: "rbac", err: apierrors.NewForbidden(jobs, "hello", errors.New(`User "system:serviceaccount:porter:operator" cannot create resource "jobs"`)), wantReason: ReasonJobCreateFailed},
+		{name: "validation", err: apierrors.NewInvalid(schema.GroupKind{Group: "batch", Kind: "Job"}, "hello", nil), wantReason: ReasonJobInvalid},
+		{name: "no api", err: apierrors.NewNotFound(jobs, ""), wantReason: ReasonJobAPIUnavailable},
+		{name: "timeout", err: apierrors.NewServerTimeout(jobs, "create", 1), wantReason: ReasonJobCreateFailed},
+		{name: "wrapped", err: errors.Wrap(webhookErr, "error creating job"), wantReason: ReasonJobRejected, wantMsg: webhookErr.ErrStatus.Message},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			reason, msg := getJobCreateFailure(tc.err)
+			g.Expect(reason).To(Equal(tc.wantReason))
+			if tc.wantMsg != "" {
+				g.Expect(msg).To(Equal(tc.wantMsg), "the API server's message should be kept verbatim")
+			}
+		})
+	}
+}
+
+// rejectingClient fails to create jobs with an error from the API server.
+type rejectingClient struct {
+	client.Client
+	err error
+}
+
+func (c rejectingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if _, ok := obj.(*batchv1.Job); ok {
+		return c.err
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestCreateJobForInstallation_Rejected(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst)
+	msg := `admission webhook "validate.kyverno.svc" denied the request: hostPath volumes are not allowed`
+	r.Client = rejectingClient{Client: r.Client, err: &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status: metav1.StatusFailure, Code: http.StatusBadRequest, Message: msg,
+	}}}
+
+	err := r.createJobForInstallation(context.Background(), jobName, inst, nil)
+	g.Expect(err).To(MatchError(ContainSubstring("denied the request")))
+
+	cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+	g.Expect(cond).ToNot(BeNil())
+	g.Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+	g.Expect(cond.Reason).To(Equal(ReasonJobRejected))
+	g.Expect(cond.Message).To(Equal("Could not create porter job " + jobName + ": " + msg))
+	g.Expect(r.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring(ReasonJobRejected)))
+}
+
+func TestIsSelected(t *testing.T) {
+	testcases := []struct {
+		name      string
+		namespace string
+		watch     []string
+		exclude   []string
+		labels    map[string]string
+		selector  string
+		want      bool
+	}{
+		{name: "defaults", namespace: "test", want: true},
+		{name: "watched", namespace: "test", watch: []string{"dev", "test"}, want: true},
+		{name: "not watched", namespace: "test", watch: []string{"dev"}},
+		{name: "excluded", namespace: "test", exclude: []string{"test"}},
+		{name: "watched and excluded", namespace: "test", watch: []string{"test"}, exclude: []string{"test"}},
+		{name: "not excluded", namespace: "dev", exclude: []string{"test"}, want: true},
+		{name: "watched without matching labels", namespace: "test", watch: []string{"test"}, selector: "team=blue"},
+		{name: "matching labels", namespace: "test", labels: map[string]string{"team": "blue"}, selector: "team=blue", want: true},
+		{name: "other labels", namespace: "test", labels: map[string]string{"team": "red"}, selector: "team=blue"},
+		{name: "matching set", namespace: "test", labels: map[string]string{"team": "red"}, selector: "team in (blue, red)", want: true},
+		{name: "excluded with matching labels", namespace: "test", exclude: []string{"test"}, labels: map[string]string{"team": "blue"}, selector: "team=blue"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Namespace = tc.namespace
+			inst.Labels = tc.labels
+			r := &InstallationReconciler{WatchNamespaces: tc.watch, ExcludeNamespaces: tc.exclude}
+			if tc.selector != "" {
+				selector, err := labels.Parse(tc.selector)
+				g.Expect(err).ToNot(HaveOccurred())
+				r.InstallationSelector = selector
+			}
+			g.Expect(r.isSelected(inst)).To(Equal(tc.want))
+		})
+	}
+}
+
+func TestReconcile_NotSelected(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Labels = map[string]string{"team": "red"}
+	r := newTestReconciler(t, inst)
+	selector, err := labels.Parse("team=blue")
+	g.Expect(err).ToNot(HaveOccurred())
+	r.InstallationSelector = selector
+
+	_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(inst)})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	jobs := &batchv1.JobList{}
+	g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+	g.Expect(jobs.Items).To(BeEmpty(), "another operator handles the Installation")
+	stored := &porterv1.Installation{}
+	g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(inst), stored)).To(Succeed())
+	g.Expect(stored.Finalizers).To(BeEmpty())
+	g.Expect(stored.Status).To(Equal(inst.Status))
+}
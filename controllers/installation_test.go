@@ -27,6 +27,10 @@ var _ = Describe("Installation controller", func() {
 
 	Context("When working with Porter", func() {
 		It("Should execute Porter", func() {
+			if !useExistingCluster() {
+				Skip("requires a cluster that runs jobs, set USE_EXISTING_CLUSTER=true")
+			}
+
 			By("By creating a new Installation")
 			ctx := context.Background()
 			inst := &apiv1.Installation{
@@ -47,13 +51,9 @@ var _ = Describe("Installation controller", func() {
 			}
 			Expect(k8sClient.Create(ctx, inst)).Should(Succeed())
 
-			jobs := &batchv1.JobList{}
-			inNamespace := client.InNamespace(testNamespace)
-			err := k8sClient.List(ctx, jobs, inNamespace)
-			Expect(err).Should(Succeed())
-			Expect(jobs.Items).Should(HaveLen(1))
+			jobs := waitForJobs(ctx, testNamespace, 1)
 
-			job := jobs.Items[0]
+			job := jobs[0]
 			Expect(job.Labels).Should(gstruct.MatchKeys(gstruct.IgnoreMissing, gstruct.Keys{
 				"porter":       Equal("true"),
 				"installation": Equal(InstallationName),
@@ -70,12 +70,19 @@ var _ = Describe("Installation controller", func() {
 
 			Expect(job.Spec.Template.Spec.Volumes).Should(ContainElement(IsVolume("porter-config")))
 			Expect(container.VolumeMounts).Should(ContainElement(IsVolumeMount("porter-config")))
+			Expect(job.Spec.Template.Spec.Volumes).Should(ContainElement(IsVolume("porter-shared")))
+			Expect(container.VolumeMounts).Should(ContainElement(IsVolumeMount("porter-shared")))
+			Expect(container.Env).Should(ContainElement(corev1.EnvVar{Name: "JOB_VOLUME_NAME", Value: job.Name}))
+
+			pvc := &corev1.PersistentVolumeClaim{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, pvc)).To(Succeed())
+			Expect(pvc.Spec.AccessModes).To(Equal([]corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}))
 
 			// Validate that the job succeeded
 			waitCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 			defer cancel()
 			for {
-				err = k8sClient.Get(waitCtx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, &job)
+				err := k8sClient.Get(waitCtx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, &job)
 				Expect(err).ToNot(HaveOccurred())
 
 				if IsJobDone(job.Status) {
@@ -100,8 +107,118 @@ var _ = Describe("Installation controller", func() {
 			Expect(job.Status.Succeeded).To(Equal(int32(1)))
 		})
 	})
+
+	Context("When reconciling an Installation", func() {
+		It("Should create a job and volume for the Installation", func() {
+			ctx := context.Background()
+			inst := newInstallation(InstallationName)
+			Expect(k8sClient.Create(ctx, inst)).Should(Succeed())
+
+			job := waitForJobs(ctx, testNamespace, 1)[0]
+			Expect(job.Labels).Should(gstruct.MatchKeys(gstruct.IgnoreExtras, gstruct.Keys{
+				"porter":       Equal("true"),
+				"installation": Equal(InstallationName),
+			}))
+
+			container := job.Spec.Template.Spec.Containers[0]
+			Expect(container.Image).Should(Equal("ghcr.io/getporter/porter:kubernetes-canary"))
+			Expect(container.Args).Should(Equal([]string{"install", InstallationName, "--reference=" + inst.Spec.Reference, "--debug", "--debug-plugins", "--driver=kubernetes"}))
+			Expect(job.Spec.Template.Spec.ServiceAccountName).Should(Equal("porter-agent"))
+
+			pvc := &corev1.PersistentVolumeClaim{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: testNamespace}, pvc)).Should(Succeed())
+			Expect(pvc.Labels).Should(HaveKeyWithValue("job", job.Name))
+		})
+
+		It("Should use the default configuration when the porter ConfigMap is missing", func() {
+			ctx := context.Background()
+			porterCfg := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "porter", Namespace: testNamespace}}
+			Expect(k8sClient.Delete(ctx, porterCfg)).Should(Succeed())
+			// Envtest does not run the controller that creates the namespace's
+			// default service account, which the agent uses by default
+			defaultSA := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: testNamespace}}
+			Expect(k8sClient.Create(ctx, defaultSA)).Should(Succeed())
+
+			inst := newInstallation(InstallationName)
+			Expect(k8sClient.Create(ctx, inst)).Should(Succeed())
+
+			job := waitForJobs(ctx, testNamespace, 1)[0]
+			container := job.Spec.Template.Spec.Containers[0]
+			Expect(container.Image).Should(Equal("ghcr.io/getporter/porter:kubernetes-latest"))
+			Expect(container.ImagePullPolicy).Should(Equal(corev1.PullAlways))
+			Expect(job.Spec.Template.Spec.ServiceAccountName).Should(BeEmpty())
+		})
+
+		It("Should create a new job when the Installation is changed", func() {
+			ctx := context.Background()
+			inst := newInstallation(InstallationName)
+			Expect(k8sClient.Create(ctx, inst)).Should(Succeed())
+			firstJob := waitForJobs(ctx, testNamespace, 1)[0]
+
+			By("Waiting for the first job to complete")
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: inst.Name, Namespace: testNamespace}, inst)).Should(Succeed())
+			inst.Spec.PorterVersion = "v0.33.0"
+			Expect(k8sClient.Update(ctx, inst)).Should(Succeed())
+			Consistently(func() ([]batchv1.Job, error) {
+				return listJobs(ctx, testNamespace)
+			}, 2*time.Second).Should(HaveLen(1))
+			completeJob(ctx, &firstJob)
+
+			By("Running a new job for the change")
+			jobs := waitForJobs(ctx, testNamespace, 2)
+			var images []string
+			for _, j := range jobs {
+				images = append(images, j.Spec.Template.Spec.Containers[0].Image)
+			}
+			Expect(images).Should(ConsistOf("ghcr.io/getporter/porter:kubernetes-canary", "ghcr.io/getporter/porter:kubernetes-v0.33.0"))
+		})
+	})
 })
 
+func newInstallation(name string) *apiv1.Installation {
+	return &apiv1.Installation{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "porter.sh/v1",
+			Kind:       "Installation",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+		},
+		Spec: apiv1.InstallationSpec{
+			Reference: "getporter/porter-hello:v0.1.1",
+			Action:    "install",
+		},
+	}
+}
+
+func listJobs(ctx context.Context, namespace string) ([]batchv1.Job, error) {
+	jobs := &batchv1.JobList{}
+	err := k8sClient.List(ctx, jobs, client.InNamespace(namespace))
+	return jobs.Items, err
+}
+
+// waitForJobs waits until the specified number of jobs exist in the namespace.
+func waitForJobs(ctx context.Context, namespace string, count int) []batchv1.Job {
+	var jobs []batchv1.Job
+	Eventually(func() ([]batchv1.Job, error) {
+		var err error
+		jobs, err = listJobs(ctx, namespace)
+		return jobs, err
+	}, 20*time.Second).Should(HaveLen(count))
+	return jobs
+}
+
+// completeJob marks the job as complete, since envtest does not run the job controller.
+func completeJob(ctx context.Context, job *batchv1.Job) {
+	job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{
+		Type:   batchv1.JobComplete,
+		Status: corev1.ConditionTrue,
+	})
+	job.Status.Succeeded = 1
+	Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+}
+
 func IsVolume(name string) gomegatypes.GomegaMatcher {
 	return WithTransform(func(v corev1.Volume) string { return v.Name }, Equal(name))
 }
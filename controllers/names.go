@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+const (
+	// maxNameLength is the maximum length of a name that is also used as a label value.
+	maxNameLength = 63
+
+	// nameHashLength is the number of characters of the hash appended to generated names.
+	nameHashLength = 8
+)
+
+// makeJobName generates the name used for the Job, and related objects, that
+// runs the current generation of the Installation. The name is deterministic,
+// unique per generation and rerun, and is always a valid label value,
+// truncating the Installation name when necessary.
+func makeJobName(inst *porterv1.Installation) string {
+	seed := fmt.Sprintf("%s/%d", inst.Name, inst.Generation)
+	if rerun := inst.GetRerun(); rerun != "" {
+		seed += "/rerun/" + rerun
+	}
+	return makeName(inst.Name, seed)
+}
+
+// makeUninstallJobName generates the name of the Job that uninstalls the
+// bundle when the Installation is deleted.
+func makeUninstallJobName(inst *porterv1.Installation) string {
+	return makeName(inst.Name, fmt.Sprintf("%s/%d/uninstall", inst.Name, inst.Generation))
+}
+
+// makeDriftCheckJobName generates the name of the Job that runs the bundle's
+// status action at the specified time, to check the Installation for drift.
+func makeDriftCheckJobName(inst *porterv1.Installation, t time.Time) string {
+	return makeName(inst.Name, fmt.Sprintf("%s/%d/drift/%d", inst.Name, inst.Generation, t.Unix()))
+}
+
+// jobNameTemplateData are the variables available to the jobNameTemplate,
+// e.g. team-{{ .Name }}-{{ .Suffix }}.
+type jobNameTemplateData struct {
+	// Name of the Installation, truncated so that the job name fits in 63 characters.
+	Name string
+
+	// Suffix is the hash that makes the job name unique.
+	Suffix string
+}
+
+// getJobName returns the name of a job, generated by one of the make*JobName
+// functions, after applying the jobNameTemplate from the porter ConfigMap.
+// The generated name is used when no template is configured.
+func (r *InstallationReconciler) getJobName(ctx context.Context, inst *porterv1.Installation, name string) (string, error) {
+	tmpl, source, ok := r.getPorterConfig(ctx, inst).get("jobNameTemplate")
+	if !ok {
+		return name, nil
+	}
+
+	jobName, err := applyJobNameTemplate(tmpl, inst.Name, name[len(name)-nameHashLength:])
+	if err != nil {
+		return "", newTerminalError(ReasonInvalidSetting, errors.Wrapf(err, "invalid jobNameTemplate %q in %s", tmpl, source))
+	}
+	return jobName, nil
+}
+
+// applyJobNameTemplate renders the name of a job from a template. The
+// Installation name is truncated when the name would be too long to also be
+// used as a label value. The name must be a valid DNS label, and the template
+// must use the Suffix so that every job has a different name.
+func applyJobNameTemplate(tmpl string, installation string, suffix string) (string, error) {
+	t, err := template.New("jobName").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	render := func(data jobNameTemplateData) (string, error) {
+		var buf bytes.Buffer
+		err := t.Execute(&buf, data)
+		return buf.String(), err
+	}
+
+	// Work out how much room is left for the Installation name
+	withoutName, err := render(jobNameTemplateData{Suffix: suffix})
+	if err != nil {
+		return "", err
+	}
+	if other, err := render(jobNameTemplateData{Suffix: strings.Repeat("0", len(suffix))}); err != nil || other == withoutName {
+		return "", errors.New("the template must use {{ .Suffix }} so that job names are unique")
+	}
+	if maxLength := maxNameLength - len(withoutName); len(installation) > maxLength && maxLength > 0 {
+		installation = strings.TrimRight(installation[:maxLength], "-.")
+	}
+
+	name, err := render(jobNameTemplateData{Name: installation, Suffix: suffix})
+	if err != nil {
+		return "", err
+	}
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return "", errors.Errorf("the job name %q is invalid: %s", name, strings.Join(errs, ", "))
+	}
+	return name, nil
+}
+
+// makeOutputsSecretName returns the name of the Secret with the outputs
+// published by the Installation's last successful run.
+func makeOutputsSecretName(installation string) string {
+	return installation + "-outputs"
+}
+
+// makeOutputsConfigMapName returns the name of the ConfigMap with the
+// non-sensitive file outputs of the Installation's last successful run.
+func makeOutputsConfigMapName(installation string) string {
+	return installation + "-outputs"
+}
+
+// makeAgentRoleName returns the name of the Role and RoleBinding that grant
+// the Installation's agentPermissions to the porter agent.
+func makeAgentRoleName(installation string) string {
+	return installation + "-porter-agent"
+}
+
+// makePorterConfigSecretName returns the name of the secret with porter's
+// config file for the configuration profile, or the default profile when empty.
+func makePorterConfigSecretName(profile string) string {
+	if profile == "" {
+		return "porter-config"
+	}
+	return "porter-config-" + profile
+}
+
+// makePorterEnvSecretName returns the name of the secret with the environment
+// variables for porter's plugins for the configuration profile, or the
+// default profile when empty.
+func makePorterEnvSecretName(profile string) string {
+	if profile == "" {
+		return "porter-env"
+	}
+	return "porter-env-" + profile
+}
+
+// makeMirroredSecretName returns the name of the copy, in the Installation's
+// namespace, of a porter secret that is kept in another namespace.
+func makeMirroredSecretName(installation string, secret string) string {
+	return installation + "-" + secret
+}
+
+// makeName truncates the prefix so that it fits in the 63 character limit
+// and appends a short hash of the specified seed.
+func makeName(prefix string, seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	hash := hex.EncodeToString(sum[:])[:nameHashLength]
+
+	maxPrefixLength := maxNameLength - nameHashLength - 1
+	if len(prefix) > maxPrefixLength {
+		prefix = prefix[:maxPrefixLength]
+	}
+	// Names must end with an alphanumeric character
+	prefix = strings.TrimRight(prefix, "-.")
+
+	return prefix + "-" + hash
+}
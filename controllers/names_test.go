@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestMakeJobName(t *testing.T) {
+	testcases := []struct {
+		name           string
+		installation   string
+		wantPrefix     string
+		wantFullLength bool
+	}{
+		{name: "short name", installation: "porter-hello", wantPrefix: "porter-hello-"},
+		{name: "max length name", installation: strings.Repeat("a", 54), wantPrefix: strings.Repeat("a", 54) + "-", wantFullLength: true},
+		{name: "long name", installation: strings.Repeat("a", 253), wantPrefix: strings.Repeat("a", 54) + "-", wantFullLength: true},
+		{name: "truncated on separator", installation: strings.Repeat("a", 53) + "-bbbb", wantPrefix: strings.Repeat("a", 53) + "-"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := &porterv1.Installation{ObjectMeta: metav1.ObjectMeta{Name: tc.installation, Generation: 1}}
+
+			name := makeJobName(inst)
+			g.Expect(name).To(HavePrefix(tc.wantPrefix))
+			g.Expect(len(name)).To(BeNumerically("<=", 63))
+			if tc.wantFullLength {
+				g.Expect(name).To(HaveLen(63))
+			}
+			g.Expect(validation.IsDNS1123Label(name)).To(BeEmpty())
+		})
+	}
+}
+
+func TestMakeJobName_Deterministic(t *testing.T) {
+	g := NewWithT(t)
+	longName := strings.Repeat("a", 100)
+	inst := &porterv1.Installation{ObjectMeta: metav1.ObjectMeta{Name: longName, Generation: 1}}
+	g.Expect(makeJobName(inst)).To(Equal(makeJobName(inst.DeepCopy())), "the same generation should always produce the same name")
+
+	next := inst.DeepCopy()
+	next.Generation = 2
+	g.Expect(makeJobName(next)).ToNot(Equal(makeJobName(inst)), "each generation should have a different name")
+
+	other := inst.DeepCopy()
+	other.Name = longName + "b"
+	g.Expect(makeJobName(other)).ToNot(Equal(makeJobName(inst)), "installations that share a truncated prefix should have different names")
+}
+
+func TestMakeJobName_Rerun(t *testing.T) {
+	g := NewWithT(t)
+	inst := &porterv1.Installation{ObjectMeta: metav1.ObjectMeta{Name: "porter-hello", Generation: 1}}
+	name := makeJobName(inst)
+
+	inst.Annotations = map[string]string{porterv1.AnnotationRerun: "2021-06-01T00:00:00Z"}
+	rerun := makeJobName(inst)
+	g.Expect(rerun).ToNot(Equal(name))
+	g.Expect(validation.IsDNS1123Label(rerun)).To(BeEmpty())
+	g.Expect(makeJobName(inst)).To(Equal(rerun))
+}
+
+func TestApplyJobNameTemplate(t *testing.T) {
+	testcases := []struct {
+		name         string
+		template     string
+		installation string
+		want         string
+		wantErr      string
+	}{
+		{name: "prefix", template: "team-blue-{{ .Name }}-{{ .Suffix }}", installation: "hello", want: "team-blue-hello-abcd1234"},
+		{name: "truncates the installation", template: "team-blue-{{ .Name }}-{{ .Suffix }}", installation: strings.Repeat("a", 60),
+			want: "team-blue-" + strings.Repeat("a", 44) + "-abcd1234"},
+		{name: "no suffix", template: "{{ .Name }}", installation: "hello", wantErr: "must use {{ .Suffix }}"},
+		{name: "not a DNS label", template: "Team_{{ .Name }}-{{ .Suffix }}", installation: "hello", wantErr: `the job name "Team_hello-abcd1234" is invalid`},
+		{name: "unknown variable", template: "{{ .Namespace }}-{{ .Suffix }}", installation: "hello", wantErr: "can't evaluate field Namespace"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			got, err := applyJobNameTemplate(tc.template, tc.installation, "abcd1234")
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tc.want))
+			g.Expect(len(got)).To(BeNumerically("<=", maxNameLength))
+		})
+	}
+}
+
+func TestGetJobName(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	r := newTestReconciler(t, inst)
+	name := makeJobName(inst)
+
+	got, err := r.getJobName(context.Background(), inst, name)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(got).To(Equal(name), "the generated name is used without a template")
+
+	r.Defaults = map[string]string{"jobNameTemplate": "porter-{{ .Name }}-{{ .Suffix }}"}
+	got, err = r.getJobName(context.Background(), inst, name)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(got).To(Equal("porter-hello-" + name[len(name)-nameHashLength:]))
+}
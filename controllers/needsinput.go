@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// getNeedsInputTimeout returns how long a porter job runs before it is
+// reported as possibly waiting for input. When zero, jobs are not checked.
+func (r *InstallationReconciler) getNeedsInputTimeout(ctx context.Context, cfg porterConfig) (time.Duration, error) {
+	v, source, ok := cfg.get("needsInputTimeout")
+	if !ok {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(v)
+	if err != nil || timeout < 0 {
+		return 0, invalidSettingf("invalid needsInputTimeout %q in %s, must be a duration, e.g. 30m", v, source)
+	}
+	r.getLogger(ctx).Info("porter job needs input timeout defaulted", "source", source, "needsInputTimeout", timeout)
+	return timeout, nil
+}
+
+// checkNeedsInput sets the NeedsInput condition when the porter job has been
+// running for longer than the needsInputTimeout, which usually means that the
+// bundle is waiting for input that a job cannot give it, instead of the run
+// hanging silently. The condition is cleared once the job finishes. When the
+// job has not reached the timeout yet, the time until it does is returned.
+func (r *InstallationReconciler) checkNeedsInput(ctx context.Context, inst *porterv1.Installation, job *batchv1.Job) (time.Duration, error) {
+	if isJobDone(job.Status) {
+		if meta.IsStatusConditionTrue(inst.Status.Conditions, porterv1.ConditionNeedsInput) {
+			return 0, r.setCondition(ctx, inst, porterv1.ConditionNeedsInput, metav1.ConditionFalse, ReasonJobFinished, "Porter job "+job.Name+" finished")
+		}
+		return 0, nil
+	}
+
+	timeout, err := r.getNeedsInputTimeout(ctx, r.getPorterConfig(ctx, inst))
+	if err != nil || timeout == 0 || job.Status.StartTime == nil {
+		return 0, err
+	}
+
+	running := time.Since(job.Status.StartTime.Time)
+	if running < timeout {
+		return timeout - running, nil
+	}
+
+	msg := fmt.Sprintf("Porter job %s has been running for more than %s, the bundle may be waiting for input. Check that the Installation provides all of the bundle's parameters and credentials", job.Name, timeout)
+	if !meta.IsStatusConditionTrue(inst.Status.Conditions, porterv1.ConditionNeedsInput) {
+		r.getLogger(ctx).Info("porter job may be waiting for input", "job", job.Name, "needsInputTimeout", timeout)
+		r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonNeedsInput, msg)
+	}
+	return 0, r.setCondition(ctx, inst, porterv1.ConditionNeedsInput, metav1.ConditionTrue, ReasonNeedsInput, msg)
+}
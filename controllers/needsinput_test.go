@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestCheckNeedsInput(t *testing.T) {
+	newJob := func(inst *porterv1.Installation, running time.Duration) *batchv1.Job {
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: makeJobName(inst), Namespace: inst.Namespace},
+			Status:     batchv1.JobStatus{StartTime: &metav1.Time{Time: time.Now().Add(-running)}},
+		}
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		r := newTestReconciler(t, inst)
+
+		after, err := r.checkNeedsInput(context.Background(), inst, newJob(inst, 24*time.Hour))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(after).To(BeZero())
+		g.Expect(meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionNeedsInput)).To(BeNil())
+	})
+
+	t.Run("before the timeout", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		r := newTestReconciler(t, inst)
+		r.Defaults = map[string]string{"needsInputTimeout": "30m"}
+
+		after, err := r.checkNeedsInput(context.Background(), inst, newJob(inst, 10*time.Minute))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(after).To(BeNumerically("~", 20*time.Minute, time.Minute))
+		g.Expect(meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionNeedsInput)).To(BeNil())
+	})
+
+	t.Run("past the timeout", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		r := newTestReconciler(t, inst)
+		r.Defaults = map[string]string{"needsInputTimeout": "30m"}
+		job := newJob(inst, time.Hour)
+
+		_, err := r.checkNeedsInput(context.Background(), inst, job)
+		g.Expect(err).ToNot(HaveOccurred())
+		cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionNeedsInput)
+		g.Expect(cond).ToNot(BeNil())
+		g.Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		g.Expect(cond.Reason).To(Equal(ReasonNeedsInput))
+
+		// Clear the condition once the job finishes
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+		_, err = r.checkNeedsInput(context.Background(), inst, job)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(meta.IsStatusConditionTrue(inst.Status.Conditions, porterv1.ConditionNeedsInput)).To(BeFalse())
+	})
+
+	t.Run("invalid timeout", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		r := newTestReconciler(t, inst)
+		r.Defaults = map[string]string{"needsInputTimeout": "30"}
+
+		_, err := r.checkNeedsInput(context.Background(), inst, newJob(inst, time.Hour))
+		g.Expect(err).To(MatchError(ContainSubstring(`invalid needsInputTimeout "30"`)))
+	})
+}
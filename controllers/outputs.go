@@ -0,0 +1,321 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// getFileOutputs returns the names of the bundle's outputs that are files
+// and are not sensitive.
+func (b *bundleDefinition) getFileOutputs() []string {
+	var names []string
+	for name, output := range b.Outputs {
+		def, ok := b.Definitions[output.Definition]
+		if ok && def.ContentEncoding == "base64" && !def.WriteOnly {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+const (
+	// outputsMarker is the line that the porter agent prints before the
+	// outputs of a run that succeeded, see images/porter/run.sh.
+	outputsMarker = "--- porter-operator outputs ---"
+
+	// annotationOutputsJob is the porter job that the outputs in an
+	// Installation's outputs Secret came from.
+	annotationOutputsJob = "porter.sh/outputs-job"
+
+	// annotationOutputsTooLarge lists the outputs that were left out of an
+	// Installation's outputs Secret because they do not fit in it.
+	annotationOutputsTooLarge = "porter.sh/outputs-too-large"
+)
+
+// agentOutput is an output in the JSON of porter installation outputs list.
+type agentOutput struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// parseOutputs finds the outputs that the porter agent printed after the last
+// outputsMarker in its logs. String values are kept as is, and other values
+// as JSON.
+func parseOutputs(logs []byte) (map[string][]byte, error) {
+	i := bytes.LastIndex(logs, []byte(outputsMarker+"\n"))
+	if i < 0 || (i > 0 && logs[i-1] != '\n') {
+		return nil, errors.New("the outputs were not found in the logs")
+	}
+
+	var list []agentOutput
+	err := json.NewDecoder(bytes.NewReader(logs[i+len(outputsMarker)+1:])).Decode(&list)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid outputs in the logs")
+	}
+	outputs := make(map[string][]byte, len(list))
+	for _, o := range list {
+		if v, ok := o.Value.(string); ok {
+			outputs[o.Name] = []byte(v)
+			continue
+		}
+		v, err := json.Marshal(o.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for output %s", o.Name)
+		}
+		outputs[o.Name] = v
+	}
+	return outputs, nil
+}
+
+// getAgentOutputs reads the outputs that the porter agent printed in the logs
+// of a job that succeeded. False is returned when the logs can not be read,
+// for example because the job's pod was removed or the agent image does not
+// print the outputs.
+func (r *InstallationReconciler) getAgentOutputs(ctx context.Context, namespace string, jobName string) (map[string][]byte, bool) {
+	log := r.getLogger(ctx)
+	if r.PodLogs == nil {
+		log.Info("could not read the outputs, pod logs are not available", "job", jobName)
+		return nil, false
+	}
+
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.InNamespace(namespace), client.MatchingLabels{"job-name": jobName})
+	if err != nil {
+		log.Info("could not read the outputs", "job", jobName, "reason", err.Error())
+		return nil, false
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded {
+			continue
+		}
+		logs, err := r.PodLogs.GetLogs(ctx, pod.Namespace, pod.Name, jobName)
+		if err != nil {
+			log.Info("could not read the outputs", "job", jobName, "pod", pod.Name, "reason", err.Error())
+			return nil, false
+		}
+		outputs, err := parseOutputs(logs)
+		if err != nil {
+			log.Info("could not read the outputs", "job", jobName, "pod", pod.Name, "reason", err.Error())
+			return nil, false
+		}
+		return outputs, true
+	}
+	log.Info("could not read the outputs, the job's pod was not found", "job", jobName)
+	return nil, false
+}
+
+// publishOutputs copies the outputs of the Installation's last run, once it
+// succeeded, from the logs of its porter agent to the Installation's outputs
+// Secret, where each key is an output. The Secret is annotated with the job
+// that the outputs came from, so that each run is published once, and is
+// removed once the bundle is uninstalled. Outputs that would go over the
+// Secret's size limit are left out and listed in its annotations, see
+// publishFileOutputs.
+func (r *InstallationReconciler) publishOutputs(ctx context.Context, inst *porterv1.Installation) error {
+	if inst.Status.Phase != porterv1.PhaseSucceeded || inst.Spec.ValidateOnly || inst.Status.LastJob.Name == "" {
+		return nil
+	}
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: makeOutputsSecretName(inst.Name), Namespace: inst.Namespace}, secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "could not retrieve the outputs of Installation %s/%s", inst.Namespace, inst.Name)
+	}
+	published := err == nil && secret.Annotations[annotationOutputsJob] != ""
+	if !inst.Status.Installed {
+		if !published {
+			return nil
+		}
+		r.getLogger(ctx).Info("removing the outputs of the uninstalled bundle", "secret", secret.Name)
+		err = r.Delete(ctx, secret)
+		return errors.Wrapf(client.IgnoreNotFound(err), "could not remove the outputs of Installation %s/%s", inst.Namespace, inst.Name)
+	}
+	if published && secret.Annotations[annotationOutputsJob] == inst.Status.LastJob.Name {
+		return nil
+	}
+
+	outputs, ok := r.getAgentOutputs(ctx, inst.Namespace, inst.Status.LastJob.Name)
+	if !ok {
+		return nil
+	}
+	// The API server rejects a Secret over the limit, publish the outputs
+	// that fit in name order
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var size int
+	var tooLarge []string
+	for _, name := range names {
+		if size+len(name)+len(outputs[name]) > corev1.MaxSecretSize {
+			tooLarge = append(tooLarge, name)
+			delete(outputs, name)
+			continue
+		}
+		size += len(name) + len(outputs[name])
+	}
+	if len(tooLarge) > 0 {
+		r.getLogger(ctx).Info("outputs are too large to publish", "outputs", tooLarge)
+	}
+	secret = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: makeOutputsSecretName(inst.Name), Namespace: inst.Namespace}}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		secret.Labels = map[string]string{
+			"porter":       "true",
+			"installation": inst.Name,
+		}
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Annotations[annotationOutputsJob] = inst.Status.LastJob.Name
+		delete(secret.Annotations, annotationOutputsTooLarge)
+		if len(tooLarge) > 0 {
+			secret.Annotations[annotationOutputsTooLarge] = strings.Join(tooLarge, ",")
+		}
+		secret.OwnerReferences = getOwnerReferences(inst)
+		secret.Data = outputs
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "could not publish the outputs of Installation %s/%s to secret %s", inst.Namespace, inst.Name, secret.Name)
+	}
+	r.getLogger(ctx).Info("published outputs", "secret", secret.Name, "job", inst.Status.LastJob.Name, "outputs", len(outputs))
+	return nil
+}
+
+// maxOutputsConfigMapSize is the most data, keys included, that the API
+// server accepts in a ConfigMap, the same limit as a Secret.
+const maxOutputsConfigMapSize = corev1.MaxSecretSize
+
+// publishFileOutputs copies the non-sensitive file outputs of an Installation
+// that succeeded, from its outputs Secret to a ConfigMap with the same name,
+// so that they can be mounted like any other configuration. Sensitive outputs
+// are left in the Secret. Which outputs are files, and which are sensitive,
+// comes from the bundle that resolveBundle reads, and nothing is published
+// when it can not be read. Outputs that would go over the ConfigMap's size
+// limit are only left in the Secret, and they are reported with the outputs
+// that did not fit in the Secret, see setOutputsTooLarge.
+func (r *InstallationReconciler) publishFileOutputs(ctx context.Context, inst *porterv1.Installation) error {
+	if inst.Status.Phase != porterv1.PhaseSucceeded || inst.Spec.ValidateOnly {
+		return nil
+	}
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: makeOutputsSecretName(inst.Name), Namespace: inst.Namespace}, secret)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "could not retrieve the outputs of Installation %s/%s", inst.Namespace, inst.Name)
+	}
+	var secretTooLarge []string
+	if v := secret.Annotations[annotationOutputsTooLarge]; v != "" {
+		secretTooLarge = strings.Split(v, ",")
+	}
+
+	bun, err := r.resolveBundle(ctx, inst)
+	if err != nil {
+		return err
+	}
+	var names []string
+	if bun != nil {
+		names = bun.getFileOutputs()
+	}
+
+	data := map[string]string{}
+	binaryData := map[string][]byte{}
+	var size int
+	var tooLarge []string
+	for _, name := range names {
+		value, ok := secret.Data[name]
+		if !ok {
+			continue
+		}
+		// The API server rejects a ConfigMap over the limit, leave the
+		// outputs that do not fit in the Secret and publish the rest
+		if size+len(name)+len(value) > maxOutputsConfigMapSize {
+			tooLarge = append(tooLarge, name)
+			continue
+		}
+		size += len(name) + len(value)
+		// ConfigMap data must be UTF-8, other files are kept as binary data
+		if utf8.Valid(value) {
+			data[name] = string(value)
+		} else {
+			binaryData[name] = value
+		}
+	}
+	if err = r.setOutputsTooLarge(ctx, inst, secretTooLarge, tooLarge); err != nil {
+		return err
+	}
+	if len(data) == 0 && len(binaryData) == 0 {
+		return nil
+	}
+
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: makeOutputsConfigMapName(inst.Name), Namespace: inst.Namespace}}
+	result, err := controllerutil.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		cm.Labels = map[string]string{
+			"porter":       "true",
+			"installation": inst.Name,
+		}
+		cm.OwnerReferences = getOwnerReferences(inst)
+		cm.Data = data
+		cm.BinaryData = binaryData
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "could not publish the file outputs of Installation %s/%s to configmap %s", inst.Namespace, inst.Name, cm.Name)
+	}
+	if result != controllerutil.OperationResultNone {
+		r.getLogger(ctx).Info("published file outputs", "configmap", cm.Name, "outputs", len(data)+len(binaryData))
+	}
+	return nil
+}
+
+// setOutputsTooLarge records the outputs that were not published to the
+// outputs Secret, and the file outputs that were not published to the outputs
+// ConfigMap, because they are too large in the OutputsTooLarge condition,
+// with an event when the outputs change. The condition is cleared once every
+// output is published.
+func (r *InstallationReconciler) setOutputsTooLarge(ctx context.Context, inst *porterv1.Installation, secretTooLarge []string, tooLarge []string) error {
+	existing := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionOutputsTooLarge)
+	if len(secretTooLarge) == 0 && len(tooLarge) == 0 {
+		if existing == nil || existing.Status != metav1.ConditionTrue {
+			return nil
+		}
+		return r.setCondition(ctx, inst, porterv1.ConditionOutputsTooLarge, metav1.ConditionFalse, ReasonOutputsPublished, "Every output was published to secret "+makeOutputsSecretName(inst.Name)+" and every file output to configmap "+makeOutputsConfigMapName(inst.Name))
+	}
+
+	var msgs []string
+	if len(secretTooLarge) > 0 {
+		msgs = append(msgs, fmt.Sprintf("The outputs %s are too large for secret %s and were not published",
+			strings.Join(secretTooLarge, ", "), makeOutputsSecretName(inst.Name)))
+	}
+	if len(tooLarge) > 0 {
+		msgs = append(msgs, fmt.Sprintf("The file outputs %s are too large for configmap %s and are only in secret %s",
+			strings.Join(tooLarge, ", "), makeOutputsConfigMapName(inst.Name), makeOutputsSecretName(inst.Name)))
+	}
+	msg := strings.Join(msgs, ". ")
+	if existing == nil || existing.Message != msg {
+		r.getLogger(ctx).Info("outputs are too large to publish", "secretOutputs", secretTooLarge, "fileOutputs", tooLarge)
+		r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonOutputsTooLarge, msg)
+	}
+	return r.setCondition(ctx, inst, porterv1.ConditionOutputsTooLarge, metav1.ConditionTrue, ReasonOutputsTooLarge, msg)
+}
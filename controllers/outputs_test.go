@@ -0,0 +1,364 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+const testOutputsLogs = `installing mysql...
+execution completed successfully!
+--- porter-operator outputs ---
+[
+  {"name": "connstr", "type": "string", "value": "mysql://example", "sensitive": true},
+  {"name": "ca-cert", "type": "file", "value": "-----BEGIN CERTIFICATE-----\n"},
+  {"name": "port", "type": "integer", "value": 3306},
+  {"name": "replicas", "type": "array", "value": ["a", "b"]}
+]
+`
+
+func TestParseOutputs(t *testing.T) {
+	g := NewWithT(t)
+
+	outputs, err := parseOutputs([]byte(testOutputsLogs))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(outputs).To(Equal(map[string][]byte{
+		"connstr":  []byte("mysql://example"),
+		"ca-cert":  []byte("-----BEGIN CERTIFICATE-----\n"),
+		"port":     []byte("3306"),
+		"replicas": []byte(`["a","b"]`),
+	}))
+
+	outputs, err = parseOutputs([]byte("--- porter-operator outputs ---\n[]\n"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(outputs).To(BeEmpty(), "a bundle without outputs has none")
+
+	_, err = parseOutputs([]byte("execution completed successfully!\n"))
+	g.Expect(err).To(MatchError(ContainSubstring("not found")))
+	_, err = parseOutputs([]byte("echo --- porter-operator outputs ---\n[]\n"))
+	g.Expect(err).To(MatchError(ContainSubstring("not found")), "the marker must start a line")
+	_, err = parseOutputs([]byte("--- porter-operator outputs ---\nError: installation not found\n"))
+	g.Expect(err).To(MatchError(ContainSubstring("invalid outputs")))
+}
+
+func TestRunScript_Outputs(t *testing.T) {
+	testcases := []struct {
+		name        string
+		env         []string
+		wantOutputs map[string][]byte
+	}{
+		{name: "succeeded", env: []string{"PORTER_INSTALLATION=hello", "PORTER_PUBLISH_OUTPUTS=true"}, wantOutputs: map[string][]byte{"greeting": []byte("hello")}},
+		{name: "failed", env: []string{"PORTER_INSTALLATION=hello", "PORTER_PUBLISH_OUTPUTS=true", "FAKE_PORTER_ERROR=Error: failed to install"}},
+		{name: "uninstall", env: []string{"PORTER_INSTALLATION=hello"}},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			logs, _, _ := runAgentScript(t, tc.env, "install", "hello")
+
+			outputs, err := parseOutputs([]byte(logs))
+			if tc.wantOutputs == nil {
+				g.Expect(err).To(HaveOccurred(), logs)
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred(), logs)
+			g.Expect(outputs).To(Equal(tc.wantOutputs))
+		})
+	}
+}
+
+// TestPublishOutputs runs an Installation to completion and checks that its
+// outputs are published for parametersFromInstallation and file outputs.
+func TestPublishOutputs(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	mysql := newTestInstallation()
+	mysql.Name = "mysql"
+	mysql.Spec.BundleConfigMap = "mysql-bundle"
+	app := newTestInstallation()
+	app.Name = "app"
+	bundle := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "mysql-bundle", Namespace: mysql.Namespace},
+		Data: map[string]string{bundleFileName: `{
+  "name": "mysql",
+  "version": "0.1.0",
+  "definitions": {
+    "file": {"type": "string", "contentEncoding": "base64"},
+    "string": {"type": "string", "writeOnly": true}
+  },
+  "outputs": {
+    "ca-cert": {"definition": "file"},
+    "connstr": {"definition": "string"}
+  }
+}`},
+	}
+	r := newTestReconciler(t, mysql, app, bundle)
+	r.PodLogs = staticPodLogs(testOutputsLogs)
+
+	jobName := makeJobName(mysql)
+	g.Expect(r.createJobForInstallation(ctx, jobName, mysql, nil)).To(Succeed())
+	job := &batchv1.Job{}
+	g.Expect(r.Get(ctx, client.ObjectKey{Namespace: mysql.Namespace, Name: jobName}, job)).To(Succeed())
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	g.Expect(r.Status().Update(ctx, job)).To(Succeed())
+	g.Expect(r.Create(ctx, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: jobName + "-abc12", Namespace: mysql.Namespace, Labels: map[string]string{"job-name": jobName}},
+		Status:     corev1.PodStatus{Phase: corev1.PodSucceeded},
+	})).To(Succeed())
+
+	// The outputs are only published once the run succeeded
+	g.Expect(r.publishOutputs(ctx, mysql)).To(Succeed())
+	_, err := r.getInstallationOutputSource(ctx, app.Namespace, porterv1.ParameterFromInstallation{Name: "connection-string", Installation: "mysql", Output: "connstr"})
+	g.Expect(err).To(HaveOccurred())
+
+	g.Expect(r.setJobStatus(ctx, mysql, job)).To(Succeed())
+	g.Expect(mysql.Status.Phase).To(Equal(porterv1.PhaseSucceeded))
+	g.Expect(r.publishOutputs(ctx, mysql)).To(Succeed())
+	g.Expect(r.publishFileOutputs(ctx, mysql)).To(Succeed())
+
+	secret := &corev1.Secret{}
+	g.Expect(r.Get(ctx, client.ObjectKey{Namespace: mysql.Namespace, Name: makeOutputsSecretName(mysql.Name)}, secret)).To(Succeed())
+	g.Expect(secret.Data).To(HaveKeyWithValue("connstr", []byte("mysql://example")))
+	g.Expect(secret.Labels).To(Equal(map[string]string{"porter": "true", "installation": "mysql"}))
+	g.Expect(secret.Annotations).To(HaveKeyWithValue(annotationOutputsJob, jobName))
+	g.Expect(secret.OwnerReferences).To(Equal(getOwnerReferences(mysql)))
+
+	source, err := r.getInstallationOutputSource(ctx, app.Namespace, porterv1.ParameterFromInstallation{Name: "connection-string", Installation: "mysql", Output: "connstr"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(source.Secret.SecretName).To(Equal(secret.Name))
+
+	cm := &corev1.ConfigMap{}
+	g.Expect(r.Get(ctx, client.ObjectKey{Namespace: mysql.Namespace, Name: makeOutputsConfigMapName(mysql.Name)}, cm)).To(Succeed())
+	g.Expect(cm.Data).To(Equal(map[string]string{"ca-cert": "-----BEGIN CERTIFICATE-----\n"}))
+
+	// The same run is only published once
+	r.PodLogs = staticPodLogs("--- porter-operator outputs ---\n[]\n")
+	g.Expect(r.publishOutputs(ctx, mysql)).To(Succeed())
+	g.Expect(r.Get(ctx, client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+	g.Expect(secret.Data).To(HaveKey("connstr"))
+
+	// The outputs are removed once the bundle is uninstalled
+	mysql.Status.Installed = false
+	g.Expect(r.publishOutputs(ctx, mysql)).To(Succeed())
+	err = r.Get(ctx, client.ObjectKeyFromObject(secret), secret)
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+}
+
+func TestPublishOutputs_TooLarge(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	inst := newTestInstallation()
+	inst.Status.Phase = porterv1.PhaseSucceeded
+	inst.Status.Installed = true
+	inst.Status.LastJob.Name = "hello-install"
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "hello-install-abc12", Namespace: inst.Namespace, Labels: map[string]string{"job-name": "hello-install"}},
+		Status:     corev1.PodStatus{Phase: corev1.PodSucceeded},
+	}
+	r := newTestReconciler(t, inst, pod)
+	manifests := strings.Repeat("a", corev1.MaxSecretSize)
+	r.PodLogs = staticPodLogs(fmt.Sprintf("--- porter-operator outputs ---\n[{\"name\": \"connstr\", \"value\": \"mysql://example\"}, {\"name\": \"manifests\", \"value\": %q}]\n", manifests))
+
+	g.Expect(r.publishOutputs(ctx, inst)).To(Succeed(), "large outputs should not fail the reconcile")
+	g.Expect(r.publishFileOutputs(ctx, inst)).To(Succeed())
+
+	secret := &corev1.Secret{}
+	g.Expect(r.Get(ctx, client.ObjectKey{Namespace: inst.Namespace, Name: makeOutputsSecretName(inst.Name)}, secret)).To(Succeed())
+	g.Expect(secret.Data).To(HaveKey("connstr"), "the outputs that fit should still be published")
+	g.Expect(secret.Data).ToNot(HaveKey("manifests"))
+	g.Expect(secret.Annotations).To(HaveKeyWithValue(annotationOutputsTooLarge, "manifests"))
+	cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionOutputsTooLarge)
+	g.Expect(cond).ToNot(BeNil())
+	g.Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+	g.Expect(cond.Message).To(ContainSubstring("The outputs manifests are too large for secret hello-outputs"))
+	g.Expect(r.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring(ReasonOutputsTooLarge)))
+
+	// The condition is cleared once a run's outputs fit
+	inst.Status.LastJob.Name = "hello-upgrade"
+	pod.Name = "hello-upgrade-abc12"
+	pod.Labels["job-name"] = "hello-upgrade"
+	pod.ResourceVersion = ""
+	g.Expect(r.Create(ctx, pod)).To(Succeed())
+	r.PodLogs = staticPodLogs(testOutputsLogs)
+	g.Expect(r.publishOutputs(ctx, inst)).To(Succeed())
+	g.Expect(r.publishFileOutputs(ctx, inst)).To(Succeed())
+
+	secret = &corev1.Secret{}
+	g.Expect(r.Get(ctx, client.ObjectKey{Namespace: inst.Namespace, Name: makeOutputsSecretName(inst.Name)}, secret)).To(Succeed())
+	g.Expect(secret.Annotations).ToNot(HaveKey(annotationOutputsTooLarge))
+	cond = meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionOutputsTooLarge)
+	g.Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+	g.Expect(cond.Reason).To(Equal(ReasonOutputsPublished))
+}
+
+func TestPublishOutputs_Unpublished(t *testing.T) {
+	t.Run("keeps a secret the operator did not create", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		inst.Status.Phase = porterv1.PhaseSucceeded
+		inst.Status.LastJob.Name = "hello-uninstall"
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: makeOutputsSecretName(inst.Name), Namespace: inst.Namespace},
+			Data:       map[string][]byte{"connstr": []byte("mysql://example")},
+		}
+		r := newTestReconciler(t, inst, secret)
+
+		g.Expect(r.publishOutputs(context.Background(), inst)).To(Succeed())
+		g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+	})
+
+	t.Run("logs are not available", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		inst.Status.Phase = porterv1.PhaseSucceeded
+		inst.Status.Installed = true
+		inst.Status.LastJob.Name = "hello-install"
+		r := newTestReconciler(t, inst)
+		r.PodLogs = staticPodLogs(testOutputsLogs)
+
+		g.Expect(r.publishOutputs(context.Background(), inst)).To(Succeed(), "the pod was removed")
+		err := r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: makeOutputsSecretName(inst.Name)}, &corev1.Secret{})
+		g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+}
+
+func TestPublishFileOutputs(t *testing.T) {
+	bundleJSON := `{
+  "name": "cluster",
+  "version": "0.1.0",
+  "definitions": {
+    "file": {"type": "string", "contentEncoding": "base64"},
+    "secret-file": {"type": "string", "contentEncoding": "base64", "writeOnly": true},
+    "string": {"type": "string"}
+  },
+  "outputs": {
+    "ca-cert": {"definition": "file"},
+    "kubeconfig": {"definition": "secret-file"},
+    "host": {"definition": "string"}
+  }
+}`
+
+	testcases := []struct {
+		name     string
+		phase    porterv1.InstallationPhase
+		wantData map[string]string
+	}{
+		{name: "succeeded", phase: porterv1.PhaseSucceeded, wantData: map[string]string{"ca-cert": "-----BEGIN CERTIFICATE-----\n"}},
+		{name: "failed", phase: porterv1.PhaseFailed},
+	}
+	for _, tc := range testcases {
+		for _, fromRegistry := range []bool{false, true} {
+			name := tc.name + "/from configmap"
+			if fromRegistry {
+				name = tc.name + "/from registry"
+			}
+			t.Run(name, func(t *testing.T) {
+				g := NewWithT(t)
+				inst := newTestInstallation()
+				inst.Status.Phase = tc.phase
+				r := newTestReconciler(t, inst,
+					&corev1.ConfigMap{
+						ObjectMeta: metav1.ObjectMeta{Name: "cluster-bundle", Namespace: inst.Namespace},
+						Data:       map[string]string{bundleFileName: bundleJSON},
+					},
+					&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{Name: makeOutputsSecretName(inst.Name), Namespace: inst.Namespace},
+						Data: map[string][]byte{
+							"ca-cert":    []byte("-----BEGIN CERTIFICATE-----\n"),
+							"kubeconfig": []byte("apiVersion: v1\n"),
+							"host":       []byte("example.com"),
+						},
+					})
+				if fromRegistry {
+					r.getBundle = func(ctx context.Context, reference string, auth registryAuth) (*bundleDefinition, error) {
+						g.Expect(reference).To(Equal(inst.Spec.Reference))
+						bun := &bundleDefinition{}
+						return bun, json.Unmarshal([]byte(bundleJSON), bun)
+					}
+				} else {
+					inst.Spec.BundleConfigMap = "cluster-bundle"
+				}
+
+				g.Expect(r.publishFileOutputs(context.Background(), inst)).To(Succeed())
+
+				cm := &corev1.ConfigMap{}
+				err := r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: makeOutputsConfigMapName(inst.Name)}, cm)
+				if tc.wantData == nil {
+					g.Expect(apierrors.IsNotFound(err)).To(BeTrue(), "outputs are only published after the Installation succeeds")
+					return
+				}
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(cm.Data).To(Equal(tc.wantData), "only non-sensitive file outputs should be published")
+				g.Expect(cm.OwnerReferences).To(Equal(getOwnerReferences(inst)))
+
+				// Publishing again is a no-op
+				g.Expect(r.publishFileOutputs(context.Background(), inst)).To(Succeed())
+			})
+		}
+	}
+}
+
+func TestPublishFileOutputs_TooLarge(t *testing.T) {
+	g := NewWithT(t)
+	bundleJSON := `{
+  "name": "cluster",
+  "version": "0.1.0",
+  "definitions": {
+    "file": {"type": "string", "contentEncoding": "base64"}
+  },
+  "outputs": {
+    "ca-cert": {"definition": "file"},
+    "manifests": {"definition": "file"}
+  }
+}`
+	inst := newTestInstallation()
+	inst.Spec.BundleConfigMap = "cluster-bundle"
+	inst.Status.Phase = porterv1.PhaseSucceeded
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: makeOutputsSecretName(inst.Name), Namespace: inst.Namespace},
+		Data: map[string][]byte{
+			"ca-cert":   []byte("-----BEGIN CERTIFICATE-----\n"),
+			"manifests": make([]byte, maxOutputsConfigMapSize),
+		},
+	}
+	r := newTestReconciler(t, inst, secret, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-bundle", Namespace: inst.Namespace},
+		Data:       map[string]string{bundleFileName: bundleJSON},
+	})
+
+	g.Expect(r.publishFileOutputs(context.Background(), inst)).To(Succeed(), "large outputs should not fail the reconcile")
+
+	cm := &corev1.ConfigMap{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: makeOutputsConfigMapName(inst.Name)}, cm)).To(Succeed())
+	g.Expect(cm.Data).To(HaveKey("ca-cert"), "the outputs that fit should still be published")
+	g.Expect(cm.Data).ToNot(HaveKey("manifests"))
+	g.Expect(cm.BinaryData).ToNot(HaveKey("manifests"))
+	cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionOutputsTooLarge)
+	g.Expect(cond).ToNot(BeNil())
+	g.Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+	g.Expect(cond.Message).To(ContainSubstring("manifests"))
+	g.Expect(r.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring(ReasonOutputsTooLarge)))
+
+	// The condition is cleared once the outputs fit
+	g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+	secret.Data["manifests"] = []byte("kind: ConfigMap\n")
+	g.Expect(r.Update(context.Background(), secret)).To(Succeed())
+	g.Expect(r.publishFileOutputs(context.Background(), inst)).To(Succeed())
+
+	cond = meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionOutputsTooLarge)
+	g.Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+	g.Expect(cond.Reason).To(Equal(ReasonOutputsPublished))
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// getParameterSetVersions returns the resource versions of the Installation's
+// ParameterSetRefs with Watch set. Objects that do not exist are skipped, the
+// run that uses them fails until they are created.
+func (r *InstallationReconciler) getParameterSetVersions(ctx context.Context, inst *porterv1.Installation) ([]porterv1.ParameterSetVersion, error) {
+	var versions []porterv1.ParameterSetVersion
+	for _, ref := range inst.Spec.ParameterSetRefs {
+		if !ref.Watch {
+			continue
+		}
+
+		var obj client.Object
+		switch ref.Kind {
+		case "Secret":
+			obj = &corev1.Secret{}
+		case "ConfigMap":
+			obj = &corev1.ConfigMap{}
+		default:
+			continue
+		}
+		err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: inst.Namespace}, obj)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not retrieve the watched parameter set %s %s/%s", strings.ToLower(ref.Kind), inst.Namespace, ref.Name)
+		}
+		versions = append(versions, porterv1.ParameterSetVersion{
+			Kind:            ref.Kind,
+			Name:            ref.Name,
+			ResourceVersion: obj.GetResourceVersion(),
+		})
+	}
+	return versions, nil
+}
+
+// getChangedParameterSets returns the names of the watched objects whose
+// resource version is different from the one used by the last run. Objects
+// that the last run did not record are not reported, so that starting to
+// watch an object does not run the Installation.
+func getChangedParameterSets(observed []porterv1.ParameterSetVersion, current []porterv1.ParameterSetVersion) []string {
+	var changed []string
+	for _, c := range current {
+		for _, o := range observed {
+			if o.Kind == c.Kind && o.Name == c.Name && o.ResourceVersion != c.ResourceVersion {
+				changed = append(changed, strings.ToLower(c.Kind)+"/"+c.Name)
+			}
+		}
+	}
+	return changed
+}
+
+// reconcileParameterSetChanges upgrades an installed Installation when a
+// watched ParameterSetRef has changed since its last run, by changing its
+// porter.sh/rerun annotation. Only Installations that upgrade the bundle are
+// rerun, and scheduled Installations pick up the change at their next run.
+func (r *InstallationReconciler) reconcileParameterSetChanges(ctx context.Context, inst *porterv1.Installation) error {
+	if !inst.IsDone() || !inst.Status.Installed || inst.Spec.ValidateOnly || inst.Spec.Apply || getAction(inst) != "upgrade" {
+		return nil
+	}
+	if inst.Spec.Schedule != "" && inst.Spec.ReconcileAction == "" {
+		return nil
+	}
+
+	versions, err := r.getParameterSetVersions(ctx, inst)
+	if err != nil {
+		return err
+	}
+	changed := getChangedParameterSets(inst.Status.ParameterSetVersions, versions)
+	if len(changed) == 0 {
+		return nil
+	}
+
+	rerun := strconv.FormatInt(time.Now().Unix(), 10)
+	if rerun == inst.GetRerun() {
+		rerun += "-1"
+	}
+	if inst.Annotations == nil {
+		inst.Annotations = map[string]string{}
+	}
+	inst.Annotations[porterv1.AnnotationRerun] = rerun
+	err = r.Update(ctx, inst)
+	if err != nil {
+		return errors.Wrapf(err, "could not update the annotations of Installation %s/%s", inst.Namespace, inst.Name)
+	}
+
+	r.getLogger(ctx).Info("upgrading Installation, its parameters changed", "parameterSets", changed, "rerun", rerun)
+	r.Recorder.Eventf(inst, corev1.EventTypeNormal, ReasonParametersChanged, "Upgrading the Installation because %s changed", strings.Join(changed, ", "))
+	return nil
+}
+
+// mapParameterSetToInstallations returns a function that maps a Secret or
+// ConfigMap, the kind of object that it is called with, to the Installations
+// in its namespace that watch it through their ParameterSetRefs. The objects
+// are watched as metadata only, so their kind is not known from their type.
+func (r *InstallationReconciler) mapParameterSetToInstallations(kind string) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		installs := &porterv1.InstallationList{}
+		if err := r.List(context.Background(), installs, client.InNamespace(obj.GetNamespace())); err != nil {
+			r.Log.Error(err, "could not list the Installations that watch a parameter set", "kind", kind, "namespace", obj.GetNamespace(), "name", obj.GetName())
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, inst := range installs.Items {
+			for _, ref := range inst.Spec.ParameterSetRefs {
+				if ref.Watch && ref.Kind == kind && ref.Name == obj.GetName() {
+					requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&inst)})
+					break
+				}
+			}
+		}
+		return requests
+	}
+}
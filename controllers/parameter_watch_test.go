@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func newWatchedParameterSet(inst *porterv1.Installation) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "hello-settings", Namespace: inst.Namespace},
+		Data:       map[string]string{"name": "llama"},
+	}
+}
+
+func TestReconcileParameterSetChanges(t *testing.T) {
+	testcases := []struct {
+		name      string
+		action    string
+		installed bool
+		watch     bool
+		observed  string
+		wantRerun bool
+	}{
+		{name: "changed", installed: true, watch: true, observed: "1", wantRerun: true},
+		{name: "unchanged", installed: true, watch: true, observed: "current"},
+		{name: "not recorded", installed: true, watch: true},
+		{name: "not watched", installed: true, observed: "1"},
+		{name: "not installed", watch: true, observed: "1"},
+		{name: "upgrade", action: "upgrade", installed: true, watch: true, observed: "1", wantRerun: true},
+		{name: "custom action", action: "deploy", installed: true, watch: true, observed: "1"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.Action = tc.action
+			inst.Spec.ParameterSetRefs = []porterv1.ParameterSetReference{{Kind: "ConfigMap", Name: "hello-settings", Watch: tc.watch}}
+			inst.Status.ObservedGeneration = inst.Generation
+			inst.Status.Phase = porterv1.PhaseSucceeded
+			inst.Status.Installed = tc.installed
+			cm := newWatchedParameterSet(inst)
+			r := newTestReconciler(t, inst, cm)
+
+			g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(cm), cm)).To(Succeed())
+			if tc.observed != "" {
+				observed := tc.observed
+				if observed == "current" {
+					observed = cm.ResourceVersion
+				}
+				inst.Status.ParameterSetVersions = []porterv1.ParameterSetVersion{{Kind: "ConfigMap", Name: cm.Name, ResourceVersion: observed}}
+			}
+
+			g.Expect(r.reconcileParameterSetChanges(context.Background(), inst)).To(Succeed())
+
+			if !tc.wantRerun {
+				g.Expect(inst.GetRerun()).To(BeEmpty())
+				g.Expect(inst.IsDone()).To(BeTrue())
+				return
+			}
+			g.Expect(inst.GetRerun()).ToNot(BeEmpty())
+			g.Expect(inst.IsDone()).To(BeFalse(), "the Installation should run again")
+			g.Expect(r.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring(ReasonParametersChanged)))
+
+			stored := &porterv1.Installation{}
+			g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(inst), stored)).To(Succeed())
+			g.Expect(stored.GetRerun()).To(Equal(inst.GetRerun()))
+		})
+	}
+}
+
+func TestCreateJobForInstallation_ParameterSetVersions(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.ParameterSetRefs = []porterv1.ParameterSetReference{
+		{Kind: "ConfigMap", Name: "hello-settings", Watch: true},
+		{Kind: "Secret", Name: "hello-secrets"},
+	}
+	cm := newWatchedParameterSet(inst)
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "hello-secrets", Namespace: inst.Namespace}}
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst, cm, secret)
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+	g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(cm), cm)).To(Succeed())
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, &batchv1.Job{})).To(Succeed())
+	stored := &porterv1.Installation{}
+	g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(inst), stored)).To(Succeed())
+	g.Expect(stored.Status.ParameterSetVersions).To(Equal([]porterv1.ParameterSetVersion{
+		{Kind: "ConfigMap", Name: "hello-settings", ResourceVersion: cm.ResourceVersion},
+	}), "only the watched parameter sets should be recorded")
+}
+
+func TestMapParameterSetToInstallations(t *testing.T) {
+	g := NewWithT(t)
+	watching := newTestInstallation()
+	watching.Spec.ParameterSetRefs = []porterv1.ParameterSetReference{{Kind: "ConfigMap", Name: "hello-settings", Watch: true}}
+	notWatching := newTestInstallation()
+	notWatching.Name = "other"
+	notWatching.Spec.ParameterSetRefs = []porterv1.ParameterSetReference{{Kind: "ConfigMap", Name: "hello-settings"}}
+	secretWatching := newTestInstallation()
+	secretWatching.Name = "secret"
+	secretWatching.Spec.ParameterSetRefs = []porterv1.ParameterSetReference{{Kind: "Secret", Name: "hello-settings", Watch: true}}
+	cm := newWatchedParameterSet(watching)
+	r := newTestReconciler(t, watching, notWatching, secretWatching)
+
+	// The objects are watched as metadata only
+	metadata := &metav1.PartialObjectMetadata{ObjectMeta: cm.ObjectMeta}
+	g.Expect(r.mapParameterSetToInstallations("ConfigMap")(metadata)).To(ConsistOf(
+		reconcile.Request{NamespacedName: client.ObjectKeyFromObject(watching)},
+	))
+	g.Expect(r.mapParameterSetToInstallations("Secret")(metadata)).To(ConsistOf(
+		reconcile.Request{NamespacedName: client.ObjectKeyFromObject(secretWatching)},
+	))
+}
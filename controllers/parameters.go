@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+const (
+	// parameterSetPath is where the generated parameter set is mounted in the agent.
+	parameterSetPath = "/porter-parameter-set"
+
+	// parameterSourcesPath is where the referenced Secrets and ConfigMaps are mounted in the agent.
+	parameterSourcesPath = "/porter-parameters"
+)
+
+// parameterSet is the porter parameter set file format.
+type parameterSet struct {
+	SchemaVersion string               `json:"schemaVersion"`
+	Name          string               `json:"name"`
+	Created       time.Time            `json:"created"`
+	Modified      time.Time            `json:"modified"`
+	Parameters    []parameterSetSource `json:"parameters"`
+}
+
+type parameterSetSource struct {
+	Name   string            `json:"name"`
+	Source map[string]string `json:"source"`
+}
+
+// ephemeralParameterSet describes how to make the generated parameter set
+// available to the porter agent.
+type ephemeralParameterSet struct {
+	Args         []string
+	Volumes      []corev1.Volume
+	VolumeMounts []corev1.VolumeMount
+}
+
+// createEphemeralParameterSet generates a porter parameter set from the
+// Installation's ParameterSetRefs. The parameter set is never saved to porter's
+// storage, instead each parameter is sourced from a file mounted from the
+// referenced Secret or ConfigMap, so there is nothing to clean up in porter
+// when the run completes or fails. The generated ConfigMap is labeled with the
+// job and owned by the Installation.
+func (r *InstallationReconciler) createEphemeralParameterSet(ctx context.Context, jobName string, inst *porterv1.Installation, labels map[string]string) (ephemeralParameterSet, error) {
+	var result ephemeralParameterSet
+	if len(inst.Spec.ParameterSetRefs) == 0 && len(inst.Spec.ParametersFromInstallation) == 0 {
+		return result, nil
+	}
+
+	now := time.Now().UTC()
+	ps := parameterSet{
+		SchemaVersion: "1.0.0",
+		Name:          jobName,
+		Created:       now,
+		Modified:      now,
+	}
+
+	for i, ref := range inst.Spec.ParameterSetRefs {
+		keys, source, err := r.getParameterSetRefSource(ctx, inst.Namespace, ref)
+		if err != nil {
+			return result, err
+		}
+
+		volumeName := fmt.Sprintf("porter-parameters-%d", i)
+		mountPath := path.Join(parameterSourcesPath, volumeName)
+		result.Volumes = append(result.Volumes, corev1.Volume{Name: volumeName, VolumeSource: source})
+		result.VolumeMounts = append(result.VolumeMounts, corev1.VolumeMount{
+			Name:      volumeName,
+			MountPath: mountPath,
+			ReadOnly:  true,
+		})
+
+		for _, key := range keys {
+			ps.Parameters = append(ps.Parameters, parameterSetSource{
+				Name:   key,
+				Source: map[string]string{"path": path.Join(mountPath, key)},
+			})
+		}
+	}
+
+	for i, p := range inst.Spec.ParametersFromInstallation {
+		source, err := r.getInstallationOutputSource(ctx, inst.Namespace, p)
+		if err != nil {
+			return result, err
+		}
+
+		volumeName := fmt.Sprintf("porter-output-%d", i)
+		mountPath := path.Join(parameterSourcesPath, volumeName)
+		result.Volumes = append(result.Volumes, corev1.Volume{Name: volumeName, VolumeSource: source})
+		result.VolumeMounts = append(result.VolumeMounts, corev1.VolumeMount{
+			Name:      volumeName,
+			MountPath: mountPath,
+			ReadOnly:  true,
+		})
+
+		ps.Parameters = append(ps.Parameters, parameterSetSource{
+			Name:   p.Name,
+			Source: map[string]string{"path": path.Join(mountPath, p.Output)},
+		})
+	}
+
+	psB, err := json.Marshal(ps)
+	if err != nil {
+		return result, errors.Wrapf(err, "error generating the parameter set for Installation %s/%s", inst.Namespace, inst.Name)
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            jobName + "-parameters",
+			Namespace:       inst.Namespace,
+			Labels:          labels,
+			OwnerReferences: getOwnerReferences(inst),
+		},
+		Data: map[string]string{
+			"parameters.json": string(psB),
+		},
+	}
+	err = r.Create(ctx, cm, &client.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// A previous reconcile was interrupted before it created the job
+		r.getLogger(ctx).Info("using existing parameter set", "configMap", cm.Name)
+	} else if err != nil {
+		return result, errors.Wrapf(err, "error creating the parameter set for Installation %s/%s@%s", inst.Namespace, inst.Name, inst.ResourceVersion)
+	}
+
+	result.Volumes = append(result.Volumes, corev1.Volume{
+		Name: "porter-parameter-set",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: cm.Name},
+			},
+		},
+	})
+	result.VolumeMounts = append(result.VolumeMounts, corev1.VolumeMount{
+		Name:      "porter-parameter-set",
+		MountPath: parameterSetPath,
+		ReadOnly:  true,
+	})
+	result.Args = append(result.Args, "--parameter-set="+path.Join(parameterSetPath, "parameters.json"))
+
+	return result, nil
+}
+
+// getParameterValueArgs renders the Installation's typed parameter values as
+// porter --param flags, in a stable order.
+func getParameterValueArgs(inst *porterv1.Installation) ([]string, error) {
+	names := make([]string, 0, len(inst.Spec.ParameterValues))
+	for name := range inst.Spec.ParameterValues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := make([]string, 0, len(names))
+	for _, name := range names {
+		value, err := formatParameterValue(inst.Spec.ParameterValues[name])
+		if err != nil {
+			return nil, newTerminalError(ReasonInvalidSetting, errors.Wrapf(err, "invalid value for parameter %s of Installation %s/%s", name, inst.Namespace, inst.Name))
+		}
+		args = append(args, "--param="+name+"="+value)
+	}
+	return args, nil
+}
+
+// formatParameterValue renders a typed parameter value for porter's
+// NAME=VALUE syntax. Strings are passed without quotes, while numbers,
+// booleans and objects are passed as JSON, which porter converts to the type
+// of the bundle's parameter.
+func formatParameterValue(v apiextensionsv1.JSON) (string, error) {
+	var s string
+	if err := json.Unmarshal(v.Raw, &s); err == nil {
+		return s, nil
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, v.Raw); err != nil {
+		return "", errors.Wrap(err, "the value is not valid JSON")
+	}
+	return compact.String(), nil
+}
+
+// getParameterSetRefSource looks up the referenced Secret or ConfigMap and
+// returns its keys, in a stable order, and a volume source that mounts it.
+func (r *InstallationReconciler) getParameterSetRefSource(ctx context.Context, namespace string, ref porterv1.ParameterSetReference) ([]string, corev1.VolumeSource, error) {
+	key := types.NamespacedName{Name: ref.Name, Namespace: namespace}
+	var keys []string
+	var source corev1.VolumeSource
+
+	switch ref.Kind {
+	case "Secret":
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, key, secret); err != nil {
+			return nil, source, errors.Wrapf(err, "could not retrieve the parameter set secret %s/%s", namespace, ref.Name)
+		}
+		for k := range secret.Data {
+			keys = append(keys, k)
+		}
+		source.Secret = &corev1.SecretVolumeSource{SecretName: ref.Name}
+	case "ConfigMap":
+		cm := &corev1.ConfigMap{}
+		if err := r.Get(ctx, key, cm); err != nil {
+			return nil, source, errors.Wrapf(err, "could not retrieve the parameter set configmap %s/%s", namespace, ref.Name)
+		}
+		for k := range cm.Data {
+			keys = append(keys, k)
+		}
+		source.ConfigMap = &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: ref.Name}}
+	default:
+		return nil, source, errors.Errorf("invalid parameter set reference kind %q for %s, must be either Secret or ConfigMap", ref.Kind, ref.Name)
+	}
+
+	sort.Strings(keys)
+	return keys, source, nil
+}
+
+// getInstallationOutputSource returns a volume source that mounts the output
+// of another Installation. An error is returned until that Installation has
+// succeeded and published the output.
+func (r *InstallationReconciler) getInstallationOutputSource(ctx context.Context, namespace string, p porterv1.ParameterFromInstallation) (corev1.VolumeSource, error) {
+	var source corev1.VolumeSource
+
+	from := &porterv1.Installation{}
+	err := r.Get(ctx, types.NamespacedName{Name: p.Installation, Namespace: namespace}, from)
+	if err != nil {
+		return source, errors.Wrapf(err, "could not retrieve Installation %s/%s for the parameter %s", namespace, p.Installation, p.Name)
+	}
+	if from.Status.Phase != porterv1.PhaseSucceeded {
+		return source, errors.Errorf("waiting for Installation %s/%s to succeed before using its output %s for the parameter %s", namespace, p.Installation, p.Output, p.Name)
+	}
+
+	secretName := makeOutputsSecretName(p.Installation)
+	secret := &corev1.Secret{}
+	err = r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: namespace}, secret)
+	if err != nil {
+		return source, errors.Wrapf(err, "could not retrieve the outputs of Installation %s/%s for the parameter %s", namespace, p.Installation, p.Name)
+	}
+	if _, ok := secret.Data[p.Output]; !ok {
+		return source, errors.Errorf("Installation %s/%s does not have the output %s used by the parameter %s", namespace, p.Installation, p.Output, p.Name)
+	}
+
+	source.Secret = &corev1.SecretVolumeSource{
+		SecretName: secretName,
+		Items:      []corev1.KeyToPath{{Key: p.Output, Path: p.Output}},
+	}
+	return source, nil
+}
@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestGetInstallationOutputSource(t *testing.T) {
+	param := porterv1.ParameterFromInstallation{Name: "connection-string", Installation: "mysql", Output: "connstr"}
+	outputs := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "mysql-outputs", Namespace: "test"},
+		Data:       map[string][]byte{"connstr": []byte("mysql://example")},
+	}
+
+	testcases := []struct {
+		name    string
+		phase   porterv1.InstallationPhase
+		outputs *corev1.Secret
+		wantErr string
+	}{
+		{name: "running", phase: porterv1.PhaseRunning, outputs: outputs, wantErr: "waiting for Installation test/mysql to succeed"},
+		{name: "no outputs", phase: porterv1.PhaseSucceeded, wantErr: "could not retrieve the outputs of Installation test/mysql"},
+		{name: "missing output", phase: porterv1.PhaseSucceeded, outputs: &corev1.Secret{ObjectMeta: outputs.ObjectMeta}, wantErr: "does not have the output connstr"},
+		{name: "succeeded", phase: porterv1.PhaseSucceeded, outputs: outputs},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			from := &porterv1.Installation{ObjectMeta: metav1.ObjectMeta{Name: "mysql", Namespace: "test"}}
+			from.Status.Phase = tc.phase
+			r := newTestReconciler(t, from)
+			if tc.outputs != nil {
+				g.Expect(r.Create(context.Background(), tc.outputs.DeepCopy())).To(Succeed())
+			}
+
+			source, err := r.getInstallationOutputSource(context.Background(), "test", param)
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(source.Secret.SecretName).To(Equal("mysql-outputs"))
+			g.Expect(source.Secret.Items).To(Equal([]corev1.KeyToPath{{Key: "connstr", Path: "connstr"}}))
+		})
+	}
+}
+
+func TestFormatParameterValue(t *testing.T) {
+	testcases := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "string", value: `"llama"`, want: "llama"},
+		{name: "string with spaces", value: `"hello world"`, want: "hello world"},
+		{name: "numeric string", value: `"1"`, want: "1"},
+		{name: "integer", value: `3`, want: "3"},
+		{name: "number", value: `0.5`, want: "0.5"},
+		{name: "boolean", value: `true`, want: "true"},
+		{name: "object", value: `{"region": "eastus", "zones": [1, 2]}`, want: `{"region":"eastus","zones":[1,2]}`},
+		{name: "array", value: `["a", "b"]`, want: `["a","b"]`},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			got, err := formatParameterValue(apiextensionsv1.JSON{Raw: []byte(tc.value)})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tc.want))
+		})
+	}
+}
+
+func TestGetParameterValueArgs(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.ParameterValues = map[string]apiextensionsv1.JSON{
+		"replicas": {Raw: []byte(`3`)},
+		"name":     {Raw: []byte(`"llama"`)},
+		"debug":    {Raw: []byte(`false`)},
+	}
+
+	args, err := getParameterValueArgs(inst)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(args).To(Equal([]string{"--param=debug=false", "--param=name=llama", "--param=replicas=3"}))
+}
+
+func TestCreateEphemeralParameterSet(t *testing.T) {
+	settings := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "hello-settings", Namespace: "test"},
+		Data:       map[string]string{"name": "llama", "color": "blue"},
+	}
+	secrets := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "hello-secrets", Namespace: "test"},
+		Data:       map[string][]byte{"password": []byte("topsecret")},
+	}
+	mysql := &porterv1.Installation{ObjectMeta: metav1.ObjectMeta{Name: "mysql", Namespace: "test"}}
+	mysql.Status.Phase = porterv1.PhaseSucceeded
+	mysqlOutputs := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "mysql-outputs", Namespace: "test"},
+		Data:       map[string][]byte{"connstr": []byte("mysql://example")},
+	}
+	parameterSetVolume := corev1.Volume{
+		Name: "porter-parameter-set",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "hello-1-parameters"}},
+		},
+	}
+	parameterSetMount := corev1.VolumeMount{Name: "porter-parameter-set", MountPath: "/porter-parameter-set", ReadOnly: true}
+
+	testcases := []struct {
+		name           string
+		refs           []porterv1.ParameterSetReference
+		fromInstall    []porterv1.ParameterFromInstallation
+		wantParameters []parameterSetSource
+		wantVolumes    []corev1.Volume
+		wantMounts     []corev1.VolumeMount
+		wantErr        string
+	}{
+		{name: "no parameter sets"},
+		{
+			name: "configmap",
+			refs: []porterv1.ParameterSetReference{{Kind: "ConfigMap", Name: "hello-settings"}},
+			wantParameters: []parameterSetSource{
+				{Name: "color", Source: map[string]string{"path": "/porter-parameters/porter-parameters-0/color"}},
+				{Name: "name", Source: map[string]string{"path": "/porter-parameters/porter-parameters-0/name"}},
+			},
+			wantVolumes: []corev1.Volume{
+				{Name: "porter-parameters-0", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "hello-settings"}}}},
+				parameterSetVolume,
+			},
+			wantMounts: []corev1.VolumeMount{
+				{Name: "porter-parameters-0", MountPath: "/porter-parameters/porter-parameters-0", ReadOnly: true},
+				parameterSetMount,
+			},
+		},
+		{
+			name: "secret and configmap",
+			refs: []porterv1.ParameterSetReference{{Kind: "Secret", Name: "hello-secrets"}, {Kind: "ConfigMap", Name: "hello-settings"}},
+			wantParameters: []parameterSetSource{
+				{Name: "password", Source: map[string]string{"path": "/porter-parameters/porter-parameters-0/password"}},
+				{Name: "color", Source: map[string]string{"path": "/porter-parameters/porter-parameters-1/color"}},
+				{Name: "name", Source: map[string]string{"path": "/porter-parameters/porter-parameters-1/name"}},
+			},
+			wantVolumes: []corev1.Volume{
+				{Name: "porter-parameters-0", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "hello-secrets"}}},
+				{Name: "porter-parameters-1", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "hello-settings"}}}},
+				parameterSetVolume,
+			},
+			wantMounts: []corev1.VolumeMount{
+				{Name: "porter-parameters-0", MountPath: "/porter-parameters/porter-parameters-0", ReadOnly: true},
+				{Name: "porter-parameters-1", MountPath: "/porter-parameters/porter-parameters-1", ReadOnly: true},
+				parameterSetMount,
+			},
+		},
+		{
+			name:        "installation output",
+			fromInstall: []porterv1.ParameterFromInstallation{{Name: "connection-string", Installation: "mysql", Output: "connstr"}},
+			wantParameters: []parameterSetSource{
+				{Name: "connection-string", Source: map[string]string{"path": "/porter-parameters/porter-output-0/connstr"}},
+			},
+			wantVolumes: []corev1.Volume{
+				{Name: "porter-output-0", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+					SecretName: "mysql-outputs",
+					Items:      []corev1.KeyToPath{{Key: "connstr", Path: "connstr"}},
+				}}},
+				parameterSetVolume,
+			},
+			wantMounts: []corev1.VolumeMount{
+				{Name: "porter-output-0", MountPath: "/porter-parameters/porter-output-0", ReadOnly: true},
+				parameterSetMount,
+			},
+		},
+		{name: "missing configmap", refs: []porterv1.ParameterSetReference{{Kind: "ConfigMap", Name: "missing"}}, wantErr: "could not retrieve the parameter set configmap test/missing"},
+		{name: "missing secret", refs: []porterv1.ParameterSetReference{{Kind: "Secret", Name: "missing"}}, wantErr: "could not retrieve the parameter set secret test/missing"},
+		{name: "invalid kind", refs: []porterv1.ParameterSetReference{{Kind: "Pod", Name: "hello-settings"}}, wantErr: `invalid parameter set reference kind "Pod"`},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := &porterv1.Installation{ObjectMeta: metav1.ObjectMeta{Name: "hello", Namespace: "test"}}
+			inst.Spec.ParameterSetRefs = tc.refs
+			inst.Spec.ParametersFromInstallation = tc.fromInstall
+			r := newTestReconciler(t, inst, settings.DeepCopy(), secrets.DeepCopy(), mysql.DeepCopy(), mysqlOutputs.DeepCopy())
+			labels := map[string]string{"job": "hello-1"}
+
+			result, err := r.createEphemeralParameterSet(context.Background(), "hello-1", inst, labels)
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result.Volumes).To(Equal(tc.wantVolumes))
+			g.Expect(result.VolumeMounts).To(Equal(tc.wantMounts))
+
+			cm := &corev1.ConfigMap{}
+			err = r.Get(context.Background(), client.ObjectKey{Namespace: "test", Name: "hello-1-parameters"}, cm)
+			if tc.wantParameters == nil {
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue(), "no parameter set should be generated")
+				g.Expect(result.Args).To(BeEmpty())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result.Args).To(Equal([]string{"--parameter-set=/porter-parameter-set/parameters.json"}))
+			g.Expect(cm.Labels).To(Equal(labels))
+			g.Expect(cm.OwnerReferences).To(Equal(getOwnerReferences(inst)))
+
+			var ps parameterSet
+			g.Expect(json.Unmarshal([]byte(cm.Data["parameters.json"]), &ps)).To(Succeed())
+			g.Expect(ps.SchemaVersion).To(Equal("1.0.0"))
+			g.Expect(ps.Name).To(Equal("hello-1"))
+			g.Expect(ps.Parameters).To(Equal(tc.wantParameters))
+		})
+	}
+}
+
+func TestCreateEphemeralParameterSet_Existing(t *testing.T) {
+	g := NewWithT(t)
+	inst := &porterv1.Installation{ObjectMeta: metav1.ObjectMeta{Name: "hello", Namespace: "test"}}
+	inst.Spec.ParameterSetRefs = []porterv1.ParameterSetReference{{Kind: "ConfigMap", Name: "hello-settings"}}
+	r := newTestReconciler(t, inst,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "hello-settings", Namespace: "test"}, Data: map[string]string{"name": "llama"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "hello-1-parameters", Namespace: "test"}},
+	)
+
+	// A previous reconcile created the parameter set but not the job
+	result, err := r.createEphemeralParameterSet(context.Background(), "hello-1", inst, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Args).To(Equal([]string{"--parameter-set=/porter-parameter-set/parameters.json"}))
+}
@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/yaml"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// defaultServiceAccount is the service account used by pods that do not set one.
+const defaultServiceAccount = "default"
+
+// driverPermissions are requests that porter's kubernetes driver makes in the
+// Installation's namespace to run the bundle, which the agent-role ClusterRole
+// permits.
+var driverPermissions = []authorizationv1.ResourceAttributes{
+	{Group: "batch", Resource: "jobs", Verb: "create"},
+	{Resource: "secrets", Verb: "create"},
+	{Resource: "pods", Verb: "list"},
+}
+
+// checkServiceAccount checks that the porter agent's service account exists,
+// and that it is permitted to run the bundle with the kubernetes driver,
+// before a job is created. Otherwise the agent fails partway through the run
+// with a permission error. When the check fails, the Installation is marked
+// as failed and false is returned.
+func (r *InstallationReconciler) checkServiceAccount(ctx context.Context, inst *porterv1.Installation, serviceAccount string) (bool, error) {
+	if serviceAccount == "" {
+		serviceAccount = defaultServiceAccount
+	}
+
+	sa := &corev1.ServiceAccount{}
+	err := r.Get(ctx, types.NamespacedName{Name: serviceAccount, Namespace: inst.Namespace}, sa)
+	if apierrors.IsNotFound(err) {
+		msg := fmt.Sprintf("The porter agent service account %s/%s does not exist", inst.Namespace, serviceAccount)
+		return false, r.rejectServiceAccount(ctx, inst, ReasonMissingServiceAccount, msg)
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "could not retrieve the porter agent service account %s/%s", inst.Namespace, serviceAccount)
+	}
+
+	for _, attrs := range driverPermissions {
+		attrs.Namespace = inst.Namespace
+		allowed, err := r.canAccess(ctx, inst, serviceAccount, attrs)
+		if err != nil {
+			return false, err
+		}
+		if !allowed {
+			resource := attrs.Resource
+			if attrs.Group != "" {
+				resource += "." + attrs.Group
+			}
+			msg := fmt.Sprintf("The porter agent service account %s/%s is not permitted to %s %s, bind it to the porter agent ClusterRole",
+				inst.Namespace, serviceAccount, attrs.Verb, resource)
+			return false, r.rejectServiceAccount(ctx, inst, ReasonMissingAgentPermissions, msg)
+		}
+	}
+	return true, nil
+}
+
+func (r *InstallationReconciler) rejectServiceAccount(ctx context.Context, inst *porterv1.Installation, reason string, msg string) error {
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, reason, msg)
+
+	return r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, reason, msg)
+}
+
+// getAllowedAgentPermissions returns the rules that Installations may grant
+// to the porter agent with agentPermissions, a YAML list of RBAC policy rules
+// in the allowedAgentPermissions setting. Like the namespace resource budget,
+// it is only read from the porter ConfigMap in the operator's namespace, or
+// the operator's defaults, so that it can not be changed from the
+// Installation's namespace. No permissions may be granted when it is not set.
+func (r *InstallationReconciler) getAllowedAgentPermissions(ctx context.Context) ([]rbacv1.PolicyRule, error) {
+	v, source := r.getOperatorSetting(ctx, "allowedAgentPermissions")
+	if v == "" {
+		return nil, nil
+	}
+	var allowed []rbacv1.PolicyRule
+	if err := yaml.Unmarshal([]byte(v), &allowed); err != nil {
+		return nil, newTerminalError(ReasonInvalidSetting, errors.Wrapf(err, "invalid allowedAgentPermissions in %s, must be a YAML list of policy rules", source))
+	}
+	return allowed, nil
+}
+
+// getDeniedAgentPermissions returns a description of the requested rules that
+// are not covered by the allowed rules, e.g. create apps/deployments. Each
+// verb, group and resource of a rule must be allowed by one of the allowed
+// rules, and a rule limited to resource names is only covered by an allowed
+// rule for all names or for the same names.
+func getDeniedAgentPermissions(requested []rbacv1.PolicyRule, allowed []rbacv1.PolicyRule) []string {
+	var denied []string
+	for _, rule := range requested {
+		if len(rule.NonResourceURLs) > 0 {
+			denied = append(denied, "non-resource URLs "+strings.Join(rule.NonResourceURLs, ","))
+		}
+		for _, group := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				for _, verb := range rule.Verbs {
+					if !isRuleAllowed(group, resource, verb, rule.ResourceNames, allowed) {
+						denied = append(denied, verb+" "+path.Join(group, resource))
+					}
+				}
+			}
+		}
+	}
+	return denied
+}
+
+// isRuleAllowed determines if an allowed rule covers the request.
+func isRuleAllowed(group string, resource string, verb string, names []string, allowed []rbacv1.PolicyRule) bool {
+	for _, a := range allowed {
+		if !matchesRule(a.APIGroups, group) || !matchesRule(a.Resources, resource) || !matchesRule(a.Verbs, verb) {
+			continue
+		}
+		if len(a.ResourceNames) == 0 {
+			return true
+		}
+		if len(names) == 0 {
+			continue
+		}
+		covered := true
+		for _, name := range names {
+			covered = covered && matchesRule(a.ResourceNames, name)
+		}
+		if covered {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesRule determines if the values of an allowed rule include the value,
+// either directly or with the * wildcard.
+func matchesRule(values []string, value string) bool {
+	for _, v := range values {
+		if v == value || v == rbacv1.ResourceAll {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAgentPermissions checks that the Installation's agentPermissions are
+// granted to a service account that the Installation chose, never the
+// namespace's default service account that every pod uses, and that they are
+// allowed by the operator's allowedAgentPermissions. Otherwise the
+// permissions that were granted before are removed, the Installation is
+// marked as failed and false is returned.
+func (r *InstallationReconciler) checkAgentPermissions(ctx context.Context, inst *porterv1.Installation, serviceAccount string) (bool, error) {
+	if len(inst.Spec.AgentPermissions) == 0 {
+		return true, nil
+	}
+
+	var msg string
+	if serviceAccount == "" {
+		msg = "The agentPermissions can not be granted without a serviceAccount, set the porter agent's service account on the Installation or in the porter configmap"
+	} else {
+		allowed, err := r.getAllowedAgentPermissions(ctx)
+		if err != nil {
+			return false, err
+		}
+		if denied := getDeniedAgentPermissions(inst.Spec.AgentPermissions, allowed); len(denied) > 0 {
+			msg = fmt.Sprintf("The agentPermissions are not allowed by the operator's allowedAgentPermissions: %s", strings.Join(denied, ", "))
+		}
+	}
+	if msg == "" {
+		return true, nil
+	}
+
+	if err := r.removeAgentPermissions(ctx, inst); err != nil {
+		return false, err
+	}
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonAgentPermissionsNotAllowed, msg)
+	return false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonAgentPermissionsNotAllowed, msg)
+}
+
+// removeAgentPermissions removes the Role and RoleBinding that granted the
+// Installation's agentPermissions, if any.
+func (r *InstallationReconciler) removeAgentPermissions(ctx context.Context, inst *porterv1.Installation) error {
+	name := makeAgentRoleName(inst.Name)
+	binding := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: inst.Namespace}}
+	role := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: inst.Namespace}}
+	for _, obj := range []client.Object{binding, role} {
+		err := r.Delete(ctx, obj)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "could not remove the porter agent permissions %s/%s", inst.Namespace, name)
+		}
+	}
+	return nil
+}
+
+// reconcileAgentPermissions grants the Installation's agentPermissions, which
+// checkAgentPermissions allowed, to the porter agent's service account, and
+// removes the Role and RoleBinding when the Installation no longer declares
+// any permissions. The operator can only grant permissions that it holds
+// itself, when the API server refuses the Role the Installation is marked as
+// failed and false is returned.
+func (r *InstallationReconciler) reconcileAgentPermissions(ctx context.Context, inst *porterv1.Installation, serviceAccount string) (bool, error) {
+	if len(inst.Spec.AgentPermissions) == 0 {
+		return true, r.removeAgentPermissions(ctx, inst)
+	}
+
+	name := makeAgentRoleName(inst.Name)
+	role := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: inst.Namespace}}
+	binding := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: inst.Namespace}}
+	labels := map[string]string{
+		"porter":       "true",
+		"installation": inst.Name,
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, role, func() error {
+		role.Labels = labels
+		role.OwnerReferences = getOwnerReferences(inst)
+		role.Rules = inst.Spec.AgentPermissions
+		return nil
+	})
+	if apierrors.IsForbidden(err) {
+		msg := fmt.Sprintf("The operator is not permitted to grant the agentPermissions with role %s/%s: %s", inst.Namespace, name, err)
+		r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+		r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonAgentPermissionsNotAllowed, msg)
+		return false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonAgentPermissionsNotAllowed, msg)
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "could not grant the porter agent permissions with role %s/%s", inst.Namespace, name)
+	}
+
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, binding, func() error {
+		binding.Labels = labels
+		binding.OwnerReferences = getOwnerReferences(inst)
+		binding.Subjects = []rbacv1.Subject{
+			{Kind: rbacv1.ServiceAccountKind, Name: serviceAccount, Namespace: inst.Namespace},
+		}
+		// The role of a binding cannot be changed, and is always the same
+		binding.RoleRef = rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name}
+		return nil
+	})
+	return err == nil, errors.Wrapf(err, "could not grant the porter agent permissions with role binding %s/%s", inst.Namespace, name)
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestReconcileAgentPermissions(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.AgentPermissions = []rbacv1.PolicyRule{
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get", "create"}},
+	}
+	r := newTestReconciler(t, inst)
+	key := client.ObjectKey{Namespace: inst.Namespace, Name: makeAgentRoleName(inst.Name)}
+
+	ok, err := r.reconcileAgentPermissions(context.Background(), inst, "porter-agent")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ok).To(BeTrue())
+	role := &rbacv1.Role{}
+	g.Expect(r.Get(context.Background(), key, role)).To(Succeed())
+	g.Expect(role.Rules).To(Equal(inst.Spec.AgentPermissions))
+	g.Expect(role.OwnerReferences).To(HaveLen(1))
+	binding := &rbacv1.RoleBinding{}
+	g.Expect(r.Get(context.Background(), key, binding)).To(Succeed())
+	g.Expect(binding.Subjects).To(Equal([]rbacv1.Subject{{Kind: "ServiceAccount", Name: "porter-agent", Namespace: inst.Namespace}}))
+	g.Expect(binding.RoleRef.Name).To(Equal(role.Name))
+
+	// Follow changes to the permissions
+	inst.Spec.AgentPermissions[0].Verbs = []string{"get"}
+	_, err = r.reconcileAgentPermissions(context.Background(), inst, "other-agent")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(r.Get(context.Background(), key, role)).To(Succeed())
+	g.Expect(role.Rules[0].Verbs).To(Equal([]string{"get"}))
+	g.Expect(r.Get(context.Background(), key, binding)).To(Succeed())
+	g.Expect(binding.Subjects[0].Name).To(Equal("other-agent"))
+
+	// Remove the role when the permissions are cleared
+	inst.Spec.AgentPermissions = nil
+	_, err = r.reconcileAgentPermissions(context.Background(), inst, "other-agent")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(apierrors.IsNotFound(r.Get(context.Background(), key, role))).To(BeTrue())
+	g.Expect(apierrors.IsNotFound(r.Get(context.Background(), key, binding))).To(BeTrue())
+}
+
+func TestCheckAgentPermissions(t *testing.T) {
+	allowed := `
+- apiGroups: ["apps"]
+  resources: ["deployments"]
+  verbs: ["get", "list", "create"]
+- apiGroups: [""]
+  resources: ["configmaps"]
+  resourceNames: ["hello-settings"]
+  verbs: ["*"]
+`
+	testcases := []struct {
+		name           string
+		rules          []rbacv1.PolicyRule
+		serviceAccount string
+		allowed        string
+		wantDenied     string
+	}{
+		{name: "no permissions", serviceAccount: "porter-agent"},
+		{name: "allowed",
+			rules:          []rbacv1.PolicyRule{{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get", "create"}}},
+			serviceAccount: "porter-agent", allowed: allowed},
+		{name: "allowed resource names",
+			rules:          []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"hello-settings"}, Verbs: []string{"update"}}},
+			serviceAccount: "porter-agent", allowed: allowed},
+		{name: "other resource names",
+			rules:          []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"update"}}},
+			serviceAccount: "porter-agent", allowed: allowed, wantDenied: "update configmaps"},
+		{name: "verb not allowed",
+			rules:          []rbacv1.PolicyRule{{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"delete"}}},
+			serviceAccount: "porter-agent", allowed: allowed, wantDenied: "delete apps/deployments"},
+		{name: "wildcard not allowed",
+			rules:          []rbacv1.PolicyRule{{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}}},
+			serviceAccount: "porter-agent", allowed: allowed, wantDenied: "* */*"},
+		{name: "no allowlist",
+			rules:          []rbacv1.PolicyRule{{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get"}}},
+			serviceAccount: "porter-agent", wantDenied: "get apps/deployments"},
+		{name: "default service account",
+			rules:   []rbacv1.PolicyRule{{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get"}}},
+			allowed: allowed, wantDenied: "without a serviceAccount"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.AgentPermissions = tc.rules
+			r := newTestReconciler(t, inst, &rbacv1.Role{
+				ObjectMeta: metav1.ObjectMeta{Name: makeAgentRoleName(inst.Name), Namespace: inst.Namespace},
+			})
+			r.Defaults = map[string]string{"allowedAgentPermissions": tc.allowed}
+
+			ok, err := r.checkAgentPermissions(context.Background(), inst, tc.serviceAccount)
+			g.Expect(err).ToNot(HaveOccurred())
+			cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+			if tc.wantDenied == "" {
+				g.Expect(ok).To(BeTrue())
+				g.Expect(cond).To(BeNil())
+				return
+			}
+			g.Expect(ok).To(BeFalse())
+			g.Expect(cond).ToNot(BeNil())
+			g.Expect(cond.Reason).To(Equal(ReasonAgentPermissionsNotAllowed))
+			g.Expect(cond.Message).To(ContainSubstring(tc.wantDenied))
+			err = r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: makeAgentRoleName(inst.Name)}, &rbacv1.Role{})
+			g.Expect(apierrors.IsNotFound(err)).To(BeTrue(), "permissions granted before should be removed")
+		})
+	}
+}
+
+func TestGetAllowedAgentPermissions_OperatorNamespaceOnly(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	r := newTestReconciler(t, inst, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: porterConfigMapName, Namespace: inst.Namespace},
+		Data:       map[string]string{"allowedAgentPermissions": `[{"apiGroups": ["*"], "resources": ["*"], "verbs": ["*"]}]`},
+	})
+	r.OperatorNamespace = "porter-operator"
+
+	allowed, err := r.getAllowedAgentPermissions(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(allowed).To(BeEmpty(), "the Installation's namespace should not be able to allow permissions")
+}
+
+func TestCheckServiceAccount(t *testing.T) {
+	testcases := []struct {
+		name           string
+		serviceAccount string
+		permitted      bool
+		wantReason     string
+	}{
+		{name: "default service account", permitted: true},
+		{name: "missing service account", serviceAccount: "porter-agent", permitted: true, wantReason: ReasonMissingServiceAccount},
+		{name: "not permitted", permitted: false, wantReason: ReasonMissingAgentPermissions},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			r := newTestReconciler(t, inst)
+			if !tc.permitted {
+				r.Client = accessReviewClient{Client: r.Client}
+			}
+
+			ok, err := r.checkServiceAccount(context.Background(), inst, tc.serviceAccount)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(Equal(tc.wantReason == ""))
+			cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+			if tc.wantReason == "" {
+				g.Expect(cond).To(BeNil())
+				return
+			}
+			g.Expect(cond).ToNot(BeNil())
+			g.Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			g.Expect(cond.Reason).To(Equal(tc.wantReason))
+			g.Expect(r.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring(tc.wantReason)))
+		})
+	}
+}
+
+func TestCreateJobForInstallation_MissingServiceAccount(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.ServiceAccount = "porter-agent"
+	inst.Spec.AgentPermissions = []rbacv1.PolicyRule{
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get"}},
+	}
+	r := newTestReconciler(t, inst)
+	r.Defaults = map[string]string{"allowedAgentPermissions": `[{"apiGroups": ["apps"], "resources": ["deployments"], "verbs": ["*"]}]`}
+
+	g.Expect(r.createJobForInstallation(context.Background(), makeJobName(inst), inst, nil)).To(Succeed())
+
+	cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+	g.Expect(cond).ToNot(BeNil())
+	g.Expect(cond.Reason).To(Equal(ReasonMissingServiceAccount))
+	roles := &rbacv1.RoleList{}
+	g.Expect(r.List(context.Background(), roles)).To(Succeed())
+	g.Expect(roles.Items).To(BeEmpty(), "the permissions should not be granted to an account that does not exist")
+	bindings := &rbacv1.RoleBindingList{}
+	g.Expect(r.List(context.Background(), bindings)).To(Succeed())
+	g.Expect(bindings.Items).To(BeEmpty())
+}
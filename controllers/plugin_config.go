@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+const (
+	// porterConfigFileName is the key of porter's config file in the
+	// porter-config secret.
+	porterConfigFileName = "config.toml"
+
+	// pluginConfigName is the name of the plugin configurations that the
+	// rendered config file selects.
+	pluginConfigName = "operator"
+)
+
+// porterConfigFileNames are the keys of porter's config file in the
+// porter-config secret, in the order that porter looks for them.
+var porterConfigFileNames = []string{porterConfigFileName, "config.yaml", "config.yml", "config.json"}
+
+// renderPluginConfig merges the Installation's plugin configuration into
+// porter's config file, which is in the format of its name, e.g.
+//
+//	default-secrets = "operator"
+//
+//	[[secrets]]
+//	  name = "operator"
+//	  plugin = "azure.keyvault"
+//	  [secrets.config]
+//	    vault = "mykeyvault"
+//
+// The rest of the config file is kept, and plugin configurations named
+// operator in it are replaced.
+func renderPluginConfig(fileName string, config []byte, cfg *porterv1.PorterPluginConfig) ([]byte, error) {
+	f := map[string]interface{}{}
+	isTOML := path.Ext(fileName) == ".toml"
+	if len(bytes.TrimSpace(config)) > 0 {
+		var err error
+		if isTOML {
+			_, err = toml.Decode(string(config), &f)
+		} else {
+			err = yaml.Unmarshal(config, &f)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse %s", fileName)
+		}
+	}
+	if cfg.Secrets != nil {
+		setPluginConfig(f, "default-secrets", "secrets", cfg.Secrets)
+	}
+	if cfg.Storage != nil {
+		setPluginConfig(f, "default-storage", "storage", cfg.Storage)
+	}
+
+	switch {
+	case isTOML:
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(f); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case path.Ext(fileName) == ".json":
+		return json.MarshalIndent(f, "", "  ")
+	default:
+		return yaml.Marshal(f)
+	}
+}
+
+// setPluginConfig selects the plugin as porter's default, in the key of the
+// config file, e.g. default-secrets, and sets it in the list of plugin
+// configurations, e.g. secrets.
+func setPluginConfig(f map[string]interface{}, defaultKey string, listKey string, cfg *porterv1.PluginConfig) {
+	var entries []map[string]interface{}
+	add := func(v interface{}) {
+		if entry, ok := v.(map[string]interface{}); ok && entry["name"] != pluginConfigName {
+			entries = append(entries, entry)
+		}
+	}
+	switch existing := f[listKey].(type) {
+	case []map[string]interface{}:
+		for _, v := range existing {
+			add(v)
+		}
+	case []interface{}:
+		for _, v := range existing {
+			add(v)
+		}
+	}
+
+	entry := map[string]interface{}{"name": pluginConfigName, "plugin": cfg.Plugin}
+	if len(cfg.Config) > 0 {
+		config := make(map[string]interface{}, len(cfg.Config))
+		for k, v := range cfg.Config {
+			config[k] = v
+		}
+		entry["config"] = config
+	}
+	f[defaultKey] = pluginConfigName
+	f[listKey] = append(entries, entry)
+}
+
+// checkPluginConfig validates the Installation's PluginConfig, in case the
+// Installation was created without the webhook. An Installation with an
+// invalid PluginConfig is not run until it is fixed.
+func (r *InstallationReconciler) checkPluginConfig(ctx context.Context, inst *porterv1.Installation) (bool, error) {
+	errs := porterv1.ValidatePluginConfig(inst.Spec.PluginConfig, field.NewPath("spec", "pluginConfig"))
+	if len(errs) == 0 {
+		return true, nil
+	}
+
+	msg := fmt.Sprintf("Invalid pluginConfig: %s", errs.ToAggregate())
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonInvalidPluginConfig, msg)
+
+	return false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonInvalidPluginConfig, msg)
+}
+
+// createPluginConfig merges the Installation's PluginConfig into porter's
+// config file from the porter-config secret, in a copy of the secret that is
+// labeled with the job and owned by the Installation, and returns the name of
+// the copy. The other files of the porter-config secret are kept. The plugin
+// settings may be sensitive, so they are kept in a Secret and never logged.
+func (r *InstallationReconciler) createPluginConfig(ctx context.Context, jobName string, inst *porterv1.Installation, configSecret string, labels map[string]string) (string, error) {
+	src := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: configSecret, Namespace: inst.Namespace}, src)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", errors.Wrapf(err, "could not retrieve porter secret %s/%s for Installation %s/%s", inst.Namespace, configSecret, inst.Namespace, inst.Name)
+	}
+
+	data := make(map[string][]byte, len(src.Data)+1)
+	for k, v := range src.Data {
+		data[k] = v
+	}
+	fileName := porterConfigFileName
+	for _, name := range porterConfigFileNames {
+		if _, ok := data[name]; ok {
+			fileName = name
+			break
+		}
+	}
+	config, err := renderPluginConfig(fileName, data[fileName], inst.Spec.PluginConfig)
+	if err != nil {
+		return "", newTerminalError(ReasonInvalidPluginConfig, errors.Wrapf(err, "could not render the plugin config of Installation %s/%s into porter secret %s", inst.Namespace, inst.Name, configSecret))
+	}
+	data[fileName] = config
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            jobName + "-porter-config",
+			Namespace:       inst.Namespace,
+			Labels:          labels,
+			OwnerReferences: getOwnerReferences(inst),
+		},
+		Data: data,
+	}
+	err = r.Create(ctx, secret, &client.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// A previous reconcile was interrupted before it created the job
+		r.getLogger(ctx).Info("using existing plugin config", "secret", secret.Name)
+	} else if err != nil {
+		return "", errors.Wrapf(err, "error creating the plugin config for Installation %s/%s@%s", inst.Namespace, inst.Name, inst.ResourceVersion)
+	}
+	return secret.Name, nil
+}
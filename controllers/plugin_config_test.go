@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// porterConfigFile is the part of porter's config file that selects the
+// secrets and storage plugins.
+type porterConfigFile struct {
+	Verbosity      string              `toml:"verbosity" json:"verbosity"`
+	DefaultSecrets string              `toml:"default-secrets" json:"default-secrets"`
+	DefaultStorage string              `toml:"default-storage" json:"default-storage"`
+	Secrets        []pluginConfigEntry `toml:"secrets" json:"secrets"`
+	Storage        []pluginConfigEntry `toml:"storage" json:"storage"`
+}
+
+// pluginConfigEntry is a named plugin configuration in porter's config file.
+type pluginConfigEntry struct {
+	Name   string            `toml:"name" json:"name"`
+	Plugin string            `toml:"plugin" json:"plugin"`
+	Config map[string]string `toml:"config" json:"config,omitempty"`
+}
+
+func TestRenderPluginConfig(t *testing.T) {
+	cfg := &porterv1.PorterPluginConfig{
+		Secrets: &porterv1.PluginConfig{Plugin: "azure.keyvault", Config: map[string]string{"vault": `my"vault`}},
+	}
+	operatorSecrets := pluginConfigEntry{Name: "operator", Plugin: "azure.keyvault", Config: map[string]string{"vault": `my"vault`}}
+
+	testcases := []struct {
+		name     string
+		fileName string
+		config   string
+		want     porterConfigFile
+		wantErr  string
+	}{
+		{name: "no config", fileName: "config.toml", want: porterConfigFile{DefaultSecrets: "operator", Secrets: []pluginConfigEntry{operatorSecrets}}},
+		{
+			name:     "toml",
+			fileName: "config.toml",
+			config: `verbosity = "debug"
+default-storage = "mongo"
+
+[[secrets]]
+  name = "operator"
+  plugin = "kubernetes.secrets"
+
+[[secrets]]
+  name = "vault"
+  plugin = "hashicorp.vault"
+
+[[storage]]
+  name = "mongo"
+  plugin = "mongodb"
+  [storage.config]
+    url = "mongodb://mongodb:27017"
+`,
+			want: porterConfigFile{
+				Verbosity:      "debug",
+				DefaultSecrets: "operator",
+				DefaultStorage: "mongo",
+				Secrets:        []pluginConfigEntry{{Name: "vault", Plugin: "hashicorp.vault"}, operatorSecrets},
+				Storage:        []pluginConfigEntry{{Name: "mongo", Plugin: "mongodb", Config: map[string]string{"url": "mongodb://mongodb:27017"}}},
+			},
+		},
+		{
+			name:     "yaml",
+			fileName: "config.yaml",
+			config:   "verbosity: debug\nsecrets:\n  - name: vault\n    plugin: hashicorp.vault\n",
+			want: porterConfigFile{
+				Verbosity:      "debug",
+				DefaultSecrets: "operator",
+				Secrets:        []pluginConfigEntry{{Name: "vault", Plugin: "hashicorp.vault"}, operatorSecrets},
+			},
+		},
+		{
+			name:     "json",
+			fileName: "config.json",
+			config:   `{"verbosity": "debug"}`,
+			want:     porterConfigFile{Verbosity: "debug", DefaultSecrets: "operator", Secrets: []pluginConfigEntry{operatorSecrets}},
+		},
+		{name: "invalid", fileName: "config.toml", config: "verbosity = ", wantErr: "could not parse config.toml"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			config, err := renderPluginConfig(tc.fileName, []byte(tc.config), cfg)
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			var f porterConfigFile
+			if tc.fileName == "config.toml" {
+				_, err = toml.Decode(string(config), &f)
+			} else {
+				err = yaml.Unmarshal(config, &f)
+			}
+			g.Expect(err).ToNot(HaveOccurred(), string(config))
+			g.Expect(f).To(Equal(tc.want), string(config))
+		})
+	}
+}
+
+func TestCreateJobForInstallation_PluginConfig(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.PluginConfig = &porterv1.PorterPluginConfig{
+		Secrets: &porterv1.PluginConfig{Plugin: "kubernetes.secrets"},
+		Storage: &porterv1.PluginConfig{Plugin: "mongodb", Config: map[string]string{"url": "mongodb://mongodb:27017"}},
+	}
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "porter-config", Namespace: inst.Namespace},
+		Data: map[string][]byte{
+			porterConfigFileName: []byte("verbosity = \"debug\"\n"),
+			"ca.crt":             []byte("-----BEGIN CERTIFICATE-----\n"),
+		},
+	})
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+	job := &batchv1.Job{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+	secretName := jobName + "-porter-config"
+	var configVolume *corev1.Volume
+	for i, v := range job.Spec.Template.Spec.Volumes {
+		if v.Name == "porter-config" {
+			configVolume = &job.Spec.Template.Spec.Volumes[i]
+		}
+	}
+	g.Expect(configVolume).ToNot(BeNil())
+	g.Expect(configVolume.Secret.SecretName).To(Equal(secretName), "the merged config should be used instead of the porter-config secret")
+	g.Expect(job.Spec.Template.Spec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{
+		Name:      "porter-config",
+		MountPath: "/porter-config/",
+		ReadOnly:  true,
+	}))
+
+	secret := &corev1.Secret{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: secretName}, secret)).To(Succeed())
+	g.Expect(secret.Labels).To(HaveKeyWithValue("job", jobName), "the rendered config should be cleaned up with the job's artifacts")
+	g.Expect(secret.OwnerReferences).To(Equal(getOwnerReferences(inst)))
+	g.Expect(secret.Data).To(HaveKeyWithValue("ca.crt", []byte("-----BEGIN CERTIFICATE-----\n")), "the other files of the porter-config secret should be kept")
+	var f porterConfigFile
+	_, err := toml.Decode(string(secret.Data[porterConfigFileName]), &f)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(f.Verbosity).To(Equal("debug"), "the porter-config secret's settings should be kept")
+	g.Expect(f.DefaultSecrets).To(Equal("operator"))
+	g.Expect(f.DefaultStorage).To(Equal("operator"))
+	g.Expect(f.Storage).To(Equal([]pluginConfigEntry{
+		{Name: "operator", Plugin: "mongodb", Config: map[string]string{"url": "mongodb://mongodb:27017"}},
+	}))
+}
+
+func TestCheckPluginConfig(t *testing.T) {
+	testcases := []struct {
+		name    string
+		cfg     *porterv1.PorterPluginConfig
+		wantErr string
+	}{
+		{name: "no plugins", cfg: &porterv1.PorterPluginConfig{}, wantErr: "must configure the secrets or storage plugin"},
+		{name: "no plugin name", cfg: &porterv1.PorterPluginConfig{Secrets: &porterv1.PluginConfig{}}, wantErr: "spec.pluginConfig.secrets.plugin: Required value"},
+		{name: "invalid plugin name", cfg: &porterv1.PorterPluginConfig{Storage: &porterv1.PluginConfig{Plugin: "mongo db"}}, wantErr: "spec.pluginConfig.storage.plugin: Invalid value"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.PluginConfig = tc.cfg
+			jobName := makeJobName(inst)
+			r := newTestReconciler(t, inst)
+
+			g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+			jobs := &batchv1.JobList{}
+			g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+			g.Expect(jobs.Items).To(BeEmpty())
+			cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+			g.Expect(cond).ToNot(BeNil())
+			g.Expect(cond.Reason).To(Equal(ReasonInvalidPluginConfig))
+			g.Expect(cond.Message).To(ContainSubstring(tc.wantErr))
+		})
+	}
+}
+
+func TestRunScript_ConfigNotLogged(t *testing.T) {
+	g := NewWithT(t)
+	logs, _, exitCode := runAgentScript(t, nil, "install", "hello")
+	g.Expect(exitCode).To(Equal(0), logs)
+	g.Expect(logs).To(ContainSubstring("config.toml"))
+	g.Expect(logs).ToNot(ContainSubstring("verbosity"), "the porter config may have secrets and should not be logged")
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"strings"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// coreActions are the actions that porter has a command for. Other actions
+// are custom actions of the bundle, which are run with porter invoke.
+var coreActions = map[string]bool{
+	"install":   true,
+	"upgrade":   true,
+	"uninstall": true,
+}
+
+// isCoreAction determines if porter has a command for the action.
+func isCoreAction(action string) bool {
+	return action == "" || coreActions[action]
+}
+
+// getAction returns the action that a run of the Installation makes. When
+// the Installation does not set an Action, the bundle is installed by the
+// first run that succeeds, and upgraded by the runs after it.
+func getAction(inst *porterv1.Installation) string {
+	if inst.Spec.Action != "" {
+		return inst.Spec.Action
+	}
+	if inst.Status.Installed {
+		return "upgrade"
+	}
+	return "install"
+}
+
+// buildPorterArgs returns the porter command that runs the Installation's
+// action, e.g. porter install NAME --reference=REFERENCE --cred=SET
+// --parameter-set=SET --param=NAME=VALUE. Custom actions are run with porter invoke
+// NAME --action=ACTION. The bundleArg selects the bundle, and paramSetArgs
+// are the flags of the parameter set that the operator created for the job.
+// Values are passed as separate arguments, not through a shell, so they do
+// not need to be quoted.
+func buildPorterArgs(inst *porterv1.Installation, bundleArg string, paramSetArgs []string, porterNamespace string) ([]string, error) {
+	var args []string
+	if action := getAction(inst); isCoreAction(action) {
+		args = []string{action, inst.Name}
+	} else {
+		args = []string{"invoke", inst.Name, "--action=" + action}
+	}
+	args = append(args,
+		bundleArg,
+		"--debug",
+		"--debug-plugins",
+		"--driver=kubernetes",
+	)
+
+	for _, c := range inst.Spec.Credentials {
+		args = append(args, "--cred="+c)
+	}
+	for _, p := range inst.Spec.Parameters {
+		if strings.Contains(p, "=") {
+			args = append(args, "--param="+p)
+			continue
+		}
+		args = append(args, "--parameter-set="+p)
+	}
+	valueArgs, err := getParameterValueArgs(inst)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, valueArgs...)
+	args = append(args, paramSetArgs...)
+	if inst.Spec.RelocationMapConfigMap != "" {
+		args = append(args, makeRelocationMapArg())
+	}
+	if porterNamespace != "" {
+		args = append(args, "--namespace="+porterNamespace)
+	}
+	return args, nil
+}
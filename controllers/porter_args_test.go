@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func TestBuildPorterArgs(t *testing.T) {
+	testcases := []struct {
+		name            string
+		action          string
+		credentials     []string
+		parameters      []string
+		parameterValues map[string]string
+		paramSetArgs    []string
+		porterNamespace string
+		want            []string
+	}{
+		{
+			name:   "install",
+			action: "install",
+			want:   []string{"install", "hello", "--reference=getporter/porter-hello:v0.1.1", "--debug", "--debug-plugins", "--driver=kubernetes"},
+		},
+		{
+			name:   "uninstall",
+			action: "uninstall",
+			want:   []string{"uninstall", "hello", "--reference=getporter/porter-hello:v0.1.1", "--debug", "--debug-plugins", "--driver=kubernetes"},
+		},
+		{
+			name:   "custom action",
+			action: "status",
+			want:   []string{"invoke", "hello", "--action=status", "--reference=getporter/porter-hello:v0.1.1", "--debug", "--debug-plugins", "--driver=kubernetes"},
+		},
+		{
+			name:   "action named invoke",
+			action: "invoke",
+			want:   []string{"invoke", "hello", "--action=invoke", "--reference=getporter/porter-hello:v0.1.1", "--debug", "--debug-plugins", "--driver=kubernetes"},
+		},
+		{
+			name:            "sets and parameters",
+			action:          "upgrade",
+			credentials:     []string{"aws", "github"},
+			parameters:      []string{"prod", "region", "color=blue"},
+			parameterValues: map[string]string{"replicas": `3`, "name": `"hello"`},
+			paramSetArgs:    []string{"--parameter-set=/porter-parameter-set/parameters.json"},
+			porterNamespace: "team-a",
+			want: []string{"upgrade", "hello", "--reference=getporter/porter-hello:v0.1.1", "--debug", "--debug-plugins", "--driver=kubernetes",
+				"--cred=aws", "--cred=github",
+				"--parameter-set=prod", "--parameter-set=region", "--param=color=blue",
+				"--param=name=hello", "--param=replicas=3",
+				"--parameter-set=/porter-parameter-set/parameters.json",
+				"--namespace=team-a"},
+		},
+		{
+			name:            "special characters",
+			action:          "install",
+			parameters:      []string{"greeting=hello, world!", "query=a=b&c=d"},
+			parameterValues: map[string]string{"motd": `"it's $HOME \"quoted\""`},
+			want: []string{"install", "hello", "--reference=getporter/porter-hello:v0.1.1", "--debug", "--debug-plugins", "--driver=kubernetes",
+				"--param=greeting=hello, world!", "--param=query=a=b&c=d", `--param=motd=it's $HOME "quoted"`},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.Action = tc.action
+			inst.Spec.Reference = "getporter/porter-hello:v0.1.1"
+			inst.Spec.Credentials = tc.credentials
+			inst.Spec.Parameters = tc.parameters
+			if tc.parameterValues != nil {
+				inst.Spec.ParameterValues = map[string]apiextensionsv1.JSON{}
+				for name, value := range tc.parameterValues {
+					inst.Spec.ParameterValues[name] = apiextensionsv1.JSON{Raw: []byte(value)}
+				}
+			}
+
+			args, err := buildPorterArgs(inst, "--reference="+inst.Spec.Reference, tc.paramSetArgs, tc.porterNamespace)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(args).To(Equal(tc.want))
+		})
+	}
+}
+
+func TestBuildPorterArgs_InvalidParameterValue(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.ParameterValues = map[string]apiextensionsv1.JSON{"replicas": {Raw: []byte(`{`)}}
+
+	_, err := buildPorterArgs(inst, "--reference="+inst.Spec.Reference, nil, "")
+	g.Expect(err).To(MatchError(ContainSubstring("invalid value for parameter replicas")))
+}
+
+func TestGetAction(t *testing.T) {
+	testcases := []struct {
+		name      string
+		action    string
+		installed bool
+		want      string
+	}{
+		{name: "first run", want: "install"},
+		{name: "installed", installed: true, want: "upgrade"},
+		{name: "explicit action", action: "install", installed: true, want: "install"},
+		{name: "custom action", action: "backup", want: "backup"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.Action = tc.action
+			inst.Status.Installed = tc.installed
+
+			g.Expect(getAction(inst)).To(Equal(tc.want))
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// getPorterHome returns the porter home directory of the agent, from the
+// Installation or the porterHome setting. When neither sets it, the agent
+// image's home directory is used and an empty string is returned.
+func (r *InstallationReconciler) getPorterHome(ctx context.Context, inst *porterv1.Installation, cfg porterConfig) (string, error) {
+	log := r.getLogger(ctx)
+	if inst.Spec.PorterHome != "" {
+		log.Info("porter home override", "porterHome", inst.Spec.PorterHome)
+		return inst.Spec.PorterHome, nil
+	}
+	v, source, ok := cfg.get("porterHome")
+	if !ok || v == "" {
+		return "", nil
+	}
+	if errs := porterv1.ValidatePorterHome(v, field.NewPath("porterHome")); len(errs) > 0 {
+		return "", invalidSettingf("invalid porterHome %q in %s, %s", v, source, errs.ToAggregate())
+	}
+	log.Info("porter home defaulted", "source", source, "porterHome", v)
+	return v, nil
+}
+
+// checkPorterHome validates the Installation's porter home, which the webhook
+// also checks, that its PorterHomeVolumeClaimName has a porter home to be
+// mounted at, and that a porter home from the porter configmap has porter
+// installed.
+func (r *InstallationReconciler) checkPorterHome(ctx context.Context, inst *porterv1.Installation, porterHome string) (bool, error) {
+	var errs field.ErrorList
+	if inst.Spec.PorterHome != "" {
+		errs = porterv1.ValidatePorterHome(inst.Spec.PorterHome, field.NewPath("spec", "porterHome"))
+	}
+	if inst.Spec.PorterHomeVolumeClaimName != "" && porterHome == "" {
+		errs = append(errs, field.Required(field.NewPath("spec", "porterHome"), "must be set with porterHomeVolumeClaimName, on the Installation or in the porter configmap"))
+	}
+	if len(errs) == 0 && porterHome != "" {
+		errs = porterv1.ValidatePorterHomeVolume(porterHome, inst.Spec.PorterHomeVolumeClaimName, field.NewPath("spec", "porterHome"))
+	}
+	if len(errs) == 0 {
+		return true, nil
+	}
+
+	msg := fmt.Sprintf("Invalid porterHome: %s", errs.ToAggregate())
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonInvalidPorterHome, msg)
+
+	return false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonInvalidPorterHome, msg)
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestCreateJobForInstallation_PorterHome(t *testing.T) {
+	testcases := []struct {
+		name        string
+		porterHome  string
+		claimName   string
+		configHome  string
+		wantHome    string
+		wantBlocked string
+	}{
+		{name: "image default"},
+		{name: "spec", porterHome: "/app/.porter", wantHome: "/app/.porter"},
+		{name: "configmap", configHome: "/app/.porter", wantHome: "/app/.porter"},
+		{name: "spec wins", porterHome: "/root/.porter", configHome: "/app/.porter", wantHome: "/root/.porter"},
+		{name: "volume", porterHome: "/porter-home", claimName: "porter-home", wantHome: "/porter-home"},
+		{name: "configmap volume", configHome: "/porter-home", claimName: "porter-home", wantHome: "/porter-home"},
+		{name: "not in the image", porterHome: "/home/nonroot/.porter", wantBlocked: "where the agent image has porter installed"},
+		{name: "configmap not in the image", configHome: "/porter-home", wantBlocked: "where the agent image has porter installed"},
+		{name: "relative", porterHome: ".porter", wantBlocked: "must be an absolute path"},
+		{name: "operator volume", porterHome: "/porter-shared/", wantBlocked: "is used by the operator"},
+		{name: "volume without home", claimName: "porter-home", wantBlocked: "must be set with porterHomeVolumeClaimName"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.PorterHome = tc.porterHome
+			inst.Spec.PorterHomeVolumeClaimName = tc.claimName
+			jobName := makeJobName(inst)
+			r := newTestReconciler(t, inst, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: porterConfigMapName, Namespace: inst.Namespace},
+				Data:       map[string]string{"porterHome": tc.configHome},
+			})
+
+			g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+			jobs := &batchv1.JobList{}
+			g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+			if tc.wantBlocked != "" {
+				g.Expect(jobs.Items).To(BeEmpty())
+				cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+				g.Expect(cond).ToNot(BeNil())
+				g.Expect(cond.Reason).To(Equal(ReasonInvalidPorterHome))
+				g.Expect(cond.Message).To(ContainSubstring(tc.wantBlocked))
+				return
+			}
+
+			g.Expect(jobs.Items).To(HaveLen(1))
+			podSpec := jobs.Items[0].Spec.Template.Spec
+			agent := podSpec.Containers[0]
+			if tc.wantHome == "" {
+				for _, env := range agent.Env {
+					g.Expect(env.Name).ToNot(Equal("PORTER_HOME"))
+				}
+				return
+			}
+			g.Expect(agent.Env).To(ContainElement(corev1.EnvVar{Name: "PORTER_HOME", Value: tc.wantHome}))
+
+			mount := corev1.VolumeMount{Name: "porter-home", MountPath: tc.wantHome}
+			if tc.claimName == "" {
+				g.Expect(agent.VolumeMounts).ToNot(ContainElement(mount))
+				return
+			}
+			g.Expect(agent.VolumeMounts).To(ContainElement(mount))
+			g.Expect(podSpec.Volumes).To(ContainElement(corev1.Volume{
+				Name: "porter-home",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: tc.claimName},
+				},
+			}))
+		})
+	}
+}
+
+func TestGetPorterHome_InvalidSetting(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	r := newTestReconciler(t, inst)
+	r.Defaults = map[string]string{"porterHome": "porter"}
+
+	_, err := r.getPorterHome(context.Background(), inst, r.getPorterConfig(context.Background(), inst))
+	g.Expect(err).To(MatchError(ContainSubstring(`invalid porterHome "porter"`)))
+	_, terminal := classifyError(err)
+	g.Expect(terminal).To(BeTrue(), "an invalid setting should not be retried")
+}
+
+func TestRunScript_PorterHome(t *testing.T) {
+	g := NewWithT(t)
+	porterHome := t.TempDir()
+
+	logs, _, exitCode := runAgentScript(t, []string{"PORTER_HOME=" + porterHome}, "install", "hello")
+	g.Expect(exitCode).To(Equal(0), logs)
+	_, err := os.Stat(filepath.Join(porterHome, "config.toml"))
+	g.Expect(err).ToNot(HaveOccurred(), "the porter configuration should be copied into the porter home")
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// porterSecrets are the names of the secrets, in the Installation's
+// namespace, with porter's config file and the environment variables for
+// porter's plugins.
+type porterSecrets struct {
+	Config string
+	Env    string
+}
+
+func (r *InstallationReconciler) getPorterSecretsNamespace(ctx context.Context, inst *porterv1.Installation, cfg porterConfig) string {
+	v, source, ok := cfg.get("porterSecretsNamespace")
+	if !ok || v == inst.Namespace {
+		return ""
+	}
+	r.getLogger(ctx).Info("porter secrets namespace defaulted", "source", source, "porterSecretsNamespace", v)
+	return v
+}
+
+// mirrorPorterSecrets returns the porter-config and porter-env secrets of the
+// Installation's configuration profile. When the secrets are kept in another
+// namespace, which pods can not mount from, they are copied into the
+// Installation's namespace each time a job is created, so that changes to
+// the source secrets are used by the next run. The copies are owned by the
+// Installation. The service account of the porter agent must be permitted
+// to read secrets in the other namespace, otherwise the Installation is
+// marked as failed and false is returned.
+func (r *InstallationReconciler) mirrorPorterSecrets(ctx context.Context, inst *porterv1.Installation, cfg porterConfig, serviceAccount string) (porterSecrets, bool, error) {
+	secrets := porterSecrets{
+		Config: makePorterConfigSecretName(inst.Spec.PorterConfig),
+		Env:    makePorterEnvSecretName(inst.Spec.PorterConfig),
+	}
+	namespace := r.getPorterSecretsNamespace(ctx, inst, cfg)
+	if namespace == "" {
+		return secrets, true, nil
+	}
+
+	if serviceAccount == "" {
+		serviceAccount = defaultServiceAccount
+	}
+	allowed, err := r.canReadSecrets(ctx, inst, serviceAccount, namespace)
+	if err != nil {
+		return secrets, false, err
+	}
+	if !allowed {
+		msg := fmt.Sprintf("The porter agent service account %s is not permitted to read secrets in namespace %s, which has the porter secrets",
+			serviceAccount, namespace)
+		r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+		r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonInvalidReference, msg)
+		return secrets, false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonInvalidReference, msg)
+	}
+
+	// The config of a selected profile must exist, like when it is mounted
+	// directly, unless the Installation's plugin config is used instead
+	secrets.Config, err = r.mirrorPorterSecret(ctx, inst, namespace, secrets.Config, inst.Spec.PorterConfig != "" && inst.Spec.PluginConfig == nil)
+	if err != nil {
+		return secrets, false, err
+	}
+	secrets.Env, err = r.mirrorPorterSecret(ctx, inst, namespace, secrets.Env, false)
+	return secrets, err == nil, err
+}
+
+// mirrorPorterSecret copies the secret into the Installation's namespace, and
+// returns the name of the copy. When a secret that is not required does not
+// exist, its previous copy is removed so that the agent does not use it.
+func (r *InstallationReconciler) mirrorPorterSecret(ctx context.Context, inst *porterv1.Installation, namespace string, name string, required bool) (string, error) {
+	mirror := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: makeMirroredSecretName(inst.Name, name), Namespace: inst.Namespace}}
+
+	src := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, src)
+	if apierrors.IsNotFound(err) && !required {
+		err = r.Delete(ctx, mirror)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return "", errors.Wrapf(err, "could not remove the copy of porter secret %s/%s", inst.Namespace, mirror.Name)
+		}
+		return mirror.Name, nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "could not retrieve porter secret %s/%s for Installation %s/%s", namespace, name, inst.Namespace, inst.Name)
+	}
+
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, mirror, func() error {
+		mirror.Labels = map[string]string{
+			"porter":       "true",
+			"installation": inst.Name,
+		}
+		mirror.OwnerReferences = getOwnerReferences(inst)
+		if mirror.CreationTimestamp.IsZero() {
+			mirror.Type = src.Type
+		}
+		mirror.Data = src.Data
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "could not copy porter secret %s/%s to %s/%s", namespace, name, inst.Namespace, mirror.Name)
+	}
+	r.getLogger(ctx).Info("copied porter secret", "source", namespace+"/"+name, "secret", mirror.Name)
+	return mirror.Name, nil
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestMirrorPorterSecrets(t *testing.T) {
+	cfg := porterConfig{sources: []configSource{{name: "configmap", data: map[string]string{"porterSecretsNamespace": "porter-shared"}}}}
+
+	t.Run("same namespace", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		r := newTestReconciler(t, inst)
+		local := porterConfig{sources: []configSource{{name: "configmap", data: map[string]string{"porterSecretsNamespace": inst.Namespace}}}}
+
+		got, ok, err := r.mirrorPorterSecrets(context.Background(), inst, local, "")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeTrue())
+		g.Expect(got).To(Equal(porterSecrets{Config: "porter-config", Env: "porter-env"}))
+	})
+
+	t.Run("copied", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		src := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "porter-config", Namespace: "porter-shared"},
+			Data:       map[string][]byte{"config.toml": []byte("default-storage = \"azure\"")},
+		}
+		staleEnv := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "hello-porter-env", Namespace: inst.Namespace}}
+		r := newTestReconciler(t, inst, src, staleEnv)
+		r.Client = accessReviewClient{Client: r.Client, allowedNamespaces: map[string]bool{"porter-shared": true}}
+
+		got, ok, err := r.mirrorPorterSecrets(context.Background(), inst, cfg, "")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeTrue())
+		g.Expect(got).To(Equal(porterSecrets{Config: "hello-porter-config", Env: "hello-porter-env"}))
+
+		mirror := &corev1.Secret{}
+		g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: got.Config}, mirror)).To(Succeed())
+		g.Expect(mirror.Data).To(Equal(src.Data))
+		g.Expect(mirror.OwnerReferences).To(Equal(getOwnerReferences(inst)))
+
+		// The source porter-env secret was removed, so the copy is removed too
+		err = r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: got.Env}, &corev1.Secret{})
+		g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	t.Run("missing profile", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		inst.Spec.PorterConfig = "prod"
+		r := newTestReconciler(t, inst)
+		r.Client = accessReviewClient{Client: r.Client, allowedNamespaces: map[string]bool{"porter-shared": true}}
+
+		_, _, err := r.mirrorPorterSecrets(context.Background(), inst, cfg, "")
+		g.Expect(err).To(MatchError(ContainSubstring("could not retrieve porter secret porter-shared/porter-config-prod")))
+	})
+
+	t.Run("not permitted", func(t *testing.T) {
+		g := NewWithT(t)
+		inst := newTestInstallation()
+		r := newTestReconciler(t, inst)
+		r.Client = accessReviewClient{Client: r.Client}
+
+		_, ok, err := r.mirrorPorterSecrets(context.Background(), inst, cfg, "porter-agent")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeFalse())
+		cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+		g.Expect(cond).ToNot(BeNil())
+		g.Expect(cond.Reason).To(Equal(ReasonInvalidReference))
+		g.Expect(cond.Message).To(ContainSubstring("porter-agent is not permitted to read secrets in namespace porter-shared"))
+	})
+}
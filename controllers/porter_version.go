@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+)
+
+const (
+	// agentTagPrefix is the prefix of the tags of the porter agent image,
+	// followed by the porter version, e.g. kubernetes-v1.0.0.
+	agentTagPrefix = "kubernetes-"
+
+	// registryCacheTTL is how long a lookup in a registry, such as the porter
+	// version that a version range resolves to, is used before the registry is
+	// queried again.
+	registryCacheTTL = 10 * time.Minute
+)
+
+// registryCache remembers the results of lookups in a registry, such as which
+// porter version a version range resolved to, so that the registry is not
+// queried for every job.
+type registryCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedRegistryResult
+}
+
+type cachedRegistryResult struct {
+	value   string
+	expires time.Time
+}
+
+func (c *registryCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return "", false
+	}
+	return entry.value, true
+}
+
+func (c *registryCache) set(key string, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = map[string]cachedRegistryResult{}
+	}
+	c.entries[key] = cachedRegistryResult{value: value, expires: time.Now().Add(registryCacheTTL)}
+}
+
+// parsePorterVersionRange returns the semver constraint of a porter version,
+// e.g. ~1.0 or >=1.0.0 <2.0.0. Exact versions, and the latest and canary
+// tags, are not ranges.
+func parsePorterVersionRange(version string) (*semver.Constraints, bool) {
+	if version == "latest" || version == "canary" {
+		return nil, false
+	}
+	if _, err := semver.NewVersion(version); err == nil {
+		return nil, false
+	}
+	constraint, err := semver.NewConstraint(version)
+	return constraint, err == nil
+}
+
+// resolvePorterVersion returns the highest published porter version, in the
+// repository of the porter agent image, that matches a version range. Other
+// versions are returned unchanged.
+func (r *InstallationReconciler) resolvePorterVersion(ctx context.Context, repository string, version string) (string, error) {
+	constraint, ok := parsePorterVersionRange(version)
+	if !ok {
+		return version, nil
+	}
+
+	key := repository + ":" + version
+	if resolved, ok := r.porterVersions.get(key); ok {
+		return resolved, nil
+	}
+
+	listTags := r.listTags
+	if listTags == nil {
+		listTags = listRegistryTags
+	}
+	tags, err := listTags(ctx, repository)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not resolve porter version %s", version)
+	}
+
+	var best *semver.Version
+	var resolved string
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, agentTagPrefix) {
+			continue
+		}
+		candidate := strings.TrimPrefix(tag, agentTagPrefix)
+		v, err := semver.NewVersion(candidate)
+		if err != nil || !constraint.Check(v) {
+			continue
+		}
+		if best == nil || v.GreaterThan(best) {
+			best, resolved = v, candidate
+		}
+	}
+	if best == nil {
+		return "", errors.Errorf("no porter agent image in %s matches porter version %s", repository, version)
+	}
+
+	r.getLogger(ctx).Info("resolved porter version range", "range", version, "version", resolved)
+	r.porterVersions.set(key, resolved)
+	return resolved, nil
+}
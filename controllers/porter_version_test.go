@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestResolvePorterVersion(t *testing.T) {
+	tags := []string{
+		"v1.0.0", "kubernetes-v0.38.4", "kubernetes-v1.0.0", "kubernetes-v1.0.2",
+		"kubernetes-v1.1.0", "kubernetes-v1.0.3-beta.1", "kubernetes-latest", "kubernetes-canary",
+	}
+
+	testcases := []struct {
+		name    string
+		version string
+		want    string
+		wantErr string
+	}{
+		{name: "exact version", version: "v1.0.0", want: "v1.0.0"},
+		{name: "latest", version: "latest", want: "latest"},
+		{name: "canary", version: "canary", want: "canary"},
+		{name: "patch range", version: "~1.0", want: "v1.0.2"},
+		{name: "minor range", version: "^1.0", want: "v1.1.0"},
+		{name: "comparison range", version: ">=0.38, <1.0", want: "v0.38.4"},
+		{name: "no match", version: "~2.0", wantErr: "no porter agent image in ghcr.io/getporter/porter matches porter version ~2.0"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			r := newTestReconciler(t)
+			listed := 0
+			r.listTags = func(ctx context.Context, repository string) ([]string, error) {
+				listed++
+				g.Expect(repository).To(Equal("ghcr.io/getporter/porter"))
+				return tags, nil
+			}
+
+			got, err := r.resolvePorterVersion(context.Background(), "ghcr.io/getporter/porter", tc.version)
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tc.want))
+
+			// Ranges are only resolved from the registry once
+			got, err = r.resolvePorterVersion(context.Background(), "ghcr.io/getporter/porter", tc.version)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tc.want))
+			if got != tc.version {
+				g.Expect(listed).To(Equal(1))
+			} else {
+				g.Expect(listed).To(BeZero())
+			}
+		})
+	}
+}
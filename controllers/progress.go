@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// getProgress returns the latest progress reported by the pods of a porter
+// job, in the porter.sh/progress annotation of the porter agent pod, or of
+// the pods that porter's kubernetes driver runs the bundle in. When more than
+// one pod reports progress, the newest pod wins.
+func (r *InstallationReconciler) getProgress(ctx context.Context, inst *porterv1.Installation, job *batchv1.Job) (string, error) {
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"porter": "true", "installation": inst.Name})
+	if err != nil {
+		return "", errors.Wrapf(err, "could not list the pods for porter job %s/%s", job.Namespace, job.Name)
+	}
+
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].CreationTimestamp.Before(&pods.Items[j].CreationTimestamp)
+	})
+	var progress string
+	for _, pod := range pods.Items {
+		if pod.Labels["job-name"] != job.Name && pod.Labels["job"] != job.Name {
+			continue
+		}
+		if msg, ok := pod.Annotations[porterv1.AnnotationProgress]; ok {
+			progress = msg
+		}
+	}
+	return progress, nil
+}
+
+// reconcileProgress copies the progress of a running porter job to the
+// Installation's status message. Progress is best-effort, when the job does
+// not report any the message is cleared. The message is kept once the job
+// finishes.
+func (r *InstallationReconciler) reconcileProgress(ctx context.Context, inst *porterv1.Installation, job *batchv1.Job) error {
+	if isJobDone(job.Status) {
+		return nil
+	}
+
+	progress, err := r.getProgress(ctx, inst, job)
+	if err != nil {
+		// Progress is only informational, do not hold up the run
+		r.getLogger(ctx).Info("could not read the progress of the porter job", "job", job.Name, "reason", err.Error())
+		return nil
+	}
+	if progress == inst.Status.Message {
+		return nil
+	}
+	r.getLogger(ctx).V(1).Info("porter job reported progress", "job", job.Name, "progress", progress)
+	inst.Status.Message = progress
+	return r.updateStatus(ctx, inst)
+}
+
+// mapPodToInstallation returns the Installation of a pod created for a
+// porter job, from its installation label.
+func mapPodToInstallation(obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	name, ok := labels["installation"]
+	if !ok || labels["porter"] != "true" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: obj.GetNamespace(), Name: name}}}
+}
+
+// progressChanged selects pods whose reported progress has changed.
+var progressChanged = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		_, ok := e.Object.GetAnnotations()[porterv1.AnnotationProgress]
+		return ok
+	},
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return e.ObjectOld.GetAnnotations()[porterv1.AnnotationProgress] != e.ObjectNew.GetAnnotations()[porterv1.AnnotationProgress]
+	},
+	DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+	GenericFunc: func(e event.GenericEvent) bool { return false },
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func newTestProgressPod(name string, created time.Time, labels map[string]string, progress string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test", CreationTimestamp: metav1.NewTime(created), Labels: labels},
+	}
+	if progress != "" {
+		pod.Annotations = map[string]string{porterv1.AnnotationProgress: progress}
+	}
+	return pod
+}
+
+func TestReconcileProgress(t *testing.T) {
+	now := time.Now()
+	agentLabels := map[string]string{"porter": "true", "installation": "hello", "job-name": "porter-hello"}
+	driverLabels := map[string]string{"porter": "true", "installation": "hello", "job": "porter-hello"}
+	otherLabels := map[string]string{"porter": "true", "installation": "hello", "job-name": "porter-hello-old"}
+
+	testcases := []struct {
+		name    string
+		message string
+		pods    []client.Object
+		wantMsg string
+	}{
+		{name: "agent", pods: []client.Object{newTestProgressPod("agent", now, agentLabels, "pulling image")}, wantMsg: "pulling image"},
+		{
+			name: "newest pod wins",
+			pods: []client.Object{
+				newTestProgressPod("agent", now.Add(-time.Minute), agentLabels, "pulling image"),
+				newTestProgressPod("bundle", now, driverLabels, "running install step 3/5"),
+			},
+			wantMsg: "running install step 3/5",
+		},
+		{name: "other job", message: "pulling image", pods: []client.Object{newTestProgressPod("old", now, otherLabels, "done")}},
+		{name: "no progress", pods: []client.Object{newTestProgressPod("agent", now, agentLabels, "")}},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Status.Message = tc.message
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "porter-hello", Namespace: inst.Namespace}}
+			r := newTestReconciler(t, append([]client.Object{inst, job}, tc.pods...)...)
+
+			g.Expect(r.reconcileProgress(context.Background(), inst, job)).To(Succeed())
+
+			updated := &porterv1.Installation{}
+			g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(inst), updated)).To(Succeed())
+			g.Expect(updated.Status.Message).To(Equal(tc.wantMsg))
+		})
+	}
+}
+
+func TestMapPodToInstallation(t *testing.T) {
+	g := NewWithT(t)
+	pod := newTestProgressPod("agent", time.Now(), map[string]string{"porter": "true", "installation": "hello"}, "")
+	g.Expect(mapPodToInstallation(pod)).To(Equal([]reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: "test", Name: "hello"}}}))
+
+	pod.Labels = map[string]string{"app": "hello"}
+	g.Expect(mapPodToInstallation(pod)).To(BeEmpty())
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"math/rand"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// requeueBaseDelay is the delay before the first retry of a failed reconcile.
+	requeueBaseDelay = 5 * time.Millisecond
+
+	// requeueJitter is the fraction of a retry's delay that is randomized.
+	requeueJitter = 0.25
+)
+
+// jitterRateLimiter backs off exponentially for each Installation, like the
+// controller's default rate limiter, with a configurable maximum delay and
+// jitter, so that Installations failing for the same reason, e.g. the
+// registry is down, do not retry in lockstep. The backoff is reset once the
+// Installation is reconciled successfully.
+type jitterRateLimiter struct {
+	workqueue.RateLimiter
+	maxDelay time.Duration
+}
+
+// newRequeueRateLimiter creates the rate limiter used to retry failed
+// reconciles, capping the delay between retries at maxDelay.
+func newRequeueRateLimiter(maxDelay time.Duration) workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		&jitterRateLimiter{
+			RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(requeueBaseDelay, maxDelay),
+			maxDelay:    maxDelay,
+		},
+		// Limit the overall retry rate, the same as the controller's default rate limiter
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+	)
+}
+
+// When returns the delay before the item is retried, taking off up to
+// requeueJitter of the exponential delay, so that the delay never exceeds
+// the maximum.
+func (l *jitterRateLimiter) When(item interface{}) time.Duration {
+	delay := l.RateLimiter.When(item)
+	if delay > l.maxDelay {
+		delay = l.maxDelay
+	}
+	return delay - time.Duration(rand.Float64()*requeueJitter*float64(delay))
+}
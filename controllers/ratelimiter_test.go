@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestJitterRateLimiter(t *testing.T) {
+	g := NewWithT(t)
+	maxDelay := time.Second
+	limiter := newRequeueRateLimiter(maxDelay)
+
+	// The delay grows for each failure of the same Installation, up to the maximum
+	var last time.Duration
+	for i := 0; i < 20; i++ {
+		delay := limiter.When("test/hello")
+		g.Expect(delay).To(BeNumerically("<=", maxDelay))
+		g.Expect(delay).To(BeNumerically(">=", time.Duration(float64(requeueBaseDelay)*(1-requeueJitter))))
+		last = delay
+	}
+	g.Expect(last).To(BeNumerically(">=", time.Duration(float64(maxDelay)*(1-requeueJitter))))
+
+	// Other Installations have their own backoff
+	g.Expect(limiter.When("test/other")).To(BeNumerically("<=", requeueBaseDelay))
+
+	// The backoff is reset after a successful reconcile
+	limiter.Forget("test/hello")
+	g.Expect(limiter.NumRequeues("test/hello")).To(Equal(0))
+	g.Expect(limiter.When("test/hello")).To(BeNumerically("<=", requeueBaseDelay))
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// labelReconcileAction marks the porter jobs that run an Installation's
+// ReconcileAction at its scheduled times.
+const labelReconcileAction = "reconcile-action"
+
+// isReconcileActionJob determines if the job runs the Installation's
+// ReconcileAction, instead of the Installation's action.
+func isReconcileActionJob(job *batchv1.Job) bool {
+	return job.Labels[labelReconcileAction] == "true"
+}
+
+// isMaintenanceJob determines if the job was run on an Installation that
+// succeeded, such as a drift check, and does not change the status of the
+// Installation's action.
+func isMaintenanceJob(job *batchv1.Job) bool {
+	return isDriftCheckJob(job) || isReconcileActionJob(job)
+}
+
+// getLatestReconcileActionJob returns the most recently created job that ran
+// the ReconcileAction of the current generation of the Installation, if any.
+func getLatestReconcileActionJob(jobs []batchv1.Job, inst *porterv1.Installation) *batchv1.Job {
+	var latest *batchv1.Job
+	for i := range jobs {
+		if !isReconcileActionJob(&jobs[i]) {
+			continue
+		}
+		if gen, ok := getJobGeneration(&jobs[i], inst); !ok || gen != inst.Generation {
+			continue
+		}
+		if latest == nil || latest.CreationTimestamp.Before(&jobs[i].CreationTimestamp) {
+			latest = &jobs[i]
+		}
+	}
+	return latest
+}
+
+// checkReconcileAction validates the Installation's ReconcileAction, in case
+// the Installation was created without the webhook. An Installation with an
+// invalid ReconcileAction is not run until it is fixed.
+func (r *InstallationReconciler) checkReconcileAction(ctx context.Context, inst *porterv1.Installation) (bool, error) {
+	errs := porterv1.ValidateReconcileAction(inst.Spec, field.NewPath("spec"))
+	if len(errs) == 0 {
+		return true, nil
+	}
+
+	msg := fmt.Sprintf("Invalid reconcileAction: %s", errs.ToAggregate())
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonInvalidReconcileAction, msg)
+
+	return false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonInvalidReconcileAction, msg)
+}
+
+// reconcileScheduledAction runs the Installation's ReconcileAction at its
+// scheduled times, once the Installation's action succeeded, and records the
+// result of the last run in the ReconcileActionFailed condition.
+func (r *InstallationReconciler) reconcileScheduledAction(ctx context.Context, inst *porterv1.Installation) (ctrl.Result, error) {
+	if inst.Status.Phase != porterv1.PhaseSucceeded {
+		return ctrl.Result{}, nil
+	}
+
+	jobs, err := r.listJobs(ctx, inst)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if latest := getLatestReconcileActionJob(jobs, inst); latest != nil {
+		if err = r.setReconcileActionStatus(ctx, inst, latest); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	return r.reconcileSchedule(ctx, inst)
+}
+
+// setReconcileActionStatus records the result of a ReconcileAction job that is
+// done in the Installation's ReconcileActionFailed condition. An event is
+// recorded when the action fails.
+func (r *InstallationReconciler) setReconcileActionStatus(ctx context.Context, inst *porterv1.Installation, job *batchv1.Job) error {
+	if !isJobDone(job.Status) {
+		return nil
+	}
+
+	result, err := r.getAgentResult(ctx, job)
+	if err != nil {
+		return err
+	}
+	if getPhase(job, result) == porterv1.PhaseSucceeded {
+		msg := fmt.Sprintf("The %s action of porter job %s succeeded", inst.Spec.ReconcileAction, job.Name)
+		return r.setCondition(ctx, inst, porterv1.ConditionReconcileActionFailed, metav1.ConditionFalse, ReasonReconcileActionSucceeded, msg)
+	}
+
+	msg := fmt.Sprintf("The %s action of porter job %s failed. See the job's logs for details", inst.Spec.ReconcileAction, job.Name)
+	// Record the event once for each job that failed
+	if existing := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionReconcileActionFailed); existing == nil || existing.Message != msg {
+		r.getLogger(ctx).Info("reconcile action failed", "job", job.Name)
+		r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonReconcileActionFailed, msg)
+	}
+	return r.setCondition(ctx, inst, porterv1.ConditionReconcileActionFailed, metav1.ConditionTrue, ReasonReconcileActionFailed, msg)
+}
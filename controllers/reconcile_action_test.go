@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func newTestReconcileActionInstallation() *porterv1.Installation {
+	inst := newTestInstallation()
+	inst.CreationTimestamp = metav1.NewTime(time.Now().Add(-2 * time.Minute))
+	inst.Spec.Schedule = "* * * * *"
+	inst.Spec.ReconcileAction = "status"
+	inst.Status.ObservedGeneration = inst.Generation
+	inst.Status.Phase = porterv1.PhaseSucceeded
+	return inst
+}
+
+func TestReconcileScheduledAction_RunsReconcileAction(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestReconcileActionInstallation()
+	r := newTestReconciler(t, inst)
+
+	result, err := r.reconcileScheduledAction(context.Background(), inst)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.RequeueAfter).To(BeNumerically("<=", time.Minute))
+	g.Expect(inst.Status.LastScheduledTime).ToNot(BeNil())
+
+	jobs := &batchv1.JobList{}
+	g.Expect(r.List(context.Background(), jobs, client.InNamespace(inst.Namespace))).To(Succeed())
+	g.Expect(jobs.Items).To(HaveLen(1))
+	job := jobs.Items[0]
+	g.Expect(isReconcileActionJob(&job)).To(BeTrue())
+	args := job.Spec.Template.Spec.Containers[0].Args
+	g.Expect(args[:2]).To(Equal([]string{"invoke", inst.Name}))
+	g.Expect(args).To(ContainElement("--action=status"))
+
+	// The job is not adopted as the Installation's job
+	g.Expect(getLatestJob(jobs.Items)).To(BeNil())
+	g.Expect(inst.Status.Phase).To(Equal(porterv1.PhaseSucceeded))
+}
+
+func TestReconcileScheduledAction_NotRun(t *testing.T) {
+	testcases := []struct {
+		name      string
+		phase     porterv1.InstallationPhase
+		scheduled bool
+	}{
+		{name: "failed", phase: porterv1.PhaseFailed},
+		{name: "not due", phase: porterv1.PhaseSucceeded, scheduled: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestReconcileActionInstallation()
+			inst.Status.Phase = tc.phase
+			if tc.scheduled {
+				// The next run is at the start of the next minute
+				inst.Status.LastScheduledTime = &metav1.Time{Time: time.Now()}
+			}
+			r := newTestReconciler(t, inst)
+
+			_, err := r.reconcileScheduledAction(context.Background(), inst)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			jobs := &batchv1.JobList{}
+			g.Expect(r.List(context.Background(), jobs, client.InNamespace(inst.Namespace))).To(Succeed())
+			g.Expect(jobs.Items).To(BeEmpty())
+		})
+	}
+}
+
+func TestReconcileScheduledAction_SetsCondition(t *testing.T) {
+	testcases := []struct {
+		name       string
+		jobStatus  batchv1.JobConditionType
+		wantStatus metav1.ConditionStatus
+		wantReason string
+	}{
+		{name: "failed", jobStatus: batchv1.JobFailed, wantStatus: metav1.ConditionTrue, wantReason: ReasonReconcileActionFailed},
+		{name: "succeeded", jobStatus: batchv1.JobComplete, wantStatus: metav1.ConditionFalse, wantReason: ReasonReconcileActionSucceeded},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestReconcileActionInstallation()
+			inst.Status.LastScheduledTime = &metav1.Time{Time: time.Now()}
+			job := &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "porter-hello-status",
+					Namespace:   inst.Namespace,
+					Labels:      map[string]string{"porter": "true", "installation": inst.Name, labelReconcileAction: "true"},
+					Annotations: map[string]string{annotationGeneration: "1"},
+				},
+				Status: batchv1.JobStatus{
+					Conditions: []batchv1.JobCondition{{Type: tc.jobStatus, Status: corev1.ConditionTrue}},
+				},
+			}
+			r := newTestReconciler(t, inst, job)
+
+			_, err := r.reconcileScheduledAction(context.Background(), inst)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionReconcileActionFailed)
+			g.Expect(cond).ToNot(BeNil())
+			g.Expect(cond.Status).To(Equal(tc.wantStatus))
+			g.Expect(cond.Reason).To(Equal(tc.wantReason))
+			g.Expect(inst.Status.Phase).To(Equal(porterv1.PhaseSucceeded))
+		})
+	}
+}
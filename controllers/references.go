@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// checkSetReferences validates the names of the Installation's credential and
+// parameter sets, in case the Installation was created without the webhook.
+// When a reference is invalid, the Installation is marked as failed and false
+// is returned.
+func (r *InstallationReconciler) checkSetReferences(ctx context.Context, inst *porterv1.Installation) (bool, error) {
+	errs := porterv1.ValidateSetReferences(inst.Spec, field.NewPath("spec"))
+	if len(errs) == 0 {
+		return true, nil
+	}
+
+	return false, r.rejectSetReferences(ctx, inst, fmt.Sprintf("Invalid credential or parameter set: %s", errs.ToAggregate()))
+}
+
+// canReadSecrets checks if the porter agent's service account is permitted to
+// read secrets in the namespace.
+func (r *InstallationReconciler) canReadSecrets(ctx context.Context, inst *porterv1.Installation, serviceAccount string, namespace string) (bool, error) {
+	return r.canAccess(ctx, inst, serviceAccount, authorizationv1.ResourceAttributes{
+		Namespace: namespace,
+		Verb:      "get",
+		Resource:  "secrets",
+	})
+}
+
+// canAccess checks if the porter agent's service account is permitted to
+// make the request.
+func (r *InstallationReconciler) canAccess(ctx context.Context, inst *porterv1.Installation, serviceAccount string, attrs authorizationv1.ResourceAttributes) (bool, error) {
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:               fmt.Sprintf("system:serviceaccount:%s:%s", inst.Namespace, serviceAccount),
+			ResourceAttributes: &attrs,
+		},
+	}
+	err := r.Create(ctx, review)
+	if err != nil {
+		return false, errors.Wrapf(err, "could not check access to namespace %s for Installation %s/%s", attrs.Namespace, inst.Namespace, inst.Name)
+	}
+	return review.Status.Allowed, nil
+}
+
+func (r *InstallationReconciler) rejectSetReferences(ctx context.Context, inst *porterv1.Installation, msg string) error {
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonInvalidReference, msg)
+
+	return r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonInvalidReference, msg)
+}
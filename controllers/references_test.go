@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// accessReviewClient answers SubjectAccessReviews, which the fake client cannot evaluate.
+type accessReviewClient struct {
+	client.Client
+	allowedNamespaces map[string]bool
+}
+
+func (c accessReviewClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if review, ok := obj.(*authorizationv1.SubjectAccessReview); ok {
+		review.Status.Allowed = c.allowedNamespaces[review.Spec.ResourceAttributes.Namespace]
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestCheckSetReferences(t *testing.T) {
+	testcases := []struct {
+		name        string
+		credentials []string
+		parameters  []string
+		wantErr     string
+	}{
+		{name: "names", credentials: []string{"azure"}, parameters: []string{"settings", "name=hello"}},
+		{name: "qualified value", parameters: []string{"path=shared/settings"}},
+		{name: "qualified credential set", credentials: []string{"shared/azure"}, wantErr: `spec.credentials[0]: Invalid value: "shared/azure": namespace-qualified references are not supported`},
+		{name: "qualified parameter set", parameters: []string{"shared/settings"}, wantErr: `spec.parameters[0]: Invalid value: "shared/settings"`},
+		{name: "empty", credentials: []string{""}, wantErr: "spec.credentials[0]: Required value"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.Credentials = tc.credentials
+			inst.Spec.Parameters = tc.parameters
+			r := newTestReconciler(t, inst)
+
+			ok, err := r.checkSetReferences(context.Background(), inst)
+			g.Expect(err).ToNot(HaveOccurred())
+			cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+			if tc.wantErr == "" {
+				g.Expect(ok).To(BeTrue())
+				g.Expect(cond).To(BeNil())
+				return
+			}
+			g.Expect(ok).To(BeFalse())
+			g.Expect(cond).ToNot(BeNil())
+			g.Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			g.Expect(cond.Reason).To(Equal(ReasonInvalidReference))
+			g.Expect(cond.Message).To(ContainSubstring(tc.wantErr))
+		})
+	}
+}
+
+func TestCreateJobForInstallation_QualifiedSetReference(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	inst.Spec.Credentials = []string{"shared/azure"}
+	jobName := makeJobName(inst)
+	r := newTestReconciler(t, inst)
+
+	g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+	jobs := &batchv1.JobList{}
+	g.Expect(r.List(context.Background(), jobs)).To(Succeed())
+	g.Expect(jobs.Items).To(BeEmpty(), "porter would look up the set in the wrong namespace")
+}
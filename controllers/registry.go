@@ -0,0 +1,460 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+const (
+	// dockerHubHost is the host that serves the registry API of Docker Hub.
+	dockerHubHost = "registry-1.docker.io"
+
+	// registryTimeout is how long to wait for a response from a registry.
+	registryTimeout = 30 * time.Second
+
+	// maxBundleSize is the size of the largest manifest or bundle.json that
+	// is read from a registry.
+	maxBundleSize = 4 << 20
+
+	// dockerManifestListMediaType is the docker equivalent of an OCI index.
+	dockerManifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// dockerManifestMediaType is the docker equivalent of an OCI manifest.
+	dockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+
+	// cnabManifestTypeAnnotation is set on the manifests in the index of a
+	// bundle, to cnabManifestTypeConfig on the manifest of its bundle.json.
+	cnabManifestTypeAnnotation = "io.cnab.manifest.type"
+	cnabManifestTypeConfig     = "config"
+)
+
+var (
+	// challengeParam matches a parameter of a WWW-Authenticate challenge, e.g. realm="https://ghcr.io/token".
+	challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+	// nextLink matches the next page of a paginated registry response.
+	nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+)
+
+// registryCredentials are the username and password for a registry, from the
+// docker config of an image pull secret.
+type registryCredentials struct {
+	Username string
+	Password string
+}
+
+// registryAuth holds the credentials to use for each registry host.
+type registryAuth map[string]registryCredentials
+
+// get returns the credentials for a registry host, or nil when the registry
+// is accessed anonymously.
+func (a registryAuth) get(registry string) *registryCredentials {
+	if creds, ok := a[porterv1.NormalizeRegistry(registry)]; ok {
+		return &creds
+	}
+	return nil
+}
+
+// manifestNotFoundError is returned when a registry reports that a reference
+// does not exist, as opposed to a registry that can not be reached or that
+// denies access.
+type manifestNotFoundError struct {
+	reference string
+	registry  string
+}
+
+func (e *manifestNotFoundError) Error() string {
+	return fmt.Sprintf("%s was not found in %s", e.reference, e.registry)
+}
+
+// isManifestNotFound determines if the registry reported that a reference
+// does not exist.
+func isManifestNotFound(err error) bool {
+	var nf *manifestNotFoundError
+	return errors.As(err, &nf)
+}
+
+// dockerConfigEntry is the credentials for a registry in a docker config.
+type dockerConfigEntry struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     string `json:"auth"`
+}
+
+// parseDockerConfig returns the registry credentials in an image pull secret,
+// of type kubernetes.io/dockerconfigjson or kubernetes.io/dockercfg. Other
+// secrets have no credentials.
+func parseDockerConfig(secret *corev1.Secret) (registryAuth, error) {
+	var entries map[string]dockerConfigEntry
+	var err error
+	switch secret.Type {
+	case corev1.SecretTypeDockerConfigJson:
+		config := struct {
+			Auths map[string]dockerConfigEntry `json:"auths"`
+		}{}
+		err = json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config)
+		entries = config.Auths
+	case corev1.SecretTypeDockercfg:
+		err = json.Unmarshal(secret.Data[corev1.DockerConfigKey], &entries)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid docker config in image pull secret %s/%s", secret.Namespace, secret.Name)
+	}
+
+	auth := registryAuth{}
+	for server, entry := range entries {
+		creds := registryCredentials{Username: entry.Username, Password: entry.Password}
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid auth for %s in image pull secret %s/%s", server, secret.Namespace, secret.Name)
+			}
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) == 2 {
+				creds = registryCredentials{Username: parts[0], Password: parts[1]}
+			}
+		}
+
+		// Servers may be written as a URL, e.g. https://index.docker.io/v1/
+		host := server
+		if i := strings.Index(host, "://"); i >= 0 {
+			host = host[i+3:]
+		}
+		host = strings.SplitN(host, "/", 2)[0]
+		auth[porterv1.NormalizeRegistry(host)] = creds
+	}
+	return auth, nil
+}
+
+// registryRepository makes requests to the HTTP API of a repository in a
+// registry, e.g. ghcr.io/getporter/porter, with the credentials for the
+// registry from auth, or anonymously when auth has none for it.
+type registryRepository struct {
+	client   *http.Client
+	registry string
+	url      string
+	creds    *registryCredentials
+
+	// authorization is the Authorization header that answered the
+	// registry's challenge, and is reused for the next requests.
+	authorization string
+}
+
+func newRegistryRepository(repository string, auth registryAuth) *registryRepository {
+	registry, name := porterv1.ParseBundleRepository(repository)
+	return &registryRepository{
+		client:   &http.Client{Timeout: registryTimeout},
+		registry: registry,
+		url:      fmt.Sprintf("https://%s/v2/%s", getRegistryHost(registry), name),
+		creds:    auth.get(registry),
+	}
+}
+
+// do sends a request to the repository and returns the response. When the
+// registry challenges the request, it is authenticated and sent again.
+func (r *registryRepository) do(ctx context.Context, method string, u string, accept string) (*http.Response, error) {
+	for {
+		req, err := http.NewRequestWithContext(ctx, method, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if r.authorization != "" {
+			req.Header.Set("Authorization", r.authorization)
+		}
+		resp, err := r.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || r.authorization != "" {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		r.authorization, err = getRegistryAuthorization(ctx, r.client, resp.Header.Get("WWW-Authenticate"), r.creds)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not authenticate to %s", r.registry)
+		}
+	}
+}
+
+// checkStatus returns an error for a response that was not successful. A
+// missing manifest returns a manifestNotFoundError.
+func (r *registryRepository) checkStatus(resp *http.Response, reference string) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return &manifestNotFoundError{reference: reference, registry: r.registry}
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errors.Errorf("%s denied access to %s, the repository may not exist or may require authentication", r.registry, reference)
+	default:
+		return errors.Errorf("could not read %s, %s returned %s", reference, r.registry, resp.Status)
+	}
+}
+
+// get reads a manifest or a blob of the repository, e.g. manifests/v0.1.1,
+// and returns its content and media type. Content with a digest is verified.
+func (r *registryRepository) get(ctx context.Context, path string, accept string, reference string, dgst digest.Digest) ([]byte, string, error) {
+	resp, err := r.do(ctx, http.MethodGet, r.url+"/"+path, accept)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "could not read %s", reference)
+	}
+	defer resp.Body.Close()
+	if err = r.checkStatus(resp, reference); err != nil {
+		return nil, "", err
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBundleSize+1))
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "could not read %s", reference)
+	}
+	if len(content) > maxBundleSize {
+		return nil, "", errors.Errorf("%s is larger than %d bytes", reference, maxBundleSize)
+	}
+	if dgst != "" && dgst.Validate() == nil && dgst.Algorithm().FromBytes(content) != dgst {
+		return nil, "", errors.Errorf("the content of %s does not match its digest %s", reference, dgst)
+	}
+	return content, strings.TrimSpace(strings.SplitN(resp.Header.Get("Content-Type"), ";", 2)[0]), nil
+}
+
+// listRegistryTags returns the tags of an image repository, e.g.
+// ghcr.io/getporter/porter, using the registry's HTTP API. Only public
+// repositories are supported, the operator requests an anonymous token when
+// the registry asks for one.
+func listRegistryTags(ctx context.Context, repository string) ([]string, error) {
+	repo := newRegistryRepository(repository, nil)
+
+	var tags []string
+	next := repo.url + "/tags/list"
+	for next != "" {
+		resp, err := repo.do(ctx, http.MethodGet, next, "")
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not list the tags of %s", repository)
+		}
+
+		page := struct {
+			Tags []string `json:"tags"`
+		}{}
+		err = decodeRegistryResponse(resp, &page)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not list the tags of %s", repository)
+		}
+		tags = append(tags, page.Tags...)
+
+		next = ""
+		if m := nextLink.FindStringSubmatch(resp.Header.Get("Link")); m != nil {
+			link, err := resp.Request.URL.Parse(m[1])
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid link to the next page of tags of %s", repository)
+			}
+			next = link.String()
+		}
+	}
+	return tags, nil
+}
+
+// manifestMediaTypes are the manifests that a bundle reference may resolve
+// to, a CNAB bundle is pushed as an OCI index or a docker manifest list.
+var manifestMediaTypes = []string{
+	ocispec.MediaTypeImageIndex,
+	dockerManifestListMediaType,
+	ocispec.MediaTypeImageManifest,
+	dockerManifestMediaType,
+}
+
+// getManifestReference returns the tag or digest of a reference to look up
+// in its repository, defaulting to the latest tag.
+func getManifestReference(tag string, dgst string) string {
+	if dgst != "" {
+		return dgst
+	}
+	if tag != "" {
+		return tag
+	}
+	return "latest"
+}
+
+// getRegistryDigest returns the digest of the manifest of an image reference,
+// e.g. getporter/porter-hello:v0.1.1, using the registry's HTTP API. The
+// registry is accessed with its credentials from auth, or anonymously when
+// auth has none for it. A reference that the registry reports as missing
+// returns a manifestNotFoundError.
+func getRegistryDigest(ctx context.Context, reference string, auth registryAuth) (string, error) {
+	repository, tag, dgst := porterv1.ParseBundleReference(reference)
+	repo := newRegistryRepository(repository, auth)
+
+	resp, err := repo.do(ctx, http.MethodHead, repo.url+"/manifests/"+getManifestReference(tag, dgst), strings.Join(manifestMediaTypes, ", "))
+	if err != nil {
+		return "", errors.Wrapf(err, "could not resolve %s", reference)
+	}
+	resp.Body.Close()
+	if err = repo.checkStatus(resp, reference); err != nil {
+		return "", err
+	}
+	if d := resp.Header.Get("Docker-Content-Digest"); d != "" {
+		return d, nil
+	}
+	if dgst != "" {
+		return dgst, nil
+	}
+	return "", errors.Errorf("%s did not return the digest of %s", repo.registry, reference)
+}
+
+// getRegistryBundle returns the bundle.json of a bundle reference from its
+// registry, using the same credentials as getRegistryDigest. Porter pushes a
+// bundle as an index, or a docker manifest list, of the bundle's invocation
+// images and of a config manifest, whose config blob is the bundle.json.
+func getRegistryBundle(ctx context.Context, reference string, auth registryAuth) (*bundleDefinition, error) {
+	repository, tag, dgst := porterv1.ParseBundleReference(reference)
+	repo := newRegistryRepository(repository, auth)
+
+	content, mediaType, err := repo.get(ctx, "manifests/"+getManifestReference(tag, dgst), strings.Join(manifestMediaTypes, ", "), reference, digest.Digest(dgst))
+	if err != nil {
+		return nil, err
+	}
+	if mediaType == ocispec.MediaTypeImageIndex || mediaType == dockerManifestListMediaType {
+		index := ocispec.Index{}
+		if err = json.Unmarshal(content, &index); err != nil {
+			return nil, errors.Wrapf(err, "invalid manifest for %s", reference)
+		}
+		config, err := getBundleConfigManifest(index)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a bundle", reference)
+		}
+		content, _, err = repo.get(ctx, "manifests/"+config.Digest.String(), strings.Join(manifestMediaTypes, ", "), reference, config.Digest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	manifest := ocispec.Manifest{}
+	if err = json.Unmarshal(content, &manifest); err != nil || manifest.Config.Digest == "" {
+		return nil, errors.Errorf("invalid manifest for %s", reference)
+	}
+	content, _, err = repo.get(ctx, "blobs/"+manifest.Config.Digest.String(), "", reference, manifest.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	bun := &bundleDefinition{}
+	err = json.Unmarshal(content, bun)
+	return bun, errors.Wrapf(err, "could not parse the bundle.json of %s", reference)
+}
+
+// getBundleConfigManifest returns the config manifest in the index of a
+// bundle. It is annotated with its type in an OCI index, and is the first
+// manifest of a docker manifest list, which does not have annotations.
+func getBundleConfigManifest(index ocispec.Index) (ocispec.Descriptor, error) {
+	for _, m := range index.Manifests {
+		if m.Annotations[cnabManifestTypeAnnotation] == cnabManifestTypeConfig {
+			return m, nil
+		}
+	}
+	for _, m := range index.Manifests {
+		if len(m.Annotations) == 0 {
+			return m, nil
+		}
+	}
+	return ocispec.Descriptor{}, errors.New("the index does not have a bundle config manifest")
+}
+
+// getRegistryHost returns the host that serves the registry API of a
+// registry.
+func getRegistryHost(registry string) string {
+	if registry == porterv1.DockerHubRegistry {
+		return dockerHubHost
+	}
+	return registry
+}
+
+func getRegistry(ctx context.Context, client *http.Client, u string, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return client.Do(req)
+}
+
+// getRegistryAuthorization answers a registry's authentication challenge, and
+// returns the Authorization header to retry the request with. A bearer
+// challenge, e.g. Bearer realm="https://ghcr.io/token",service="ghcr.io",scope="repository:getporter/porter:pull",
+// requests a pull token from the realm, authenticated with creds when they
+// are set and anonymously otherwise. A basic challenge requires creds.
+func getRegistryAuthorization(ctx context.Context, client *http.Client, challenge string, creds *registryCredentials) (string, error) {
+	var basic string
+	if creds != nil {
+		basic = "Basic " + base64.StdEncoding.EncodeToString([]byte(creds.Username+":"+creds.Password))
+	}
+	scheme := strings.ToLower(strings.SplitN(challenge, " ", 2)[0])
+	switch {
+	case scheme == "basic" && basic != "":
+		return basic, nil
+	case scheme == "basic":
+		return "", errors.New("the registry requires credentials, add them to an image pull secret of the porter agent's service account")
+	case scheme != "bearer":
+		return "", errors.Errorf("unsupported authentication challenge %q", challenge)
+	}
+	params := map[string]string{}
+	for _, m := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", errors.Errorf("invalid realm in authentication challenge %q", challenge)
+	}
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if v := params[key]; v != "" {
+			query.Set(key, v)
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	resp, err := getRegistry(ctx, client, realm.String(), basic)
+	if err != nil {
+		return "", err
+	}
+	result := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err = decodeRegistryResponse(resp, &result); err != nil {
+		return "", err
+	}
+	if result.Token != "" {
+		return "Bearer " + result.Token, nil
+	}
+	return "Bearer " + result.AccessToken, nil
+}
+
+// decodeRegistryResponse reads a JSON response from a registry, and closes it.
+func decodeRegistryResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s returned %s", resp.Request.URL.Host, resp.Status)
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(v), "invalid response from %s", resp.Request.URL.Host)
+}
@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestListRegistryTags(t *testing.T) {
+	g := NewWithT(t)
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/token":
+			g.Expect(req.URL.Query().Get("scope")).To(Equal("repository:getporter/porter:pull"))
+			fmt.Fprint(w, `{"token":"anonymous"}`)
+		case "/v2/getporter/porter/tags/list":
+			if req.Header.Get("Authorization") != "Bearer anonymous" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:getporter/porter:pull"`, srv.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if req.URL.Query().Get("last") == "" {
+				w.Header().Set("Link", `</v2/getporter/porter/tags/list?last=kubernetes-v1.0.0>; rel="next"`)
+				fmt.Fprint(w, `{"tags":["kubernetes-v0.38.4","kubernetes-v1.0.0"]}`)
+				return
+			}
+			fmt.Fprint(w, `{"tags":["kubernetes-v1.0.2"]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	// Trust the test server's certificate
+	transport := http.DefaultTransport
+	http.DefaultTransport = srv.Client().Transport
+	defer func() { http.DefaultTransport = transport }()
+
+	tags, err := listRegistryTags(context.Background(), strings.TrimPrefix(srv.URL, "https://")+"/getporter/porter")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(tags).To(Equal([]string{"kubernetes-v0.38.4", "kubernetes-v1.0.0", "kubernetes-v1.0.2"}))
+}
+
+func TestGetRegistryDigest(t *testing.T) {
+	g := NewWithT(t)
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/token":
+			fmt.Fprint(w, `{"token":"anonymous"}`)
+		case "/v2/getporter/porter-hello/manifests/v0.1.1":
+			if req.Header.Get("Authorization") != "Bearer anonymous" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:getporter/porter-hello:pull"`, srv.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			g.Expect(req.Method).To(Equal(http.MethodHead))
+			g.Expect(req.Header.Get("Accept")).To(ContainSubstring("application/vnd.oci.image.index.v1+json"))
+			w.Header().Set("Docker-Content-Digest", "sha256:abc123")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	// Trust the test server's certificate
+	transport := http.DefaultTransport
+	http.DefaultTransport = srv.Client().Transport
+	defer func() { http.DefaultTransport = transport }()
+
+	registry := strings.TrimPrefix(srv.URL, "https://")
+	digest, err := getRegistryDigest(context.Background(), registry+"/getporter/porter-hello:v0.1.1", nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(digest).To(Equal("sha256:abc123"))
+
+	_, err = getRegistryDigest(context.Background(), registry+"/getporter/porter-hello:v0.1.2", nil)
+	g.Expect(err).To(MatchError(ContainSubstring("was not found")))
+	g.Expect(isManifestNotFound(err)).To(BeTrue())
+}
+
+func TestGetRegistryDigest_Credentials(t *testing.T) {
+	testcases := []struct {
+		name    string
+		scheme  string
+		auth    registryAuth
+		wantErr string
+	}{
+		{name: "bearer", scheme: "Bearer", auth: registryAuth{"REGISTRY": {Username: "porter", Password: "secret"}}},
+		{name: "basic", scheme: "Basic", auth: registryAuth{"REGISTRY": {Username: "porter", Password: "secret"}}},
+		{name: "basic without credentials", scheme: "Basic", wantErr: "requires credentials"},
+		{name: "bearer without credentials", scheme: "Bearer", wantErr: "denied access"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			var srv *httptest.Server
+			srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				user, password, _ := req.BasicAuth()
+				switch req.URL.Path {
+				case "/token":
+					if user == "porter" && password == "secret" {
+						fmt.Fprint(w, `{"access_token":"private"}`)
+						return
+					}
+					fmt.Fprint(w, `{"token":"anonymous"}`)
+				case "/v2/private/porter-hello/manifests/v0.1.1":
+					authorized := req.Header.Get("Authorization") == "Bearer private"
+					if tc.scheme == "Basic" {
+						authorized = user == "porter" && password == "secret"
+					}
+					if !authorized {
+						w.Header().Set("WWW-Authenticate", fmt.Sprintf(`%s realm="%s/token",service="registry"`, tc.scheme, srv.URL))
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					w.Header().Set("Docker-Content-Digest", "sha256:abc123")
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			transport := http.DefaultTransport
+			http.DefaultTransport = srv.Client().Transport
+			defer func() { http.DefaultTransport = transport }()
+
+			registry := strings.TrimPrefix(srv.URL, "https://")
+			auth := registryAuth{}
+			for _, creds := range tc.auth {
+				auth[registry] = creds
+			}
+			digest, err := getRegistryDigest(context.Background(), registry+"/private/porter-hello:v0.1.1", auth)
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.wantErr)))
+				g.Expect(isManifestNotFound(err)).To(BeFalse())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(digest).To(Equal("sha256:abc123"))
+		})
+	}
+}
+
+func TestParseDockerConfig(t *testing.T) {
+	g := NewWithT(t)
+	secret := &corev1.Secret{
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{
+			"https://index.docker.io/v1/":{"auth":"` + base64.StdEncoding.EncodeToString([]byte("hub:pass:word")) + `"},
+			"ghcr.io":{"username":"gh","password":"token"}}}`)},
+	}
+	auth, err := parseDockerConfig(secret)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(auth).To(Equal(registryAuth{
+		porterv1.DockerHubRegistry: {Username: "hub", Password: "pass:word"},
+		"ghcr.io":                  {Username: "gh", Password: "token"},
+	}))
+
+	secret = &corev1.Secret{
+		Type: corev1.SecretTypeDockercfg,
+		Data: map[string][]byte{corev1.DockerConfigKey: []byte(`{"quay.io":{"username":"quay","password":"pw"}}`)},
+	}
+	auth, err = parseDockerConfig(secret)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(auth.get("quay.io")).To(Equal(&registryCredentials{Username: "quay", Password: "pw"}))
+
+	auth, err = parseDockerConfig(&corev1.Secret{Type: corev1.SecretTypeOpaque})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(auth).To(BeEmpty())
+}
+
+func TestGetRegistryBundle(t *testing.T) {
+	bundleJSON := []byte(`{"name":"porter-hello","version":"0.1.1","parameters":{"name":{"definition":"string","required":true}}}`)
+	bundleDigest := digest.FromBytes(bundleJSON)
+	configManifest := []byte(fmt.Sprintf(`{"schemaVersion":2,"config":{"mediaType":"application/vnd.cnab.config.v1+json","digest":"%s","size":%d}}`, bundleDigest, len(bundleJSON)))
+	configDigest := digest.FromBytes(configManifest)
+
+	testcases := []struct {
+		name      string
+		mediaType string
+		index     string
+		blob      []byte
+		wantErr   string
+	}{
+		{name: "oci index", mediaType: ocispec.MediaTypeImageIndex, index: fmt.Sprintf(`{"schemaVersion":2,"manifests":[
+			{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:0000000000000000000000000000000000000000000000000000000000000000","size":1,"annotations":{"io.cnab.manifest.type":"invocation"}},
+			{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"%s","size":%d,"annotations":{"io.cnab.manifest.type":"config"}}]}`, configDigest, len(configManifest))},
+		{name: "docker manifest list", mediaType: dockerManifestListMediaType, index: fmt.Sprintf(`{"schemaVersion":2,"manifests":[
+			{"mediaType":"application/vnd.docker.distribution.manifest.v2+json","digest":"%s","size":%d}]}`, configDigest, len(configManifest))},
+		{name: "corrupt blob", mediaType: ocispec.MediaTypeImageIndex, blob: []byte(`{"name":"evil"}`), index: fmt.Sprintf(`{"schemaVersion":2,"manifests":[
+			{"digest":"%s","size":%d,"annotations":{"io.cnab.manifest.type":"config"}}]}`, configDigest, len(configManifest)), wantErr: "does not match its digest"},
+		{name: "not a bundle", mediaType: ocispec.MediaTypeImageIndex, index: `{"schemaVersion":2,"manifests":[
+			{"digest":"sha256:0000000000000000000000000000000000000000000000000000000000000000","size":1,"annotations":{"io.cnab.manifest.type":"invocation"}}]}`, wantErr: "is not a bundle"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			blob := bundleJSON
+			if tc.blob != nil {
+				blob = tc.blob
+			}
+			srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/v2/getporter/porter-hello/manifests/v0.1.1":
+					w.Header().Set("Content-Type", tc.mediaType)
+					fmt.Fprint(w, tc.index)
+				case "/v2/getporter/porter-hello/manifests/" + configDigest.String():
+					w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+					w.Write(configManifest)
+				case "/v2/getporter/porter-hello/blobs/" + bundleDigest.String():
+					w.Write(blob)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			transport := http.DefaultTransport
+			http.DefaultTransport = srv.Client().Transport
+			defer func() { http.DefaultTransport = transport }()
+
+			bun, err := getRegistryBundle(context.Background(), strings.TrimPrefix(srv.URL, "https://")+"/getporter/porter-hello:v0.1.1", nil)
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(bun.Name).To(Equal("porter-hello"))
+			g.Expect(bun.Parameters).To(HaveKeyWithValue("name", bundleParameter{Definition: "string", Required: true}))
+		})
+	}
+}
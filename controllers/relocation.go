@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+const (
+	// relocationMapPath is where the Installation's RelocationMapConfigMap is mounted in the agent.
+	relocationMapPath = "/porter-relocation"
+
+	// relocationMapKey is the key in the RelocationMapConfigMap with the relocation mapping.
+	relocationMapKey = "relocation-mapping.json"
+)
+
+// makeRelocationMapArg returns the porter flag that uses the relocation
+// mapping mounted from the Installation's RelocationMapConfigMap.
+func makeRelocationMapArg() string {
+	return "--relocation-mapping=" + path.Join(relocationMapPath, relocationMapKey)
+}
+
+// checkRelocationMap validates the relocation mapping in the Installation's
+// RelocationMapConfigMap, so that a missing or malformed mapping is reported
+// on the Installation instead of failing in the agent. The mapping is a JSON
+// object of the original image references to their relocated references.
+func (r *InstallationReconciler) checkRelocationMap(ctx context.Context, inst *porterv1.Installation) (bool, error) {
+	if inst.Spec.RelocationMapConfigMap == "" {
+		return true, nil
+	}
+
+	cm := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: inst.Spec.RelocationMapConfigMap, Namespace: inst.Namespace}, cm)
+	if apierrors.IsNotFound(err) {
+		msg := fmt.Sprintf("The relocation mapping configmap %s/%s does not exist", inst.Namespace, inst.Spec.RelocationMapConfigMap)
+		return false, r.rejectRelocationMap(ctx, inst, msg)
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "could not retrieve the relocation mapping configmap %s/%s", inst.Namespace, inst.Spec.RelocationMapConfigMap)
+	}
+
+	data, ok := cm.Data[relocationMapKey]
+	if !ok {
+		msg := fmt.Sprintf("The relocation mapping configmap %s/%s does not contain %s", inst.Namespace, inst.Spec.RelocationMapConfigMap, relocationMapKey)
+		return false, r.rejectRelocationMap(ctx, inst, msg)
+	}
+	mapping := map[string]string{}
+	if err := json.Unmarshal([]byte(data), &mapping); err != nil {
+		msg := fmt.Sprintf("Invalid %s in the relocation mapping configmap %s/%s: %s", relocationMapKey, inst.Namespace, inst.Spec.RelocationMapConfigMap, err)
+		return false, r.rejectRelocationMap(ctx, inst, msg)
+	}
+	return true, nil
+}
+
+func (r *InstallationReconciler) rejectRelocationMap(ctx context.Context, inst *porterv1.Installation, msg string) error {
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonInvalidRelocationMap, msg)
+	return r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonInvalidRelocationMap, msg)
+}
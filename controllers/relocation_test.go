@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestCreateJobForInstallation_RelocationMap(t *testing.T) {
+	testcases := []struct {
+		name       string
+		data       map[string]string
+		wantReason string
+	}{
+		{name: "valid", data: map[string]string{relocationMapKey: `{"getporter/porter-hello:v0.1.1": "registry.corp/porter-hello@sha256:abc123"}`}},
+		{name: "missing configmap", wantReason: ReasonInvalidRelocationMap},
+		{name: "missing key", data: map[string]string{"mapping.json": `{}`}, wantReason: ReasonInvalidRelocationMap},
+		{name: "malformed json", data: map[string]string{relocationMapKey: `{"getporter/porter-hello:v0.1.1": `}, wantReason: ReasonInvalidRelocationMap},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.RelocationMapConfigMap = "hello-relocation"
+			jobName := makeJobName(inst)
+			objs := []client.Object{inst}
+			if tc.data != nil {
+				objs = append(objs, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "hello-relocation", Namespace: inst.Namespace},
+					Data:       tc.data,
+				})
+			}
+			r := newTestReconciler(t, objs...)
+
+			g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+			job := &batchv1.Job{}
+			err := r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)
+			if tc.wantReason != "" {
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+				cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+				g.Expect(cond).ToNot(BeNil())
+				g.Expect(cond.Reason).To(Equal(tc.wantReason))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			agent := job.Spec.Template.Spec.Containers[0]
+			g.Expect(agent.Args).To(ContainElement("--relocation-mapping=/porter-relocation/relocation-mapping.json"))
+			g.Expect(agent.VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: "porter-relocation", MountPath: relocationMapPath, ReadOnly: true}))
+		})
+	}
+}
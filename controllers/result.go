@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+const (
+	// resultSucceeded is the status reported by the porter agent when the run succeeded.
+	resultSucceeded = "succeeded"
+
+	// resultFailed is the status reported by the porter agent when the run failed.
+	resultFailed = "failed"
+)
+
+// getAgentResult reads the result of the porter run from the termination
+// message of the agent container. The porter agent writes the result as
+// JSON, e.g. {"action":"install","status":"succeeded","bundleVersion":"0.1.1"}.
+// When the agent failed without reporting a result, the container's
+// FallbackToLogsOnError policy puts the end of its logs in the termination
+// message, which is returned as the message of a failed result. Otherwise,
+// for example an older agent that succeeded, nil is returned.
+func (r *InstallationReconciler) getAgentResult(ctx context.Context, job *batchv1.Job) (*porterv1.InstallationResult, error) {
+	terminated, err := r.getAgentTermination(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	return r.parseAgentResult(ctx, job, terminated), nil
+}
+
+// getAgentTermination returns the terminated state of the agent container in
+// the job's pod, with its exit code and reason. When the container has not
+// terminated, or its pod was removed, nil is returned.
+func (r *InstallationReconciler) getAgentTermination(ctx context.Context, job *batchv1.Job) (*corev1.ContainerStateTerminated, error) {
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not list the pods for porter job %s/%s", job.Namespace, job.Name)
+	}
+
+	for _, pod := range pods.Items {
+		for _, c := range pod.Status.ContainerStatuses {
+			if c.Name == job.Name && c.State.Terminated != nil {
+				return c.State.Terminated, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// parseAgentResult reads the result of the porter run from the termination
+// message of the agent container, see getAgentResult.
+func (r *InstallationReconciler) parseAgentResult(ctx context.Context, job *batchv1.Job, terminated *corev1.ContainerStateTerminated) *porterv1.InstallationResult {
+	if terminated == nil || terminated.Message == "" {
+		return nil
+	}
+
+	result := &porterv1.InstallationResult{}
+	err := json.Unmarshal([]byte(terminated.Message), result)
+	if err == nil && result.Status != "" {
+		return result
+	}
+
+	r.getLogger(ctx).Info("porter job did not report a result", "job", job.Name, "exitCode", terminated.ExitCode)
+	if terminated.ExitCode != 0 {
+		return &porterv1.InstallationResult{Status: resultFailed, Message: strings.TrimSpace(terminated.Message)}
+	}
+	return nil
+}
+
+// setExitCode records the exit code of the porter agent, and the reason that
+// its container terminated, e.g. Error or OOMKilled. Both are cleared when the
+// agent's container is not found.
+func setExitCode(status *porterv1.InstallationStatus, terminated *corev1.ContainerStateTerminated) {
+	status.LastExitCode = nil
+	status.LastExitReason = ""
+	if terminated != nil {
+		exitCode := terminated.ExitCode
+		status.LastExitCode = &exitCode
+		status.LastExitReason = terminated.Reason
+	}
+}
+
+// getPhase determines the phase of the Installation from the result reported
+// by the porter agent, falling back to the status of the finished job.
+func getPhase(job *batchv1.Job, result *porterv1.InstallationResult) porterv1.InstallationPhase {
+	if result != nil {
+		switch result.Status {
+		case resultSucceeded:
+			return porterv1.PhaseSucceeded
+		case resultFailed:
+			return porterv1.PhaseFailed
+		}
+	}
+
+	if isJobFailed(job.Status) {
+		return porterv1.PhaseFailed
+	}
+	return porterv1.PhaseSucceeded
+}
@@ -0,0 +1,334 @@
+package controllers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestSetJobStatus_AgentResult(t *testing.T) {
+	testcases := []struct {
+		name       string
+		message    string
+		jobFailed  bool
+		wantPhase  porterv1.InstallationPhase
+		wantResult *porterv1.InstallationResult
+		wantDigest string
+	}{
+		{name: "no result", wantPhase: porterv1.PhaseSucceeded},
+		{name: "text logs", message: "Error: bundle not found\n", jobFailed: true, wantPhase: porterv1.PhaseFailed,
+			wantResult: &porterv1.InstallationResult{Status: "failed", Message: "Error: bundle not found"}},
+		{name: "text logs with a successful job", message: "installed porter-hello", wantPhase: porterv1.PhaseSucceeded},
+		{
+			name:       "failed with a message",
+			message:    `{"action":"install","status":"failed","message":"could not resolve the bundle"}`,
+			jobFailed:  true,
+			wantPhase:  porterv1.PhaseFailed,
+			wantResult: &porterv1.InstallationResult{Action: "install", Status: "failed", Message: "could not resolve the bundle"},
+		},
+		{
+			name:       "succeeded",
+			message:    `{"action":"install","status":"succeeded","bundleVersion":"0.1.1","bundleDigest":"sha256:abc123"}`,
+			wantPhase:  porterv1.PhaseSucceeded,
+			wantResult: &porterv1.InstallationResult{Action: "install", Status: "succeeded", BundleVersion: "0.1.1", BundleDigest: "sha256:abc123"},
+			wantDigest: "sha256:abc123",
+		},
+		{
+			name:       "failed with a successful job",
+			message:    `{"action":"install","status":"failed","bundleVersion":"0.1.1"}`,
+			wantPhase:  porterv1.PhaseFailed,
+			wantResult: &porterv1.InstallationResult{Action: "install", Status: "failed", BundleVersion: "0.1.1"},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: makeJobName(inst), Namespace: inst.Namespace}}
+			job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+			var exitCode int32
+			if tc.jobFailed {
+				job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+				exitCode = 1
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: job.Name + "-abc12", Namespace: inst.Namespace, Labels: map[string]string{"job-name": job.Name}},
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{
+						{Name: job.Name, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode, Message: tc.message}}},
+					},
+				},
+			}
+			r := newTestReconciler(t, inst, pod)
+
+			g.Expect(r.setJobStatus(context.Background(), inst, job)).To(Succeed())
+			g.Expect(inst.Status.Phase).To(Equal(tc.wantPhase))
+			g.Expect(inst.Status.Result).To(Equal(tc.wantResult))
+			g.Expect(inst.Status.InstalledBundleDigest).To(Equal(tc.wantDigest))
+		})
+	}
+}
+
+func TestSetJobStatus_ExitCode(t *testing.T) {
+	testcases := []struct {
+		name       string
+		terminated *corev1.ContainerStateTerminated
+		jobFailed  bool
+		wantCode   *int32
+		wantReason string
+	}{
+		{name: "succeeded", terminated: &corev1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed"}, wantCode: pointer.Int32Ptr(0), wantReason: "Completed"},
+		{name: "failed", terminated: &corev1.ContainerStateTerminated{ExitCode: 2, Reason: "Error"}, jobFailed: true, wantCode: pointer.Int32Ptr(2), wantReason: "Error"},
+		{name: "out of memory", terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}, jobFailed: true, wantCode: pointer.Int32Ptr(137), wantReason: "OOMKilled"},
+		{name: "pod removed", jobFailed: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			// Left from a previous run
+			inst.Status.LastExitCode = pointer.Int32Ptr(1)
+			inst.Status.LastExitReason = "Error"
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: makeJobName(inst), Namespace: inst.Namespace}}
+			job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+			if tc.jobFailed {
+				job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+			}
+			objs := []client.Object{inst}
+			if tc.terminated != nil {
+				objs = append(objs, &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: job.Name + "-abc12", Namespace: inst.Namespace, Labels: map[string]string{"job-name": job.Name}},
+					Status: corev1.PodStatus{
+						ContainerStatuses: []corev1.ContainerStatus{
+							{Name: job.Name, State: corev1.ContainerState{Terminated: tc.terminated}},
+						},
+					},
+				})
+			}
+			r := newTestReconciler(t, objs...)
+
+			g.Expect(r.setJobStatus(context.Background(), inst, job)).To(Succeed())
+			g.Expect(inst.Status.LastExitCode).To(Equal(tc.wantCode))
+			g.Expect(inst.Status.LastExitReason).To(Equal(tc.wantReason))
+		})
+	}
+}
+
+// fakePorter stands in for porter in runAgentScript. It fails the command
+// with FAKE_PORTER_ERROR when it is set.
+const fakePorter = `#!/bin/sh
+case "$1 $2" in
+  "version "*) echo "porter v1.0.0" ;;
+  "installation show") printf '{\n  "name": "%s",\n  "status": {\n    "bundleVersion": "0.1.1",\n    "bundleDigest": "sha256:abc123"\n  }\n}\n' "$3" ;;
+  "installation outputs") echo '[{"name": "greeting", "value": "hello"}]' ;;
+  *)
+    echo "running porter $*"
+    if [ -n "${FAKE_PORTER_ERROR:-}" ]; then
+      printf '%b\n' "$FAKE_PORTER_ERROR" >&2
+      exit 2
+    fi
+    ;;
+esac
+`
+
+// runAgentScript runs the porter agent's script, images/porter/run.sh, with
+// a fake porter, and returns its logs, termination message and exit code.
+func runAgentScript(t *testing.T, env []string, args ...string) (string, string, int) {
+	g := NewWithT(t)
+	shell, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run the agent script")
+	}
+
+	dir := t.TempDir()
+	for _, d := range []string{"bin", "porter-config", "porter-home"} {
+		g.Expect(os.Mkdir(filepath.Join(dir, d), 0755)).To(Succeed())
+	}
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "bin", "porter"), []byte(fakePorter), 0755)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "porter-config", "config.toml"), []byte("verbosity = \"debug\"\n"), 0644)).To(Succeed())
+	script, err := ioutil.ReadFile(filepath.Join("..", "images", "porter", "run.sh"))
+	g.Expect(err).ToNot(HaveOccurred())
+	script = []byte(strings.Replace(string(script), "/porter-config/", filepath.Join(dir, "porter-config")+"/", -1))
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "run.sh"), script, 0755)).To(Succeed())
+
+	cmd := exec.Command(shell, append([]string{filepath.Join(dir, "run.sh")}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append([]string{
+		"PATH=" + filepath.Join(dir, "bin") + string(os.PathListSeparator) + os.Getenv("PATH"),
+		"TERMINATION_LOG=" + filepath.Join(dir, "termination-log"),
+		"PORTER_HOME=" + filepath.Join(dir, "porter-home"),
+	}, env...)
+	logs, err := cmd.CombinedOutput()
+	exitCode := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = exitErr.ExitCode()
+	} else {
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+	termination, err := ioutil.ReadFile(filepath.Join(dir, "termination-log"))
+	if !os.IsNotExist(err) {
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+	return string(logs), string(termination), exitCode
+}
+
+func TestRunScript_Result(t *testing.T) {
+	testcases := []struct {
+		name         string
+		args         []string
+		env          []string
+		wantExitCode int
+		wantResult   *porterv1.InstallationResult
+	}{
+		{
+			name:       "succeeded",
+			args:       []string{"install", "hello"},
+			env:        []string{"PORTER_RESULT_ACTION=install", "PORTER_INSTALLATION=hello"},
+			wantResult: &porterv1.InstallationResult{Action: "install", Status: "succeeded", BundleVersion: "0.1.1", BundleDigest: "sha256:abc123"},
+		},
+		{
+			name:       "explain",
+			args:       []string{"explain", "--reference=getporter/porter-hello:v0.1.1"},
+			env:        []string{"PORTER_RESULT_ACTION=explain"},
+			wantResult: &porterv1.InstallationResult{Action: "explain", Status: "succeeded"},
+		},
+		{
+			name:         "failed",
+			args:         []string{"upgrade", "hello"},
+			env:          []string{"PORTER_RESULT_ACTION=upgrade", "PORTER_INSTALLATION=hello", `FAKE_PORTER_ERROR=\033[31mError:\033[0m parameter "name" is invalid\n\tmust be a string`},
+			wantExitCode: 2,
+			wantResult: &porterv1.InstallationResult{Action: "upgrade", Status: "failed", BundleVersion: "0.1.1", BundleDigest: "sha256:abc123",
+				Message: "running porter upgrade hello\n[31mError:[0m parameter \"name\" is invalid\nmust be a string"},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			logs, termination, exitCode := runAgentScript(t, tc.env, tc.args...)
+			g.Expect(exitCode).To(Equal(tc.wantExitCode), logs)
+
+			inst := newTestInstallation()
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: makeJobName(inst), Namespace: inst.Namespace}}
+			r := newTestReconciler(t)
+			result := r.parseAgentResult(context.Background(), job, &corev1.ContainerStateTerminated{ExitCode: int32(exitCode), Message: termination})
+			g.Expect(result).To(Equal(tc.wantResult), termination)
+		})
+	}
+}
+
+// TestSetJobStatus_RunScript records the result that the agent's script
+// reports in the Installation's status.
+func TestSetJobStatus_RunScript(t *testing.T) {
+	testcases := []struct {
+		name       string
+		env        []string
+		wantPhase  porterv1.InstallationPhase
+		wantResult *porterv1.InstallationResult
+	}{
+		{
+			name:       "succeeded",
+			wantPhase:  porterv1.PhaseSucceeded,
+			wantResult: &porterv1.InstallationResult{Action: "install", Status: "succeeded", BundleVersion: "0.1.1", BundleDigest: "sha256:abc123"},
+		},
+		{
+			name:       "failed",
+			env:        []string{"FAKE_PORTER_ERROR=Error: parameter name is required"},
+			wantPhase:  porterv1.PhaseFailed,
+			wantResult: &porterv1.InstallationResult{Action: "install", Status: "failed", BundleVersion: "0.1.1", BundleDigest: "sha256:abc123", Message: "running porter install hello\nError: parameter name is required"},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: makeJobName(inst), Namespace: inst.Namespace}}
+			// The job's status alone would report success
+			job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+			_, termination, exitCode := runAgentScript(t, append([]string{"PORTER_RESULT_ACTION=install", "PORTER_INSTALLATION=hello"}, tc.env...), "install", "hello")
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: job.Name + "-abc12", Namespace: inst.Namespace, Labels: map[string]string{"job-name": job.Name}},
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{
+						{Name: job.Name, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: int32(exitCode), Message: termination}}},
+					},
+				},
+			}
+			r := newTestReconciler(t, inst, pod)
+
+			g.Expect(r.setJobStatus(context.Background(), inst, job)).To(Succeed())
+			g.Expect(inst.Status.Phase).To(Equal(tc.wantPhase))
+			g.Expect(inst.Status.Result).To(Equal(tc.wantResult))
+		})
+	}
+}
+
+func TestCreateJobForInstallation_AgentResultEnv(t *testing.T) {
+	testcases := []struct {
+		name         string
+		action       string
+		validateOnly bool
+		namespace    string
+		wantEnv      []corev1.EnvVar
+	}{
+		{name: "install", action: "install", wantEnv: []corev1.EnvVar{
+			{Name: "PORTER_RESULT_ACTION", Value: "install"},
+			{Name: "PORTER_INSTALLATION", Value: "hello"},
+			{Name: "PORTER_PUBLISH_OUTPUTS", Value: "true"},
+		}},
+		{name: "custom action", action: "deploy", wantEnv: []corev1.EnvVar{
+			{Name: "PORTER_RESULT_ACTION", Value: "deploy"},
+			{Name: "PORTER_INSTALLATION", Value: "hello"},
+			{Name: "PORTER_PUBLISH_OUTPUTS", Value: "true"},
+		}},
+		{name: "porter namespace", action: "install", namespace: "dev", wantEnv: []corev1.EnvVar{
+			{Name: "PORTER_RESULT_ACTION", Value: "install"},
+			{Name: "PORTER_INSTALLATION", Value: "hello"},
+			{Name: "PORTER_INSTALLATION_NAMESPACE", Value: "dev"},
+			{Name: "PORTER_PUBLISH_OUTPUTS", Value: "true"},
+		}},
+		{name: "uninstall", action: "uninstall", wantEnv: []corev1.EnvVar{
+			{Name: "PORTER_RESULT_ACTION", Value: "uninstall"},
+			{Name: "PORTER_INSTALLATION", Value: "hello"},
+		}},
+		{name: "validate only", action: "install", validateOnly: true, wantEnv: []corev1.EnvVar{
+			{Name: "PORTER_RESULT_ACTION", Value: "explain"},
+		}},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.Action = tc.action
+			inst.Spec.ValidateOnly = tc.validateOnly
+			inst.Spec.PorterNamespace = tc.namespace
+			jobName := makeJobName(inst)
+			r := newTestReconciler(t, inst)
+
+			g.Expect(r.createJobForInstallation(context.Background(), jobName, inst, nil)).To(Succeed())
+
+			job := &batchv1.Job{}
+			g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: jobName}, job)).To(Succeed())
+			var env []corev1.EnvVar
+			for _, e := range job.Spec.Template.Spec.Containers[0].Env {
+				if strings.HasPrefix(e.Name, "PORTER_RESULT_") || strings.HasPrefix(e.Name, "PORTER_INSTALLATION") || e.Name == "PORTER_PUBLISH_OUTPUTS" {
+					env = append(env, e)
+				}
+			}
+			g.Expect(env).To(Equal(tc.wantEnv))
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// reconcileRetryFailed handles the porter.sh/retry-failed annotation. When
+// the last run of the Installation failed, its porter.sh/rerun annotation is
+// changed so that the action runs again. The annotation is removed either
+// way, so that it does not retry a later failure of an Installation that had
+// succeeded when it was set.
+func (r *InstallationReconciler) reconcileRetryFailed(ctx context.Context, inst *porterv1.Installation) error {
+	retry, ok := inst.Annotations[porterv1.AnnotationRetryFailed]
+	if !ok {
+		return nil
+	}
+
+	delete(inst.Annotations, porterv1.AnnotationRetryFailed)
+	failed := inst.IsDone() && inst.Status.Phase == porterv1.PhaseFailed
+	if failed {
+		// Each rerun value only runs once
+		if retry == "" || retry == inst.GetRerun() {
+			retry = strconv.FormatInt(time.Now().Unix(), 10)
+		}
+		inst.Annotations[porterv1.AnnotationRerun] = retry
+	}
+	err := r.Update(ctx, inst)
+	if err != nil {
+		return errors.Wrapf(err, "could not update the annotations of Installation %s/%s", inst.Namespace, inst.Name)
+	}
+
+	if failed {
+		r.getLogger(ctx).Info("retrying failed Installation", "rerun", retry)
+		r.Recorder.Eventf(inst, corev1.EventTypeNormal, ReasonRetryFailed, "Retrying the failed Installation with rerun %s", retry)
+	}
+	return nil
+}
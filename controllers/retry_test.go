@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestReconcileRetryFailed(t *testing.T) {
+	testcases := []struct {
+		name      string
+		phase     porterv1.InstallationPhase
+		retry     string
+		rerun     string
+		wantRerun string
+	}{
+		{name: "failed", phase: porterv1.PhaseFailed, retry: "1", wantRerun: "1"},
+		{name: "failed with the same value", phase: porterv1.PhaseFailed, retry: "1", rerun: "1"},
+		{name: "succeeded", phase: porterv1.PhaseSucceeded, retry: "1", rerun: "0", wantRerun: "0"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Annotations = map[string]string{porterv1.AnnotationRetryFailed: tc.retry}
+			if tc.rerun != "" {
+				inst.Annotations[porterv1.AnnotationRerun] = tc.rerun
+			}
+			inst.Status.ObservedGeneration = inst.Generation
+			inst.Status.ObservedRerun = tc.rerun
+			inst.Status.Phase = tc.phase
+			r := newTestReconciler(t, inst)
+
+			err := r.reconcileRetryFailed(context.Background(), inst)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			updated := &porterv1.Installation{}
+			g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(inst), updated)).To(Succeed())
+			g.Expect(updated.Annotations).ToNot(HaveKey(porterv1.AnnotationRetryFailed), "the annotation should be removed once handled")
+			if tc.wantRerun != "" {
+				g.Expect(updated.GetRerun()).To(Equal(tc.wantRerun))
+			} else {
+				g.Expect(updated.GetRerun()).ToNot(Equal(tc.rerun), "a new rerun value should be used")
+			}
+			g.Expect(updated.IsDone()).To(Equal(tc.phase != porterv1.PhaseFailed))
+		})
+	}
+}
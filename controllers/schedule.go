@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// reconcileSchedule runs the Installation's action, or its ReconcileAction
+// when set, when a scheduled run is due, and requeues the Installation for its next scheduled time. Runs that
+// were missed, because the operator was not running or a previous job had not
+// completed, are skipped and only the most recent one is run.
+func (r *InstallationReconciler) reconcileSchedule(ctx context.Context, inst *porterv1.Installation) (ctrl.Result, error) {
+	schedule, err := cron.ParseStandard(inst.Spec.Schedule)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid schedule %q: %s", inst.Spec.Schedule, err)
+		r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonInvalidSchedule, msg)
+		// Wait for the Installation to be fixed instead of retrying
+		return ctrl.Result{}, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonInvalidSchedule, msg)
+	}
+
+	now := time.Now()
+	due := getMostRecentSchedule(schedule, inst, now)
+	next := schedule.Next(now)
+	result := ctrl.Result{RequeueAfter: next.Sub(now)}
+	if due == nil {
+		r.getLogger(ctx).Info("next run of Installation is scheduled", "next", next)
+		return result, nil
+	}
+
+	inst.Status.LastScheduledTime = &metav1.Time{Time: *due}
+
+	jobs, err := r.listJobs(ctx, inst)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if activeJob := getActiveJob(jobs); activeJob != nil {
+		msg := fmt.Sprintf("Skipped the run scheduled for %s because porter job %s is still running", due.Format(time.RFC3339), activeJob.Name)
+		r.getLogger(ctx).Info("skipped scheduled run", "reason", msg)
+		r.Recorder.Event(inst, corev1.EventTypeNormal, ReasonScheduledRunSkipped, msg)
+	} else {
+		jobName, err := r.getJobName(ctx, inst, makeName(inst.Name, fmt.Sprintf("%s/%d/%s", inst.Name, inst.Generation, strconv.FormatInt(due.Unix(), 10))))
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		run, jobLabels := inst, map[string]string(nil)
+		if inst.Spec.ReconcileAction != "" {
+			// porter invoke INSTALLATION_NAME --action=RECONCILE_ACTION, or
+			// the matching porter command for a core action
+			run = inst.DeepCopy()
+			run.Spec.Action = inst.Spec.ReconcileAction
+			run.Spec.Apply = false
+			jobLabels = map[string]string{labelReconcileAction: "true"}
+		}
+		// The scheduled run is not recorded until the job is created
+		runResult, err := r.runJob(ctx, jobName, run, jobLabels)
+		if run != inst {
+			inst.ResourceVersion = run.ResourceVersion
+			inst.Status = *run.Status.DeepCopy()
+		}
+		if err != nil || !runResult.IsZero() {
+			return runResult, err
+		}
+	}
+
+	return result, r.updateStatus(ctx, inst)
+}
+
+// getMostRecentSchedule returns the latest scheduled time, since the last
+// scheduled run of the Installation, that is due. Nil is returned when no
+// run is due.
+func getMostRecentSchedule(schedule cron.Schedule, inst *porterv1.Installation, now time.Time) *time.Time {
+	last := inst.CreationTimestamp.Time
+	if inst.Status.LastScheduledTime != nil {
+		last = inst.Status.LastScheduledTime.Time
+	}
+
+	var due *time.Time
+	for t := schedule.Next(last); !t.After(now); t = schedule.Next(t) {
+		scheduled := t
+		due = &scheduled
+	}
+	return due
+}
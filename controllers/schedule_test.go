@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestGetMostRecentSchedule(t *testing.T) {
+	schedule, err := cron.ParseStandard("0 2 * * *")
+	NewWithT(t).Expect(err).ToNot(HaveOccurred())
+
+	created := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(day, hour int) time.Time { return time.Date(2021, 1, day, hour, 0, 0, 0, time.UTC) }
+
+	testcases := []struct {
+		name          string
+		lastScheduled *time.Time
+		now           time.Time
+		want          *time.Time
+	}{
+		{name: "not due yet", now: at(2, 1)},
+		{name: "first run due", now: at(2, 3), want: timePtr(at(2, 2))},
+		{name: "already ran", lastScheduled: timePtr(at(2, 2)), now: at(2, 3)},
+		{name: "missed runs are skipped", lastScheduled: timePtr(at(2, 2)), now: at(5, 3), want: timePtr(at(5, 2))},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := &porterv1.Installation{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)}}
+			if tc.lastScheduled != nil {
+				inst.Status.LastScheduledTime = &metav1.Time{Time: *tc.lastScheduled}
+			}
+
+			due := getMostRecentSchedule(schedule, inst, tc.now)
+			if tc.want == nil {
+				g.Expect(due).To(BeNil())
+			} else {
+				g.Expect(due).ToNot(BeNil())
+				g.Expect(*due).To(BeTemporally("==", *tc.want))
+			}
+		})
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// getSchedulingFailure returns why the porter agent pod cannot be scheduled,
+// for example insufficient resources or no node matching its node selector.
+// An empty message is returned when the pod is scheduled, or still waiting
+// for the scheduler.
+func (r *InstallationReconciler) getSchedulingFailure(ctx context.Context, job *batchv1.Job) (string, error) {
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name})
+	if err != nil {
+		return "", errors.Wrapf(err, "could not list the pods for porter job %s/%s", job.Namespace, job.Name)
+	}
+
+	for _, pod := range pods.Items {
+		for _, c := range pod.Status.Conditions {
+			if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse && c.Reason == corev1.PodReasonUnschedulable {
+				return fmt.Sprintf("Could not schedule the pod for porter job %s: %s", job.Name, c.Message), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// checkScheduling reports on the Installation, with the SchedulingFailed
+// condition, when the porter agent pod cannot be scheduled, instead of the
+// job never starting without explanation. The condition is cleared once the
+// pod is scheduled.
+func (r *InstallationReconciler) checkScheduling(ctx context.Context, inst *porterv1.Installation, job *batchv1.Job) (bool, error) {
+	msg, err := r.getSchedulingFailure(ctx, job)
+	if err != nil {
+		return false, err
+	}
+
+	existing := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionSchedulingFailed)
+	failing := existing != nil && existing.Status == metav1.ConditionTrue
+	if msg == "" {
+		if failing {
+			return false, r.setCondition(ctx, inst, porterv1.ConditionSchedulingFailed, metav1.ConditionFalse, ReasonScheduled, "Scheduled the pod for porter job "+job.Name)
+		}
+		return false, nil
+	}
+
+	r.getLogger(ctx).Info("porter job is waiting on a pod that cannot be scheduled", "job", job.Name, "reason", msg)
+	if !failing || existing.Message != msg {
+		r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonUnschedulable, msg)
+	}
+	return true, r.setCondition(ctx, inst, porterv1.ConditionSchedulingFailed, metav1.ConditionTrue, ReasonUnschedulable, msg)
+}
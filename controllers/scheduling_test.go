@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestCheckScheduling(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: makeJobName(inst), Namespace: inst.Namespace}}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: job.Name + "-abc12", Namespace: inst.Namespace, Labels: map[string]string{"job-name": job.Name}},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodPending,
+			Conditions: []corev1.PodCondition{
+				{
+					Type:    corev1.PodScheduled,
+					Status:  corev1.ConditionFalse,
+					Reason:  corev1.PodReasonUnschedulable,
+					Message: "0/3 nodes are available: 3 Insufficient memory.",
+				},
+			},
+		},
+	}
+	r := newTestReconciler(t, inst, pod)
+	recorder := r.Recorder.(*record.FakeRecorder)
+
+	unschedulable, err := r.checkScheduling(context.Background(), inst, job)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(unschedulable).To(BeTrue())
+	cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionSchedulingFailed)
+	g.Expect(cond).ToNot(BeNil())
+	g.Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+	g.Expect(cond.Reason).To(Equal(ReasonUnschedulable))
+	g.Expect(cond.Message).To(ContainSubstring("3 Insufficient memory"))
+	g.Expect(recorder.Events).To(HaveLen(1))
+
+	// The event is only recorded once while the pod is pending
+	_, err = r.checkScheduling(context.Background(), inst, job)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(recorder.Events).To(HaveLen(1))
+
+	// Clear the condition once the pod is scheduled
+	pod.Status.Conditions[0] = corev1.PodCondition{Type: corev1.PodScheduled, Status: corev1.ConditionTrue}
+	g.Expect(r.Status().Update(context.Background(), pod)).To(Succeed())
+	unschedulable, err = r.checkScheduling(context.Background(), inst, job)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(unschedulable).To(BeFalse())
+	cond = meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionSchedulingFailed)
+	g.Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+	g.Expect(cond.Reason).To(Equal(ReasonScheduled))
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// getStabilizationDelay returns how long to wait after an Installation is
+// created or changed before running it. When zero, it runs right away.
+func (r *InstallationReconciler) getStabilizationDelay(ctx context.Context, cfg porterConfig) (time.Duration, error) {
+	v, source, ok := cfg.get("stabilizationDelay")
+	if !ok {
+		return 0, nil
+	}
+
+	delay, err := time.ParseDuration(v)
+	if err != nil || delay < 0 {
+		return 0, invalidSettingf("invalid stabilizationDelay %q in %s, must be a duration, e.g. 30s", v, source)
+	}
+	r.getLogger(ctx).Info("installation stabilization delay defaulted", "source", source, "stabilizationDelay", delay)
+	return delay, nil
+}
+
+// waitForStabilization delays running a new generation of the Installation
+// until the stabilizationDelay has passed since it was first seen, and
+// records when it will run in the status. Each change to the Installation
+// while it waits starts the delay again, so that quick successive edits, or a
+// bulk apply, result in one run. The time left to wait is returned.
+func (r *InstallationReconciler) waitForStabilization(ctx context.Context, inst *porterv1.Installation) (time.Duration, error) {
+	delay, err := r.getStabilizationDelay(ctx, r.getPorterConfig(ctx, inst))
+	if err != nil || delay <= 0 {
+		return 0, err
+	}
+
+	now := time.Now()
+	if inst.Status.PendingGeneration != inst.Generation || inst.Status.PendingRunTime == nil {
+		r.getLogger(ctx).Info("waiting for the Installation to stabilize before running it", "stabilizationDelay", delay)
+		inst.Status.PendingGeneration = inst.Generation
+		inst.Status.PendingRunTime = &metav1.Time{Time: now.Add(delay)}
+		return delay, r.updateStatus(ctx, inst)
+	}
+
+	if wait := inst.Status.PendingRunTime.Sub(now); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestReconcile_StabilizationDelay(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	r := newTestReconciler(t, inst)
+	r.Defaults = map[string]string{"stabilizationDelay": "1m"}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(inst)}
+
+	jobExists := func() bool {
+		err := r.Get(context.Background(), client.ObjectKey{Namespace: inst.Namespace, Name: makeJobName(inst)}, &batchv1.Job{})
+		g.Expect(err == nil || apierrors.IsNotFound(err)).To(BeTrue())
+		return err == nil
+	}
+
+	// The first reconcile starts the delay
+	result, err := r.Reconcile(context.Background(), req)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.RequeueAfter).To(Equal(time.Minute))
+	g.Expect(jobExists()).To(BeFalse(), "the job should wait for the delay")
+	g.Expect(r.Get(context.Background(), req.NamespacedName, inst)).To(Succeed())
+	g.Expect(inst.Status.PendingGeneration).To(Equal(inst.Generation))
+	g.Expect(inst.Status.PendingRunTime).ToNot(BeNil())
+
+	// A change restarts the delay
+	inst.Generation = 2
+	inst.Status.PendingRunTime = &metav1.Time{Time: time.Now().Add(-time.Second)}
+	g.Expect(r.Update(context.Background(), inst)).To(Succeed())
+	g.Expect(r.Status().Update(context.Background(), inst)).To(Succeed())
+	result, err = r.Reconcile(context.Background(), req)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.RequeueAfter).To(Equal(time.Minute))
+	g.Expect(r.Get(context.Background(), req.NamespacedName, inst)).To(Succeed())
+	g.Expect(inst.Status.PendingGeneration).To(Equal(int64(2)))
+
+	// Once the delay has passed, the job is created
+	inst.Status.PendingRunTime = &metav1.Time{Time: time.Now().Add(-time.Second)}
+	g.Expect(r.Status().Update(context.Background(), inst)).To(Succeed())
+	_, err = r.Reconcile(context.Background(), req)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(jobExists()).To(BeTrue())
+	updated := &porterv1.Installation{}
+	g.Expect(r.Get(context.Background(), req.NamespacedName, updated)).To(Succeed())
+	g.Expect(updated.Status.PendingRunTime).To(BeNil(), "the pending run has started")
+	g.Expect(updated.Status.Phase).To(Equal(porterv1.PhaseRunning))
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// updateStatus saves the Installation's status. The operator owns the
+// status, so when the update conflicts with a concurrent change to the
+// Installation, the status is written again on the latest version instead of
+// failing the reconcile. Only the resource version of the Installation is
+// updated, the caller keeps working with the spec that it read.
+func (r *InstallationReconciler) updateStatus(ctx context.Context, inst *porterv1.Installation) error {
+	ctx, span := r.startSpan(ctx, "updateStatus")
+	defer span.End()
+
+	status := inst.Status.DeepCopy()
+	target := inst
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := r.Status().Update(ctx, target)
+		if !apierrors.IsConflict(err) {
+			return err
+		}
+
+		latest := &porterv1.Installation{}
+		if getErr := r.Get(ctx, client.ObjectKeyFromObject(inst), latest); getErr != nil {
+			return getErr
+		}
+		latest.Status = *status.DeepCopy()
+		target = latest
+		return err
+	})
+	if err == nil && target != inst {
+		r.getLogger(ctx).V(1).Info("retried the status update after a conflict")
+		inst.ResourceVersion = target.ResourceVersion
+	}
+	err = errors.Wrapf(err, "could not update the status of Installation %s/%s", inst.Namespace, inst.Name)
+	recordSpanError(span, err)
+	return err
+}
+
+// setCondition sets a condition on the Installation's status. The status is
+// only saved when the condition has changed, so that reconciling an unchanged
+// Installation does not trigger another reconcile.
+func (r *InstallationReconciler) setCondition(ctx context.Context, inst *porterv1.Installation, conditionType string, status metav1.ConditionStatus, reason string, message string) error {
+	existing := meta.FindStatusCondition(inst.Status.Conditions, conditionType)
+	if existing != nil && existing.Status == status && existing.Reason == reason &&
+		existing.Message == message && existing.ObservedGeneration == inst.Generation {
+		return nil
+	}
+
+	meta.SetStatusCondition(&inst.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: inst.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+	// SetStatusCondition does not update the generation of an existing condition
+	meta.FindStatusCondition(inst.Status.Conditions, conditionType).ObservedGeneration = inst.Generation
+
+	return r.updateStatus(ctx, inst)
+}
+
+// setJobStatus records the Installation's job in its status. A job that is
+// still running is the ActiveJob, and once it is done it becomes the LastJob.
+func (r *InstallationReconciler) setJobStatus(ctx context.Context, inst *porterv1.Installation, job *batchv1.Job) error {
+	before := inst.Status.DeepCopy()
+	if gen, ok := getJobGeneration(job, inst); ok {
+		inst.Status.ObservedGeneration = gen
+		inst.Status.ObservedRerun = job.Annotations[porterv1.AnnotationRerun]
+		// The pending run has started
+		if gen == inst.Status.PendingGeneration {
+			inst.Status.PendingRunTime = nil
+		}
+	}
+	inst.Status.Phase = porterv1.PhaseRunning
+	if isJobDone(job.Status) {
+		terminated, err := r.getAgentTermination(ctx, job)
+		if err != nil {
+			return err
+		}
+		result := r.parseAgentResult(ctx, job, terminated)
+
+		if inst.Status.ActiveJob.Name == job.Name {
+			inst.Status.ActiveJob = corev1.LocalObjectReference{}
+		}
+		inst.Status.LastJob = corev1.LocalObjectReference{Name: job.Name}
+		inst.Status.Phase = getPhase(job, result)
+		inst.Status.Result = result
+		setExitCode(&inst.Status, terminated)
+		if inst.Spec.ValidateOnly {
+			// Nothing was deployed, only the bundle's explanation is recorded
+			inst.Status.Explanation = nil
+			if inst.Status.Phase == porterv1.PhaseSucceeded {
+				inst.Status.Explanation = r.getExplanation(ctx, job)
+			}
+		} else {
+			inst.Status.Dependencies = r.getDependencyStatus(ctx, inst, result, inst.Status.Phase == porterv1.PhaseSucceeded)
+		}
+		if inst.Status.Phase == porterv1.PhaseSucceeded && !inst.Spec.ValidateOnly {
+			setInstalledBundle(&inst.Status, job, result)
+			setInstalled(&inst.Status, inst, job)
+		}
+	} else {
+		inst.Status.ActiveJob = corev1.LocalObjectReference{Name: job.Name}
+	}
+	setRunTimes(&inst.Status, job, before.LastJob.Name != job.Name)
+	if equality.Semantic.DeepEqual(before, &inst.Status) {
+		return nil
+	}
+
+	return r.updateStatus(ctx, inst)
+}
+
+// setInstalledBundle keeps a record of the bundle that a job that succeeded
+// deployed, which the Reference may not pin down. The version and digest that
+// the porter agent reports are used, falling back to the ones that the
+// operator resolved when it created the job. The previous record is kept when
+// neither is known, for jobs created before the operator recorded them.
+func setInstalledBundle(status *porterv1.InstallationStatus, job *batchv1.Job, result *porterv1.InstallationResult) {
+	version, hasVersion := job.Annotations[annotationBundleVersion]
+	digest, hasDigest := job.Annotations[annotationBundleDigest]
+	if result == nil && !hasVersion && !hasDigest {
+		return
+	}
+	if result != nil && result.BundleVersion != "" {
+		version = result.BundleVersion
+	}
+	if result != nil && result.BundleDigest != "" {
+		digest = result.BundleDigest
+	}
+	status.InstalledBundleVersion = version
+	status.InstalledBundleDigest = digest
+}
+
+// setInstalled records whether the bundle is installed after a job that
+// succeeded, and which bundle, so that the action of the Installation's next
+// run can be inferred. Applying an installation file installs or upgrades the
+// bundle. The action and apply are read from the job, the Installation may
+// have changed since the job was created.
+func setInstalled(status *porterv1.InstallationStatus, inst *porterv1.Installation, job *batchv1.Job) {
+	action, hasAction := job.Annotations[annotationAction]
+	apply := job.Annotations[annotationApply] == "true"
+	if !hasAction && !apply {
+		// Jobs created before the action and apply annotations were added
+		action = inst.Spec.Action
+		apply = inst.Spec.Apply
+	}
+	switch {
+	case apply, action == "install", action == "upgrade":
+		status.Installed = true
+		if reference := job.Annotations[annotationReference]; reference != "" {
+			status.InstalledBundleReference = reference
+		}
+	case action == "uninstall":
+		status.Installed = false
+		status.InstalledBundleReference = ""
+	}
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// conflictClient rejects the first status updates with a conflict, as if
+// the Installation was changed concurrently.
+type conflictClient struct {
+	client.Client
+	conflicts int
+}
+
+func (c *conflictClient) Status() client.StatusWriter {
+	return conflictStatusWriter{StatusWriter: c.Client.Status(), client: c}
+}
+
+type conflictStatusWriter struct {
+	client.StatusWriter
+	client *conflictClient
+}
+
+func (w conflictStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if w.client.conflicts > 0 {
+		w.client.conflicts--
+		return apierrors.NewConflict(schema.GroupResource{Group: porterv1.GroupVersion.Group, Resource: "installations"}, obj.GetName(), errors.New("the object has been modified"))
+	}
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
+
+func TestUpdateStatus_Conflict(t *testing.T) {
+	testcases := []struct {
+		name      string
+		conflicts int
+		wantErr   bool
+	}{
+		{name: "no conflict"},
+		{name: "conflicts", conflicts: 2},
+		{name: "too many conflicts", conflicts: 100, wantErr: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			r := newTestReconciler(t, inst)
+			r.Client = &conflictClient{Client: r.Client, conflicts: tc.conflicts}
+
+			// Someone else changed the Installation after it was read
+			latest := &porterv1.Installation{}
+			g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(inst), latest)).To(Succeed())
+			latest.Labels = map[string]string{"team": "blue"}
+			g.Expect(r.Update(context.Background(), latest)).To(Succeed())
+
+			inst.Status.Phase = porterv1.PhaseRunning
+			err := r.updateStatus(context.Background(), inst)
+			if tc.wantErr {
+				g.Expect(apierrors.IsConflict(err)).To(BeTrue(), "the conflict should be returned once the retries run out")
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			updated := &porterv1.Installation{}
+			g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(inst), updated)).To(Succeed())
+			g.Expect(updated.Status.Phase).To(Equal(porterv1.PhaseRunning))
+			g.Expect(updated.Labels).To(HaveKeyWithValue("team", "blue"), "the concurrent change should be kept")
+			g.Expect(inst.ResourceVersion).To(Equal(updated.ResourceVersion))
+		})
+	}
+}
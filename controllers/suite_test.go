@@ -48,7 +48,7 @@ var _ = BeforeSuite(func(done Done) {
 
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
-		UseExistingCluster: pointer.BoolPtr(true),
+		UseExistingCluster: pointer.BoolPtr(useExistingCluster()),
 		CRDDirectoryPaths:  []string{filepath.Join("..", "config", "crd", "bases")},
 	}
 
@@ -71,8 +71,9 @@ var _ = BeforeSuite(func(done Done) {
 	Expect(err).ToNot(HaveOccurred())
 
 	err = (&controllers.InstallationReconciler{
-		Client: k8sManager.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Installation"),
+		Client:   k8sManager.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("Installation"),
+		Recorder: k8sManager.GetEventRecorderFor("installation-controller"),
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
@@ -104,6 +105,13 @@ var _ = AfterEach(func() {
 	deleteNamespace(testNamespace)
 }, 5)
 
+// useExistingCluster determines if the tests run against a real cluster,
+// USE_EXISTING_CLUSTER=true, or against a local API server started by envtest.
+// Envtest does not run any controllers, so the porter jobs never execute.
+func useExistingCluster() bool {
+	return os.Getenv("USE_EXISTING_CLUSTER") == "true"
+}
+
 func createTestNamespace(ctx context.Context) string {
 	ns := &v1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// parameterTemplateData are the variables available to parameter templates,
+// e.g. {{ .Namespace }}.
+type parameterTemplateData struct {
+	// Name of the Installation.
+	Name string
+
+	// Namespace of the Installation.
+	Namespace string
+
+	clusterName string
+}
+
+// ClusterName is the clusterName from the porter ConfigMap, since Kubernetes
+// does not know the name of the cluster. Using it when it is not configured
+// is an error.
+func (d parameterTemplateData) ClusterName() (string, error) {
+	if d.clusterName == "" {
+		return "", errors.New("clusterName is not set in the porter configmap")
+	}
+	return d.clusterName, nil
+}
+
+// renderParameters returns the Installation to run with the templates in its
+// parameters and string parameterValues resolved, e.g. name={{ .Namespace }}.
+// The Installation is returned as is when it does not use templates. When a
+// template is invalid, the Installation is marked as failed and false is
+// returned.
+func (r *InstallationReconciler) renderParameters(ctx context.Context, inst *porterv1.Installation) (*porterv1.Installation, bool, error) {
+	if !usesParameterTemplates(inst) {
+		return inst, true, nil
+	}
+
+	cfg := r.getPorterConfig(ctx, inst)
+	clusterName, _, _ := cfg.get("clusterName")
+	data := parameterTemplateData{Name: inst.Name, Namespace: inst.Namespace, clusterName: clusterName}
+
+	rendered := inst.DeepCopy()
+	for i, p := range inst.Spec.Parameters {
+		// Only NAME=VALUE parameters, and not named parameter sets, are templates
+		if !strings.Contains(p, "=") {
+			continue
+		}
+		v, err := renderParameterTemplate(p, data)
+		if err != nil {
+			ok, err := r.failParameterTemplate(ctx, inst, fmt.Sprintf("Invalid template in parameter %s: %s", strings.SplitN(p, "=", 2)[0], err))
+			return inst, ok, err
+		}
+		rendered.Spec.Parameters[i] = v
+	}
+	for name, value := range inst.Spec.ParameterValues {
+		var s string
+		if json.Unmarshal(value.Raw, &s) != nil {
+			continue
+		}
+		v, err := renderParameterTemplate(s, data)
+		if err != nil {
+			ok, err := r.failParameterTemplate(ctx, inst, fmt.Sprintf("Invalid template in parameter %s: %s", name, err))
+			return inst, ok, err
+		}
+		// Marshaling a string does not fail
+		raw, _ := json.Marshal(v)
+		rendered.Spec.ParameterValues[name] = apiextensionsv1.JSON{Raw: raw}
+	}
+	return rendered, true, nil
+}
+
+// usesParameterTemplates determines if any of the Installation's parameters
+// have a template.
+func usesParameterTemplates(inst *porterv1.Installation) bool {
+	for _, p := range inst.Spec.Parameters {
+		if strings.Contains(p, "{{") {
+			return true
+		}
+	}
+	for _, v := range inst.Spec.ParameterValues {
+		if strings.Contains(string(v.Raw), "{{") {
+			return true
+		}
+	}
+	return false
+}
+
+func renderParameterTemplate(text string, data parameterTemplateData) (string, error) {
+	tmpl, err := template.New("parameter").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err = tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func (r *InstallationReconciler) failParameterTemplate(ctx context.Context, inst *porterv1.Installation, msg string) (bool, error) {
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, ReasonInvalidParameterTemplate, msg)
+
+	return false, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, ReasonInvalidParameterTemplate, msg)
+}
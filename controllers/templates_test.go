@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestRenderParameters(t *testing.T) {
+	testcases := []struct {
+		name        string
+		parameters  []string
+		values      map[string]apiextensionsv1.JSON
+		clusterName string
+		want        []string
+		wantValues  map[string]apiextensionsv1.JSON
+		wantErr     string
+	}{
+		{name: "no templates", parameters: []string{"name=llama", "mysettings"}, want: []string{"name=llama", "mysettings"}},
+		{
+			name:        "templates",
+			parameters:  []string{"namespace={{ .Namespace }}", "release={{ .Name }}-{{ .ClusterName }}", "mysettings"},
+			values:      map[string]apiextensionsv1.JSON{"ns": {Raw: []byte(`"{{ .Namespace }}"`)}, "replicas": {Raw: []byte(`3`)}},
+			clusterName: "east",
+			want:        []string{"namespace=test", "release=hello-east", "mysettings"},
+			wantValues:  map[string]apiextensionsv1.JSON{"ns": {Raw: []byte(`"test"`)}, "replicas": {Raw: []byte(`3`)}},
+		},
+		{name: "cluster name not configured", parameters: []string{"cluster={{ .ClusterName }}"}, wantErr: "clusterName is not set in the porter configmap"},
+		{name: "unknown variable", parameters: []string{"region={{ .Region }}"}, wantErr: "Invalid template in parameter region"},
+		{name: "invalid syntax", values: map[string]apiextensionsv1.JSON{"ns": {Raw: []byte(`"{{ .Namespace"`)}}, wantErr: "Invalid template in parameter ns"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			inst := newTestInstallation()
+			inst.Spec.Parameters = tc.parameters
+			inst.Spec.ParameterValues = tc.values
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: porterConfigMapName, Namespace: inst.Namespace},
+				Data:       map[string]string{"clusterName": tc.clusterName},
+			}
+			r := newTestReconciler(t, inst, cm)
+
+			got, ok, err := r.renderParameters(context.Background(), inst)
+			g.Expect(err).ToNot(HaveOccurred())
+			if tc.wantErr != "" {
+				g.Expect(ok).To(BeFalse())
+				cond := meta.FindStatusCondition(inst.Status.Conditions, porterv1.ConditionFailed)
+				g.Expect(cond).ToNot(BeNil())
+				g.Expect(cond.Reason).To(Equal(ReasonInvalidParameterTemplate))
+				g.Expect(cond.Message).To(ContainSubstring(tc.wantErr))
+				return
+			}
+			g.Expect(ok).To(BeTrue())
+			g.Expect(got.Spec.Parameters).To(Equal(tc.want))
+			g.Expect(got.Spec.ParameterValues).To(Equal(tc.wantValues))
+			g.Expect(inst.Spec.Parameters).To(Equal(tc.parameters), "the Installation should not be modified")
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+// terminalError is an error that reconciling the Installation again will not
+// fix, such as an invalid setting. The reason is used for the event and the
+// Failed condition that report it.
+type terminalError struct {
+	reason string
+	err    error
+}
+
+func (e *terminalError) Error() string {
+	return e.err.Error()
+}
+
+func (e *terminalError) Unwrap() error {
+	return e.err
+}
+
+// newTerminalError marks an error as terminal, so that the Installation is not
+// requeued for it.
+func newTerminalError(reason string, err error) error {
+	return &terminalError{reason: reason, err: err}
+}
+
+// invalidSettingf returns a terminal error for a setting of the Installation,
+// or of the porter ConfigMaps, that can not be used.
+func invalidSettingf(format string, args ...interface{}) error {
+	return newTerminalError(ReasonInvalidSetting, errors.Errorf(format, args...))
+}
+
+// classifyError determines if an error from reconciling an Installation is
+// terminal, and returns the reason to report it with. Errors are transient
+// unless they were marked with newTerminalError, including errors from the
+// API server such as conflicts and timeouts, which usually succeed when
+// retried.
+func classifyError(err error) (reason string, terminal bool) {
+	var te *terminalError
+	if errors.As(err, &te) {
+		return te.reason, true
+	}
+	return "", false
+}
+
+// handleReconcileError decides whether an Installation is requeued after an
+// error. Transient errors are returned, and the Installation is retried with
+// the controller's backoff. Terminal errors are recorded in the Failed
+// condition instead, because retrying would fail the same way. The
+// Installation is reconciled again when it is changed, or at the next resync
+// once a setting in a porter ConfigMap is fixed.
+func (r *InstallationReconciler) handleReconcileError(ctx context.Context, inst *porterv1.Installation, result ctrl.Result, err error) (ctrl.Result, error) {
+	reason, terminal := classifyError(err)
+	if !terminal {
+		return result, err
+	}
+
+	msg := fmt.Sprintf("Could not run the Installation: %s", err)
+	r.getLogger(ctx).Info("skipping Installation", "reason", msg)
+	r.Recorder.Event(inst, corev1.EventTypeWarning, reason, msg)
+	return ctrl.Result{}, r.setCondition(ctx, inst, porterv1.ConditionFailed, metav1.ConditionTrue, reason, msg)
+}
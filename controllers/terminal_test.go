@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+)
+
+func TestClassifyError(t *testing.T) {
+	jobs := schema.GroupResource{Group: "batch", Resource: "jobs"}
+	testcases := []struct {
+		name         string
+		err          error
+		wantTerminal bool
+		wantReason   string
+	}{
+		{name: "no error"},
+		{name: "invalid setting", err: invalidSettingf("invalid outputsVolumeSize %q in %s", "lots", "configmap"), wantTerminal: true, wantReason: ReasonInvalidSetting},
+		{name: "wrapped", err: errors.Wrap(newTerminalError(ReasonInvalidSetting, errors.New("invalid jobNameTemplate")), "could not run"), wantTerminal: true, wantReason: ReasonInvalidSetting},
+		{name: "conflict", err: apierrors.NewConflict(jobs, "porter-hello", errors.New("the object has been modified"))},
+		{name: "server timeout", err: apierrors.NewServerTimeout(jobs, "create", 1)},
+		{name: "too many requests", err: apierrors.NewTooManyRequests("slow down", 1)},
+		{name: "other", err: errors.New("connection refused")},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			reason, terminal := classifyError(tc.err)
+			g.Expect(terminal).To(Equal(tc.wantTerminal))
+			g.Expect(reason).To(Equal(tc.wantReason))
+		})
+	}
+}
+
+func TestGetOutputsVolumeSize(t *testing.T) {
+	testcases := []struct {
+		name      string
+		configMap string
+		want      string
+		wantErr   string
+	}{
+		{name: "not set", want: "64Mi"},
+		{name: "configmap", configMap: "1Gi", want: "1Gi"},
+		{name: "invalid", configMap: "lots", wantErr: `invalid outputsVolumeSize "lots" in configmap`},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			r := &InstallationReconciler{Log: ctrl.Log.WithName("test")}
+			cfg := porterConfig{}
+			if tc.configMap != "" {
+				cfg.sources = []configSource{{name: "configmap", data: map[string]string{"outputsVolumeSize": tc.configMap}}}
+			}
+
+			got, err := r.getOutputsVolumeSize(context.Background(), cfg)
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.wantErr)))
+				_, terminal := classifyError(err)
+				g.Expect(terminal).To(BeTrue(), "an invalid size should not be retried")
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got.String()).To(Equal(tc.want))
+		})
+	}
+}
+
+func TestReconcile_TerminalError(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	r := newTestReconciler(t, inst, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: porterConfigMapName, Namespace: inst.Namespace},
+		Data:       map[string]string{"outputsVolumeSize": "lots"},
+	})
+
+	result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(inst)})
+	g.Expect(err).ToNot(HaveOccurred(), "a terminal error should not be retried")
+	g.Expect(result.IsZero()).To(BeTrue())
+
+	updated := &porterv1.Installation{}
+	g.Expect(r.Get(context.Background(), client.ObjectKeyFromObject(inst), updated)).To(Succeed())
+	cond := meta.FindStatusCondition(updated.Status.Conditions, porterv1.ConditionFailed)
+	g.Expect(cond).ToNot(BeNil())
+	g.Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+	g.Expect(cond.Reason).To(Equal(ReasonInvalidSetting))
+	g.Expect(cond.Message).To(ContainSubstring(`invalid outputsVolumeSize "lots"`))
+
+	jobs := &batchv1.JobList{}
+	g.Expect(r.List(context.Background(), jobs, client.InNamespace(inst.Namespace))).To(Succeed())
+	g.Expect(jobs.Items).To(BeEmpty())
+}
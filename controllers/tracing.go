@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/label"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// tracerName is the instrumentation name of the operator's spans.
+	tracerName = "get.porter.sh/operator"
+
+	// tracingServiceName is the service name of the operator in its traces.
+	tracingServiceName = "porter-operator"
+)
+
+// NewTracerProvider creates a tracer provider that exports the operator's
+// spans to an OTLP collector over gRPC, e.g. otel-collector:4317. An endpoint
+// with the http:// scheme is not encrypted, like setting insecure.
+func NewTracerProvider(ctx context.Context, endpoint string, insecure bool) (*sdktrace.TracerProvider, error) {
+	endpoint, insecure = parseOTLPEndpoint(endpoint, insecure)
+	opts := []otlpgrpc.Option{otlpgrpc.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlpgrpc.WithInsecure())
+	}
+
+	exporter, err := otlp.NewExporter(ctx, otlpgrpc.NewDriver(opts...))
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create the OTLP exporter for %s", endpoint)
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(sdkresource.NewWithAttributes(semconv.ServiceNameKey.String(tracingServiceName))),
+	), nil
+}
+
+// parseOTLPEndpoint returns the host and port of an OTLP endpoint, which may
+// be a URL as in the OTEL_EXPORTER_OTLP_ENDPOINT environment variable, and
+// whether the connection is insecure.
+func parseOTLPEndpoint(endpoint string, insecure bool) (string, bool) {
+	if strings.HasPrefix(endpoint, "http://") {
+		endpoint, insecure = strings.TrimPrefix(endpoint, "http://"), true
+	}
+	endpoint = strings.TrimPrefix(endpoint, "https://")
+	return strings.TrimSuffix(endpoint, "/"), insecure
+}
+
+// startSpan starts a span for an operation of the reconcile. When the
+// reconciler does not have a TracerProvider, the span is not recorded.
+func (r *InstallationReconciler) startSpan(ctx context.Context, name string, attrs ...label.KeyValue) (context.Context, trace.Span) {
+	provider := r.TracerProvider
+	if provider == nil {
+		provider = trace.NewNoopTracerProvider()
+	}
+	return provider.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// recordSpanError marks the span as failed with the error, if any.
+func recordSpanError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
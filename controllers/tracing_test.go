@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/oteltest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestParseOTLPEndpoint(t *testing.T) {
+	testcases := []struct {
+		endpoint     string
+		insecure     bool
+		wantEndpoint string
+		wantInsecure bool
+	}{
+		{endpoint: "otel-collector:4317", wantEndpoint: "otel-collector:4317"},
+		{endpoint: "otel-collector:4317", insecure: true, wantEndpoint: "otel-collector:4317", wantInsecure: true},
+		{endpoint: "http://otel-collector:4317", wantEndpoint: "otel-collector:4317", wantInsecure: true},
+		{endpoint: "https://otel-collector:4317/", wantEndpoint: "otel-collector:4317"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.endpoint, func(t *testing.T) {
+			g := NewWithT(t)
+			endpoint, insecure := parseOTLPEndpoint(tc.endpoint, tc.insecure)
+			g.Expect(endpoint).To(Equal(tc.wantEndpoint))
+			g.Expect(insecure).To(Equal(tc.wantInsecure))
+		})
+	}
+}
+
+func TestReconcile_Traces(t *testing.T) {
+	g := NewWithT(t)
+	inst := newTestInstallation()
+	r := newTestReconciler(t, inst)
+	recorder := &oteltest.StandardSpanRecorder{}
+	r.TracerProvider = oteltest.NewTracerProvider(oteltest.WithSpanRecorder(recorder))
+
+	_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(inst)})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	spans := map[string]*oteltest.Span{}
+	for _, span := range recorder.Completed() {
+		spans[span.Name()] = span
+	}
+	g.Expect(spans).To(HaveKey("Reconcile"))
+	for _, name := range []string{"getPorterConfig", "createOutputsVolume", "createJob", "updateStatus"} {
+		g.Expect(spans).To(HaveKey(name))
+		g.Expect(spans[name].ParentSpanID()).ToNot(BeZero(), "%s should be part of the reconcile's trace", name)
+		g.Expect(spans[name].StatusCode()).ToNot(Equal(codes.Error))
+	}
+}
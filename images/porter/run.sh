@@ -2,15 +2,70 @@
 
 set -euo pipefail
 
-# Copy user-defined porter configuration into PORTER_HOME
+# The operator reads the result of the run from the termination message
+TERMINATION_LOG="${TERMINATION_LOG:-/dev/termination-log}"
+
+# Escape stdin as the content of a JSON string, control characters, such as
+# colors, are dropped
+json_escape() {
+  tr -d '\000-\011\013-\037' | sed -e 's/\\/\\\\/g' -e 's/"/\\"/g' | awk 'NR > 1 { printf "\\n" } { printf "%s", $0 }'
+}
+
+# Print the value of a string field in porter's JSON output
+json_field() {
+  sed -n "s/.*\"$1\": *\"\([^\"]*\)\".*/\1/p" | head -n 1
+}
+
+# Copy user-defined porter configuration into PORTER_HOME, which the operator
+# sets when the porter home is not the image's
+PORTER_HOME="${PORTER_HOME:-/root/.porter}"
 echo "loading porter configuration..."
-cp -L /porter-config/config.* /root/.porter/
-ls | grep config.*
-cat /root/.porter/config.*
+cp -L /porter-config/config.* "${PORTER_HOME}/"
+# Only the names are printed, the config may have secrets such as the plugins'
+ls "${PORTER_HOME}" | grep config.*
 
 # Print the version of porter we are using for this run
 porter version
 
-# Execute the command passed
+# Execute the command passed, keeping its logs to report why it failed
 echo "porter $@"
-porter $@
+run_dir="$(mktemp -d)"
+{ porter "$@" 2>&1 || echo "$?" > "${run_dir}/exit-code"; } | tee "${run_dir}/porter.log"
+exit_code=0
+if [ -f "${run_dir}/exit-code" ]; then
+  exit_code="$(cat "${run_dir}/exit-code")"
+fi
+
+# Report the result of the run, with the bundle that porter recorded for the
+# installation
+namespace_flag=""
+if [ -n "${PORTER_INSTALLATION_NAMESPACE:-}" ]; then
+  namespace_flag="--namespace=${PORTER_INSTALLATION_NAMESPACE}"
+fi
+bundle_version=""
+bundle_digest=""
+if [ -n "${PORTER_INSTALLATION:-}" ]; then
+  installation="$(porter installation show "${PORTER_INSTALLATION}" ${namespace_flag} --output=json 2>/dev/null || true)"
+  bundle_version="$(printf '%s\n' "${installation}" | json_field bundleVersion)"
+  bundle_digest="$(printf '%s\n' "${installation}" | json_field bundleDigest)"
+fi
+if [ "${exit_code}" = "0" ]; then
+  status="succeeded"
+  message=""
+else
+  status="failed"
+  # The termination message is limited to 4096 bytes
+  message="$(tail -n 20 "${run_dir}/porter.log" | tail -c 2048 | json_escape)"
+fi
+printf '{"action":"%s","status":"%s","bundleVersion":"%s","bundleDigest":"%s","message":"%s"}\n' \
+  "${PORTER_RESULT_ACTION:-}" "${status}" "${bundle_version}" "${bundle_digest}" "${message}" > "${TERMINATION_LOG}"
+if [ "${exit_code}" != "0" ]; then
+  exit "${exit_code}"
+fi
+
+# Print the outputs of the installation after the marker that the operator
+# looks for in the logs, so that it can publish them
+if [ "${PORTER_PUBLISH_OUTPUTS:-}" = "true" ]; then
+  echo "--- porter-operator outputs ---"
+  porter installation outputs list --installation "${PORTER_INSTALLATION}" ${namespace_flag} --output=json || echo "could not list the outputs"
+fi
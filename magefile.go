@@ -16,6 +16,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/carolynvs/magex/pkg"
 	"github.com/carolynvs/magex/shx"
@@ -32,7 +33,14 @@ const (
 	kindVersion     = "v0.9.0"
 	kindClusterName = "porter"
 	namespace       = "porter-operator-system"
-	kubeconfig      = "kind.config"
+
+	// kubeconfig is the kubeconfig for the KIND cluster, written to the root
+	// of the repository. Export KUBECONFIG with its path to use the cluster.
+	kubeconfig = "kind.config"
+
+	// kindConfig is the KIND cluster configuration, which only exists while
+	// the cluster is created.
+	kindConfig = "kind.config.yaml"
 )
 
 // Install mage if necessary.
@@ -44,8 +52,15 @@ func Build() error {
 	return runMake("all")
 }
 
+// Run the unit and controller tests against a local API server started by envtest.
+func TestUnit() error {
+	return runMake("test")
+}
+
+// Run all the tests, including those that execute porter, against the KIND cluster.
 func Test() error {
 	mg.Deps(EnsureCluster)
+	os.Setenv("USE_EXISTING_CLUSTER", "true")
 	return runMake("test")
 }
 
@@ -73,7 +88,8 @@ func Bump(sample string) error {
 		}
 	}
 
-	retryCountField := ".metadata.annotations.retryCount"
+	// Changing the rerun annotation runs the Installation again
+	retryCountField := `.metadata.annotations."porter.sh/rerun"`
 	cmd := shx.Command("yq", "eval", retryCountField, "-")
 	cmd.Cmd.Stdin = bytes.NewReader(dataB)
 	retryCount, err := cmd.OutputE()
@@ -101,6 +117,107 @@ func Bump(sample string) error {
 	return cmd.RunV()
 }
 
+const (
+	// e2eTimeout is how long E2E waits for an Installation to finish.
+	e2eTimeout = 10 * time.Minute
+
+	// e2ePollInterval is how often E2E checks the status of the Installation.
+	e2ePollInterval = 5 * time.Second
+)
+
+// Run a sample from config/samples, e.g. porter-hello, against the KIND cluster and wait for it to finish.
+func E2E(sample string) error {
+	mg.Deps(EnsureCluster)
+
+	file := fmt.Sprintf("config/samples/%s.yaml", sample)
+	if _, err := os.Stat(file); err != nil {
+		return errors.Wrapf(err, "cannot find the sample %s", sample)
+	}
+	if err := ensureNamespace(namespace); err != nil {
+		return err
+	}
+
+	// Start from a fresh Installation so that the sample always runs
+	err := kubectl("delete", "-f", file, "--namespace", namespace, "--ignore-not-found", "--wait")
+	if err != nil {
+		return err
+	}
+	applied, err := kubectlCmd("apply", "-f", file, "--namespace", namespace, "-o", "name").OutputE()
+	if err != nil {
+		return errors.Wrapf(err, "could not apply the sample %s", sample)
+	}
+
+	var installations []string
+	for _, obj := range strings.Split(applied, "\n") {
+		if name := strings.TrimPrefix(obj, "installation.porter.sh/"); name != obj {
+			installations = append(installations, name)
+		}
+	}
+	if len(installations) == 0 {
+		return errors.Errorf("the sample %s does not have an Installation", sample)
+	}
+
+	var failed []string
+	for _, name := range installations {
+		phase, err := waitForInstallation(name)
+		if err != nil {
+			return err
+		}
+		log.Printf("Installation %s %s\n", name, phase)
+		if phase == "Failed" {
+			failed = append(failed, name)
+			printAgentLogs(name)
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("the sample %s failed: %s", sample, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// ensureNamespace creates the namespace if it does not exist.
+func ensureNamespace(name string) error {
+	if _, err := kubectlCmd("get", "namespace", name).OutputE(); err == nil {
+		return nil
+	}
+	return kubectl("create", "namespace", name)
+}
+
+// waitForInstallation polls the status of an Installation until its current
+// generation has finished, and returns its phase.
+func waitForInstallation(name string) (string, error) {
+	deadline := time.Now().Add(e2eTimeout)
+	for {
+		status, err := kubectlCmd("get", "installation.porter.sh", name, "--namespace", namespace,
+			"-o", "jsonpath={.metadata.generation} {.status.observedGeneration} {.status.phase}").OutputE()
+		if err != nil {
+			return "", errors.Wrapf(err, "could not get the status of Installation %s", name)
+		}
+
+		fields := strings.Fields(status)
+		if len(fields) == 3 && fields[0] == fields[1] && (fields[2] == "Succeeded" || fields[2] == "Failed") {
+			return fields[2], nil
+		}
+		if time.Now().After(deadline) {
+			return "", errors.Errorf("timed out waiting for Installation %s to finish, its status is %q", name, status)
+		}
+		time.Sleep(e2ePollInterval)
+	}
+}
+
+// printAgentLogs prints the logs of the last porter agent job of the Installation.
+func printAgentLogs(name string) {
+	job, err := kubectlCmd("get", "installation.porter.sh", name, "--namespace", namespace, "-o", "jsonpath={.status.lastJob.name}").OutputE()
+	if err != nil || job == "" {
+		fmt.Fprintf(os.Stderr, "WARNING: could not find the porter agent job of Installation %s\n", name)
+		return
+	}
+	fmt.Printf("Logs of porter agent job %s:\n", job)
+	if err = kubectl("logs", "job/"+job, "--namespace", namespace); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: %v\n", err)
+	}
+}
+
 func Clean() error {
 	// Remove manual runs
 	err := kubectl("delete", "jobs", "-l", "porter=true")
@@ -113,6 +230,29 @@ func Clean() error {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "WARNING: %v\n", err)
 	}
+
+	return CleanConfig()
+}
+
+// Remove the generated KIND config files that are stale, and report which KUBECONFIG to use.
+func CleanConfig() error {
+	// The cluster configuration is only needed while the cluster is created
+	if err := removeFile(kindConfig); err != nil {
+		return err
+	}
+
+	// Keep the kubeconfig in sync with the cluster, or remove it when the cluster is gone
+	if _, err := shx.OutputE("kind", "get", "kubeconfig", "--name", kindClusterName); err != nil {
+		if err := removeFile(kubeconfig); err != nil {
+			return err
+		}
+		fmt.Printf("The %s KIND cluster does not exist. Unset KUBECONFIG if it is %s\n", kindClusterName, kubeconfigPath())
+		return nil
+	}
+	if err := writeKubeconfig(); err != nil {
+		return err
+	}
+	printKubeconfig()
 	return nil
 }
 
@@ -156,20 +296,56 @@ func EnsureCluster() error {
 	}
 
 	log.Println("Reusing existing kind cluster")
-	pwd, _ := os.Getwd()
-	userKubeConfig, _ := filepath.Abs(os.Getenv("KUBECONFIG"))
-	currentKubeConfig := filepath.Join(pwd, kubeconfig)
-	if userKubeConfig != currentKubeConfig {
-		fmt.Printf("ATTENTION! You should set your KUBECONFIG to match the cluster used by this project\n\n\texport KUBECONFIG=%s\n\n", currentKubeConfig)
-	}
-	os.Setenv("KUBECONFIG", currentKubeConfig)
+	printKubeconfig()
+	os.Setenv("KUBECONFIG", kubeconfigPath())
 	err = ioutil.WriteFile(kubeconfig, []byte(contents), 0644)
 	if err != nil {
-		errors.Wrapf(err, "error writing %s", kubeconfig)
+		return errors.Wrapf(err, "error writing %s", kubeconfig)
 	}
 	return setClusterNamespace()
 }
 
+// kubeconfigPath returns the absolute path of the KIND cluster's kubeconfig.
+func kubeconfigPath() string {
+	pwd, _ := os.Getwd()
+	return filepath.Join(pwd, kubeconfig)
+}
+
+// writeKubeconfig writes the kubeconfig of the KIND cluster to kind.config.
+func writeKubeconfig() error {
+	contents, err := shx.OutputE("kind", "get", "kubeconfig", "--name", kindClusterName)
+	if err != nil {
+		return errors.Wrapf(err, "could not get the kubeconfig of the %s KIND cluster", kindClusterName)
+	}
+	err = ioutil.WriteFile(kubeconfig, []byte(contents), 0644)
+	return errors.Wrapf(err, "error writing %s", kubeconfig)
+}
+
+// printKubeconfig reports the KUBECONFIG for the KIND cluster, and warns when
+// a different one is active.
+func printKubeconfig() {
+	expected := kubeconfigPath()
+	current, _ := filepath.Abs(os.Getenv("KUBECONFIG"))
+	if os.Getenv("KUBECONFIG") == "" || current != expected {
+		fmt.Printf("ATTENTION! You should set your KUBECONFIG to match the cluster used by this project\n\n\texport KUBECONFIG=%s\n\n", expected)
+		return
+	}
+	fmt.Printf("Using KUBECONFIG=%s\n", expected)
+}
+
+// removeFile removes a generated file, if it exists.
+func removeFile(path string) error {
+	err := os.Remove(path)
+	if err == nil {
+		log.Println("Removed", path)
+		return nil
+	}
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return errors.Wrapf(err, "could not remove %s", path)
+}
+
 func setClusterNamespace() error {
 	return shx.RunV("kubectl", "config", "set-context", "--current", "--namespace", "porter-operator-system")
 }
@@ -196,25 +372,31 @@ func CreateKindCluster() error {
 		}
 	}
 
-	pwd, _ := os.Getwd()
-	os.Setenv("KUBECONFIG", filepath.Join(pwd, kubeconfig))
-	kindCfg := "kind.config.yaml"
+	os.Setenv("KUBECONFIG", kubeconfigPath())
 	contents := fmt.Sprintf(`kind: Cluster
 apiVersion: kind.x-k8s.io/v1alpha4
 networking:
   apiServerAddress: %s
 `, ipAddress)
-	err = ioutil.WriteFile(kindCfg, []byte(contents), 0644)
+	err = ioutil.WriteFile(kindConfig, []byte(contents), 0644)
 	if err != nil {
 		return errors.Wrap(err, "could not write kind config file")
 	}
-	defer os.Remove(kindCfg)
+	defer removeFile(kindConfig)
 
-	err = shx.RunE("kind", "create", "cluster", "--name", kindClusterName)
+	err = shx.RunE("kind", "create", "cluster", "--name", kindClusterName, "--config", kindConfig)
 	if err != nil {
-		errors.Wrap(err, "could not create KIND cluster")
+		return errors.Wrap(err, "could not create KIND cluster")
 	}
 
+	// kind merges the cluster into KUBECONFIG, write it again so that the
+	// file only has this cluster
+	err = writeKubeconfig()
+	if err != nil {
+		return err
+	}
+	printKubeconfig()
+
 	err = setClusterNamespace()
 	if err != nil {
 		return err
@@ -229,10 +411,10 @@ func DeleteKindCluster() error {
 
 	err := shx.RunE("kind", "delete", "cluster", "--name", kindClusterName)
 	if err != nil {
-		errors.Wrap(err, "could not delete KIND cluster")
+		return errors.Wrap(err, "could not delete KIND cluster")
 	}
 
-	return nil
+	return CleanConfig()
 }
 
 // Install kind if necessary.
@@ -282,7 +464,8 @@ func EnsureKubectl() error {
 func runMake(args ...string) error {
 	// Can't call this function make because it redefines the make keyword
 	env := map[string]string{
-		"KUBECONFIG": os.Getenv("KUBECONFIG"),
+		"KUBECONFIG":           os.Getenv("KUBECONFIG"),
+		"USE_EXISTING_CLUSTER": os.Getenv("USE_EXISTING_CLUSTER"),
 	}
 
 	return sh.RunWithV(env, "make", args...)
@@ -1,17 +1,31 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"github.com/pkg/errors"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
@@ -36,11 +50,47 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var operatorNamespace string
+	var defaultPorterVersion string
+	var defaultPorterRepository string
+	var installationSelector string
+	var watchNamespaces string
+	var excludeNamespaces string
+	var maxJobsPerNamespace int
+	var maxRequeueDelay time.Duration
+	var syncPeriod time.Duration
+	var paused bool
+	var otlpEndpoint string
+	var otlpInsecure bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&operatorNamespace, "operator-namespace", os.Getenv("POD_NAMESPACE"),
+		"The namespace where the operator is deployed. The porter ConfigMap in this namespace configures defaults for all Installations.")
+	flag.StringVar(&defaultPorterVersion, "default-porter-version", "",
+		"The default version of the porter agent, used when it is not configured on the Installation or in a porter ConfigMap.")
+	flag.StringVar(&defaultPorterRepository, "default-porter-repository", "",
+		"The default repository of the porter agent image, used when it is not configured in a porter ConfigMap.")
+	flag.StringVar(&installationSelector, "installation-selector", "",
+		"A label selector, e.g. team=blue, that limits the Installations handled by this operator. All Installations are handled when unset.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"A comma separated list of namespaces, e.g. team-blue,team-red, that limits the Installations handled by this operator. Installations in all namespaces are handled when unset.")
+	flag.StringVar(&excludeNamespaces, "exclude-namespaces", "",
+		"A comma separated list of namespaces whose Installations are ignored by this operator.")
+	flag.IntVar(&maxJobsPerNamespace, "max-jobs-per-namespace", 0,
+		"The maximum number of porter agent jobs that run at the same time in a namespace. The number of jobs is not limited when 0.")
+	flag.DurationVar(&maxRequeueDelay, "max-requeue-delay", 5*time.Minute,
+		"The maximum delay between retries of an Installation that failed to reconcile. Retries back off exponentially, with jitter, up to this delay.")
+	flag.DurationVar(&syncPeriod, "sync-period", 0,
+		"How often all Installations are reconciled again, as a safety net for missed changes, e.g. 30m. Uses the controller-runtime default of 10h when 0.")
+	flag.BoolVar(&paused, "paused", false,
+		"Start the operator paused, so that it does not run any Installation until it is restarted without this flag. Deleted Installations are still uninstalled.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		"The OTLP gRPC endpoint, e.g. otel-collector:4317, that traces of each reconcile are exported to. Reconciles are not traced when unset.")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", os.Getenv("OTEL_EXPORTER_OTLP_INSECURE") == "true",
+		"Export traces to the OTLP endpoint without TLS.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -49,27 +99,90 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	var selector labels.Selector
+	if installationSelector != "" {
+		var err error
+		selector, err = labels.Parse(installationSelector)
+		if err != nil {
+			setupLog.Error(err, "invalid installation selector", "selector", installationSelector)
+			os.Exit(1)
+		}
+	}
+
+	mgrOpts := ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "c58eb551.porter.sh",
-	})
+		SyncPeriod:             getSyncPeriod(syncPeriod),
+	}
+	// ConfigMaps and Secrets are read from the API server, the operator only
+	// caches their metadata to watch parameter sets, instead of keeping every
+	// Secret in the cluster in memory
+	mgrOpts.ClientDisableCacheFor = []client.Object{&corev1.ConfigMap{}, &corev1.Secret{}}
+	watched := splitNamespaces(watchNamespaces)
+	if len(watched) > 0 {
+		// Only watch the allowed namespaces, and the operator's namespace for
+		// its porter ConfigMap. Objects that are read from other namespaces,
+		// or are cluster scoped, bypass the cache.
+		cached := watched
+		if operatorNamespace != "" {
+			cached = append([]string{operatorNamespace}, watched...)
+		}
+		mgrOpts.NewCache = cache.MultiNamespacedCacheBuilder(cached)
+		mgrOpts.ClientDisableCacheFor = append(mgrOpts.ClientDisableCacheFor, &portershv1.Bundle{}, &corev1.Namespace{})
+	}
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), mgrOpts)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	// Leave the tracer provider unset when tracing is not configured, so that
+	// spans are not recorded
+	var tracerProvider trace.TracerProvider
+	if otlpEndpoint != "" {
+		tp, err := controllers.NewTracerProvider(context.Background(), otlpEndpoint, otlpInsecure)
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing", "endpoint", otlpEndpoint)
+			os.Exit(1)
+		}
+		defer shutdownTracing(tp)
+		tracerProvider = tp
+	}
+
 	if err = (&controllers.InstallationReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Installation"),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("Installation"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("installation-controller"),
+
+		OperatorNamespace: operatorNamespace,
+		Defaults: map[string]string{
+			"porterVersion":    defaultPorterVersion,
+			"porterRepository": defaultPorterRepository,
+		},
+		InstallationSelector: selector,
+		WatchNamespaces:      watched,
+		ExcludeNamespaces:    splitNamespaces(excludeNamespaces),
+		MaxJobsPerNamespace:  maxJobsPerNamespace,
+		MaxRequeueDelay:      maxRequeueDelay,
+		Paused:               paused,
+		PodLogs:              controllers.NewPodLogReader(kubernetes.NewForConfigOrDie(mgr.GetConfig())),
+		TracerProvider:       tracerProvider,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Installation")
 		os.Exit(1)
 	}
+	// The webhook requires a serving certificate, see config/default to enable it
+	if os.Getenv("ENABLE_WEBHOOKS") == "true" {
+		if err = (&portershv1.Installation{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Installation")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("health", healthz.Ping); err != nil {
@@ -80,6 +193,17 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	// Only report ready once the operator can reach the API server and has
+	// loaded the objects it watches. These are not used for the health check,
+	// so that the operator is not restarted while the API server is unavailable.
+	if err := mgr.AddReadyzCheck("apiserver", apiServerCheck(mgr)); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("informers", cacheSyncCheck(mgr)); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -87,3 +211,62 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// tracingShutdownTimeout is how long to wait for the remaining spans to be
+// exported when the operator stops.
+const tracingShutdownTimeout = 5 * time.Second
+
+// shutdownTracing exports the remaining spans and stops the tracer provider.
+func shutdownTracing(tp *sdktrace.TracerProvider) {
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if err := tp.Shutdown(ctx); err != nil {
+		setupLog.Error(err, "could not export the remaining traces")
+	}
+}
+
+// readyCheckTimeout is how long a readiness check waits before it fails.
+const readyCheckTimeout = 5 * time.Second
+
+// apiServerCheck reports whether the API server is reachable.
+func apiServerCheck(mgr ctrl.Manager) healthz.Checker {
+	cfg := rest.CopyConfig(mgr.GetConfig())
+	cfg.Timeout = readyCheckTimeout
+	client := discovery.NewDiscoveryClientForConfigOrDie(cfg)
+	return func(_ *http.Request) error {
+		_, err := client.ServerVersion()
+		return errors.Wrap(err, "could not reach the API server")
+	}
+}
+
+// cacheSyncCheck reports whether the informers have synced.
+func cacheSyncCheck(mgr ctrl.Manager) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), readyCheckTimeout)
+		defer cancel()
+		if !mgr.GetCache().WaitForCacheSync(ctx) {
+			return errors.New("the informers have not synced")
+		}
+		return nil
+	}
+}
+
+// getSyncPeriod returns the sync period of the manager, or nil to use the
+// controller-runtime default when the flag is not set.
+func getSyncPeriod(syncPeriod time.Duration) *time.Duration {
+	if syncPeriod <= 0 {
+		return nil
+	}
+	return &syncPeriod
+}
+
+// splitNamespaces parses a comma separated list of namespaces.
+func splitNamespaces(s string) []string {
+	var namespaces []string
+	for _, ns := range strings.Split(s, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
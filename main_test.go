@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// testManager is a manager with only the config and cache used by the
+// readiness checks.
+type testManager struct {
+	ctrl.Manager
+	config *rest.Config
+	cache  cache.Cache
+}
+
+func (m testManager) GetConfig() *rest.Config {
+	return m.config
+}
+
+func (m testManager) GetCache() cache.Cache {
+	return m.cache
+}
+
+// testCache is a cache that reports whether its informers have synced.
+type testCache struct {
+	cache.Cache
+	synced bool
+}
+
+func (c testCache) WaitForCacheSync(ctx context.Context) bool {
+	return c.synced
+}
+
+func TestAPIServerCheck(t *testing.T) {
+	testcases := []struct {
+		name    string
+		status  int
+		wantErr string
+	}{
+		{name: "reachable", status: http.StatusOK},
+		{name: "unavailable", status: http.StatusServiceUnavailable, wantErr: "could not reach the API server"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				g.Expect(req.URL.Path).To(Equal("/version"))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tc.status)
+				w.Write([]byte(`{"major": "1", "minor": "19", "gitVersion": "v1.19.2"}`))
+			}))
+			defer server.Close()
+
+			check := apiServerCheck(testManager{config: &rest.Config{Host: server.URL}})
+			err := check(httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+		})
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		g := NewWithT(t)
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+
+		check := apiServerCheck(testManager{config: &rest.Config{Host: server.URL}})
+		err := check(httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		g.Expect(err).To(MatchError(ContainSubstring("could not reach the API server")))
+	})
+}
+
+func TestCacheSyncCheck(t *testing.T) {
+	testcases := []struct {
+		name    string
+		synced  bool
+		wantErr string
+	}{
+		{name: "synced", synced: true},
+		{name: "not synced", wantErr: "the informers have not synced"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			check := cacheSyncCheck(testManager{cache: testCache{synced: tc.synced}})
+			err := check(httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if tc.wantErr != "" {
+				g.Expect(err).To(MatchError(tc.wantErr))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+		})
+	}
+}
+
+func TestGetSyncPeriod(t *testing.T) {
+	testcases := []struct {
+		name       string
+		syncPeriod time.Duration
+		want       *time.Duration
+	}{
+		{name: "default"},
+		{name: "negative", syncPeriod: -time.Minute},
+		{name: "set", syncPeriod: 30 * time.Minute, want: durationPtr(30 * time.Minute)},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(getSyncPeriod(tc.syncPeriod)).To(Equal(tc.want))
+		})
+	}
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}